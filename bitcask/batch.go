@@ -5,6 +5,7 @@ import (
 	"kv-go/bitcask/data"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const nonTransactionSeqNo uint64 = 0
@@ -79,13 +80,14 @@ func (wb *Writebatch) Delete(key []byte) error {
 }
 
 // 提交事务,将暂存的数据写到数据文件，并更新内存索引
-func (wb *Writebatch) Commit() error {
+func (wb *Writebatch) Commit() (err error) {
 	wb.mu.Lock()
 	defer wb.mu.Unlock()
 	if len(wb.pendingWrites) == 0 {
 		return nil
 	}
 
+	defer wb.db.observe(OpBatchCommit, time.Now(), &err)
 	if uint(len(wb.pendingWrites)) > wb.Options.MaxBatchNum {
 		return ErrExceedMaxBatchNum
 	}
@@ -115,16 +117,19 @@ func (wb *Writebatch) Commit() error {
 		Key:  logRecordKeyWithSeq(txnFinKey, seqNo),
 		Type: data.LogRecordTxnFinished,
 	}
-	if _, err := wb.db.appendLogRecord(finishedRecord); err != nil {
+	finishedPos, err := wb.db.appendLogRecord(finishedRecord)
+	if err != nil {
 		return err
 	}
 	//根据配置决定是否持久化
 	if wb.Options.SyncWrites && wb.db.activeFile != nil {
-		if err := wb.db.activeFile.Sync(); err != nil {
+		if err := wb.db.syncFile(wb.db.activeFile); err != nil {
 			return err
 		}
 	}
 	//更新内存索引
+	cursor := wb.db.positionAfter(finishedPos)
+	events := make([]*Event, 0, len(wb.pendingWrites))
 	for _, record := range wb.pendingWrites {
 
 		pos := positions[string(record.Key)]
@@ -138,7 +143,13 @@ func (wb *Writebatch) Commit() error {
 		if oldPos != nil {
 			wb.db.reclaimSize += int64(oldPos.Size)
 		}
+		event := &Event{Key: record.Key, Value: record.Value, Type: EventPut, SeqNo: seqNo, Cursor: cursor}
+		if record.Type == data.LogRecordDelete {
+			event.Type = EventDelete
+		}
+		events = append(events, event)
 	}
+	wb.db.notifyWatchers(events...)
 	//将暂存的数据清空
 	wb.pendingWrites = make(map[string]*data.LogRecord)
 	return nil
@@ -0,0 +1,191 @@
+package bitcask
+
+import (
+	"io"
+	"kv-go/bitcask/data"
+	"os"
+	"path/filepath"
+)
+
+// Position 数据文件中的一个日志位置,可以持久化之后用于断点续传
+type Position struct {
+	//最近一次 merge 的边界文件 id,用于识别 merge 之后被重写的数据文件
+	Epoch  uint32
+	Fid    uint32
+	Offset int64
+}
+
+// ChangeStream 从指定位置开始顺序读取数据文件中的变更
+// 事务中的写入只有在读到事务完成的标识之后才会返回
+type ChangeStream struct {
+	db        *DB
+	pos       Position //下一条要读取的日志位置
+	committed Position //已经返回给调用方的变更之后的位置
+	txnSeqNo  uint64   //正在读取的事务序列号
+	txnEvents []*Event //暂存还未完成的事务中的变更
+	queue     []*Event //已经完成但还没有返回的变更
+}
+
+// Position 返回数据库当前日志的末尾位置
+func (db *DB) Position() Position {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.activeFile == nil {
+		return Position{Epoch: db.mergeEpoch}
+	}
+	return Position{
+		Epoch:  db.mergeEpoch,
+		Fid:    db.activeFile.FileId,
+		Offset: db.activeFile.WriteOff,
+	}
+}
+
+// NewChangeStream 从 from 位置开始读取变更,零值表示从头开始读取
+// 如果 from 所在的数据文件已经被 merge 重写或者会在重启时被替换,返回 ErrCursorExpired,需要重新全量同步
+func (db *DB) NewChangeStream(from Position) (*ChangeStream, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if from.Epoch != db.mergeEpoch && from.Fid < db.mergeEpoch {
+		return nil, ErrCursorExpired
+	}
+	from.Epoch = db.mergeEpoch
+	return &ChangeStream{
+		db:        db,
+		pos:       from,
+		committed: from,
+	}, nil
+}
+
+// Position 返回已经读取的变更之后的位置,重新订阅时从这个位置开始不会丢失也不会重复
+func (cs *ChangeStream) Position() Position {
+	return cs.committed
+}
+
+// Next 返回下一条变更,已经读到日志末尾时返回 io.EOF,之后有新的写入可以继续调用
+func (cs *ChangeStream) Next() (*Event, error) {
+	if len(cs.queue) > 0 {
+		return cs.pop(), nil
+	}
+	cs.db.mu.RLock()
+	defer cs.db.mu.RUnlock()
+	for {
+		//读到了 merge 边界之后的数据文件,这些文件重启之后不会被替换,位置可以使用新的 epoch
+		if cs.pos.Epoch != cs.db.mergeEpoch && cs.pos.Fid >= cs.db.mergeEpoch {
+			cs.pos.Epoch = cs.db.mergeEpoch
+		}
+		dataFile := cs.db.getDataFile(cs.pos.Fid)
+		if dataFile == nil {
+			//文件不存在,跳到下一个数据文件
+			if !cs.nextFile() {
+				return nil, io.EOF
+			}
+			continue
+		}
+		isActive := dataFile == cs.db.activeFile
+		if isActive && cs.pos.Offset >= dataFile.WriteOff {
+			return nil, io.EOF
+		}
+		logRecord, size, err := dataFile.ReadLogRecord(cs.pos.Offset)
+		if err != nil {
+			if err == io.EOF {
+				if isActive || !cs.nextFile() {
+					return nil, io.EOF
+				}
+				continue
+			}
+			return nil, err
+		}
+		cs.pos.Offset += size
+
+		realKey, seqNo := parseLogRecordKey(logRecord.Key)
+		if seqNo == nonTransactionSeqNo {
+			//没有读到完成标识的事务是无效的
+			cs.txnEvents = nil
+			cs.committed = cs.pos
+			return newEvent(realKey, logRecord, seqNo, cs.pos), nil
+		}
+		//事务的数据是连续写入的,序列号变化说明之前的事务没有提交成功
+		if seqNo != cs.txnSeqNo {
+			cs.txnSeqNo = seqNo
+			cs.txnEvents = nil
+		}
+		if logRecord.Type != data.LogRecordTxnFinished {
+			cs.txnEvents = append(cs.txnEvents, newEvent(realKey, logRecord, seqNo, Position{}))
+			continue
+		}
+		events := cs.txnEvents
+		cs.txnEvents = nil
+		if len(events) == 0 {
+			cs.committed = cs.pos
+			continue
+		}
+		for _, event := range events {
+			event.Cursor = cs.pos
+		}
+		cs.queue = events
+		return cs.pop(), nil
+	}
+}
+
+func (cs *ChangeStream) pop() *Event {
+	event := cs.queue[0]
+	cs.queue = cs.queue[1:]
+	if len(cs.queue) == 0 {
+		cs.committed = event.Cursor
+	}
+	return event
+}
+
+// 跳到下一个存在的数据文件,调用前必须持有读锁
+func (cs *ChangeStream) nextFile() bool {
+	db := cs.db
+	if db.activeFile == nil || cs.pos.Fid >= db.activeFile.FileId {
+		return false
+	}
+	next := db.activeFile.FileId
+	for fid := range db.olderFiles {
+		if fid > cs.pos.Fid && fid < next {
+			next = fid
+		}
+	}
+	cs.pos.Fid = next
+	cs.pos.Offset = 0
+	return true
+}
+
+// 根据文件 id 找到对应的数据文件,调用前必须持有锁
+func (db *DB) getDataFile(fid uint32) *data.DataFile {
+	if db.activeFile != nil && db.activeFile.FileId == fid {
+		return db.activeFile
+	}
+	return db.olderFiles[fid]
+}
+
+func newEvent(key []byte, logRecord *data.LogRecord, seqNo uint64, cursor Position) *Event {
+	event := &Event{
+		Key:    key,
+		Value:  logRecord.Value,
+		Type:   EventPut,
+		SeqNo:  seqNo,
+		Cursor: cursor,
+	}
+	if logRecord.Type == data.LogRecordDelete {
+		event.Type = EventDelete
+		event.Value = nil
+	}
+	return event
+}
+
+// 加载最近一次 merge 的边界,merge 完成的标识文件会在启动时被移动到数据目录中
+func (db *DB) loadMergeEpoch() error {
+	mergeFinishName := filepath.Join(db.Options.DirPath, data.MergeFinishName)
+	if _, err := os.Stat(mergeFinishName); os.IsNotExist(err) {
+		return nil
+	}
+	epoch, err := db.getNonMergeFileId(db.Options.DirPath)
+	if err != nil {
+		return err
+	}
+	db.mergeEpoch = epoch
+	return nil
+}
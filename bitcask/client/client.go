@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"kv-go/bitcask"
+	"net"
+	"time"
+)
+
+// KV bitcask.DB 常用方法的带 context 的版本,嵌入式的数据库(Embedded)、HTTP 服务(NewHTTP)
+// 和 Redis 兼容服务(NewRESP)都实现了这个接口,使用方可以在嵌入式和远程模式之间切换而不需要修改代码
+type KV interface {
+	Put(ctx context.Context, key, value []byte) error
+	//key 不存在时返回 bitcask.ErrKeyNotFound
+	Get(ctx context.Context, key []byte) ([]byte, error)
+	//和 DB.Delete 一样,key 不存在时不返回错误
+	Delete(ctx context.Context, key []byte) error
+	//按照 key 的顺序返回所有的 key
+	ListKeys(ctx context.Context) ([][]byte, error)
+	//按照 key 的顺序遍历所有的数据,fn 返回 false 时停止
+	Fold(ctx context.Context, fn func(key, value []byte) bool) error
+	Stat(ctx context.Context) (*bitcask.Stat, error)
+	NewWriteBatch() WriteBatch
+	Close() error
+}
+
+// WriteBatch 暂存写入和删除,Commit 时原子地提交,提交成功之后清空
+type WriteBatch interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Commit(ctx context.Context) error
+}
+
+var (
+	ErrClosed          = errors.New("client is closed")
+	ErrInvalidPoolSize = errors.New("pool size must be greater than 0")
+)
+
+// 服务端返回的存储引擎的错误,错误信息相同时还原为对应的错误
+var serverErrors = []error{
+	bitcask.ErrKeyNotFound,
+	bitcask.ErrKeyIsEmpty,
+	bitcask.ErrExceedMaxBatchNum,
+	bitcask.ErrIsMerging,
+	bitcask.ErrMergeRatioUnreached,
+	bitcask.ErrNoEnoughSpace,
+	bitcask.ErrDatabaseClosed,
+}
+
+// ServerError 服务端返回的其他错误,如 Redis 兼容服务的 WRONGTYPE,不会重试
+type ServerError struct {
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return e.Message
+}
+
+func newServerError(message string) error {
+	for _, err := range serverErrors {
+		if message == err.Error() {
+			return err
+		}
+	}
+	return &ServerError{Message: message}
+}
+
+// Options 远程客户端的配置
+type Options struct {
+	//单次请求的超时时间,包括建立连接,为0时只受 context 的限制
+	Timeout time.Duration
+
+	//网络错误时的最大重试次数,所有的操作都是幂等的,重试不会重复写入
+	MaxRetries int
+
+	//第一次重试之前等待的时间,之后每次翻倍
+	RetryBackoff time.Duration
+
+	//和服务端之间的最大连接数
+	PoolSize int
+
+	//不为空时使用 TLS 连接
+	TLSConfig *tls.Config
+
+	//Redis 兼容服务的用户名和密码,用户名为空时使用 default 用户
+	Username string
+	Password string
+
+	//Redis 兼容服务的数据库编号
+	DB int
+}
+
+var DefaultOptions = Options{
+	Timeout:      5 * time.Second,
+	MaxRetries:   2,
+	RetryBackoff: 50 * time.Millisecond,
+	PoolSize:     10,
+}
+
+func checkOptions(opts Options) error {
+	if opts.PoolSize <= 0 {
+		return ErrInvalidPoolSize
+	}
+	return nil
+}
+
+// 执行 fn,遇到网络错误时按照 MaxRetries 和 RetryBackoff 重试,每次执行的超时时间是 Timeout
+func (opts Options) retry(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err := opts.attempt(ctx, fn)
+		if err == nil || attempt >= opts.MaxRetries || !retryable(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (opts Options) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// 服务暂时不可用时返回的错误,如 HTTP 的 503
+type unavailableError struct {
+	err error
+}
+
+func (e *unavailableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unavailableError) Unwrap() error {
+	return e.err
+}
+
+// 网络错误、连接被关闭和服务暂时不可用时可以重试
+func retryable(err error) bool {
+	var netErr net.Error
+	var unavailable *unavailableError
+	return errors.As(err, &netErr) || errors.As(err, &unavailable) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// 远程客户端的 WriteBatch,提交时把所有的操作一次发送给服务端
+type remoteBatch struct {
+	operations []batchOperation
+	commit     func(ctx context.Context, operations []batchOperation) error
+}
+
+type batchOperation struct {
+	delete bool
+	key    []byte
+	value  []byte
+}
+
+func (b *remoteBatch) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	b.operations = append(b.operations, batchOperation{key: key, value: value})
+	return nil
+}
+
+func (b *remoteBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	b.operations = append(b.operations, batchOperation{delete: true, key: key})
+	return nil
+}
+
+func (b *remoteBatch) Commit(ctx context.Context) error {
+	if len(b.operations) == 0 {
+		return nil
+	}
+	if err := b.commit(ctx, b.operations); err != nil {
+		return err
+	}
+	b.operations = nil
+	return nil
+}
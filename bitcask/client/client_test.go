@@ -0,0 +1,197 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"kv-go/bitcask/utils"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestEmbedded(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-client")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	kv := Embedded(db)
+	defer kv.Close()
+	ctx := context.Background()
+
+	assert.Nil(t, kv.Put(ctx, utils.GetTestKey(1), []byte("v1")))
+	value, err := kv.Get(ctx, utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), value)
+	_, err = kv.Get(ctx, utils.GetTestKey(2))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	wb := kv.NewWriteBatch()
+	assert.Nil(t, wb.Put(utils.GetTestKey(2), []byte("v2")))
+	assert.Nil(t, wb.Delete(utils.GetTestKey(1)))
+	assert.Equal(t, bitcask.ErrKeyIsEmpty, wb.Put(nil, []byte("v")))
+	assert.Nil(t, wb.Commit(ctx))
+	keys, err := kv.ListKeys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{utils.GetTestKey(2)}, keys)
+
+	stat, err := kv.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1), stat.KeyNum)
+
+	// context 取消之后不再执行
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Equal(t, context.Canceled, kv.Put(canceled, utils.GetTestKey(3), []byte("v3")))
+	assert.Equal(t, context.Canceled, kv.Fold(canceled, func(key, value []byte) bool {
+		return true
+	}))
+	assert.Nil(t, kv.Delete(ctx, utils.GetTestKey(3)))
+}
+
+func TestNewClient_InvalidOptions(t *testing.T) {
+	opts := DefaultOptions
+	opts.PoolSize = 0
+	_, err := NewHTTP("http://127.0.0.1:8080", opts)
+	assert.Equal(t, ErrInvalidPoolSize, err)
+	_, err = NewRESP("127.0.0.1:6380", opts)
+	assert.Equal(t, ErrInvalidPoolSize, err)
+	_, err = NewHTTP("tcp://127.0.0.1:8080", DefaultOptions)
+	assert.Equal(t, errInvalidBaseURL, err)
+}
+
+func TestHTTPClient_Retry(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 前两次请求返回 503
+		if requests.Add(1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("value"))
+	}))
+	defer srv.Close()
+
+	opts := DefaultOptions
+	opts.RetryBackoff = time.Millisecond
+	cli, err := NewHTTP(srv.URL, opts)
+	assert.Nil(t, err)
+	value, err := cli.Get(context.Background(), []byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+	assert.Equal(t, int32(3), requests.Load())
+
+	// 超过最大重试次数之后返回最后一次的错误
+	requests.Store(0)
+	opts.MaxRetries = 1
+	cli, err = NewHTTP(srv.URL, opts)
+	assert.Nil(t, err)
+	_, err = cli.Get(context.Background(), []byte("key"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), requests.Load())
+
+	assert.Nil(t, cli.Close())
+	_, err = cli.Get(context.Background(), []byte("key"))
+	assert.Equal(t, ErrClosed, err)
+}
+
+// 接受连接之后只读取请求,从不回复的服务
+func startSilentServer(t *testing.T) (string, *atomic.Int32) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = ln.Close()
+	})
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				rd := bufio.NewReader(conn)
+				for {
+					if _, err := rd.ReadByte(); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), &accepted
+}
+
+func TestRESPClient_Timeout(t *testing.T) {
+	addr, accepted := startSilentServer(t)
+	opts := DefaultOptions
+	opts.Timeout = 50 * time.Millisecond
+	opts.MaxRetries = 1
+	opts.RetryBackoff = time.Millisecond
+	cli, err := NewRESP(addr, opts)
+	assert.Nil(t, err)
+	defer cli.Close()
+
+	// 每次超时之后重试,超时的连接不会放回连接池
+	_, err = cli.Get(context.Background(), []byte("key"))
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), accepted.Load())
+
+	// context 取消时中断正在等待的请求
+	opts.Timeout = 0
+	cli, err = NewRESP(addr, opts)
+	assert.Nil(t, err)
+	defer cli.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = cli.Get(ctx, []byte("key"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestConnPool_Limit(t *testing.T) {
+	var dialed atomic.Int32
+	pool := newConnPool(2, func(ctx context.Context) (*respConn, error) {
+		dialed.Add(1)
+		client, server := net.Pipe()
+		t.Cleanup(func() {
+			_ = server.Close()
+		})
+		return newRESPConn(client), nil
+	})
+	ctx := context.Background()
+	c1, err := pool.get(ctx)
+	assert.Nil(t, err)
+	c2, err := pool.get(ctx)
+	assert.Nil(t, err)
+
+	// 连接都在使用中时等待
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = pool.get(timeout)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// 归还的连接被复用,出错的连接被关闭
+	pool.put(c1, false)
+	pool.put(c2, true)
+	c3, err := pool.get(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, c1, c3)
+	c4, err := pool.get(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(3), dialed.Load())
+	pool.put(c3, false)
+	pool.put(c4, false)
+
+	assert.Nil(t, pool.close())
+	_, err = pool.get(ctx)
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"kv-go/bitcask"
+)
+
+// 进程内的数据库,直接调用 bitcask.DB 的方法
+type embedded struct {
+	db *bitcask.DB
+}
+
+// Embedded 把打开的数据库包装为 KV,context 只在操作开始之前和 Fold 的过程中检查,Close 会关闭数据库
+func Embedded(db *bitcask.DB) KV {
+	return &embedded{db: db}
+}
+
+func (e *embedded) Put(ctx context.Context, key, value []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.db.Put(key, value)
+}
+
+func (e *embedded) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.db.Get(key)
+}
+
+func (e *embedded) Delete(ctx context.Context, key []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.db.Delete(key)
+}
+
+func (e *embedded) ListKeys(ctx context.Context) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.db.ListKeys(), nil
+}
+
+func (e *embedded) Fold(ctx context.Context, fn func(key, value []byte) bool) error {
+	var ctxErr error
+	err := e.db.Fold(func(key, value []byte) bool {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			return false
+		}
+		return fn(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	return ctxErr
+}
+
+func (e *embedded) Stat(ctx context.Context) (*bitcask.Stat, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.db.Stat(), nil
+}
+
+func (e *embedded) NewWriteBatch() WriteBatch {
+	return &embeddedBatch{wb: e.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)}
+}
+
+func (e *embedded) Close() error {
+	return e.db.Close()
+}
+
+type embeddedBatch struct {
+	wb *bitcask.Writebatch
+}
+
+func (b *embeddedBatch) Put(key, value []byte) error {
+	return b.wb.Put(key, value)
+}
+
+func (b *embeddedBatch) Delete(key []byte) error {
+	return b.wb.Delete(key)
+}
+
+func (b *embeddedBatch) Commit(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return b.wb.Commit()
+}
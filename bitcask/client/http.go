@@ -0,0 +1,270 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"kv-go/bitcask"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// 分页遍历时每页的 key 数量,是服务端允许的最大值
+const httpPageSize = 1000
+
+var errInvalidBaseURL = errors.New("base url must be http or https")
+
+// HTTPClient HTTP 服务(bitcask/http)的客户端,读写使用 v2 接口,支持二进制的 key 和 value,
+// Stat 使用 /bitcask/status,连接由 http.Transport 复用
+type HTTPClient struct {
+	baseURL string
+	client  *http.Client
+	opts    Options
+	closed  atomic.Bool
+}
+
+// NewHTTP 创建 baseURL(如 http://localhost:8080)上的服务的客户端,不会立即建立连接
+func NewHTTP(baseURL string, opts Options) (*HTTPClient, error) {
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errInvalidBaseURL
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = opts.PoolSize
+	transport.MaxConnsPerHost = opts.PoolSize
+	transport.TLSClientConfig = opts.TLSConfig
+	return &HTTPClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Transport: transport},
+		opts:    opts,
+	}, nil
+}
+
+// 发送请求,2xx 时把响应体交给 handle,其他状态码转换为错误,网络错误和 502/503/504 时重试
+func (c *HTTPClient) do(ctx context.Context, method, path string, body []byte,
+	handle func(resp *http.Response) error) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+	return c.opts.retry(ctx, func(ctx context.Context) error {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+		if err != nil {
+			return err
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return handle(resp)
+		}
+		return responseError(resp)
+	})
+}
+
+// 错误的响应体是 {"error": "..."},v1 接口返回的是纯文本
+func responseError(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var res struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(data))
+	if json.Unmarshal(data, &res) == nil && res.Error != "" {
+		message = res.Error
+	}
+	if message == "" {
+		message = resp.Status
+	}
+	err = newServerError(message)
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return bitcask.ErrKeyNotFound
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return &unavailableError{err: fmt.Errorf("%s: %w", resp.Status, err)}
+	}
+	return err
+}
+
+func keyPath(key []byte) string {
+	return "/v2/keys/" + url.PathEscape(string(key))
+}
+
+func (c *HTTPClient) Put(ctx context.Context, key, value []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	return c.do(ctx, http.MethodPut, keyPath(key), value, func(resp *http.Response) error {
+		return nil
+	})
+}
+
+func (c *HTTPClient) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, bitcask.ErrKeyIsEmpty
+	}
+	var value []byte
+	err := c.do(ctx, http.MethodGet, keyPath(key), nil, func(resp *http.Response) error {
+		var err error
+		value, err = io.ReadAll(resp.Body)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (c *HTTPClient) Delete(ctx context.Context, key []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	err := c.do(ctx, http.MethodDelete, keyPath(key), nil, func(resp *http.Response) error {
+		return nil
+	})
+	//v2 接口删除不存在的 key 时返回 404
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
+
+type httpListResponse struct {
+	Items []struct {
+		Key   string  `json:"key"`
+		Value *string `json:"value"`
+	} `json:"items"`
+	NextCursor string `json:"next_cursor"`
+}
+
+// 分页获取所有的 key,每一页单独重试
+func (c *HTTPClient) list(ctx context.Context, withValues bool, fn func(key, value []byte) bool) error {
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Set("encoding", "base64")
+		query.Set("limit", fmt.Sprint(httpPageSize))
+		if withValues {
+			query.Set("values", "true")
+		}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		var res httpListResponse
+		err := c.do(ctx, http.MethodGet, "/v2/keys?"+query.Encode(), nil, func(resp *http.Response) error {
+			res = httpListResponse{}
+			return json.NewDecoder(resp.Body).Decode(&res)
+		})
+		if err != nil {
+			return err
+		}
+		for _, item := range res.Items {
+			key, err := base64.StdEncoding.DecodeString(item.Key)
+			if err != nil {
+				return err
+			}
+			var value []byte
+			if item.Value != nil {
+				if value, err = base64.StdEncoding.DecodeString(*item.Value); err != nil {
+					return err
+				}
+			}
+			if !fn(key, value) {
+				return nil
+			}
+		}
+		if res.NextCursor == "" {
+			return nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+func (c *HTTPClient) ListKeys(ctx context.Context) ([][]byte, error) {
+	var keys [][]byte
+	err := c.list(ctx, false, func(key, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (c *HTTPClient) Fold(ctx context.Context, fn func(key, value []byte) bool) error {
+	return c.list(ctx, true, fn)
+}
+
+func (c *HTTPClient) Stat(ctx context.Context) (*bitcask.Stat, error) {
+	var stat bitcask.Stat
+	err := c.do(ctx, http.MethodGet, "/bitcask/status", nil, func(resp *http.Response) error {
+		return json.NewDecoder(resp.Body).Decode(&stat)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &stat, nil
+}
+
+func (c *HTTPClient) NewWriteBatch() WriteBatch {
+	return &remoteBatch{commit: c.commitBatch}
+}
+
+type httpBatchOperation struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+}
+
+// 通过 POST /v2/batch 原子地提交
+func (c *HTTPClient) commitBatch(ctx context.Context, operations []batchOperation) error {
+	req := struct {
+		Operations []httpBatchOperation `json:"operations"`
+	}{Operations: make([]httpBatchOperation, 0, len(operations))}
+	for _, op := range operations {
+		item := httpBatchOperation{Op: "put", Key: base64.StdEncoding.EncodeToString(op.key)}
+		if op.delete {
+			item.Op = "delete"
+		} else {
+			item.Value = base64.StdEncoding.EncodeToString(op.value)
+		}
+		req.Operations = append(req.Operations, item)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/v2/batch?encoding=base64", body, func(resp *http.Response) error {
+		return nil
+	})
+}
+
+// Close 关闭空闲的连接,之后的请求返回 ErrClosed
+func (c *HTTPClient) Close() error {
+	c.closed.Store(true)
+	c.client.CloseIdleConnections()
+	return nil
+}
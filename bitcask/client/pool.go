@@ -0,0 +1,167 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var errInvalidReply = errors.New("invalid reply from server")
+
+// 和 Redis 兼容服务之间的一个连接
+type respConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+	wr   *bufio.Writer
+}
+
+func newRESPConn(conn net.Conn) *respConn {
+	return &respConn{conn: conn, rd: bufio.NewReader(conn), wr: bufio.NewWriter(conn)}
+}
+
+// 写入一条命令,调用 flush 之后才会发送,多条命令可以一起发送
+func (c *respConn) writeCommand(args ...[]byte) {
+	c.wr.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		c.wr.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n")
+		c.wr.Write(arg)
+		c.wr.WriteString("\r\n")
+	}
+}
+
+func (c *respConn) flush() error {
+	return c.wr.Flush()
+}
+
+// 读取一个回复: 简单字符串为 string,批量字符串为 []byte,整数为 int64,数组为 []interface{},
+// 空值为 nil,错误回复为 *ServerError 或者存储引擎的错误;返回的 error 只表示连接出错
+func (c *respConn) readReply() (interface{}, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errInvalidReply
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return newServerError(line[1:]), nil
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errInvalidReply
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errInvalidReply
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.rd, buf); err != nil {
+			return nil, err
+		}
+		return buf[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errInvalidReply
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, errInvalidReply
+}
+
+// 连接池,最多同时有 size 个连接,空闲的连接留在池中复用
+type connPool struct {
+	dial   func(ctx context.Context) (*respConn, error)
+	tokens chan struct{} //每个使用中的连接占用一个
+	mu     sync.Mutex
+	idle   []*respConn
+	closed bool
+}
+
+func newConnPool(size int, dial func(ctx context.Context) (*respConn, error)) *connPool {
+	return &connPool{dial: dial, tokens: make(chan struct{}, size)}
+}
+
+// 获取一个连接,连接都在使用中时等待其他的请求归还
+func (p *connPool) get(ctx context.Context) (*respConn, error) {
+	select {
+	case p.tokens <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		<-p.tokens
+		return nil, ErrClosed
+	}
+	var conn *respConn
+	if n := len(p.idle); n > 0 {
+		conn = p.idle[n-1]
+		p.idle = p.idle[:n-1]
+	}
+	p.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+	conn, err := p.dial(ctx)
+	if err != nil {
+		<-p.tokens
+		return nil, err
+	}
+	return conn, nil
+}
+
+// 归还连接,broken 为 true 时连接的状态未知(如读写出错),直接关闭
+func (p *connPool) put(conn *respConn, broken bool) {
+	p.mu.Lock()
+	if broken || p.closed {
+		_ = conn.conn.Close()
+	} else {
+		_ = conn.conn.SetDeadline(time.Time{})
+		p.idle = append(p.idle, conn)
+	}
+	p.mu.Unlock()
+	<-p.tokens
+}
+
+// 关闭所有空闲的连接,使用中的连接在归还时关闭
+func (p *connPool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	var err error
+	for _, conn := range p.idle {
+		if e := conn.conn.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	p.idle = nil
+	return err
+}
@@ -0,0 +1,355 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"kv-go/bitcask"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCAN 每次返回的 key 数量
+const respScanCount = 1000
+
+// RESPClient Redis 兼容服务(bitcask/redis/cmd)的客户端,key 和 value 通过字符串命令读写,
+// ListKeys 和 Fold 只遍历字符串类型的 key,Stat 返回服务端所有已经打开的数据库的统计信息之和,
+// 集群模式下写命令需要发送给 leader
+type RESPClient struct {
+	addr string
+	opts Options
+	pool *connPool
+}
+
+// NewRESP 创建 addr 上的服务的客户端,连接在第一次使用时建立
+func NewRESP(addr string, opts Options) (*RESPClient, error) {
+	if err := checkOptions(opts); err != nil {
+		return nil, err
+	}
+	c := &RESPClient{addr: addr, opts: opts}
+	c.pool = newConnPool(opts.PoolSize, c.dial)
+	return c, nil
+}
+
+// 建立连接,并且完成认证和选择数据库
+func (c *RESPClient) dial(ctx context.Context) (*respConn, error) {
+	var conn net.Conn
+	var err error
+	if c.opts.TLSConfig != nil {
+		dialer := &tls.Dialer{Config: c.opts.TLSConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rc := newRESPConn(conn)
+	var commands [][][]byte
+	if c.opts.Password != "" {
+		if c.opts.Username != "" {
+			commands = append(commands, args("AUTH", c.opts.Username, c.opts.Password))
+		} else {
+			commands = append(commands, args("AUTH", c.opts.Password))
+		}
+	}
+	if c.opts.DB != 0 {
+		commands = append(commands, args("SELECT", strconv.Itoa(c.opts.DB)))
+	}
+	if len(commands) > 0 {
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.SetDeadline(deadline)
+		}
+		if _, err := rc.pipeline(commands...); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	return rc, nil
+}
+
+func args(strs ...string) [][]byte {
+	res := make([][]byte, len(strs))
+	for i, s := range strs {
+		res[i] = []byte(s)
+	}
+	return res
+}
+
+// 一起发送多条命令并依次读取回复,任何一条命令返回错误时返回这个错误
+func (c *respConn) pipeline(commands ...[][]byte) ([]interface{}, error) {
+	for _, command := range commands {
+		c.writeCommand(command...)
+	}
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(commands))
+	var replyErr error
+	for i := range replies {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := reply.(error); ok && replyErr == nil {
+			replyErr = e
+		}
+		replies[i] = reply
+	}
+	return replies, replyErr
+}
+
+// 从连接池中获取一个连接执行 fn,网络错误时重试;context 取消或者超时时中断正在进行的读写
+func (c *RESPClient) do(ctx context.Context, fn func(conn *respConn) error) error {
+	return c.opts.retry(ctx, func(ctx context.Context) error {
+		conn, err := c.pool.get(ctx)
+		if err != nil {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = conn.conn.SetDeadline(deadline)
+		}
+		stop := context.AfterFunc(ctx, func() {
+			_ = conn.conn.SetDeadline(time.Unix(1, 0))
+		})
+		err = fn(conn)
+		stopped := stop()
+		//服务端返回的错误不影响连接,其他的错误之后连接的状态未知
+		var serverErr *ServerError
+		broken := err != nil && !errors.As(err, &serverErr) && !isEngineError(err)
+		c.pool.put(conn, broken || !stopped)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	})
+}
+
+func isEngineError(err error) bool {
+	for _, e := range serverErrors {
+		if err == e {
+			return true
+		}
+	}
+	return false
+}
+
+// 执行一条命令并返回回复
+func (c *RESPClient) command(ctx context.Context, command ...[]byte) (interface{}, error) {
+	var reply interface{}
+	err := c.do(ctx, func(conn *respConn) error {
+		replies, err := conn.pipeline(command)
+		if err != nil {
+			return err
+		}
+		reply = replies[0]
+		return nil
+	})
+	return reply, err
+}
+
+func (c *RESPClient) Put(ctx context.Context, key, value []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	_, err := c.command(ctx, []byte("SET"), key, value)
+	return err
+}
+
+func (c *RESPClient) Get(ctx context.Context, key []byte) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, bitcask.ErrKeyIsEmpty
+	}
+	reply, err := c.command(ctx, []byte("GET"), key)
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, errInvalidReply
+	}
+	return value, nil
+}
+
+func (c *RESPClient) Delete(ctx context.Context, key []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	_, err := c.command(ctx, []byte("DEL"), key)
+	return err
+}
+
+// 通过 SCAN 遍历字符串类型的 key,withValues 为 true 时在同一个连接上通过 MGET 获取 value,
+// 每一页单独重试,遍历过程中被删除的 key 会被跳过
+func (c *RESPClient) scan(ctx context.Context, withValues bool, fn func(key, value []byte) bool) error {
+	cursor := []byte("0")
+	for {
+		var keys [][]byte
+		var values []interface{}
+		err := c.do(ctx, func(conn *respConn) error {
+			replies, err := conn.pipeline(append(args("SCAN"), cursor,
+				[]byte("COUNT"), []byte(strconv.Itoa(respScanCount)), []byte("TYPE"), []byte("string")))
+			if err != nil {
+				return err
+			}
+			var next []byte
+			if next, keys, err = parseScanReply(replies[0]); err != nil {
+				return err
+			}
+			if withValues && len(keys) > 0 {
+				replies, err = conn.pipeline(append(args("MGET"), keys...))
+				if err != nil {
+					return err
+				}
+				var ok bool
+				if values, ok = replies[0].([]interface{}); !ok || len(values) != len(keys) {
+					return errInvalidReply
+				}
+			}
+			cursor = next
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i, key := range keys {
+			var value []byte
+			if withValues {
+				if values[i] == nil {
+					continue
+				}
+				value, _ = values[i].([]byte)
+			}
+			if !fn(key, value) {
+				return nil
+			}
+		}
+		if bytes.Equal(cursor, []byte("0")) {
+			return nil
+		}
+	}
+}
+
+// SCAN 的回复是 [下一个 cursor, [key...]]
+func parseScanReply(reply interface{}) ([]byte, [][]byte, error) {
+	items, ok := reply.([]interface{})
+	if !ok || len(items) != 2 {
+		return nil, nil, errInvalidReply
+	}
+	next, ok := items[0].([]byte)
+	if !ok {
+		return nil, nil, errInvalidReply
+	}
+	keyItems, ok := items[1].([]interface{})
+	if !ok {
+		return nil, nil, errInvalidReply
+	}
+	keys := make([][]byte, len(keyItems))
+	for i, item := range keyItems {
+		if keys[i], ok = item.([]byte); !ok {
+			return nil, nil, errInvalidReply
+		}
+	}
+	return next, keys, nil
+}
+
+func (c *RESPClient) ListKeys(ctx context.Context) ([][]byte, error) {
+	var keys [][]byte
+	err := c.scan(ctx, false, func(key, value []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (c *RESPClient) Fold(ctx context.Context, fn func(key, value []byte) bool) error {
+	return c.scan(ctx, true, fn)
+}
+
+// Stat 解析 INFO persistence 中的存储引擎统计信息
+func (c *RESPClient) Stat(ctx context.Context) (*bitcask.Stat, error) {
+	reply, err := c.command(ctx, []byte("INFO"), []byte("persistence"))
+	if err != nil {
+		return nil, err
+	}
+	info, ok := reply.([]byte)
+	if !ok {
+		return nil, errInvalidReply
+	}
+	stat := &bitcask.Stat{}
+	for _, line := range strings.Split(string(info), "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		var err error
+		switch name {
+		case "engine_keys":
+			var n uint64
+			n, err = strconv.ParseUint(value, 10, 64)
+			stat.KeyNum = uint(n)
+		case "data_files":
+			var n uint64
+			n, err = strconv.ParseUint(value, 10, 64)
+			stat.DataFileNum = uint(n)
+		case "reclaimable_size":
+			stat.ReclaimSize, err = strconv.ParseInt(value, 10, 64)
+		case "disk_size":
+			stat.DisSize, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in INFO: %w", name, err)
+		}
+	}
+	return stat, nil
+}
+
+func (c *RESPClient) NewWriteBatch() WriteBatch {
+	return &remoteBatch{commit: c.commitBatch}
+}
+
+// 通过 MULTI/EXEC 原子地提交,事务中的命令都使用同一个连接
+func (c *RESPClient) commitBatch(ctx context.Context, operations []batchOperation) error {
+	commands := make([][][]byte, 0, len(operations)+2)
+	commands = append(commands, args("MULTI"))
+	for _, op := range operations {
+		if op.delete {
+			commands = append(commands, [][]byte{[]byte("DEL"), op.key})
+		} else {
+			commands = append(commands, [][]byte{[]byte("SET"), op.key, op.value})
+		}
+	}
+	commands = append(commands, args("EXEC"))
+	return c.do(ctx, func(conn *respConn) error {
+		replies, err := conn.pipeline(commands...)
+		if err != nil {
+			return err
+		}
+		results, ok := replies[len(replies)-1].([]interface{})
+		if !ok {
+			return errInvalidReply
+		}
+		for _, result := range results {
+			if e, ok := result.(error); ok {
+				return e
+			}
+		}
+		return nil
+	})
+}
+
+// Close 关闭连接池,之后的请求返回 ErrClosed
+func (c *RESPClient) Close() error {
+	return c.pool.close()
+}
@@ -120,6 +120,55 @@ func (df *DataFile) ReadLogRecord(offset int64) (*LogRecord, int64, error) {
 	return logRecord, recordSize, nil
 }
 
+// IsTornTail 判断 offset 处读取失败的记录是否是写入过程中崩溃留下的不完整的结尾:
+// 记录声明的长度超出了文件末尾,或者记录之后剩下的数据全部是0
+func (df *DataFile) IsTornTail(offset int64) (bool, error) {
+	fileSize, err := df.IoManager.Size()
+	if err != nil {
+		return false, err
+	}
+	headerBytes := min(int64(maxLogRecordHeaderSize), fileSize-offset)
+	if headerBytes <= 0 {
+		return true, nil
+	}
+	headerBuf, err := df.readNBytes(headerBytes, offset)
+	if err != nil {
+		return false, err
+	}
+	header, headerSize := decodeLogRecordHeader(headerBuf)
+	if header == nil {
+		return true, nil
+	}
+	//全是0的header之后可能还有正常的记录
+	if header.crc == 0 && header.keySize == 0 && header.valueSize == 0 {
+		return df.isZeroFrom(offset, fileSize)
+	}
+	recordEnd := offset + headerSize + int64(header.keySize) + int64(header.valueSize)
+	if recordEnd > fileSize {
+		return true, nil
+	}
+	return df.isZeroFrom(recordEnd, fileSize)
+}
+
+// 判断 offset 到文件末尾的数据是否全部是0
+func (df *DataFile) isZeroFrom(offset, fileSize int64) (bool, error) {
+	const chunkSize = 4096
+	for offset < fileSize {
+		n := min(chunkSize, fileSize-offset)
+		buf, err := df.readNBytes(n, offset)
+		if err != nil {
+			return false, err
+		}
+		for _, b := range buf {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		offset += n
+	}
+	return true, nil
+}
+
 // 非文件怎么sync呢
 func (df *DataFile) Sync() error {
 	return df.IoManager.Sync()
@@ -8,12 +8,14 @@ import (
 	"kv-go/bitcask/fio"
 	"kv-go/bitcask/index"
 	"kv-go/bitcask/utils"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 const seqNoKey = "seq.no"
@@ -34,6 +36,10 @@ type DB struct {
 	fileLock        *flock.Flock              // 文件锁保证多进程之间互斥
 	bytesWrite      uint                      // 累计写了字节的数量
 	reclaimSize     int64                     //表示有多少数据是无效的
+	mergeEpoch      uint32                    //最近一次merge的边界文件id
+	watchMu         *sync.Mutex
+	watchers        map[*Watcher]struct{} //key变更的订阅者
+	logger          *slog.Logger
 }
 type Stat struct {
 	KeyNum      uint  // key总量
@@ -45,6 +51,7 @@ type Stat struct {
 
 // 打开存储引擎实例
 func Open(options Options) (*DB, error) {
+	start := time.Now()
 	//对用户传入的配置项进行校验
 	if err := checkOptions(options); err != nil {
 		return nil, err
@@ -67,6 +74,18 @@ func Open(options Options) (*DB, error) {
 	if !hold {
 		return nil, ErrDatabaseIsUsing
 	}
+	//启动失败时释放文件锁和已经打开的文件,修复数据目录之后可以重新打开
+	var db *DB
+	var opened bool
+	defer func() {
+		if opened {
+			return
+		}
+		if db != nil {
+			db.closeFiles()
+		}
+		_ = fileLock.Unlock()
+	}()
 	//文件为空
 	entries, err := os.ReadDir(options.DirPath)
 	if err != nil {
@@ -76,19 +95,26 @@ func Open(options Options) (*DB, error) {
 		isInitial = true
 	}
 	//初始化db实例的结构体
-	db := &DB{
+	db = &DB{
 		Options:    options,
 		mu:         new(sync.RWMutex),
 		activeFile: nil,
 		olderFiles: make(map[uint32]*data.DataFile),
-		index:      index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrites),
+		index:      index.NewIndexer(options.IndexType, options.DirPath, options.SyncWrites, options.Comparator),
 		isInitial:  isInitial,
 		fileLock:   fileLock,
+		watchMu:    new(sync.Mutex),
+		watchers:   make(map[*Watcher]struct{}),
+		logger:     newLogger(options),
 	}
 	//加载merge数据目录
 	if err := db.loadMergeFiles(); err != nil {
 		return nil, err
 	}
+	//加载merge的边界,用于判断变更订阅的位置是否还有效
+	if err := db.loadMergeEpoch(); err != nil {
+		return nil, err
+	}
 	//加载数据文件
 	if err := db.loadDataFiles(); err != nil {
 		return nil, err
@@ -104,12 +130,11 @@ func Open(options Options) (*DB, error) {
 			return nil, err
 
 		}
-
-		//重置io类型为标准文件
-		if db.Options.MMapAtStartup {
-			if err := db.resetIoType(); err != nil {
-
-			}
+	}
+	//重置io类型为标准文件,b+树索引同样需要,否则活跃文件无法写入
+	if db.Options.MMapAtStartup {
+		if err := db.resetIoType(); err != nil {
+			return nil, err
 		}
 	}
 	//取出当前事务序列号
@@ -125,9 +150,23 @@ func Open(options Options) (*DB, error) {
 			db.activeFile.WriteOff = size
 		}
 	}
+	db.logger.Info("database opened", "data_files", len(db.fileIds), "keys", db.index.Size(),
+		"reclaim_size", db.reclaimSize, "duration", time.Since(start))
+	opened = true
 	return db, nil
 }
 
+// 启动失败时关闭索引和已经打开的数据文件
+func (db *DB) closeFiles() {
+	_ = db.index.Close()
+	if db.activeFile != nil {
+		_ = db.activeFile.Close()
+	}
+	for _, file := range db.olderFiles {
+		_ = file.Close()
+	}
+}
+
 // 关闭数据库
 func (db *DB) Close() error {
 	//释放文件锁
@@ -136,15 +175,17 @@ func (db *DB) Close() error {
 			panic("failed to unlock file")
 		}
 	}()
-	if db.activeFile == nil {
-		return nil
-	}
+	//关闭所有的订阅者
+	db.closeWatchers()
 	db.mu.Lock()
 	defer db.mu.Unlock()
 	//关闭索引
 	if err := db.index.Close(); err != nil {
 		return err
 	}
+	if db.activeFile == nil {
+		return nil
+	}
 	//保存事务序列号
 	seqNoFile, err := data.OpenSeqNoFile(db.Options.DirPath)
 	if err != nil {
@@ -183,7 +224,31 @@ func (db *DB) Sync() error {
 	//持久化当前的一个活跃文件
 	db.mu.Lock()
 	defer db.mu.Unlock()
-	return db.activeFile.Sync()
+	return db.syncFile(db.activeFile)
+}
+
+// Reconfigure 在运行时修改 DataFileSize、SyncWrites、BytesPerSync 和 DataFileMergeRatio,
+// 其他的配置项只有重新打开数据库才能修改,会被忽略
+func (db *DB) Reconfigure(options Options) error {
+	if err := db.CheckReconfigure(options); err != nil {
+		return err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.Options.DataFileSize = options.DataFileSize
+	db.Options.SyncWrites = options.SyncWrites
+	db.Options.BytesPerSync = options.BytesPerSync
+	db.Options.DataFileMergeRatio = options.DataFileMergeRatio
+	return nil
+}
+
+// CheckReconfigure 只检查 Reconfigure 使用的配置项是否合法,不修改配置,
+// 同时修改多个数据库时先检查所有的数据库,避免只有一部分生效
+func (db *DB) CheckReconfigure(options Options) error {
+	options.DirPath = db.Options.DirPath
+	options.IndexType = db.Options.IndexType
+	options.Comparator = db.Options.Comparator
+	return checkOptions(options)
 }
 
 // 返回数据相关统计数据
@@ -196,8 +261,8 @@ func (db *DB) Stat() *Stat {
 	}
 	dirSize, err := utils.DirSize(db.Options.DirPath)
 	if err != nil {
-		panic(err)
-
+		//统计信息中的其他数据仍然有效,不因为读取目录失败而中断调用方
+		db.ReportBackgroundError(err)
 	}
 
 	return &Stat{
@@ -215,7 +280,8 @@ func (db *DB) Backup(dir string) error {
 }
 
 // 写入key/value
-func (db *DB) Put(key []byte, value []byte) error {
+func (db *DB) Put(key []byte, value []byte) (err error) {
+	defer db.observe(OpPut, time.Now(), &err)
 	//判断key是否有效
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -226,8 +292,11 @@ func (db *DB) Put(key []byte, value []byte) error {
 		Value: value,
 		Type:  data.LogRecordNormal,
 	}
+	//追加写入、更新索引和通知订阅者都在同一个锁中完成,订阅者收到的事件和日志的顺序一致
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	//追加当前数据到活跃文件当中
-	pos, err := db.appendLogRecordWithLock(&logRecord)
+	pos, err := db.appendLogRecord(&logRecord)
 	if err != nil {
 		return err
 	}
@@ -235,10 +304,17 @@ func (db *DB) Put(key []byte, value []byte) error {
 	if oldPos := db.index.Put(key, pos); oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
 	}
+	db.notifyWatchers(&Event{
+		Key:    key,
+		Value:  value,
+		Type:   EventPut,
+		Cursor: db.positionAfter(pos),
+	})
 	return nil
 }
 
-func (db *DB) Delete(key []byte) error {
+func (db *DB) Delete(key []byte) (err error) {
+	defer db.observe(OpDelete, time.Now(), &err)
 	//先判断用户传递过来的key
 	if len(key) == 0 {
 		return ErrKeyIsEmpty
@@ -253,8 +329,10 @@ func (db *DB) Delete(key []byte) error {
 		Key:  logRecordKeyWithSeq(key, nonTransactionSeqNo),
 		Type: data.LogRecordDelete,
 	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
 	//写入到数据文件里面
-	pos, err := db.appendLogRecordWithLock(&logRecord)
+	pos, err := db.appendLogRecord(&logRecord)
 	if err != nil {
 		db.reclaimSize += int64(pos.Size)
 		return err
@@ -267,9 +345,23 @@ func (db *DB) Delete(key []byte) error {
 	if oldPos != nil {
 		db.reclaimSize += int64(oldPos.Size)
 	}
+	db.notifyWatchers(&Event{
+		Key:    key,
+		Type:   EventDelete,
+		Cursor: db.positionAfter(pos),
+	})
 	return nil
 }
 
+// 日志记录之后的位置
+func (db *DB) positionAfter(pos *data.LogRecordPos) Position {
+	return Position{
+		Epoch:  db.mergeEpoch,
+		Fid:    pos.Fid,
+		Offset: pos.Offset + int64(pos.Size),
+	}
+}
+
 // 从数据库中获取所有的key
 func (db *DB) ListKeys() [][]byte {
 
@@ -309,7 +401,8 @@ func (db *DB) Fold(fn func(key []byte, value []byte) bool) error {
 }
 
 // 根据key读取文件
-func (db *DB) Get(key []byte) ([]byte, error) {
+func (db *DB) Get(key []byte) (value []byte, err error) {
+	defer db.observe(OpGet, time.Now(), &err)
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 	//判断key的有效性
@@ -374,12 +467,6 @@ func (db *DB) getValueByPosition(pos *data.LogRecordPos) ([]byte, error) {
 	return logRecord.Value, nil
 }
 
-func (db *DB) appendLogRecordWithLock(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	return db.appendLogRecord(logRecord)
-}
-
 // 追加写入到活跃文件
 func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, error) {
 
@@ -396,17 +483,19 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 	//如果写入数据加上活跃文件大小超过了阈值，就需要转换新数据文件为旧数据文件
 	if db.activeFile.WriteOff+size > db.Options.DataFileSize {
 		//先将当前文件持久化，确保文件写入到磁盘当中
-		if err := db.activeFile.Sync(); err != nil {
+		if err := db.syncFile(db.activeFile); err != nil {
 			return nil, err
 		}
 
 		//转换为旧的数据文件
-		db.olderFiles[db.activeFile.FileId] = db.activeFile
+		oldFileId := db.activeFile.FileId
+		db.olderFiles[oldFileId] = db.activeFile
 
 		//打开新的数据文件
 		if err := db.setActiveDataFile(); err != nil {
 			return nil, err
 		}
+		db.fileRotated(oldFileId, db.activeFile.FileId)
 	}
 	writeOff := db.activeFile.WriteOff
 
@@ -424,7 +513,7 @@ func (db *DB) appendLogRecord(logRecord *data.LogRecord) (*data.LogRecordPos, er
 
 	//是否需要对数据进行一次安全的持久化,根据用户配置决定
 	if needSync {
-		if err := db.activeFile.Sync(); err != nil {
+		if err := db.syncFile(db.activeFile); err != nil {
 			return nil, err
 		}
 		//清空累计值
@@ -500,7 +589,7 @@ func (db *DB) loadDataFiles() error {
 			db.activeFile = dataFile
 		} else {
 			//说明是旧的数据文件
-			db.olderFiles = make(map[uint32]*data.DataFile)
+			db.olderFiles[uint32(fid)] = dataFile
 		}
 	}
 	return nil
@@ -516,7 +605,7 @@ func (db *DB) loadIndexFromDateFiles() error {
 	hasMerge, nonMergeFileId := false, uint32(0)
 
 	mergeFinishName := filepath.Join(db.Options.DirPath, data.MergeFinishName)
-	if _, err := os.Stat(mergeFinishName); err != nil {
+	if _, err := os.Stat(mergeFinishName); err == nil {
 		fid, err := db.getNonMergeFileId(db.Options.DirPath)
 		if err != nil {
 			return err
@@ -534,7 +623,7 @@ func (db *DB) loadIndexFromDateFiles() error {
 			oldPos = db.index.Put(key, pos)
 		}
 		if oldPos != nil {
-			panic("failed to put index")
+			db.reclaimSize += int64(oldPos.Size)
 		}
 	}
 	//暂存我们对应事务的数据 ,事务id对应一个列表
@@ -559,9 +648,25 @@ func (db *DB) loadIndexFromDateFiles() error {
 			logRecord, size, err := dataFile.ReadLogRecord(offset)
 			//读到了文件末尾
 			if err != nil {
+				//活跃文件末尾不完整的记录是写入过程中崩溃留下的,截断之后继续启动,
+				//之后还有其他数据时是文件中间的数据损坏,不能截断
+				if i == len(db.fileIds)-1 && (err == io.EOF || err == data.ErrInvalidCRC) {
+					torn, tornErr := dataFile.IsTornTail(offset)
+					if tornErr != nil {
+						return tornErr
+					}
+					if torn {
+						if err := db.truncateActiveFile(offset, err); err != nil {
+							return err
+						}
+						break
+					}
+					err = data.ErrInvalidCRC
+				}
 				if err == io.EOF {
 					break
 				}
+				db.logger.Error("data file corrupted", "file", fileId, "offset", offset, "error", err)
 				return err
 			}
 
@@ -622,14 +727,19 @@ func checkOptions(options Options) error {
 	if options.DataFileMergeRatio < 0 || options.DataFileMergeRatio > 1 {
 		return errors.New("DataFileMergeRatio must be between 0 and 1")
 	}
+	//ART 和 B+ 树的顺序由底层的数据结构决定,无法自定义
+	if options.Comparator != nil && options.IndexType != BTree {
+		return ErrComparatorNotSupported
+	}
 	return nil
 }
 
 func (db *DB) loadSeqNo() error {
 
 	fileName := filepath.Join(db.Options.DirPath, data.SeqNoFileName)
-	if _, err := os.Stat(fileName); err != nil {
-		return err
+	//序列号文件不存在，说明还没有写过数据或者没有正常关闭
+	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+		return nil
 	}
 	seqNoFile, err := data.OpenSeqNoFile(db.Options.DirPath)
 	if err != nil {
@@ -645,6 +755,29 @@ func (db *DB) loadSeqNo() error {
 	return nil
 }
 
+// 截断活跃文件中 offset 之后的数据,读到文件末尾时 offset 就是文件大小,不需要截断
+func (db *DB) truncateActiveFile(offset int64, reason error) error {
+	fileSize, err := db.activeFile.IoManager.Size()
+	if err != nil {
+		return err
+	}
+	if offset >= fileSize {
+		return nil
+	}
+	fileName := data.GetDataFileName(db.Options.DirPath, db.activeFile.FileId)
+	if err := os.Truncate(fileName, offset); err != nil {
+		return err
+	}
+	db.recoveryTruncated(RecoveryTruncatedInfo{
+		DirPath: db.Options.DirPath,
+		FileId:  db.activeFile.FileId,
+		Offset:  offset,
+		Size:    fileSize - offset,
+		Reason:  reason,
+	})
+	return nil
+}
+
 // 将数据文件的io类型设置为标准文件
 func (db *DB) resetIoType() error {
 	//数据目录是空的
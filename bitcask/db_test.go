@@ -5,6 +5,7 @@ import (
 	"kv-go/bitcask/utils"
 	"os"
 	"testing"
+	"time"
 )
 
 // 测试完成之后销毁 DB 数据目录
@@ -296,6 +297,45 @@ func TestDB_Sync(t *testing.T) {
 	err = db.Sync()
 	assert.Nil(t, err)
 }
+func TestDB_Reconfigure(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-reconfigure")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	newOpts := opts
+	newOpts.DataFileSize = 1024
+	newOpts.SyncWrites = true
+	newOpts.DirPath = "other"
+	err = db.Reconfigure(newOpts)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1024), db.Options.DataFileSize)
+	assert.True(t, db.Options.SyncWrites)
+	assert.Equal(t, dir, db.Options.DirPath)
+
+	// 超过新的文件大小之后切换到新的数据文件
+	for i := 0; i < 20; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(100))
+		assert.Nil(t, err)
+	}
+	assert.True(t, len(db.olderFiles) > 0)
+
+	newOpts.DataFileMergeRatio = 2
+	err = db.CheckReconfigure(newOpts)
+	assert.NotNil(t, err)
+	err = db.Reconfigure(newOpts)
+	assert.NotNil(t, err)
+	assert.Equal(t, opts.DataFileMergeRatio, db.Options.DataFileMergeRatio)
+
+	// 只检查不修改配置
+	newOpts.DataFileMergeRatio = 1
+	newOpts.DataFileSize = 2048
+	assert.Nil(t, db.CheckReconfigure(newOpts))
+	assert.Equal(t, int64(1024), db.Options.DataFileSize)
+}
 func TestDB_fileLock(t *testing.T) {
 	opts := DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-file-lock")
@@ -335,3 +375,128 @@ func TestDB_Backup(t *testing.T) {
 	t.Log(err)
 	t.Log(db2)
 }
+
+func TestDB_OpenOlderFiles(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-older-files")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, db.Close())
+
+	// 重新打开之后旧的数据文件中的 key 都可以读取
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Greater(t, db2.Stat().DataFileNum, uint(1))
+	for i := 0; i < 1000; i++ {
+		_, err := db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+}
+
+func TestDB_OpenOverwrittenKeys(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-overwritten")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		err := db.Put(utils.GetTestKey(1), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Put(utils.GetTestKey(1), []byte("latest"))
+	assert.Nil(t, err)
+	reclaimSize := db.Stat().ReclaimSize
+	assert.Greater(t, reclaimSize, int64(0))
+	assert.Nil(t, db.Close())
+
+	// 被覆盖的记录在重新打开时计入可以回收的空间
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	assert.Equal(t, reclaimSize, db2.Stat().ReclaimSize)
+	val, err := db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("latest"), val)
+}
+
+func TestDB_OpenWithoutMerge(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-without-merge")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	// 没有 merge 过的目录中没有 merge 完成的文件,重新打开时从所有的数据文件加载索引
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	_, err = db2.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+}
+
+func TestDB_OpenBPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bptree")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	// 新的目录中还没有事务序列号文件
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+}
+
+func TestDB_OpenBPlusTreeWrite(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bptree-write")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(24))
+	assert.Nil(t, err)
+	assert.Nil(t, db.Close())
+
+	// 启动时用 mmap 打开的数据文件需要重置为标准文件才能继续写入
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	err = db2.Put(utils.GetTestKey(2), utils.RandomValue(24))
+	assert.Nil(t, err)
+	_, err = db2.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+}
+
+func TestDB_CloseBPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-bptree-close")
+	opts.DirPath = dir
+	opts.IndexType = BPlusTree
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	// 没有写入过数据时同样需要关闭索引,否则索引文件一直被锁住
+	assert.Nil(t, db.Close())
+
+	opened := make(chan *DB, 1)
+	go func() {
+		db2, err := Open(opts)
+		assert.Nil(t, err)
+		opened <- db2
+	}()
+	select {
+	case db2 := <-opened:
+		destroyDB(db2)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reopen blocked on the index file")
+	}
+}
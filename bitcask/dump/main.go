@@ -0,0 +1,116 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"kv-go/bitcask"
+	"log"
+	"os"
+)
+
+// 数据导出导入工具,可以用于在不同索引类型、不同机器之间迁移数据
+//
+//	dump export -dir /tmp/bitcask-go -file data.bkex -compress
+//	dump import -dir /tmp/bitcask-go-bptree -index bptree -file data.bkex
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	dir := fs.String("dir", "", "数据库数据目录")
+	indexType := fs.String("index", "btree", "索引类型: btree, art, bptree")
+	file := fs.String("file", "", "导出/导入的文件,为空时使用标准输出/标准输入")
+	compress := fs.Bool("compress", false, "导出时是否使用gzip压缩")
+	_ = fs.Parse(os.Args[2:])
+
+	if *dir == "" {
+		log.Fatal("dir is empty")
+	}
+	opts := bitcask.DefaultOptions
+	opts.DirPath = *dir
+	typ, err := parseIndexType(*indexType)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts.IndexType = typ
+
+	switch cmd {
+	case "export":
+		err = runExport(opts, *file, *compress)
+	case "import":
+		err = runImport(opts, *file)
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runExport(opts bitcask.Options, file string, compress bool) error {
+	//导出的目录必须是已经存在的
+	if _, err := os.Stat(opts.DirPath); err != nil {
+		return err
+	}
+	db, err := bitcask.Open(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var w io.Writer = os.Stdout
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	exportOpts := bitcask.DefaultExportOptions
+	exportOpts.Compress = compress
+	return db.Export(w, exportOpts)
+}
+
+func runImport(opts bitcask.Options, file string) error {
+	db, err := bitcask.Open(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var r io.Reader = os.Stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if err := db.Import(r); err != nil {
+		return err
+	}
+	return db.Sync()
+}
+
+func parseIndexType(name string) (bitcask.IndexerType, error) {
+	switch name {
+	case "btree":
+		return bitcask.BTree, nil
+	case "art":
+		return bitcask.ART, nil
+	case "bptree":
+		return bitcask.BPlusTree, nil
+	default:
+		return 0, fmt.Errorf("unknown index type: %s", name)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dump <export|import> -dir <path> [-index btree|art|bptree] [-file <path>] [-compress]")
+}
@@ -13,4 +13,14 @@ var (
 	ErrDatabaseIsUsing        = errors.New("database is used by other process")
 	ErrMergeRatioUnreached    = errors.New("merge ratio unreached")
 	ErrNoEnoughSpace          = errors.New("no enough space")
+
+	ErrInvalidExportStream      = errors.New("invalid export stream")
+	ErrUnsupportedExportVersion = errors.New("unsupported export stream version")
+	ErrExportChecksumMismatch   = errors.New("export stream checksum mismatch")
+
+	ErrWatcherLagged  = errors.New("watcher lagged behind and was closed")
+	ErrDatabaseClosed = errors.New("database is closed")
+	ErrCursorExpired  = errors.New("cursor expired, data files were rewritten by merge")
+
+	ErrComparatorNotSupported = errors.New("comparator is only supported by the BTree index")
 )
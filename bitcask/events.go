@@ -0,0 +1,113 @@
+package bitcask
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// FileRotatedInfo 活跃文件写满或者 merge 开始时切换到新的数据文件
+type FileRotatedInfo struct {
+	DirPath   string
+	OldFileId uint32 //变为旧数据文件的 id
+	NewFileId uint32 //新的活跃文件的 id
+}
+
+// MergeInfo 一次 merge 的信息
+type MergeInfo struct {
+	DirPath        string
+	MergeFiles     int           //参与 merge 的数据文件数量
+	NonMergeFileId uint32        //没有参与 merge 的第一个文件 id,比它小的文件会在下次打开时被替换
+	ReclaimSize    int64         //merge 开始时可以回收的数据量
+	Duration       time.Duration //只在 OnMergeEnd 中设置
+}
+
+// RecoveryTruncatedInfo 启动时活跃文件的末尾有不完整的记录(写入过程中崩溃),从 Offset 开始的数据被截断
+type RecoveryTruncatedInfo struct {
+	DirPath string
+	FileId  uint32
+	Offset  int64 //截断之后的文件大小
+	Size    int64 //被截断的字节数
+	Reason  error //读取最后一条记录时的错误,如 data.ErrInvalidCRC
+}
+
+// EventListener 接收存储引擎内部的事件,通过 Options.EventListener 设置,为空时不通知
+// 回调是同步调用的,可能持有数据库的锁,回调中不能调用 DB 的方法,耗时的处理需要放到其他 goroutine 中
+type EventListener interface {
+	OnFileRotated(info FileRotatedInfo)
+	OnMergeBegin(info MergeInfo)
+	//err 为空表示 merge 的数据已经写入 merge 目录,下次打开数据库时生效
+	OnMergeEnd(info MergeInfo, err error)
+	OnRecoveryTruncated(info RecoveryTruncatedInfo)
+	//没有返回给调用方的错误,如清理 merge 目录失败
+	OnBackgroundError(err error)
+}
+
+// BaseEventListener 所有的回调都为空,嵌入之后只需要实现关心的回调
+type BaseEventListener struct{}
+
+func (BaseEventListener) OnFileRotated(info FileRotatedInfo)             {}
+func (BaseEventListener) OnMergeBegin(info MergeInfo)                    {}
+func (BaseEventListener) OnMergeEnd(info MergeInfo, err error)           {}
+func (BaseEventListener) OnRecoveryTruncated(info RecoveryTruncatedInfo) {}
+func (BaseEventListener) OnBackgroundError(err error)                    {}
+
+// 没有设置 Logger 时丢弃所有的日志
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+// 日志中带上数据目录,区分同一个进程中的多个数据库
+func newLogger(options Options) *slog.Logger {
+	if options.Logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return options.Logger.With("dir", options.DirPath)
+}
+
+func (db *DB) eventListener() EventListener {
+	if db.Options.EventListener == nil {
+		return BaseEventListener{}
+	}
+	return db.Options.EventListener
+}
+
+func (db *DB) fileRotated(oldFileId, newFileId uint32) {
+	db.logger.Info("data file rotated", "old_file", oldFileId, "new_file", newFileId)
+	db.eventListener().OnFileRotated(FileRotatedInfo{
+		DirPath:   db.Options.DirPath,
+		OldFileId: oldFileId,
+		NewFileId: newFileId,
+	})
+}
+
+func (db *DB) mergeBegin(info MergeInfo) {
+	db.logger.Info("merge started", "files", info.MergeFiles, "non_merge_file", info.NonMergeFileId,
+		"reclaim_size", info.ReclaimSize)
+	db.eventListener().OnMergeBegin(info)
+}
+
+func (db *DB) mergeEnd(info MergeInfo, err error) {
+	if err != nil {
+		db.logger.Error("merge failed", "files", info.MergeFiles, "duration", info.Duration, "error", err)
+	} else {
+		db.logger.Info("merge finished", "files", info.MergeFiles, "duration", info.Duration)
+	}
+	db.eventListener().OnMergeEnd(info, err)
+}
+
+func (db *DB) recoveryTruncated(info RecoveryTruncatedInfo) {
+	db.logger.Warn("truncated incomplete records at the end of data file", "file", info.FileId,
+		"offset", info.Offset, "size", info.Size, "reason", info.Reason)
+	db.eventListener().OnRecoveryTruncated(info)
+}
+
+// ReportBackgroundError 记录没有返回给调用方的错误,并通知 EventListener,
+// 在存储引擎之上运行的后台任务(如 Redis 数据结构的过期清理)也可以通过它上报错误
+func (db *DB) ReportBackgroundError(err error) {
+	db.logger.Error("background error", "error", err)
+	db.eventListener().OnBackgroundError(err)
+}
@@ -0,0 +1,220 @@
+package bitcask
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"kv-go/bitcask/data"
+	"kv-go/bitcask/utils"
+	"log/slog"
+	"os"
+	"sync"
+	"testing"
+)
+
+// 记录收到的所有事件
+type testEventListener struct {
+	BaseEventListener
+	mu         sync.Mutex
+	rotated    []FileRotatedInfo
+	mergeBegin []MergeInfo
+	mergeEnd   []error
+	truncated  []RecoveryTruncatedInfo
+}
+
+func (l *testEventListener) OnFileRotated(info FileRotatedInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rotated = append(l.rotated, info)
+}
+
+func (l *testEventListener) OnMergeBegin(info MergeInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeBegin = append(l.mergeBegin, info)
+}
+
+func (l *testEventListener) OnMergeEnd(info MergeInfo, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mergeEnd = append(l.mergeEnd, err)
+}
+
+func (l *testEventListener) OnRecoveryTruncated(info RecoveryTruncatedInfo) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.truncated = append(l.truncated, info)
+}
+
+func TestDB_EventListener(t *testing.T) {
+	listener := &testEventListener{}
+	var logs bytes.Buffer
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-events")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.EventListener = listener
+	opts.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	assert.True(t, len(listener.rotated) > 0)
+	assert.Equal(t, uint32(0), listener.rotated[0].OldFileId)
+	assert.Equal(t, uint32(1), listener.rotated[0].NewFileId)
+	assert.Equal(t, dir, listener.rotated[0].DirPath)
+	rotated := len(listener.rotated)
+
+	assert.Nil(t, db.Merge())
+	// merge 开始时切换活跃文件
+	assert.Equal(t, rotated+1, len(listener.rotated))
+	assert.Equal(t, 1, len(listener.mergeBegin))
+	assert.Equal(t, rotated+1, listener.mergeBegin[0].MergeFiles)
+	assert.Equal(t, listener.rotated[rotated].NewFileId, listener.mergeBegin[0].NonMergeFileId)
+	assert.Equal(t, []error{nil}, listener.mergeEnd)
+
+	// 没有开始的 merge 不会通知
+	db.Options.DataFileMergeRatio = 1
+	assert.Equal(t, ErrMergeRatioUnreached, db.Merge())
+	assert.Equal(t, 1, len(listener.mergeBegin))
+
+	res := logs.String()
+	assert.Contains(t, res, "msg=\"database opened\"")
+	assert.Contains(t, res, "msg=\"data file rotated\"")
+	assert.Contains(t, res, "msg=\"merge finished\"")
+	assert.Contains(t, res, "dir="+dir)
+}
+
+func TestDB_RecoveryTruncated(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("k1"), []byte("v1")))
+	assert.Nil(t, db.Put([]byte("k2"), []byte("v2")))
+	assert.Nil(t, db.Close())
+
+	// 模拟写入过程中崩溃: 活跃文件末尾只有半条记录
+	fileName := data.GetDataFileName(dir, 0)
+	stat, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeq([]byte("k3"), nonTransactionSeqNo),
+		Value: []byte("a value that was not fully written"),
+	})
+	file, err := os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.Write(encRecord[:len(encRecord)/2])
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	listener := &testEventListener{}
+	opts.EventListener = listener
+	db, err = Open(opts)
+	defer func() {
+		destroyDB(db)
+	}()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listener.truncated))
+	assert.Equal(t, uint32(0), listener.truncated[0].FileId)
+	assert.Equal(t, stat.Size(), listener.truncated[0].Offset)
+	assert.Equal(t, int64(len(encRecord)/2), listener.truncated[0].Size)
+	assert.Equal(t, io.EOF, listener.truncated[0].Reason)
+
+	// 截断之后新的写入从正确的位置开始
+	val, err := db.Get([]byte("k2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), val)
+	_, err = db.Get([]byte("k3"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Put([]byte("k4"), []byte("v4")))
+	val, err = db.Get([]byte("k4"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v4"), val)
+	assert.Nil(t, db.Close())
+
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(listener.truncated))
+	val, err = db.Get([]byte("k4"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v4"), val)
+}
+
+func TestDB_RecoveryCorrupted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-recovery-corrupted")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+	db, err := Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("k1"), []byte("v1")))
+	firstEnd := db.activeFile.WriteOff
+	assert.Nil(t, db.Put([]byte("k2"), []byte("v2")))
+	secondEnd := db.activeFile.WriteOff
+	assert.Nil(t, db.Put([]byte("k3"), []byte("v3")))
+	assert.Nil(t, db.Close())
+
+	fileName := data.GetDataFileName(dir, 0)
+	stat, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	corrupt := func(offset int64, b byte) {
+		file, err := os.OpenFile(fileName, os.O_WRONLY, 0644)
+		assert.Nil(t, err)
+		_, err = file.WriteAt([]byte{b}, offset)
+		assert.Nil(t, err)
+		assert.Nil(t, file.Close())
+	}
+
+	// 文件中间的记录损坏时不能截断之后的数据,启动失败
+	corrupt(firstEnd-1, 'x')
+	listener := &testEventListener{}
+	opts.EventListener = listener
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+	assert.Equal(t, 0, len(listener.truncated))
+	after, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, stat.Size(), after.Size())
+
+	// 中间被清零的记录也不是不完整的结尾
+	corrupt(firstEnd-1, '1')
+	zeros := make([]byte, secondEnd-firstEnd)
+	file, err := os.OpenFile(fileName, os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	_, err = file.WriteAt(zeros, firstEnd)
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+	_, err = Open(opts)
+	assert.Equal(t, data.ErrInvalidCRC, err)
+	assert.Equal(t, 0, len(listener.truncated))
+
+	// 最后一条记录损坏,之后只有填充的0时是不完整的结尾
+	assert.Nil(t, os.Truncate(fileName, firstEnd))
+	file, err = os.OpenFile(fileName, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.Nil(t, err)
+	encRecord, _ := data.EncodeLogRecord(&data.LogRecord{
+		Key:   logRecordKeyWithSeq([]byte("k2"), nonTransactionSeqNo),
+		Value: []byte("v2"),
+	})
+	encRecord[len(encRecord)-1] = 'x'
+	_, err = file.Write(append(encRecord, make([]byte, 16)...))
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	assert.Equal(t, 1, len(listener.truncated))
+	assert.Equal(t, firstEnd, listener.truncated[0].Offset)
+	assert.Equal(t, data.ErrInvalidCRC, listener.truncated[0].Reason)
+	val, err := db.Get([]byte("k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v1"), val)
+	_, err = db.Get([]byte("k2"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
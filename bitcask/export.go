@@ -0,0 +1,228 @@
+package bitcask
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// 导出流格式(版本 1),所有多字节整数均为小端序
+//
+// 流头部,不参与压缩:
+// +-------------+-----------+----------+
+// | magic "BKEX" | version   | flags    |
+// +-------------+-----------+----------+
+// | 4字节        | 1字节      | 1字节     |
+//
+// flags 的最低位为 1 表示之后的内容使用 gzip 压缩
+//
+// 头部之后是若干条记录,每条记录以一个字节的记录类型开头:
+// 数据记录 exportRecordKV:
+// +------+-----------------+-------------------+-----+-------+---------+
+// | type | key size        | value size        | key | value | crc     |
+// +------+-----------------+-------------------+-----+-------+---------+
+// | 1字节 | 变长(uvarint)    | 变长(uvarint)      |     |       | 4字节    |
+//
+// crc 是对 type 到 value 之间所有字节计算的 crc32(IEEE) 校验值
+//
+// 结束记录 exportRecordEnd:
+// +------+--------------------+---------+
+// | type | record count       | crc     |
+// +------+--------------------+---------+
+// | 1字节 | 变长(uvarint)       | 4字节    |
+//
+// record count 是数据记录的总条数,crc 是所有数据记录 crc 按顺序累加计算的校验值,
+// 用于发现记录被截断或者丢失的情况
+const (
+	exportMagic   = "BKEX"
+	exportVersion = 1
+
+	exportFlagGzip = 1 << 0
+)
+
+// 数据文件中 key 和 value 的长度以 varint32 编码,超过这个长度的记录一定是损坏的
+const maxExportFieldSize = math.MaxInt32
+
+const (
+	exportRecordEnd byte = iota
+	exportRecordKV
+)
+
+// Export 将数据库中所有有效的 key/value 以可移植的格式写入到 w 中
+// 导出的数据与索引类型以及数据文件布局无关,可以导入到任意一个 DB 实例
+func (db *DB) Export(w io.Writer, opts ExportOptions) error {
+	var flags byte
+	if opts.Compress {
+		flags |= exportFlagGzip
+	}
+	header := append([]byte(exportMagic), exportVersion, flags)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	//根据配置决定是否进行压缩
+	var gw *gzip.Writer
+	if opts.Compress {
+		gw = gzip.NewWriter(w)
+		w = gw
+	}
+	bw := bufio.NewWriter(w)
+
+	var count uint64
+	var sum uint32
+	var writeErr error
+	//Fold 持有读锁,导出的是一个一致的快照
+	err := db.Fold(func(key []byte, value []byte) bool {
+		buf := encodeExportRecord(key, value)
+		if _, writeErr = bw.Write(buf); writeErr != nil {
+			return false
+		}
+		count++
+		sum = crc32.Update(sum, crc32.IEEETable, buf[len(buf)-crc32.Size:])
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	//写入结束记录
+	endBuf := make([]byte, 1+binary.MaxVarintLen64+crc32.Size)
+	endBuf[0] = exportRecordEnd
+	var index = 1
+	index += binary.PutUvarint(endBuf[index:], count)
+	binary.LittleEndian.PutUint32(endBuf[index:], sum)
+	index += crc32.Size
+	if _, err := bw.Write(endBuf[:index]); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if gw != nil {
+		return gw.Close()
+	}
+	return nil
+}
+
+// Import 从 r 中读取 Export 导出的数据并写入到当前数据库,已经存在的 key 会被覆盖
+// 流中的数据全部校验通过之前就已经写入的记录不会回滚
+func (db *DB) Import(r io.Reader) error {
+	header := make([]byte, len(exportMagic)+2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return ErrInvalidExportStream
+	}
+	if string(header[:len(exportMagic)]) != exportMagic {
+		return ErrInvalidExportStream
+	}
+	if header[len(exportMagic)] != exportVersion {
+		return ErrUnsupportedExportVersion
+	}
+	flags := header[len(exportMagic)+1]
+	if flags&exportFlagGzip != 0 {
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		r = gr
+	}
+	br := bufio.NewReader(r)
+
+	var count uint64
+	var sum uint32
+	for {
+		typ, err := br.ReadByte()
+		if err != nil {
+			//没有读到结束记录就到了末尾,说明数据被截断了
+			return ErrInvalidExportStream
+		}
+		switch typ {
+		case exportRecordKV:
+			key, value, crc, err := readExportRecord(br)
+			if err != nil {
+				return err
+			}
+			if err := db.Put(key, value); err != nil {
+				return err
+			}
+			count++
+			crcBuf := make([]byte, crc32.Size)
+			binary.LittleEndian.PutUint32(crcBuf, crc)
+			sum = crc32.Update(sum, crc32.IEEETable, crcBuf)
+		case exportRecordEnd:
+			expectCount, err := binary.ReadUvarint(br)
+			if err != nil {
+				return ErrInvalidExportStream
+			}
+			crcBuf := make([]byte, crc32.Size)
+			if _, err := io.ReadFull(br, crcBuf); err != nil {
+				return ErrInvalidExportStream
+			}
+			if expectCount != count || binary.LittleEndian.Uint32(crcBuf) != sum {
+				return ErrExportChecksumMismatch
+			}
+			return nil
+		default:
+			return ErrInvalidExportStream
+		}
+	}
+}
+
+// 对一条数据记录进行编码
+func encodeExportRecord(key, value []byte) []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen64*2+len(key)+len(value)+crc32.Size)
+	buf[0] = exportRecordKV
+	var index = 1
+	index += binary.PutUvarint(buf[index:], uint64(len(key)))
+	index += binary.PutUvarint(buf[index:], uint64(len(value)))
+	index += copy(buf[index:], key)
+	index += copy(buf[index:], value)
+	crc := crc32.ChecksumIEEE(buf[:index])
+	binary.LittleEndian.PutUint32(buf[index:], crc)
+	index += crc32.Size
+	return buf[:index]
+}
+
+// 读取一条数据记录(记录类型已经被读取),并校验 crc
+func readExportRecord(br *bufio.Reader) ([]byte, []byte, uint32, error) {
+	keySize, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, nil, 0, ErrInvalidExportStream
+	}
+	valueSize, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, nil, 0, ErrInvalidExportStream
+	}
+	if keySize > maxExportFieldSize || valueSize > maxExportFieldSize {
+		return nil, nil, 0, ErrInvalidExportStream
+	}
+	//长度可能是损坏的,随着读取的数据增长缓冲区,而不是按照长度一次分配
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, br, int64(keySize+valueSize+crc32.Size)); err != nil {
+		return nil, nil, 0, ErrInvalidExportStream
+	}
+	kvBuf := buf.Bytes()
+	key := kvBuf[:keySize]
+	value := kvBuf[keySize : keySize+valueSize]
+
+	//重新计算 crc
+	sizeBuf := make([]byte, 1+binary.MaxVarintLen64*2)
+	sizeBuf[0] = exportRecordKV
+	var index = 1
+	index += binary.PutUvarint(sizeBuf[index:], keySize)
+	index += binary.PutUvarint(sizeBuf[index:], valueSize)
+	crc := crc32.ChecksumIEEE(sizeBuf[:index])
+	crc = crc32.Update(crc, crc32.IEEETable, key)
+	crc = crc32.Update(crc, crc32.IEEETable, value)
+	if crc != binary.LittleEndian.Uint32(kvBuf[keySize+valueSize:]) {
+		return nil, nil, 0, ErrExportChecksumMismatch
+	}
+	return key, value, crc, nil
+}
@@ -0,0 +1,142 @@
+package bitcask
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask/utils"
+	"math"
+	"os"
+	"testing"
+)
+
+func TestDB_Export_Import(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	assert.NotNil(t, db)
+
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	// 被删除的数据不会被导出
+	err = db.Delete(utils.GetTestKey(10))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(200), nil)
+	assert.Nil(t, err)
+
+	for _, compress := range []bool{false, true} {
+		buf := new(bytes.Buffer)
+		exportOpts := DefaultExportOptions
+		exportOpts.Compress = compress
+		err = db.Export(buf, exportOpts)
+		assert.Nil(t, err)
+
+		// 导入到 b+ 树索引的实例中
+		opts2 := DefaultOptions
+		dir2, _ := os.MkdirTemp("", "bitcask-go-import")
+		opts2.DirPath = dir2
+		opts2.IndexType = BPlusTree
+		db2, err := Open(opts2)
+		assert.Nil(t, err)
+
+		err = db2.Import(buf)
+		assert.Nil(t, err)
+		assert.Equal(t, db.Stat().KeyNum, db2.Stat().KeyNum)
+
+		err = db.Fold(func(key []byte, value []byte) bool {
+			val, err := db2.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, value, val)
+			return true
+		})
+		assert.Nil(t, err)
+		_, err = db2.Get(utils.GetTestKey(10))
+		assert.Equal(t, ErrKeyNotFound, err)
+		destroyDB(db2)
+	}
+}
+
+func TestDB_Import_Corrupted(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-import-corrupted")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	buf := new(bytes.Buffer)
+	err = db.Export(buf, DefaultExportOptions)
+	assert.Nil(t, err)
+	stream := buf.Bytes()
+
+	// 格式不正确
+	err = db.Import(bytes.NewReader([]byte("hello world")))
+	assert.Equal(t, ErrInvalidExportStream, err)
+
+	// 数据被截断
+	err = db.Import(bytes.NewReader(stream[:len(stream)-10]))
+	assert.Equal(t, ErrInvalidExportStream, err)
+
+	// 数据被篡改
+	corrupted := append([]byte{}, stream...)
+	corrupted[20] ^= 0xff
+	err = db.Import(bytes.NewReader(corrupted))
+	assert.Equal(t, ErrExportChecksumMismatch, err)
+
+	// 记录的长度被篡改
+	for _, sizes := range [][2]uint64{{1 << 62, 10}, {10, math.MaxUint64}, {1 << 30, 1 << 30}} {
+		corrupted = append([]byte{}, stream[:len(exportMagic)+2]...)
+		corrupted = append(corrupted, exportRecordKV)
+		corrupted = binary.AppendUvarint(corrupted, sizes[0])
+		corrupted = binary.AppendUvarint(corrupted, sizes[1])
+		corrupted = append(corrupted, "key-value"...)
+		err = db.Import(bytes.NewReader(corrupted))
+		assert.Equal(t, ErrInvalidExportStream, err)
+	}
+}
+
+func TestDB_Import_Reopen_BPlusTree(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-export-reopen")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+	for i := 0; i < 10; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(24))
+		assert.Nil(t, err)
+	}
+	buf := new(bytes.Buffer)
+	err = db.Export(buf, DefaultExportOptions)
+	assert.Nil(t, err)
+
+	opts2 := DefaultOptions
+	dir2, _ := os.MkdirTemp("", "bitcask-go-import-reopen")
+	opts2.DirPath = dir2
+	opts2.IndexType = BPlusTree
+	db2, err := Open(opts2)
+	assert.Nil(t, err)
+	err = db2.Import(buf)
+	assert.Nil(t, err)
+	err = db2.Close()
+	assert.Nil(t, err)
+
+	// 重启之后数据仍然存在,并且可以继续写入
+	db3, err := Open(opts2)
+	defer destroyDB(db3)
+	assert.Nil(t, err)
+	val, err := db3.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotNil(t, val)
+	err = db3.Put(utils.GetTestKey(100), utils.RandomValue(24))
+	assert.Nil(t, err)
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"io"
+	"kv-go/bitcask"
+	"kv-go/bitcask/grpc/kvpb"
+)
+
+// Client bitcask gRPC 服务的客户端,服务端返回的错误会被还原为 bitcask 的错误,
+// 如 key 不存在时 Get 返回 bitcask.ErrKeyNotFound
+type Client struct {
+	conn *grpc.ClientConn //由 Dial 创建时在 Close 中关闭
+	kv   kvpb.KVClient
+}
+
+// Dial 连接 target 上的服务,opts 中需要指定传输的凭证,如 insecure.NewCredentials()
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, kv: kvpb.NewKVClient(conn)}, nil
+}
+
+// New 使用已经创建好的连接,Close 不会关闭这个连接
+func New(conn grpc.ClientConnInterface) *Client {
+	return &Client{kv: kvpb.NewKVClient(conn)}
+}
+
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+func (c *Client) Get(ctx context.Context, key []byte) ([]byte, error) {
+	resp, err := c.kv.Get(ctx, &kvpb.GetRequest{Key: key})
+	if err != nil {
+		return nil, kvpb.FromStatus(err)
+	}
+	return resp.Value, nil
+}
+
+func (c *Client) Put(ctx context.Context, key, value []byte) error {
+	_, err := c.kv.Put(ctx, &kvpb.PutRequest{Key: key, Value: value})
+	return kvpb.FromStatus(err)
+}
+
+func (c *Client) Delete(ctx context.Context, key []byte) error {
+	_, err := c.kv.Delete(ctx, &kvpb.DeleteRequest{Key: key})
+	return kvpb.FromStatus(err)
+}
+
+// MultiGet 返回的 value 和 keys 一一对应,不存在的 key 对应的 value 为空
+func (c *Client) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	resp, err := c.kv.MultiGet(ctx, &kvpb.MultiGetRequest{Keys: keys})
+	if err != nil {
+		return nil, kvpb.FromStatus(err)
+	}
+	values := make([][]byte, len(resp.Items))
+	for i, item := range resp.Items {
+		if item.Found {
+			//存在但是 value 为空时返回空的切片,和不存在的 key 区分开
+			values[i] = append([]byte{}, item.Value...)
+		}
+	}
+	return values, nil
+}
+
+// ScanOptions Scan 的范围,都为空时遍历所有的 key
+type ScanOptions struct {
+	Prefix   []byte
+	Start    []byte //包含 Start
+	End      []byte //不包含 End,为空时不限制
+	Limit    uint32 //为0时不限制
+	KeysOnly bool   //为 true 时 fn 的 value 为空
+}
+
+// Scan 按照 key 的顺序遍历范围内的数据,fn 返回 false 时停止
+func (c *Client) Scan(ctx context.Context, opts ScanOptions, fn func(key, value []byte) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	//提前停止时取消请求,服务端不再发送剩下的数据
+	defer cancel()
+	stream, err := c.kv.Scan(ctx, &kvpb.ScanRequest{
+		Prefix:   opts.Prefix,
+		Start:    opts.Start,
+		End:      opts.End,
+		Limit:    opts.Limit,
+		KeysOnly: opts.KeysOnly,
+	})
+	if err != nil {
+		return kvpb.FromStatus(err)
+	}
+	for {
+		item, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return kvpb.FromStatus(err)
+		}
+		if !fn(item.Key, item.Value) {
+			return nil
+		}
+	}
+}
+
+// Batch 暂存写入和删除,Commit 时原子地提交
+type Batch struct {
+	client     *Client
+	operations []*kvpb.BatchOperation
+	sync       bool
+}
+
+// NewBatch sync 为 true 时提交之后持久化到磁盘
+func (c *Client) NewBatch(sync bool) *Batch {
+	return &Batch{client: c, sync: sync}
+}
+
+func (b *Batch) Put(key, value []byte) {
+	b.operations = append(b.operations, &kvpb.BatchOperation{Type: kvpb.BatchOperation_PUT, Key: key, Value: value})
+}
+
+func (b *Batch) Delete(key []byte) {
+	b.operations = append(b.operations, &kvpb.BatchOperation{Type: kvpb.BatchOperation_DELETE, Key: key})
+}
+
+// Commit 提交暂存的操作,成功之后清空
+func (b *Batch) Commit(ctx context.Context) error {
+	if len(b.operations) == 0 {
+		return nil
+	}
+	_, err := b.client.kv.Batch(ctx, &kvpb.BatchRequest{Operations: b.operations, Sync: b.sync})
+	if err != nil {
+		return kvpb.FromStatus(err)
+	}
+	b.operations = nil
+	return nil
+}
+
+func (c *Client) Stat(ctx context.Context) (*bitcask.Stat, error) {
+	resp, err := c.kv.Stat(ctx, &kvpb.StatRequest{})
+	if err != nil {
+		return nil, kvpb.FromStatus(err)
+	}
+	return &bitcask.Stat{
+		KeyNum:      uint(resp.KeyNum),
+		DataFileNum: uint(resp.DataFileNum),
+		ReclaimSize: resp.ReclaimSize,
+		DisSize:     resp.DiskSize,
+	}, nil
+}
+
+func (c *Client) Merge(ctx context.Context) error {
+	_, err := c.kv.Merge(ctx, &kvpb.MergeRequest{})
+	return kvpb.FromStatus(err)
+}
+
+// Backup 备份数据到服务端备份根目录(-backup-dir)下的 dir 子目录,dir 必须是相对路径
+func (c *Client) Backup(ctx context.Context, dir string) error {
+	_, err := c.kv.Backup(ctx, &kvpb.BackupRequest{Dir: dir})
+	return kvpb.FromStatus(err)
+}
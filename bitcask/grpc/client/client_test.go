@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"kv-go/bitcask"
+	"kv-go/bitcask/grpc/server"
+	"kv-go/bitcask/utils"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 在内存中的 listener 上启动服务,backupDir 为备份的根目录
+func startTestServer(t *testing.T, opts bitcask.Options, backupDir string) (*Client, *bitcask.DB) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-grpc")
+	opts.DirPath = dir
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+
+	ln := bufconn.Listen(1 << 20)
+	grpcServer := grpc.NewServer()
+	server.New(db, backupDir).Register(grpcServer)
+	go func() {
+		_ = grpcServer.Serve(ln)
+	}()
+
+	cli, err := Dial("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		_ = cli.Close()
+		grpcServer.Stop()
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return cli, db
+}
+
+func TestClient_GetPutDelete(t *testing.T) {
+	cli, db := startTestServer(t, bitcask.DefaultOptions, "")
+	ctx := context.Background()
+
+	assert.Nil(t, cli.Put(ctx, []byte("k1"), []byte{0, 1, 2}))
+	value, err := cli.Get(ctx, []byte("k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, value)
+	// 写入的数据在服务端的 DB 中可见
+	value, err = db.Get([]byte("k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, value)
+
+	// 服务端的错误被还原为 bitcask 的错误
+	_, err = cli.Get(ctx, []byte("missing"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	assert.Equal(t, bitcask.ErrKeyIsEmpty, cli.Put(ctx, nil, []byte("v")))
+
+	assert.Nil(t, cli.Delete(ctx, []byte("k1")))
+	_, err = cli.Get(ctx, []byte("k1"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	assert.Nil(t, cli.Delete(ctx, []byte("k1")))
+
+	assert.Nil(t, cli.Put(ctx, []byte("empty"), nil))
+	values, err := cli.MultiGet(ctx, [][]byte{[]byte("empty"), []byte("missing")})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{{}, nil}, values)
+}
+
+func TestClient_Scan(t *testing.T) {
+	cli, _ := startTestServer(t, bitcask.DefaultOptions, "")
+	ctx := context.Background()
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, cli.Put(ctx, utils.GetTestKey(i), []byte{byte(i)}))
+	}
+	assert.Nil(t, cli.Put(ctx, []byte("other"), []byte("v")))
+
+	scan := func(opts ScanOptions, stopAt int) ([]string, [][]byte) {
+		var keys []string
+		var values [][]byte
+		err := cli.Scan(ctx, opts, func(key, value []byte) bool {
+			keys = append(keys, string(key))
+			values = append(values, value)
+			return len(keys) != stopAt
+		})
+		assert.Nil(t, err)
+		return keys, values
+	}
+
+	keys, values := scan(ScanOptions{Prefix: []byte("bitcask-go-key")}, -1)
+	assert.Equal(t, 20, len(keys))
+	assert.Equal(t, string(utils.GetTestKey(0)), keys[0])
+	assert.Equal(t, []byte{0}, values[0])
+
+	keys, values = scan(ScanOptions{Start: utils.GetTestKey(5), End: utils.GetTestKey(8), KeysOnly: true}, -1)
+	assert.Equal(t, []string{string(utils.GetTestKey(5)), string(utils.GetTestKey(6)), string(utils.GetTestKey(7))}, keys)
+	assert.Nil(t, values[0])
+
+	keys, _ = scan(ScanOptions{Limit: 3}, -1)
+	assert.Equal(t, 3, len(keys))
+	// fn 返回 false 时停止
+	keys, _ = scan(ScanOptions{}, 2)
+	assert.Equal(t, 2, len(keys))
+}
+
+func TestClient_BatchStatMergeBackup(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	opts.DataFileMergeRatio = 0
+	backupRoot, _ := os.MkdirTemp("", "bitcask-go-grpc-backup")
+	defer os.RemoveAll(backupRoot)
+	cli, _ := startTestServer(t, opts, backupRoot)
+	ctx := context.Background()
+
+	assert.Nil(t, cli.Put(ctx, []byte("old"), []byte("v")))
+	b := cli.NewBatch(true)
+	b.Put([]byte("a"), []byte("1"))
+	b.Put([]byte("b"), []byte("2"))
+	b.Delete([]byte("old"))
+	assert.Nil(t, b.Commit(ctx))
+	values, err := cli.MultiGet(ctx, [][]byte{[]byte("a"), []byte("b"), []byte("old")})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("1"), []byte("2"), nil}, values)
+
+	// 有无效的操作时整个批次都不会写入
+	b.Put([]byte("c"), []byte("3"))
+	b.Put(nil, []byte("4"))
+	assert.Equal(t, bitcask.ErrKeyIsEmpty, b.Commit(ctx))
+	_, err = cli.Get(ctx, []byte("c"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	stat, err := cli.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), stat.KeyNum)
+	assert.Equal(t, uint(1), stat.DataFileNum)
+	assert.True(t, stat.ReclaimSize > 0)
+	assert.True(t, stat.DisSize > 0)
+
+	assert.Nil(t, cli.Merge(ctx))
+
+	assert.Nil(t, cli.Backup(ctx, "daily/1"))
+	backupDir := filepath.Join(backupRoot, "daily", "1")
+	backupDB, err := bitcask.Open(bitcask.Options{DirPath: backupDir, DataFileSize: opts.DataFileSize, IndexType: bitcask.BTree})
+	assert.Nil(t, err)
+	defer backupDB.Close()
+	value, err := backupDB.Get([]byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), value)
+
+	// 只能备份到根目录下的子目录
+	outside := filepath.Join(filepath.Dir(backupRoot), filepath.Base(backupRoot)+"-outside")
+	defer os.RemoveAll(outside)
+	for _, dir := range []string{"", ".", "..", "../" + filepath.Base(outside), "daily/../../x", outside} {
+		err := cli.Backup(ctx, dir)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), dir)
+	}
+	_, err = os.Stat(outside)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestClient_BackupDisabled(t *testing.T) {
+	cli, _ := startTestServer(t, bitcask.DefaultOptions, "")
+	err := cli.Backup(context.Background(), "backup")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
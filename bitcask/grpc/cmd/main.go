@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"kv-go/bitcask"
+	"kv-go/bitcask/grpc/server"
+	"kv-go/bitcask/utils"
+	"log"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:50051", "gRPC 服务监听的地址")
+	dir := flag.String("dir", filepath.Join(os.TempDir(), "bitcask-go-grpc"), "数据目录")
+	syncWrites := flag.Bool("sync-writes", false, "每次写入之后持久化到磁盘")
+	certFile := flag.String("tls-cert-file", "", "TLS 证书文件,和 tls-key-file 一起设置时使用 TLS")
+	keyFile := flag.String("tls-key-file", "", "TLS 私钥文件")
+	caFile := flag.String("tls-ca-cert-file", "", "验证客户端证书的 CA 文件,设置之后要求客户端提供证书")
+	backupDir := flag.String("backup-dir", "", "Backup 写入的根目录,客户端只能指定其中的子目录,为空时不允许备份")
+	flag.Parse()
+
+	options := bitcask.DefaultOptions
+	options.DirPath = *dir
+	options.SyncWrites = *syncWrites
+	options.Logger = slog.Default()
+	db, err := bitcask.Open(options)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	tlsConfig, err := utils.NewServerTLSConfig(*certFile, *keyFile, *caFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var serverOpts []grpc.ServerOption
+	if tlsConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(serverOpts...)
+	server.New(db, *backupDir).Register(grpcServer)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	//收到 SIGINT 或者 SIGTERM 之后等待正在处理的请求完成,再关闭数据库
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		log.Println("bitcask grpc server running on", ln.Addr())
+		if err := grpcServer.Serve(ln); err != nil {
+			log.Println("serve failed:", err)
+		}
+		stop()
+	}()
+	<-ctx.Done()
+	stop()
+	grpcServer.GracefulStop()
+	if err := db.Close(); err != nil {
+		log.Println("close db failed:", err)
+	}
+}
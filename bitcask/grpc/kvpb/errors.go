@@ -0,0 +1,52 @@
+package kvpb
+
+import (
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"kv-go/bitcask"
+)
+
+// 存储引擎的错误和 gRPC 状态码的对应关系,客户端根据状态码和错误信息还原出相同的错误
+var errorCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{bitcask.ErrKeyNotFound, codes.NotFound},
+	{bitcask.ErrKeyIsEmpty, codes.InvalidArgument},
+	{bitcask.ErrExceedMaxBatchNum, codes.InvalidArgument},
+	{bitcask.ErrIsMerging, codes.Aborted},
+	{bitcask.ErrMergeRatioUnreached, codes.FailedPrecondition},
+	{bitcask.ErrNoEnoughSpace, codes.ResourceExhausted},
+	{bitcask.ErrDatabaseClosed, codes.Unavailable},
+}
+
+// ToStatus 把存储引擎返回的错误转换为 gRPC 的状态,其他的错误都是 INTERNAL
+func ToStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, e := range errorCodes {
+		if errors.Is(err, e.err) {
+			return status.Error(e.code, err.Error())
+		}
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// FromStatus 把 ToStatus 返回的状态还原为存储引擎的错误,无法还原时原样返回
+func FromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, e := range errorCodes {
+		if st.Code() == e.code && st.Message() == e.err.Error() {
+			return e.err
+		}
+	}
+	return err
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"kv-go/bitcask"
+	"kv-go/bitcask/grpc/kvpb"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	errEmptyBackupDir   = status.Error(codes.InvalidArgument, "backup dir is empty")
+	errInvalidBackupDir = status.Error(codes.InvalidArgument, "backup dir must be a relative path inside the backup root")
+	errBackupDisabled   = status.Error(codes.FailedPrecondition, "backup is disabled, no backup root is configured")
+	errInvalidBatchOp   = status.Error(codes.InvalidArgument, "unknown batch operation type")
+)
+
+// Scan 每次从索引中读取的 key 的数量
+const scanPageSize = 256
+
+// Server 在 gRPC 上提供 bitcask.DB 的接口
+type Server struct {
+	kvpb.UnimplementedKVServer
+	db        *bitcask.DB
+	backupDir string //备份的根目录,为空时不允许备份
+}
+
+// New 创建服务,Backup 只能备份到 backupDir 下的子目录,backupDir 为空时拒绝备份
+func New(db *bitcask.DB, backupDir string) *Server {
+	return &Server{db: db, backupDir: backupDir}
+}
+
+// Register 把服务注册到 gRPC 服务中
+func (s *Server) Register(registrar grpc.ServiceRegistrar) {
+	kvpb.RegisterKVServer(registrar, s)
+}
+
+func (s *Server) Get(ctx context.Context, req *kvpb.GetRequest) (*kvpb.GetResponse, error) {
+	value, err := s.db.Get(req.Key)
+	if err != nil {
+		return nil, kvpb.ToStatus(err)
+	}
+	return &kvpb.GetResponse{Value: value}, nil
+}
+
+func (s *Server) Put(ctx context.Context, req *kvpb.PutRequest) (*kvpb.PutResponse, error) {
+	if err := s.db.Put(req.Key, req.Value); err != nil {
+		return nil, kvpb.ToStatus(err)
+	}
+	return &kvpb.PutResponse{}, nil
+}
+
+func (s *Server) Delete(ctx context.Context, req *kvpb.DeleteRequest) (*kvpb.DeleteResponse, error) {
+	if err := s.db.Delete(req.Key); err != nil {
+		return nil, kvpb.ToStatus(err)
+	}
+	return &kvpb.DeleteResponse{}, nil
+}
+
+func (s *Server) MultiGet(ctx context.Context, req *kvpb.MultiGetRequest) (*kvpb.MultiGetResponse, error) {
+	items := make([]*kvpb.KeyValue, len(req.Keys))
+	for i, key := range req.Keys {
+		value, err := s.db.Get(key)
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, kvpb.ToStatus(err)
+		}
+		items[i] = &kvpb.KeyValue{Key: key, Value: value, Found: err == nil}
+	}
+	return &kvpb.MultiGetResponse{Items: items}, nil
+}
+
+func (s *Server) Scan(req *kvpb.ScanRequest, stream grpc.ServerStreamingServer[kvpb.KeyValue]) error {
+	//前缀由下面的循环判断,迭代器的 Prefix 在 Seek 到前缀之外时会一直遍历到最后
+	//每次只从索引中读取一页 key,不拷贝整个索引
+	iterOpts := bitcask.DefaultIteratorOptions
+	iterOpts.PageSize = scanPageSize
+	iter := s.db.NewIterator(iterOpts)
+	defer iter.Close()
+	seek := req.Prefix
+	if bytes.Compare(req.Start, seek) > 0 {
+		seek = req.Start
+	}
+	iter.Seek(seek)
+
+	var sent uint32
+	for ; iter.Valid(); iter.Next() {
+		if req.Limit > 0 && sent == req.Limit {
+			break
+		}
+		key := iter.Key()
+		//前缀相同的 key 是连续的,超出前缀之后直接结束
+		if !bytes.HasPrefix(key, req.Prefix) || (len(req.End) > 0 && bytes.Compare(key, req.End) >= 0) {
+			break
+		}
+		item := &kvpb.KeyValue{Key: key}
+		if !req.KeysOnly {
+			value, err := iter.Value()
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				//遍历的过程中被删除了
+				continue
+			}
+			if err != nil {
+				return kvpb.ToStatus(err)
+			}
+			item.Value = value
+		}
+		//客户端断开或者取消之后 Send 返回错误
+		if err := stream.Send(item); err != nil {
+			return err
+		}
+		sent++
+	}
+	return nil
+}
+
+func (s *Server) Batch(ctx context.Context, req *kvpb.BatchRequest) (*kvpb.BatchResponse, error) {
+	opts := bitcask.DefaultWriteBatchOptions
+	opts.SyncWrites = req.Sync
+	wb := s.db.NewWriteBatch(opts)
+	for _, op := range req.Operations {
+		var err error
+		switch op.Type {
+		case kvpb.BatchOperation_PUT:
+			err = wb.Put(op.Key, op.Value)
+		case kvpb.BatchOperation_DELETE:
+			err = wb.Delete(op.Key)
+		default:
+			return nil, errInvalidBatchOp
+		}
+		if err != nil {
+			return nil, kvpb.ToStatus(err)
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		return nil, kvpb.ToStatus(err)
+	}
+	return &kvpb.BatchResponse{}, nil
+}
+
+func (s *Server) Stat(ctx context.Context, req *kvpb.StatRequest) (*kvpb.StatResponse, error) {
+	stat := s.db.Stat()
+	return &kvpb.StatResponse{
+		KeyNum:      uint64(stat.KeyNum),
+		DataFileNum: uint64(stat.DataFileNum),
+		ReclaimSize: stat.ReclaimSize,
+		DiskSize:    stat.DisSize,
+	}, nil
+}
+
+func (s *Server) Merge(ctx context.Context, req *kvpb.MergeRequest) (*kvpb.MergeResponse, error) {
+	if err := s.db.Merge(); err != nil {
+		return nil, kvpb.ToStatus(err)
+	}
+	return &kvpb.MergeResponse{}, nil
+}
+
+// 备份到服务端备份根目录下的子目录,子目录的名字由调用方指定
+func (s *Server) Backup(ctx context.Context, req *kvpb.BackupRequest) (*kvpb.BackupResponse, error) {
+	dir, err := s.backupPath(req.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Backup(dir); err != nil {
+		return nil, kvpb.ToStatus(err)
+	}
+	return &kvpb.BackupResponse{}, nil
+}
+
+// 把调用方指定的相对路径转换为备份根目录下的路径,拒绝绝对路径和跳出根目录的路径
+func (s *Server) backupPath(name string) (string, error) {
+	if s.backupDir == "" {
+		return "", errBackupDisabled
+	}
+	if name == "" {
+		return "", errEmptyBackupDir
+	}
+	if !filepath.IsLocal(name) || filepath.Clean(name) == "." {
+		return "", errInvalidBackupDir
+	}
+	root := filepath.Clean(s.backupDir)
+	dir := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errInvalidBackupDir
+	}
+	return dir, nil
+}
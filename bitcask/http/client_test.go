@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"kv-go/bitcask/client"
+	"kv-go/bitcask/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestHTTPClient(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-http-client")
+	opts.DirPath = dir
+	var err error
+	db, err = bitcask.Open(opts)
+	assert.Nil(t, err)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bitcask/status", handleStatus)
+	mux.Handle("/v2/", newAPIV2(db))
+	srv := httptest.NewServer(mux)
+	defer func() {
+		srv.Close()
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	}()
+
+	cli, err := client.NewHTTP(srv.URL, client.DefaultOptions)
+	assert.Nil(t, err)
+	defer cli.Close()
+	var kv client.KV = cli
+	ctx := context.Background()
+
+	// 二进制的 key 和 value
+	key := []byte{'a', '/', 0, 0xff, '?'}
+	assert.Nil(t, kv.Put(ctx, key, []byte{0, 1, 2}))
+	value, err := kv.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, value)
+	value, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, value)
+	_, err = kv.Get(ctx, []byte("missing"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	assert.Nil(t, kv.Delete(ctx, key))
+	assert.Nil(t, kv.Delete(ctx, key))
+	assert.Equal(t, bitcask.ErrKeyIsEmpty, kv.Put(ctx, nil, []byte("v")))
+
+	// 超过一页的数据
+	wb := kv.NewWriteBatch()
+	for i := 0; i < 1500; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), []byte{byte(i)}))
+	}
+	assert.Nil(t, wb.Commit(ctx))
+	keys, err := kv.ListKeys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500, len(keys))
+	var count int
+	assert.Nil(t, kv.Fold(ctx, func(key, value []byte) bool {
+		assert.Equal(t, utils.GetTestKey(count), key)
+		assert.Equal(t, []byte{byte(count)}, value)
+		count++
+		return count < 1200
+	}))
+	assert.Equal(t, 1200, count)
+
+	stat, err := kv.Stat(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, uint(1500), stat.KeyNum)
+	assert.True(t, stat.DisSize > 0)
+}
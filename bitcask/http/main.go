@@ -1,27 +1,41 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"kv-go/bitcask"
+	"kv-go/bitcask/metrics"
+	"kv-go/bitcask/utils"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 )
 
 var db *bitcask.DB
 
-func init() {
-	//初始化 DB 实例
-	var err error
-	option := bitcask.DefaultOptions
-	dir, _ := os.MkdirTemp("", "bitcask-go-http")
+// 在 /metrics 上以 Prometheus 格式导出的指标
+var collector = metrics.NewCollector()
 
+// 初始化 DB 实例
+func openDB(dir string) (*bitcask.DB, error) {
+	option := bitcask.DefaultOptions
 	option.DirPath = dir
-	db, err = bitcask.Open(option)
+	option.Metrics = collector.Metrics("default")
+	option.Logger = slog.Default()
+	db, err := bitcask.Open(option)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	collector.AddDatabase("default", db.Stat)
+	return db, nil
 }
 
 func handePut(w http.ResponseWriter, r *http.Request) {
@@ -32,12 +46,14 @@ func handePut(w http.ResponseWriter, r *http.Request) {
 	var data map[string]string
 	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	for key, value := range data {
 		if err := db.Put([]byte(key), []byte(value)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			log.Printf("fail to put value in db:%v\n", err)
+			return
 		}
 
 	}
@@ -45,6 +61,7 @@ func handePut(w http.ResponseWriter, r *http.Request) {
 func handeGet(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 	key := r.URL.Query().Get("key")
 	value, err := db.Get([]byte(key))
@@ -59,6 +76,7 @@ func handeGet(w http.ResponseWriter, r *http.Request) {
 func handeDelete(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 	key := r.URL.Query().Get("key")
 	err := db.Delete([]byte(key))
@@ -93,7 +111,27 @@ func handleStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("content-type", "application/json")
 	_ = json.NewEncoder(w).Encode(stat)
 }
+
+// 在 ln 上提供服务,设置了 TLSConfig 时使用 HTTPS,证书来自 TLSConfig
+func serve(server *http.Server, ln net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(ln, "", "")
+	}
+	return server.Serve(ln)
+}
+
 func main() {
+	addr := flag.String("addr", "localhost:8080", "http 服务监听的地址")
+	dir := flag.String("dir", filepath.Join(os.TempDir(), "bitcask-go-http"), "数据目录")
+	certFile := flag.String("tls-cert-file", "", "TLS 证书文件,和 tls-key-file 一起设置时使用 HTTPS")
+	keyFile := flag.String("tls-key-file", "", "TLS 私钥文件")
+	caFile := flag.String("tls-ca-cert-file", "", "验证客户端证书的 CA 文件,设置之后要求客户端提供证书")
+	flag.Parse()
+
+	var err error
+	if db, err = openDB(*dir); err != nil {
+		log.Fatalln(err)
+	}
 
 	//注册处理方法
 	http.HandleFunc("/bitcask/put", handePut)
@@ -101,6 +139,36 @@ func main() {
 	http.HandleFunc("/bitcask/delete", handeDelete)
 	http.HandleFunc("/bitcask/list", handeList)
 	http.HandleFunc("/bitcask/status", handleStatus)
-	//启动http服务
-	http.ListenAndServe("localhost:8080", nil)
+	http.Handle("/metrics", collector)
+	//v2 接口,见 v2.go
+	http.Handle("/v2/", newAPIV2(db))
+
+	tlsConfig, err := utils.NewServerTLSConfig(*certFile, *keyFile, *caFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	//启动http服务,配置了证书时使用 HTTPS
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	server := &http.Server{TLSConfig: tlsConfig}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		err := serve(server, ln)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Println("listen failed:", err)
+		}
+		stop()
+	}()
+	<-ctx.Done()
+	stop()
+
+	//收到 SIGINT 或者 SIGTERM 之后等待正在处理的请求完成,再关闭数据库
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_ = server.Shutdown(shutdownCtx)
+	if err := db.Close(); err != nil {
+		log.Println("close db failed:", err)
+	}
 }
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"kv-go/bitcask/utils"
+	"kv-go/bitcask/utils/certtest"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+)
+
+// 使用 main 中相同的方式启动 HTTPS 服务
+func startTestTLSServer(t *testing.T, tlsConfig *tls.Config) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bitcask/status", handleStatus)
+	server := &http.Server{Handler: mux, TLSConfig: tlsConfig}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		_ = serve(server, ln)
+	}()
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+	return "https://" + ln.Addr().String() + "/bitcask/status"
+}
+
+// cert 不为空时总是发送这个客户端证书,即使它不是由服务端要求的 CA 签发的
+func newTLSClient(t *testing.T, caFile string, cert *tls.Certificate) *http.Client {
+	pool, err := utils.LoadCertPool(caFile)
+	assert.Nil(t, err)
+	config := &tls.Config{RootCAs: pool}
+	if cert != nil {
+		config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cert, nil
+		}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func TestServe_TLS(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-http-tls")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	var err error
+	db, err = bitcask.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	certDir, _ := os.MkdirTemp("", "bitcask-go-http-certs")
+	defer os.RemoveAll(certDir)
+	serverCert, serverKey, err := certtest.GenerateSelfSignedCert(certDir, "server")
+	assert.Nil(t, err)
+	clientCert, clientKey, err := certtest.GenerateSelfSignedCert(certDir, "client")
+	assert.Nil(t, err)
+	otherCert, otherKey, err := certtest.GenerateSelfSignedCert(certDir, "other")
+	assert.Nil(t, err)
+	clientPair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	assert.Nil(t, err)
+	otherPair, err := tls.LoadX509KeyPair(otherCert, otherKey)
+	assert.Nil(t, err)
+
+	// 只配置服务端证书时使用 HTTPS,不要求客户端证书
+	tlsConfig, err := utils.NewServerTLSConfig(serverCert, serverKey, "")
+	assert.Nil(t, err)
+	url := startTestTLSServer(t, tlsConfig)
+	resp, err := newTLSClient(t, serverCert, nil).Get(url)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	// 不信任服务端证书的客户端无法连接
+	_, err = http.Get(url)
+	assert.NotNil(t, err)
+
+	// 双向 TLS: 只接受 CA 签发的客户端证书
+	tlsConfig, err = utils.NewServerTLSConfig(serverCert, serverKey, clientCert)
+	assert.Nil(t, err)
+	url = startTestTLSServer(t, tlsConfig)
+	_, err = newTLSClient(t, serverCert, nil).Get(url)
+	assert.NotNil(t, err)
+	_, err = newTLSClient(t, serverCert, &otherPair).Get(url)
+	assert.NotNil(t, err)
+	resp, err = newTLSClient(t, serverCert, &clientPair).Get(url)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
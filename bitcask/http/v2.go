@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"kv-go/bitcask"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+	//PUT 和批量写入的请求体的最大长度
+	maxBodySize = 64 << 20
+)
+
+var (
+	errInvalidEncoding = errors.New("encoding must be utf8 or base64")
+	errInvalidLimit    = errors.New("limit must be an integer between 1 and 1000")
+	errInvalidCursor   = errors.New("invalid cursor")
+	errInvalidBatchOp  = errors.New("op must be put or delete")
+)
+
+// v2 接口,key 在路径中(二进制的 key 使用百分号编码),value 是原始的请求体和响应体,
+// 请求参数 encoding=base64 时 value、JSON 中的 key 和 value、prefix/start/end 都使用 base64 编码
+type apiV2 struct {
+	db *bitcask.DB
+}
+
+func newAPIV2(db *bitcask.DB) http.Handler {
+	api := &apiV2{db: db}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/keys/{key...}", api.getKey)
+	mux.HandleFunc("PUT /v2/keys/{key...}", api.putKey)
+	mux.HandleFunc("DELETE /v2/keys/{key...}", api.deleteKey)
+	mux.HandleFunc("GET /v2/keys", api.listKeys)
+	mux.HandleFunc("POST /v2/batch", api.batch)
+	return mux
+}
+
+// 错误统一以 JSON 返回
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// 存储引擎返回的错误,key 为空是客户端的错误,其他的是服务端的错误
+func writeDBError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, bitcask.ErrKeyIsEmpty), errors.Is(err, bitcask.ErrExceedMaxBatchNum):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		log.Printf("fail to access db:%v\n", err)
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+// 请求中 key 和 value 的编码,默认是 utf8,也就是原样使用
+type encoding bool
+
+const (
+	encodingUTF8   encoding = false
+	encodingBase64 encoding = true
+)
+
+func parseEncoding(r *http.Request) (encoding, error) {
+	switch r.URL.Query().Get("encoding") {
+	case "", "utf8":
+		return encodingUTF8, nil
+	case "base64":
+		return encodingBase64, nil
+	default:
+		return encodingUTF8, errInvalidEncoding
+	}
+}
+
+func (e encoding) encode(b []byte) string {
+	if e == encodingBase64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return string(b)
+}
+
+func (e encoding) decode(s string) ([]byte, error) {
+	if e == encodingBase64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return []byte(s), nil
+}
+
+// GET /v2/keys/{key}
+func (api *apiV2) getKey(w http.ResponseWriter, r *http.Request) {
+	enc, err := parseEncoding(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	value, err := api.db.Get([]byte(r.PathValue("key")))
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if enc == encodingBase64 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = io.WriteString(w, enc.encode(value))
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(value)))
+	_, _ = w.Write(value)
+}
+
+// PUT /v2/keys/{key},请求体就是 value
+func (api *apiV2) putKey(w http.ResponseWriter, r *http.Request) {
+	enc, err := parseEncoding(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	value := body
+	if enc == encodingBase64 {
+		if value, err = enc.decode(string(bytes.TrimSpace(body))); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := api.db.Put([]byte(r.PathValue("key")), value); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /v2/keys/{key},key 不存在时返回 404
+func (api *apiV2) deleteKey(w http.ResponseWriter, r *http.Request) {
+	key := []byte(r.PathValue("key"))
+	if _, err := api.db.Get(key); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if err := api.db.Delete(key); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type keyValue struct {
+	Key   string  `json:"key"`
+	Value *string `json:"value,omitempty"`
+}
+
+type listResponse struct {
+	Items []keyValue `json:"items"`
+	//不为空时表示还有数据,作为下一页请求的 cursor 参数
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// GET /v2/keys?prefix=&start=&end=&limit=&cursor=&values=true
+// 按照 key 的顺序返回前缀为 prefix 并且在 [start, end) 之间的 key,
+// cursor 是上一页返回的 next_cursor,values=true 时同时返回 value
+func (api *apiV2) listKeys(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	enc, err := parseEncoding(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var prefix, start, end []byte
+	for _, param := range []struct {
+		name string
+		dst  *[]byte
+	}{{"prefix", &prefix}, {"start", &start}, {"end", &end}} {
+		if *param.dst, err = enc.decode(query.Get(param.name)); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	limit := defaultListLimit
+	if s := query.Get("limit"); s != "" {
+		if limit, err = strconv.Atoi(s); err != nil || limit < 1 || limit > maxListLimit {
+			writeError(w, http.StatusBadRequest, errInvalidLimit)
+			return
+		}
+	}
+	//cursor 是上一页最后一个 key,这一页从它之后开始
+	var after []byte
+	if s := query.Get("cursor"); s != "" {
+		if after, err = base64.RawURLEncoding.DecodeString(s); err != nil {
+			writeError(w, http.StatusBadRequest, errInvalidCursor)
+			return
+		}
+	}
+	withValues := query.Get("values") == "true"
+
+	//前缀由下面的循环判断,迭代器的 Prefix 在 Seek 到前缀之外时会一直遍历到最后
+	//一页最多需要 limit 个 key 加上 cursor 本身和判断是否还有下一页的一个 key
+	iterOpts := bitcask.DefaultIteratorOptions
+	iterOpts.PageSize = limit + 2
+	iter := api.db.NewIterator(iterOpts)
+	defer iter.Close()
+	seek := prefix
+	if bytes.Compare(start, seek) > 0 {
+		seek = start
+	}
+	if bytes.Compare(after, seek) > 0 {
+		seek = after
+	}
+	iter.Seek(seek)
+
+	res := listResponse{Items: []keyValue{}}
+	var last []byte
+	for ; iter.Valid(); iter.Next() {
+		key := iter.Key()
+		//前缀相同的 key 是连续的,超出前缀之后直接结束
+		if !bytes.HasPrefix(key, prefix) || (len(end) > 0 && bytes.Compare(key, end) >= 0) {
+			break
+		}
+		if after != nil && bytes.Equal(key, after) {
+			continue
+		}
+		if len(res.Items) == limit {
+			res.NextCursor = base64.RawURLEncoding.EncodeToString(last)
+			break
+		}
+		item := keyValue{Key: enc.encode(key)}
+		if withValues {
+			value, err := iter.Value()
+			if errors.Is(err, bitcask.ErrKeyNotFound) {
+				//遍历的过程中被删除了
+				continue
+			}
+			if err != nil {
+				writeDBError(w, err)
+				return
+			}
+			encValue := enc.encode(value)
+			item.Value = &encValue
+		}
+		res.Items = append(res.Items, item)
+		last = key
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+type batchOperation struct {
+	Op    string `json:"op"`
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type batchRequest struct {
+	Operations []batchOperation `json:"operations"`
+}
+
+// POST /v2/batch,所有的操作在一个 Writebatch 中原子地提交
+func (api *apiV2) batch(w http.ResponseWriter, r *http.Request) {
+	enc, err := parseEncoding(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	var req batchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	wb := api.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+	for _, op := range req.Operations {
+		key, err := enc.decode(op.Key)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		switch op.Op {
+		case "put":
+			var value []byte
+			if value, err = enc.decode(op.Value); err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			err = wb.Put(key, value)
+		case "delete":
+			err = wb.Delete(key)
+		default:
+			err = errInvalidBatchOp
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"applied": len(req.Operations)})
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"kv-go/bitcask"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func startTestAPIV2(t *testing.T) *httptest.Server {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-http-v2")
+	opts.DirPath = dir
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	srv := httptest.NewServer(newAPIV2(db))
+	t.Cleanup(func() {
+		srv.Close()
+		_ = db.Close()
+		_ = os.RemoveAll(dir)
+	})
+	return srv
+}
+
+func doRequest(t *testing.T, method, url string, body io.Reader) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, body)
+	assert.Nil(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp, data
+}
+
+func TestAPIV2_Keys(t *testing.T) {
+	srv := startTestAPIV2(t)
+
+	// 二进制的 value 原样保存
+	value := []byte{0, 1, 0xff, '\n'}
+	resp, _ := doRequest(t, http.MethodPut, srv.URL+"/v2/keys/a/b", bytes.NewReader(value))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body := doRequest(t, http.MethodGet, srv.URL+"/v2/keys/a/b", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/octet-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, value, body)
+	resp, body = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/a/b?encoding=base64", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(value), string(body))
+
+	// 二进制的 key 使用百分号编码
+	resp, _ = doRequest(t, http.MethodPut, srv.URL+"/v2/keys/%00%FF?encoding=base64", strings.NewReader("aGVsbG8="))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, body = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/%00%FF", nil)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello", string(body))
+	resp, _ = doRequest(t, http.MethodPut, srv.URL+"/v2/keys/x?encoding=base64", strings.NewReader("!!"))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/a/b?encoding=hex", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// 不存在的 key 返回 404
+	resp, body = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/missing", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), bitcask.ErrKeyNotFound.Error())
+	resp, _ = doRequest(t, http.MethodDelete, srv.URL+"/v2/keys/a/b", nil)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/a/b", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodDelete, srv.URL+"/v2/keys/a/b", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+"/v2/keys/a", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestAPIV2_List(t *testing.T) {
+	srv := startTestAPIV2(t)
+	for i := 0; i < 25; i++ {
+		resp, _ := doRequest(t, http.MethodPut, fmt.Sprintf("%s/v2/keys/user:%02d", srv.URL, i),
+			strings.NewReader(fmt.Sprintf("v%d", i)))
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+	resp, _ := doRequest(t, http.MethodPut, srv.URL+"/v2/keys/order:1", strings.NewReader("o"))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	list := func(query url.Values) listResponse {
+		resp, body := doRequest(t, http.MethodGet, srv.URL+"/v2/keys?"+query.Encode(), nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		var res listResponse
+		assert.Nil(t, json.Unmarshal(body, &res))
+		return res
+	}
+
+	// 分页遍历前缀相同的 key
+	var keys []string
+	query := url.Values{"prefix": {"user:"}, "limit": {"10"}}
+	for pages := 0; ; pages++ {
+		res := list(query)
+		for _, item := range res.Items {
+			keys = append(keys, item.Key)
+		}
+		if res.NextCursor == "" {
+			assert.Equal(t, 2, pages)
+			break
+		}
+		query.Set("cursor", res.NextCursor)
+	}
+	assert.Equal(t, 25, len(keys))
+	assert.Equal(t, "user:00", keys[0])
+	assert.Equal(t, "user:24", keys[24])
+
+	// 范围和 value
+	res := list(url.Values{"start": {"user:05"}, "end": {"user:08"}, "values": {"true"}})
+	assert.Equal(t, 3, len(res.Items))
+	assert.Equal(t, "user:05", res.Items[0].Key)
+	assert.Equal(t, "v7", *res.Items[2].Value)
+	assert.Empty(t, res.NextCursor)
+
+	res = list(url.Values{"prefix": {base64.StdEncoding.EncodeToString([]byte("order:"))}, "encoding": {"base64"}})
+	assert.Equal(t, 1, len(res.Items))
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("order:1")), res.Items[0].Key)
+	assert.Nil(t, res.Items[0].Value)
+
+	res = list(url.Values{"prefix": {"none"}})
+	assert.NotNil(t, res.Items)
+	assert.Equal(t, 0, len(res.Items))
+
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+"/v2/keys?limit=0", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+"/v2/keys?cursor=***", nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAPIV2_Batch(t *testing.T) {
+	srv := startTestAPIV2(t)
+	resp, _ := doRequest(t, http.MethodPut, srv.URL+"/v2/keys/old", strings.NewReader("v"))
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, body := doRequest(t, http.MethodPost, srv.URL+"/v2/batch", strings.NewReader(
+		`{"operations":[{"op":"put","key":"k1","value":"v1"},{"op":"put","key":"k2","value":"v2"},{"op":"delete","key":"old"}]}`))
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"applied":3}`, string(body))
+	_, body = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/k2", nil)
+	assert.Equal(t, "v2", string(body))
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/old", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// 有无效的操作时整个批次都不会写入
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+"/v2/batch", strings.NewReader(
+		`{"operations":[{"op":"put","key":"k3","value":"v3"},{"op":"incr","key":"k1"}]}`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodGet, srv.URL+"/v2/keys/k3", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+"/v2/batch", strings.NewReader(
+		`{"operations":[{"op":"put","key":"","value":"v"}]}`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, _ = doRequest(t, http.MethodPost, srv.URL+"/v2/batch", strings.NewReader(`not json`))
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -1,7 +1,6 @@
 package index
 
 import (
-	"bytes"
 	"github.com/google/btree"
 	"kv-go/bitcask/data"
 	"sort"
@@ -12,48 +11,64 @@ import (
 //主要封装谷歌的btree库
 
 type Btree struct {
-	tree *btree.BTree
-	lock *sync.RWMutex //由于这个Write operations are not safe for concurrent mutation by multiple,所以要进行加锁保护
+	tree    *btree.BTreeG[*Item]
+	lock    *sync.RWMutex //由于这个Write operations are not safe for concurrent mutation by multiple,所以要进行加锁保护
+	compare Comparator    //key 的排序规则
 }
 
 func NewBtree() *Btree {
+	return NewBtreeWithComparator(nil)
+}
+
+// NewBtreeWithComparator 使用自定义的比较函数决定 key 的顺序,为空时按字节序
+func NewBtreeWithComparator(compare Comparator) *Btree {
+	if compare == nil {
+		compare = DefaultComparator
+	}
+	less := func(a, b *Item) bool {
+		//使用指针避免拷贝大对象
+		return compare(a.key, b.key) < 0
+	}
 	return &Btree{
-		tree: btree.New(32), //控制叶子节点的数量，可以后期让用户进行选择
-		lock: new(sync.RWMutex),
+		tree:    btree.NewG[*Item](32, less), //控制叶子节点的数量，可以后期让用户进行选择
+		lock:    new(sync.RWMutex),
+		compare: compare,
 	}
 }
 func (bt *Btree) Put(key []byte, pos *data.LogRecordPos) *data.LogRecordPos {
 	it := Item{key: key, pos: pos}
 	bt.lock.Lock()
-	oldItem := bt.tree.ReplaceOrInsert(&it) //ReplaceOrInsert 方法：这是 btree 包提供的标准方法，用于插入或更新键值对。
+	oldItem, ok := bt.tree.ReplaceOrInsert(&it) //ReplaceOrInsert 方法：这是 btree 包提供的标准方法，用于插入或更新键值对。
 	//如果二叉树中已经存在相同的键，则替换其对应的值。
 	//如果键不存在，则插入新的键值对
 	bt.lock.Unlock()
-	if oldItem == nil {
+	if !ok {
 		return nil
 	}
-	return oldItem.(*Item).pos
+	return oldItem.pos
 
 }
 func (bt *Btree) Get(key []byte) *data.LogRecordPos {
 	it := &Item{
 		key: key,
 	}
-	btreeItem := bt.tree.Get(it)
-	if btreeItem == nil {
+	bt.lock.RLock()
+	btreeItem, ok := bt.tree.Get(it)
+	bt.lock.RUnlock()
+	if !ok {
 		return nil
 	}
-	return btreeItem.(*Item).pos
+	return btreeItem.pos
 } //拿到索引的位置信息
 func (bt *Btree) Delete(key []byte) (*data.LogRecordPos, bool) {
 	it := &Item{key: key}
 	bt.lock.Lock()
-	oldItem := bt.tree.Delete(it)
+	oldItem, ok := bt.tree.Delete(it)
 	bt.lock.Unlock()
-	if oldItem == nil {
+	if !ok {
 		return nil, false
 	}
-	return oldItem.(*Item).pos, true
+	return oldItem.pos, true
 
 }
 func (bt *Btree) Iterator(reverse bool) Iterator {
@@ -63,9 +78,11 @@ func (bt *Btree) Iterator(reverse bool) Iterator {
 	bt.lock.RLock()
 	defer bt.lock.RUnlock()
 
-	return newBtreeIterator(bt.tree, reverse)
+	return newBtreeIterator(bt.tree, reverse, bt.compare)
 }
 func (bt *Btree) Size() int {
+	bt.lock.RLock()
+	defer bt.lock.RUnlock()
 	return bt.tree.Len()
 }
 func (bt *Btree) Close() error {
@@ -80,18 +97,21 @@ type btreeIterator struct {
 	//是否反向
 	reverse bool
 
+	//key 的排序规则,Seek 时使用
+	compare Comparator
+
 	value []*Item //key+位置索引信息
 }
 
 // 这里的迭代器没有面向用户
-func newBtreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
+func newBtreeIterator(tree *btree.BTreeG[*Item], reverse bool, compare Comparator) *btreeIterator {
 	var idx int
 	value := make([]*Item, tree.Len())
 
 	//将所有的数据存放到数组中
-	saveValues := func(it btree.Item) bool {
+	saveValues := func(it *Item) bool {
 
-		value[idx] = it.(*Item)
+		value[idx] = it
 		idx++
 		return true
 	}
@@ -103,6 +123,7 @@ func newBtreeIterator(tree *btree.BTree, reverse bool) *btreeIterator {
 	return &btreeIterator{
 		currIndex: 0,
 		reverse:   reverse,
+		compare:   compare,
 		value:     value,
 	}
 }
@@ -116,11 +137,11 @@ func (bti *btreeIterator) Seek(key []byte) {
 	//二分查找
 	if bti.reverse {
 		bti.currIndex = sort.Search(len(bti.value), func(i int) bool {
-			return bytes.Compare(bti.value[i].key, key) <= 0
+			return bti.compare(bti.value[i].key, key) <= 0
 		})
 	} else {
 		bti.currIndex = sort.Search(len(bti.value), func(i int) bool {
-			return bytes.Compare(bti.value[i].key, key) >= 0
+			return bti.compare(bti.value[i].key, key) >= 0
 		})
 	}
 }
@@ -151,3 +172,90 @@ func (bti *btreeIterator) Value() *data.LogRecordPos {
 func (bti *btreeIterator) Close() {
 	bti.value = nil
 }
+
+// RangeIterator 通过 AscendGreaterOrEqual 每次只读取一页数据,一页遍历完之后从最后一个 key 之后继续读取
+func (bt *Btree) RangeIterator(reverse bool, pageSize int) Iterator {
+	iter := &btreeRangeIterator{
+		bt:       bt,
+		reverse:  reverse,
+		pageSize: max(pageSize, 1),
+	}
+	iter.load(nil, true)
+	return iter
+}
+
+// btree索引的分批迭代器,只保存当前一页的数据
+type btreeRangeIterator struct {
+	bt       *Btree
+	reverse  bool
+	pageSize int
+	page     []*Item
+	idx      int
+	more     bool //当前页之后是否还有数据
+}
+
+// 从 key 开始读取一页数据,key 为空时从第一个(反向时为最后一个) key 开始,inclusive 表示是否包含 key 本身
+func (bri *btreeRangeIterator) load(key []byte, inclusive bool) {
+	bri.page = make([]*Item, 0, bri.pageSize)
+	bri.idx = 0
+	bri.more = false
+	collect := func(it *Item) bool {
+		if !inclusive && bri.bt.compare(it.key, key) == 0 {
+			return true
+		}
+		if len(bri.page) == bri.pageSize {
+			bri.more = true
+			return false
+		}
+		bri.page = append(bri.page, it)
+		return true
+	}
+	bri.bt.lock.RLock()
+	defer bri.bt.lock.RUnlock()
+	switch {
+	case key == nil && bri.reverse:
+		bri.bt.tree.Descend(collect)
+	case key == nil:
+		bri.bt.tree.Ascend(collect)
+	case bri.reverse:
+		bri.bt.tree.DescendLessOrEqual(&Item{key: key}, collect)
+	default:
+		bri.bt.tree.AscendGreaterOrEqual(&Item{key: key}, collect)
+	}
+}
+
+func (bri *btreeRangeIterator) Rewind() {
+	bri.load(nil, true)
+}
+
+// Seek 从第一个大于（反向时小于）等于 key 的位置开始读取
+func (bri *btreeRangeIterator) Seek(key []byte) {
+	if key == nil {
+		key = []byte{}
+	}
+	bri.load(key, true)
+}
+
+// Next 当前页遍历完之后读取下一页
+func (bri *btreeRangeIterator) Next() {
+	bri.idx++
+	if bri.idx == len(bri.page) && bri.more {
+		bri.load(bri.page[len(bri.page)-1].key, false)
+	}
+}
+
+func (bri *btreeRangeIterator) Valid() bool {
+	return bri.idx < len(bri.page)
+}
+
+func (bri *btreeRangeIterator) Key() []byte {
+	return bri.page[bri.idx].key
+}
+
+func (bri *btreeRangeIterator) Value() *data.LogRecordPos {
+	return bri.page[bri.idx].pos
+}
+
+func (bri *btreeRangeIterator) Close() {
+	bri.page = nil
+}
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"kv-go/bitcask/data"
 	"testing"
@@ -99,3 +100,71 @@ func TestBTree_Iterator(t *testing.T) {
 		assert.NotNil(t, iter6.Key())
 	}
 }
+
+func TestBTree_Comparator(t *testing.T) {
+	//按照字节序的反序排列
+	bt := NewBtreeWithComparator(func(a, b []byte) int {
+		return DefaultComparator(b, a)
+	})
+	bt.Put([]byte("aa"), &data.LogRecordPos{Fid: 1, Offset: 1})
+	bt.Put([]byte("cc"), &data.LogRecordPos{Fid: 1, Offset: 2})
+	bt.Put([]byte("bb"), &data.LogRecordPos{Fid: 1, Offset: 3})
+
+	iter := bt.Iterator(false)
+	var keys []string
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	assert.Equal(t, []string{"cc", "bb", "aa"}, keys)
+
+	iter.Seek([]byte("bc"))
+	assert.True(t, iter.Valid())
+	assert.Equal(t, "bb", string(iter.Key()))
+
+	iter2 := bt.Iterator(true)
+	iter2.Seek([]byte("bc"))
+	assert.True(t, iter2.Valid())
+	assert.Equal(t, "cc", string(iter2.Key()))
+}
+
+func TestBTree_RangeIterator(t *testing.T) {
+	bt := NewBtree()
+	for i := 0; i < 10; i++ {
+		bt.Put([]byte(fmt.Sprintf("key-%d", i)), &data.LogRecordPos{Fid: 1, Offset: int64(i)})
+	}
+
+	//每页3个,跨页之后仍然按顺序遍历所有的 key
+	iter := bt.RangeIterator(false, 3)
+	var keys []string
+	for iter.Rewind(); iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	assert.Equal(t, 10, len(keys))
+	assert.Equal(t, "key-0", keys[0])
+	assert.Equal(t, "key-9", keys[9])
+
+	iter.Seek([]byte("key-35"))
+	assert.True(t, iter.Valid())
+	assert.Equal(t, "key-4", string(iter.Key()))
+	assert.Equal(t, int64(4), iter.Value().Offset)
+
+	//遍历的过程中能看到还没有读取的页中的写入
+	iter.Seek([]byte("key-5"))
+	bt.Put([]byte("key-95"), &data.LogRecordPos{Fid: 1, Offset: 95})
+	bt.Delete([]byte("key-8"))
+	keys = nil
+	for ; iter.Valid(); iter.Next() {
+		keys = append(keys, string(iter.Key()))
+	}
+	assert.Equal(t, []string{"key-5", "key-6", "key-7", "key-9", "key-95"}, keys)
+
+	riter := bt.RangeIterator(true, 2)
+	riter.Seek([]byte("key-35"))
+	keys = nil
+	for ; riter.Valid(); riter.Next() {
+		keys = append(keys, string(riter.Key()))
+	}
+	assert.Equal(t, []string{"key-3", "key-2", "key-1", "key-0"}, keys)
+	riter.Close()
+	assert.False(t, riter.Valid())
+}
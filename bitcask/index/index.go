@@ -2,7 +2,6 @@ package index
 
 import (
 	"bytes"
-	"github.com/google/btree"
 	"kv-go/bitcask/data"
 )
 
@@ -24,6 +23,12 @@ type Indexer interface {
 	Close() error
 }
 
+// RangeIndexer 可以从指定的位置开始分批读取的索引,遍历时不需要拷贝整个索引
+type RangeIndexer interface {
+	//每次最多从索引中读取 pageSize 个 key 的迭代器,遍历的过程中能看到其他的写入
+	RangeIterator(reverse bool, pageSize int) Iterator
+}
+
 type IndexType = int8
 
 const (
@@ -37,10 +42,17 @@ const (
 	BPTree
 )
 
-func NewIndexer(typ IndexType, dirPath string, sync bool) Indexer {
+// Comparator key 的比较函数,a < b 返回负数,a == b 返回0,a > b 返回正数
+type Comparator func(a, b []byte) int
+
+// DefaultComparator 默认按照字节序比较
+var DefaultComparator Comparator = bytes.Compare
+
+// NewIndexer comparator 为空时使用字节序,只有 BTree 索引支持自定义的比较函数
+func NewIndexer(typ IndexType, dirPath string, sync bool, comparator Comparator) Indexer {
 	switch typ {
 	case BTree:
-		return NewBtree()
+		return NewBtreeWithComparator(comparator)
 	case ART:
 		//todo
 		return NewART()
@@ -58,11 +70,6 @@ type Item struct {
 	pos *data.LogRecordPos
 }
 
-func (ai *Item) Less(bi btree.Item) bool {
-	//使用了接口断言,使用指针避免拷贝大对象
-	return bytes.Compare(ai.key, bi.(*Item).key) == -1
-}
-
 // 通用的索引迭代器，这里定义一个接口的原因是如果有其他数据类型，这里可以直接调用
 type Iterator interface {
 	//重新回到的迭代器的起点,就是第一个数据
@@ -14,7 +14,12 @@ type Iterator struct {
 
 // NewIterator 初始化迭代器
 func (db *DB) NewIterator(opts IteratorOptions) *Iterator {
-	indexIter := db.index.Iterator(opts.Reverse)
+	var indexIter index.Iterator
+	if rangeIndex, ok := db.index.(index.RangeIndexer); ok && opts.PageSize > 0 {
+		indexIter = rangeIndex.RangeIterator(opts.Reverse, opts.PageSize)
+	} else {
+		indexIter = db.index.Iterator(opts.Reverse)
+	}
 	return &Iterator{
 		db:        db,
 		indexIter: indexIter,
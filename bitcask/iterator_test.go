@@ -1,6 +1,7 @@
 package bitcask
 
 import (
+	"bytes"
 	"github.com/stretchr/testify/assert"
 	"kv-go/bitcask/utils"
 	"os"
@@ -96,3 +97,91 @@ func TestDB_Iterator_Multi_Values(t *testing.T) {
 	}
 	iter3.Close()
 }
+
+func TestDB_Iterator_Comparator(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-5")
+	opts.DirPath = dir
+	//key 为 tenant|timestamp,同一个 tenant 内按时间倒序排列
+	opts.Comparator = func(a, b []byte) int {
+		ta, sa, _ := bytes.Cut(a, []byte("|"))
+		tb, sb, _ := bytes.Cut(b, []byte("|"))
+		if c := bytes.Compare(ta, tb); c != 0 {
+			return c
+		}
+		return bytes.Compare(sb, sa)
+	}
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for _, key := range []string{"t1|001", "t2|002", "t1|003", "t1|002", "t2|001"} {
+		err = db.Put([]byte(key), []byte(key))
+		assert.Nil(t, err)
+	}
+	expected := []string{"t1|003", "t1|002", "t1|001", "t2|002", "t2|001"}
+	listKeys := func() []string {
+		var keys []string
+		for _, key := range db.ListKeys() {
+			keys = append(keys, string(key))
+		}
+		return keys
+	}
+	assert.Equal(t, expected, listKeys())
+
+	iterOpts := DefaultIteratorOptions
+	iterOpts.Prefix = []byte("t1|")
+	iterator := db.NewIterator(iterOpts)
+	iterator.Seek([]byte("t1|002"))
+	assert.True(t, iterator.Valid())
+	assert.Equal(t, []byte("t1|002"), iterator.Key())
+	iterator.Close()
+
+	//重启之后使用同一个比较函数,顺序保持不变
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, listKeys())
+}
+
+func TestDB_Comparator_Unsupported(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-6")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.Comparator = bytes.Compare
+	for _, typ := range []IndexerType{ART, BPlusTree} {
+		opts.IndexType = typ
+		db, err := Open(opts)
+		assert.Nil(t, db)
+		assert.Equal(t, ErrComparatorNotSupported, err)
+	}
+}
+
+func TestDB_Iterator_PageSize(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-iterator-7")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.GetTestKey(i)))
+	}
+	iterOpts := DefaultIteratorOptions
+	iterOpts.PageSize = 3
+	iterOpts.Prefix = []byte("bitcask-go-key-00000001")
+	iterator := db.NewIterator(iterOpts)
+	defer iterator.Close()
+	var count = 0
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		assert.True(t, bytes.HasPrefix(iterator.Key(), iterOpts.Prefix))
+		val, err := iterator.Value()
+		assert.Nil(t, err)
+		assert.Equal(t, iterator.Key(), val)
+		count++
+	}
+	assert.Equal(t, 10, count)
+}
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strconv"
+	"time"
 )
 
 const (
@@ -20,10 +21,11 @@ const (
 // merge过程
 // 1.检查是否在merge，如果在就返回，如果没有就进入merge状态 2.持久化当前活跃文件，持久化当前活跃文件并且转换为旧文件，则当前活跃文件就算最新文件
 // 3.取出所有需要merge的文件 4.待merge的文件从小到大排列，依次merge
-func (db *DB) Merge() error {
+func (db *DB) Merge() (err error) {
 	if db.activeFile == nil {
 		return nil
 	}
+	defer db.observe(OpMerge, time.Now(), &err)
 	db.mu.Lock()
 
 	//如果merge正在进行，则直接返回
@@ -60,16 +62,19 @@ func (db *DB) Merge() error {
 
 	//0 1 2 3
 	//持久化当前活跃文件
-	if err := db.activeFile.Sync(); err != nil {
+	if err := db.syncFile(db.activeFile); err != nil {
+		db.mu.Unlock()
 		return err
 	}
 	//转为旧文件
-	db.olderFiles[db.activeFile.FileId] = db.activeFile
+	oldFileId := db.activeFile.FileId
+	db.olderFiles[oldFileId] = db.activeFile
 	//打开新的活跃文件
 	if err := db.setActiveDataFile(); err != nil {
 		db.mu.Unlock()
 		return err
 	}
+	db.fileRotated(oldFileId, db.activeFile.FileId)
 	//记录新没有参与merge的文件
 	nonMergeFileId := db.activeFile.FileId
 	//现在需要merge的文件都是旧的数据文件了
@@ -78,8 +83,23 @@ func (db *DB) Merge() error {
 	for _, file := range db.olderFiles {
 		mergeFiles = append(mergeFiles, file)
 	}
+	//配置项可能在运行时被修改,需要在持有锁的时候拷贝
+	mergeOptions := db.Options
+	info := MergeInfo{
+		DirPath:        db.Options.DirPath,
+		MergeFiles:     len(mergeFiles),
+		NonMergeFileId: nonMergeFileId,
+		ReclaimSize:    db.reclaimSize,
+	}
 	db.mu.Unlock()
 
+	db.mergeBegin(info)
+	mergeStart := time.Now()
+	defer func() {
+		info.Duration = time.Since(mergeStart)
+		db.mergeEnd(info, err)
+	}()
+
 	//待merge的文件按照id从小到大排列，依次merge
 	sort.Slice(mergeFiles, func(i, j int) bool {
 		return mergeFiles[i].FileId < mergeFiles[j].FileId
@@ -96,9 +116,11 @@ func (db *DB) Merge() error {
 		return err
 	}
 	//打开一个新的bitcask实例
-	mergeOptions := db.Options
 	mergeOptions.DirPath = mergePath
 	mergeOptions.SyncWrites = false
+	mergeOptions.Metrics = nil //merge 中的写入不计入指标
+	mergeOptions.Logger = nil
+	mergeOptions.EventListener = nil
 	mergeDB, err := Open(mergeOptions)
 	if err != nil {
 		return err
@@ -168,6 +190,10 @@ func (db *DB) Merge() error {
 	if err := mergeFinishedFile.Sync(); err != nil {
 		return err
 	}
+	//重启之后比 nonMergeFileId 小的数据文件会被替换,其中的位置从现在开始就不能再用于续传
+	db.mu.Lock()
+	db.mergeEpoch = nonMergeFileId
+	db.mu.Unlock()
 	return nil
 }
 
@@ -190,7 +216,9 @@ func (db *DB) loadMergeFiles() error {
 		return nil
 	}
 	defer func() {
-		_ = os.RemoveAll(mergePath)
+		if err := os.RemoveAll(mergePath); err != nil {
+			db.ReportBackgroundError(err)
+		}
 	}()
 	dirEntries, err := os.ReadDir(mergePath)
 	if err != nil {
@@ -240,6 +268,7 @@ func (db *DB) loadMergeFiles() error {
 			return err
 		}
 	}
+	db.logger.Info("merged data files applied", "non_merge_file", nonMergeFileId)
 	return nil
 }
 
@@ -285,7 +314,7 @@ func (db *DB) loadIndexFromHintFile() error {
 			return err
 		}
 		//解码拿到实际的位置信息
-		pos := data.DecodeLogRecordPos(logRecord.Key)
+		pos := data.DecodeLogRecordPos(logRecord.Value)
 		db.index.Put(logRecord.Key, pos)
 		offset += size
 
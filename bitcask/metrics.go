@@ -0,0 +1,58 @@
+package bitcask
+
+import (
+	"kv-go/bitcask/data"
+	"time"
+)
+
+type Operation = byte
+
+const (
+	OpPut Operation = iota
+	OpGet
+	OpDelete
+	OpBatchCommit
+	OpMerge
+)
+
+// 指标中使用的操作名称
+var operationNames = map[Operation]string{
+	OpPut:         "put",
+	OpGet:         "get",
+	OpDelete:      "delete",
+	OpBatchCommit: "batch_commit",
+	OpMerge:       "merge",
+}
+
+// OperationName 返回操作的名称,如 put、batch_commit
+func OperationName(op Operation) string {
+	return operationNames[op]
+}
+
+// Metrics 收集存储引擎的运行指标,通过 Options.Metrics 设置,为空时不收集
+// 实现需要是并发安全的,并且不能阻塞,方法会在持有数据库锁的时候被调用
+// 数据文件数量、可回收的数据量和索引大小可以随时通过 DB.Stat 获取,不在这里上报
+type Metrics interface {
+	//一次操作完成,err 是操作返回的错误,Get 找不到 key 时为 ErrKeyNotFound
+	ObserveOperation(op Operation, duration time.Duration, err error)
+	//一次数据文件的 fsync 完成
+	ObserveSync(duration time.Duration)
+}
+
+// 记录一次操作的耗时,在操作开始时调用: defer db.observe(OpPut, time.Now(), &err)
+func (db *DB) observe(op Operation, start time.Time, err *error) {
+	if db.Options.Metrics != nil {
+		db.Options.Metrics.ObserveOperation(op, time.Since(start), *err)
+	}
+}
+
+// 持久化数据文件并记录 fsync 的耗时
+func (db *DB) syncFile(file *data.DataFile) error {
+	if db.Options.Metrics == nil {
+		return file.Sync()
+	}
+	start := time.Now()
+	err := file.Sync()
+	db.Options.Metrics.ObserveSync(time.Since(start))
+	return err
+}
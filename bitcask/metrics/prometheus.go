@@ -0,0 +1,358 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"kv-go/bitcask"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 以 Prometheus 文本格式导出存储引擎的指标,不依赖 Prometheus 的客户端库
+// 操作和 fsync 的指标通过 Collector.Metrics 返回的 bitcask.Metrics 收集,
+// 数据文件数量、可回收的数据量、索引大小和磁盘占用在每次抓取时通过 DB.Stat 获取
+
+// 操作耗时的分桶上限,单位秒,存储引擎的操作大多在微秒到毫秒之间
+var DefaultBuckets = []float64{0.00001, 0.00005, 0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var ErrDuplicateMetric = errors.New("metric is already registered")
+
+// Collector 收集一个或者多个数据库的指标,通过 db 标签区分
+type Collector struct {
+	mu         sync.RWMutex
+	buckets    []float64
+	operations map[operationKey]*histogram
+	results    map[resultKey]uint64
+	syncs      map[string]*histogram
+	databases  map[string]func() *bitcask.Stat
+	funcs      []*funcMetric
+}
+
+type operationKey struct {
+	db string
+	op string
+}
+
+func (key operationKey) less(other operationKey) bool {
+	if key.db != other.db {
+		return key.db < other.db
+	}
+	return key.op < other.op
+}
+
+type resultKey struct {
+	operationKey
+	result string
+}
+
+// 抓取时调用的计数器或者仪表盘,如服务的连接数
+type funcMetric struct {
+	name  string
+	help  string
+	typ   string
+	value func() float64
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		buckets:    DefaultBuckets,
+		operations: make(map[operationKey]*histogram),
+		results:    make(map[resultKey]uint64),
+		syncs:      make(map[string]*histogram),
+		databases:  make(map[string]func() *bitcask.Stat),
+	}
+}
+
+// Metrics 返回带有 db 标签的 bitcask.Metrics,设置到打开数据库的 Options.Metrics 中
+func (c *Collector) Metrics(db string) bitcask.Metrics {
+	return &dbMetrics{collector: c, db: db}
+}
+
+// AddDatabase 抓取时通过 stat 获取数据库的状态,一般传入 DB.Stat,同名的数据库会被替换
+func (c *Collector) AddDatabase(db string, stat func() *bitcask.Stat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.databases[db] = stat
+}
+
+// RemoveDatabase 数据库关闭之后不再抓取它的状态,已经收集的操作指标会保留
+func (c *Collector) RemoveDatabase(db string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.databases, db)
+}
+
+// GaugeFunc 注册一个抓取时计算的仪表盘
+func (c *Collector) GaugeFunc(name, help string, value func() float64) error {
+	return c.addFunc(name, help, "gauge", value)
+}
+
+// CounterFunc 注册一个抓取时计算的计数器,value 的返回值只能增加
+func (c *Collector) CounterFunc(name, help string, value func() float64) error {
+	return c.addFunc(name, help, "counter", value)
+}
+
+func (c *Collector) addFunc(name, help, typ string, value func() float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, f := range c.funcs {
+		if f.name == name {
+			return ErrDuplicateMetric
+		}
+	}
+	c.funcs = append(c.funcs, &funcMetric{name: name, help: help, typ: typ, value: value})
+	return nil
+}
+
+func (c *Collector) observeOperation(db string, op bitcask.Operation, duration time.Duration, err error) {
+	key := operationKey{db: db, op: bitcask.OperationName(op)}
+	result := "ok"
+	switch {
+	case err == nil:
+	case errors.Is(err, bitcask.ErrKeyNotFound):
+		result = "not_found"
+	default:
+		result = "error"
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.operations[key]
+	if !ok {
+		h = newHistogram(c.buckets)
+		c.operations[key] = h
+	}
+	h.observe(duration.Seconds())
+	c.results[resultKey{operationKey: key, result: result}]++
+}
+
+func (c *Collector) observeSync(db string, duration time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, ok := c.syncs[db]
+	if !ok {
+		h = newHistogram(c.buckets)
+		c.syncs[db] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// WriteTo 以 Prometheus 文本格式写出所有的指标
+// 先写到内存中再发送,避免读取缓慢的抓取方长时间持有锁,阻塞数据库的写入
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	c.write(&countingWriter{w: &buf})
+	return buf.WriteTo(w)
+}
+
+// ServeHTTP 处理 /metrics 的请求
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	_, _ = c.WriteTo(w)
+}
+
+func (c *Collector) write(w *countingWriter) {
+	//抓取数据库的状态需要读取目录大小,不在持有锁的时候进行
+	c.mu.RLock()
+	databases := make(map[string]func() *bitcask.Stat, len(c.databases))
+	for db, stat := range c.databases {
+		databases[db] = stat
+	}
+	funcs := append([]*funcMetric(nil), c.funcs...)
+	c.mu.RUnlock()
+	stats := make(map[string]*bitcask.Stat, len(databases))
+	for db, stat := range databases {
+		stats[db] = stat()
+	}
+
+	c.mu.RLock()
+	opKeys := make([]operationKey, 0, len(c.operations))
+	for key := range c.operations {
+		opKeys = append(opKeys, key)
+	}
+	sort.Slice(opKeys, func(i, j int) bool {
+		return opKeys[i].less(opKeys[j])
+	})
+	resultKeys := make([]resultKey, 0, len(c.results))
+	for key := range c.results {
+		resultKeys = append(resultKeys, key)
+	}
+	sort.Slice(resultKeys, func(i, j int) bool {
+		a, b := resultKeys[i], resultKeys[j]
+		if a.operationKey != b.operationKey {
+			return a.operationKey.less(b.operationKey)
+		}
+		return a.result < b.result
+	})
+
+	w.header("bitcask_operations_total", "Number of completed operations by result.", "counter")
+	for _, key := range resultKeys {
+		w.sample("bitcask_operations_total", labels("db", key.db, "op", key.op, "result", key.result),
+			float64(c.results[key]))
+	}
+	w.header("bitcask_operation_duration_seconds", "Latency of operations.", "histogram")
+	for _, key := range opKeys {
+		c.operations[key].write(w, "bitcask_operation_duration_seconds", "db", key.db, "op", key.op)
+	}
+	w.header("bitcask_fsync_duration_seconds", "Latency of data file fsync.", "histogram")
+	for _, db := range sortedKeys(c.syncs) {
+		c.syncs[db].write(w, "bitcask_fsync_duration_seconds", "db", db)
+	}
+	c.mu.RUnlock()
+
+	dbs := sortedKeys(stats)
+	gauges := []struct {
+		name  string
+		help  string
+		value func(stat *bitcask.Stat) float64
+	}{
+		{"bitcask_data_files", "Number of data files.", func(stat *bitcask.Stat) float64 {
+			return float64(stat.DataFileNum)
+		}},
+		{"bitcask_reclaimable_bytes", "Bytes of stale data that merge can reclaim.", func(stat *bitcask.Stat) float64 {
+			return float64(stat.ReclaimSize)
+		}},
+		{"bitcask_index_keys", "Number of keys in the in-memory index.", func(stat *bitcask.Stat) float64 {
+			return float64(stat.KeyNum)
+		}},
+		{"bitcask_disk_bytes", "Disk space used by the data directory.", func(stat *bitcask.Stat) float64 {
+			return float64(stat.DisSize)
+		}},
+	}
+	for _, gauge := range gauges {
+		w.header(gauge.name, gauge.help, "gauge")
+		for _, db := range dbs {
+			w.sample(gauge.name, labels("db", db), gauge.value(stats[db]))
+		}
+	}
+
+	for _, f := range funcs {
+		w.header(f.name, f.help, f.typ)
+		w.sample(f.name, "", f.value())
+	}
+}
+
+// 带有 db 标签的 bitcask.Metrics
+type dbMetrics struct {
+	collector *Collector
+	db        string
+}
+
+func (m *dbMetrics) ObserveOperation(op bitcask.Operation, duration time.Duration, err error) {
+	m.collector.observeOperation(m.db, op, duration, err)
+}
+
+func (m *dbMetrics) ObserveSync(duration time.Duration) {
+	m.collector.observeSync(m.db, duration)
+}
+
+// 累计分桶的直方图,counts[i] 是小于等于 buckets[i] 的观测次数
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (h *histogram) write(w *countingWriter, name string, labelPairs ...string) {
+	for i, bound := range h.buckets {
+		w.sample(name+"_bucket", labels(append(labelPairs, "le", formatFloat(bound))...), float64(h.counts[i]))
+	}
+	w.sample(name+"_bucket", labels(append(labelPairs, "le", "+Inf")...), float64(h.count))
+	w.sample(name+"_sum", labels(labelPairs...), h.sum)
+	w.sample(name+"_count", labels(labelPairs...), float64(h.count))
+}
+
+// 记录写出的字节数和第一个错误,出错之后不再写入
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countingWriter) writeString(s string) {
+	if w.err != nil {
+		return
+	}
+	n, err := io.WriteString(w.w, s)
+	w.n += int64(n)
+	w.err = err
+}
+
+func (w *countingWriter) header(name, help, typ string) {
+	w.writeString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ))
+}
+
+func (w *countingWriter) sample(name, labels string, value float64) {
+	w.writeString(name + labels + " " + formatFloat(value) + "\n")
+}
+
+// 把 name1, value1, name2, value2 格式化为 {name1="value1",name2="value2"}
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(pairs[i] + `="` + escapeLabel(pairs[i+1]) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// 标签值中的反斜杠、双引号和换行需要转义
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector_WriteTo(t *testing.T) {
+	c := NewCollector()
+	m := c.Metrics(`a"b`)
+	m.ObserveOperation(bitcask.OpPut, 20*time.Microsecond, nil)
+	m.ObserveOperation(bitcask.OpPut, 2*time.Second, bitcask.ErrNoEnoughSpace)
+	m.ObserveOperation(bitcask.OpGet, time.Microsecond, bitcask.ErrKeyNotFound)
+	m.ObserveSync(time.Millisecond)
+	c.AddDatabase(`a"b`, func() *bitcask.Stat {
+		return &bitcask.Stat{KeyNum: 3, DataFileNum: 2, ReclaimSize: 100, DisSize: 4096}
+	})
+	assert.Nil(t, c.GaugeFunc("connected_clients", "Number of clients.", func() float64 { return 5 }))
+	assert.Equal(t, ErrDuplicateMetric, c.GaugeFunc("connected_clients", "", func() float64 { return 0 }))
+
+	var buf bytes.Buffer
+	n, err := c.WriteTo(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(buf.Len()), n)
+	res := buf.String()
+
+	for _, line := range []string{
+		`# TYPE bitcask_operations_total counter`,
+		`bitcask_operations_total{db="a\"b",op="get",result="not_found"} 1`,
+		`bitcask_operations_total{db="a\"b",op="put",result="error"} 1`,
+		`bitcask_operations_total{db="a\"b",op="put",result="ok"} 1`,
+		`# TYPE bitcask_operation_duration_seconds histogram`,
+		`bitcask_operation_duration_seconds_bucket{db="a\"b",op="put",le="1e-05"} 0`,
+		`bitcask_operation_duration_seconds_bucket{db="a\"b",op="put",le="5e-05"} 1`,
+		`bitcask_operation_duration_seconds_bucket{db="a\"b",op="put",le="+Inf"} 2`,
+		`bitcask_operation_duration_seconds_sum{db="a\"b",op="put"} 2.00002`,
+		`bitcask_operation_duration_seconds_count{db="a\"b",op="put"} 2`,
+		`bitcask_fsync_duration_seconds_count{db="a\"b"} 1`,
+		`bitcask_data_files{db="a\"b"} 2`,
+		`bitcask_reclaimable_bytes{db="a\"b"} 100`,
+		`bitcask_index_keys{db="a\"b"} 3`,
+		`bitcask_disk_bytes{db="a\"b"} 4096`,
+		`# TYPE connected_clients gauge`,
+		`connected_clients 5`,
+	} {
+		assert.Contains(t, res, line+"\n")
+	}
+
+	// 移除之后不再抓取数据库的状态,操作指标仍然保留
+	c.RemoveDatabase(`a"b`)
+	buf.Reset()
+	_, _ = c.WriteTo(&buf)
+	assert.NotContains(t, buf.String(), `bitcask_index_keys{`)
+	assert.Contains(t, buf.String(), `bitcask_operations_total{db="a\"b",op="put",result="ok"} 1`)
+}
+
+func TestCollector_ServeHTTP(t *testing.T) {
+	c := NewCollector()
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-metrics-http")
+	defer os.RemoveAll(dir)
+	opts.DirPath = dir
+	opts.Metrics = c.Metrics("default")
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+	c.AddDatabase("default", db.Stat)
+	assert.Nil(t, db.Put([]byte("k"), []byte("v")))
+
+	rec := httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4"))
+	assert.Contains(t, rec.Body.String(), `bitcask_operations_total{db="default",op="put",result="ok"} 1`+"\n")
+	assert.Contains(t, rec.Body.String(), `bitcask_index_keys{db="default"} 1`+"\n")
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
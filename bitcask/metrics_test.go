@@ -0,0 +1,79 @@
+package bitcask
+
+import (
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask/utils"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 记录所有上报的指标
+type testMetrics struct {
+	mu    sync.Mutex
+	ops   map[Operation]int
+	errs  map[Operation][]error
+	syncs int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{ops: make(map[Operation]int), errs: make(map[Operation][]error)}
+}
+
+func (m *testMetrics) ObserveOperation(op Operation, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ops[op]++
+	if err != nil {
+		m.errs[op] = append(m.errs[op], err)
+	}
+}
+
+func (m *testMetrics) ObserveSync(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.syncs++
+}
+
+func TestDB_Metrics(t *testing.T) {
+	m := newTestMetrics()
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-metrics")
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.DataFileMergeRatio = 0
+	opts.Metrics = m
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, db.Put(utils.GetTestKey(i), utils.RandomValue(128)))
+	}
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	_, err = db.Get([]byte("not-exist"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Delete(utils.GetTestKey(1)))
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put([]byte("batch"), []byte("v"))
+	assert.Nil(t, wb.Commit())
+	assert.Nil(t, db.Sync())
+
+	syncs := m.syncs
+	//merge 中写入的数据不会计入 Put
+	assert.Nil(t, db.Merge())
+
+	assert.Equal(t, 1000, m.ops[OpPut])
+	assert.Equal(t, 2, m.ops[OpGet])
+	assert.Equal(t, []error{ErrKeyNotFound}, m.errs[OpGet])
+	assert.Equal(t, 1, m.ops[OpDelete])
+	assert.Equal(t, 1, m.ops[OpBatchCommit])
+	assert.Equal(t, 1, m.ops[OpMerge])
+	assert.Nil(t, m.errs[OpMerge])
+	//BytesPerSync、切换活跃文件、提交批次和 Sync 都会 fsync
+	assert.True(t, syncs > 3)
+	assert.True(t, m.syncs > syncs)
+}
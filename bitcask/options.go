@@ -1,6 +1,9 @@
 package bitcask
 
-import "os"
+import (
+	"log/slog"
+	"os"
+)
 
 type Options struct {
 	DirPath      string //数据库数据目录
@@ -14,6 +17,18 @@ type Options struct {
 	MMapAtStartup bool
 	//数据文件merge合并的阈值
 	DataFileMergeRatio float32
+
+	//自定义 key 的排序规则,影响迭代器和 ListKeys 的顺序,为空时按字节序
+	//只有 BTree 索引支持,每次打开同一个数据目录时应该使用相同的比较函数
+	Comparator func(a, b []byte) int
+
+	//收集操作次数、耗时和 fsync 耗时等运行指标,为空时不收集
+	Metrics Metrics
+
+	//记录文件切换、merge、启动恢复等事件的日志,为空时不输出日志
+	Logger *slog.Logger
+	//接收文件切换、merge、启动恢复和后台错误等事件,为空时不通知
+	EventListener EventListener
 }
 
 type IndexerType = int8
@@ -49,6 +64,15 @@ var DefaultOptions = Options{
 type IteratorOptions struct {
 	Prefix  []byte //遍历前缀为指定的key值
 	Reverse bool
+	//大于0时每次只从索引中读取 PageSize 个 key,不拷贝整个索引,遍历的过程中能看到其他的写入
+	//只有 BTree 索引支持,其他索引仍然拷贝整个索引
+	PageSize int
+}
+
+// 导出配置项
+type ExportOptions struct {
+	//是否使用gzip压缩导出的数据
+	Compress bool
 }
 
 var DefaultIteratorOptions = IteratorOptions{
@@ -59,3 +83,6 @@ var DefaultWriteBatchOptions = WriteBatchOptions{
 	MaxBatchNum: 10000,
 	SyncWrites:  true,
 }
+var DefaultExportOptions = ExportOptions{
+	Compress: false,
+}
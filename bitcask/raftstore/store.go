@@ -0,0 +1,229 @@
+package raftstore
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/hashicorp/raft"
+	"kv-go/bitcask"
+	"sync"
+	"time"
+)
+
+// 基于 bitcask 实现的 raft 日志存储(raft.LogStore)和元数据存储(raft.StableStore)
+// 日志的 key 为 logPrefix + 大端序的日志索引,保证按照索引顺序排列
+var (
+	logPrefix    = []byte("l")
+	stablePrefix = []byte("s")
+)
+
+// Store raft 日志以及元数据的存储
+type Store struct {
+	db         *bitcask.DB
+	mu         sync.RWMutex
+	firstIndex uint64
+	lastIndex  uint64
+}
+
+// New 打开存储,raft 要求日志必须持久化,这里会强制打开 SyncWrites
+func New(options bitcask.Options) (*Store, error) {
+	options.SyncWrites = true
+	db, err := bitcask.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{db: db}
+
+	//加载日志的索引范围
+	iterator := db.NewIterator(bitcask.IteratorOptions{Prefix: logPrefix})
+	defer iterator.Close()
+	for iterator.Rewind(); iterator.Valid(); iterator.Next() {
+		index := decodeLogKey(iterator.Key())
+		if s.firstIndex == 0 {
+			s.firstIndex = index
+		}
+		s.lastIndex = index
+	}
+	return s, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// FirstIndex 第一条日志的索引,没有日志时返回0
+func (s *Store) FirstIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.firstIndex, nil
+}
+
+// LastIndex 最后一条日志的索引,没有日志时返回0
+func (s *Store) LastIndex() (uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastIndex, nil
+}
+
+// GetLog 获取指定索引的日志
+func (s *Store) GetLog(index uint64, log *raft.Log) error {
+	buf, err := s.db.Get(encodeLogKey(index))
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return raft.ErrLogNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return decodeLog(buf, log)
+}
+
+// StoreLog 写入一条日志
+func (s *Store) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs 原子地写入多条日志
+func (s *Store) StoreLogs(logs []*raft.Log) error {
+	if len(logs) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wb := s.db.NewWriteBatch(bitcask.WriteBatchOptions{
+		MaxBatchNum: uint(len(logs)),
+		SyncWrites:  true,
+	})
+	for _, log := range logs {
+		if err := wb.Put(encodeLogKey(log.Index), encodeLog(log)); err != nil {
+			return err
+		}
+	}
+	if err := wb.Commit(); err != nil {
+		return err
+	}
+	for _, log := range logs {
+		if s.firstIndex == 0 || log.Index < s.firstIndex {
+			s.firstIndex = log.Index
+		}
+		if log.Index > s.lastIndex {
+			s.lastIndex = log.Index
+		}
+	}
+	return nil
+}
+
+// DeleteRange 删除 [min, max] 范围内的日志
+func (s *Store) DeleteRange(min, max uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for index := min; index <= max; index++ {
+		if err := s.db.Delete(encodeLogKey(index)); err != nil {
+			return err
+		}
+	}
+	//删除的是头部或者尾部的日志
+	if min <= s.firstIndex {
+		s.firstIndex = max + 1
+	}
+	if max >= s.lastIndex {
+		s.lastIndex = min - 1
+	}
+	if s.firstIndex > s.lastIndex {
+		s.firstIndex, s.lastIndex = 0, 0
+	}
+	return nil
+}
+
+// Set 写入元数据
+func (s *Store) Set(key []byte, val []byte) error {
+	return s.db.Put(encodeStableKey(key), val)
+}
+
+// Get 获取元数据,不存在时返回空
+func (s *Store) Get(key []byte) ([]byte, error) {
+	val, err := s.db.Get(encodeStableKey(key))
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return []byte{}, nil
+	}
+	return val, err
+}
+
+func (s *Store) SetUint64(key []byte, val uint64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, val)
+	return s.Set(key, buf)
+}
+
+func (s *Store) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil || len(val) == 0 {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(val), nil
+}
+
+func encodeLogKey(index uint64) []byte {
+	buf := make([]byte, len(logPrefix)+8)
+	copy(buf, logPrefix)
+	binary.BigEndian.PutUint64(buf[len(logPrefix):], index)
+	return buf
+}
+
+func decodeLogKey(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(logPrefix):])
+}
+
+func encodeStableKey(key []byte) []byte {
+	buf := make([]byte, len(stablePrefix)+len(key))
+	copy(buf, stablePrefix)
+	copy(buf[len(stablePrefix):], key)
+	return buf
+}
+
+// 日志的编码
+// +-------+------+------+-------------+-----------+------+------------+
+// | index | term | type | appended at | data size | data | extensions |
+// +-------+------+------+-------------+-----------+------+------------+
+// | 8字节  | 8字节 | 1字节 | 8字节         | 变长       |      |            |
+func encodeLog(log *raft.Log) []byte {
+	buf := make([]byte, 8+8+1+8+binary.MaxVarintLen64+len(log.Data)+len(log.Extensions))
+	var index = 0
+	binary.BigEndian.PutUint64(buf[index:], log.Index)
+	index += 8
+	binary.BigEndian.PutUint64(buf[index:], log.Term)
+	index += 8
+	buf[index] = byte(log.Type)
+	index++
+	binary.BigEndian.PutUint64(buf[index:], uint64(log.AppendedAt.UnixNano()))
+	index += 8
+	index += binary.PutUvarint(buf[index:], uint64(len(log.Data)))
+	index += copy(buf[index:], log.Data)
+	index += copy(buf[index:], log.Extensions)
+	return buf[:index]
+}
+
+func decodeLog(buf []byte, log *raft.Log) error {
+	if len(buf) < 8+8+1+8 {
+		return errors.New("invalid raft log")
+	}
+	var index = 0
+	log.Index = binary.BigEndian.Uint64(buf[index:])
+	index += 8
+	log.Term = binary.BigEndian.Uint64(buf[index:])
+	index += 8
+	log.Type = raft.LogType(buf[index])
+	index++
+	log.AppendedAt = time.Unix(0, int64(binary.BigEndian.Uint64(buf[index:])))
+	index += 8
+	dataSize, n := binary.Uvarint(buf[index:])
+	if n <= 0 || uint64(len(buf)-index-n) < dataSize {
+		return errors.New("invalid raft log")
+	}
+	index += n
+	log.Data = buf[index : index+int(dataSize)]
+	index += int(dataSize)
+	log.Extensions = nil
+	if index < len(buf) {
+		log.Extensions = buf[index:]
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package raftstore
+
+import (
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"os"
+	"testing"
+)
+
+func TestStore_Logs(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-raftstore")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+	s, err := New(opts)
+	assert.Nil(t, err)
+
+	first, _ := s.FirstIndex()
+	last, _ := s.LastIndex()
+	assert.Equal(t, uint64(0), first)
+	assert.Equal(t, uint64(0), last)
+
+	var logs []*raft.Log
+	for i := uint64(1); i <= 10; i++ {
+		logs = append(logs, &raft.Log{Index: i, Term: 1, Type: raft.LogCommand, Data: []byte("data")})
+	}
+	err = s.StoreLogs(logs)
+	assert.Nil(t, err)
+
+	var log raft.Log
+	err = s.GetLog(5, &log)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), log.Index)
+	assert.Equal(t, uint64(1), log.Term)
+	assert.Equal(t, []byte("data"), log.Data)
+	err = s.GetLog(11, &log)
+	assert.Equal(t, raft.ErrLogNotFound, err)
+
+	// 压缩头部的日志
+	err = s.DeleteRange(1, 4)
+	assert.Nil(t, err)
+	first, _ = s.FirstIndex()
+	assert.Equal(t, uint64(5), first)
+	err = s.GetLog(3, &log)
+	assert.Equal(t, raft.ErrLogNotFound, err)
+
+	// 删除尾部冲突的日志
+	err = s.DeleteRange(9, 10)
+	assert.Nil(t, err)
+	last, _ = s.LastIndex()
+	assert.Equal(t, uint64(8), last)
+
+	// 重启之后恢复索引范围
+	err = s.Close()
+	assert.Nil(t, err)
+	s, err = New(opts)
+	assert.Nil(t, err)
+	defer s.Close()
+	first, _ = s.FirstIndex()
+	last, _ = s.LastIndex()
+	assert.Equal(t, uint64(5), first)
+	assert.Equal(t, uint64(8), last)
+}
+
+func TestStore_Stable(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-raftstore-stable")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+	s, err := New(opts)
+	assert.Nil(t, err)
+	defer s.Close()
+
+	val, err := s.Get([]byte("unknown"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(val))
+
+	err = s.Set([]byte("LastVoteCand"), []byte("node-1"))
+	assert.Nil(t, err)
+	val, err = s.Get([]byte("LastVoteCand"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("node-1"), val)
+
+	err = s.SetUint64([]byte("CurrentTerm"), 3)
+	assert.Nil(t, err)
+	term, err := s.GetUint64([]byte("CurrentTerm"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), term)
+}
@@ -0,0 +1,808 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/tidwall/redcon"
+	"kv-go/bitcask/utils"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const defaultUserName = "default"
+
+var (
+	errNoAuth               = errors.New("NOAUTH Authentication required.")
+	errWrongPass            = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+	errNoPasswordConfigured = errors.New("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	errNoKeyPermission      = errors.New("NOPERM No permissions to access a key")
+	errNoACLFile            = errors.New("ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command")
+	errDeleteDefaultUser    = errors.New("ERR The 'default' user cannot be removed")
+	errUnknownACLCommand    = errors.New("ERR unknown subcommand for 'acl'")
+	errUnknownACLCategory   = errors.New("ERR Unknown category")
+
+	//ACL SETUSER 中的规则错误
+	errACLSyntax          = errors.New("Syntax error")
+	errACLUnknownName     = errors.New("Unknown command or category name in ACL")
+	errACLNoSuchPassword  = errors.New("no such password")
+	errACLInvalidHash     = errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+	errACLInvalidFileLine = errors.New("invalid ACL file line")
+)
+
+func newNoPermError(user, cmd string) error {
+	return fmt.Errorf("NOPERM User %s has no permissions to run the '%s' command", user, cmd)
+}
+
+func newACLRuleError(rule string, err error) error {
+	return fmt.Errorf("ERR Error in ACL SETUSER modifier '%s': %v", rule, err)
+}
+
+// ACL 的分类需要遍历命令表,AUTH 和 ACL 在 init 中注册以避免初始化循环,
+// 它们只修改连接和用户的状态,不需要写入 raft 日志
+func init() {
+	supportedCommands["auth"] = command{auth, false}
+	supportedCommands["acl"] = command{acl, false}
+}
+
+// 按照子命令分别授权的命令,ACL 中使用 命令|子命令 表示
+var aclSubcommands = map[string][]string{
+	"acl":     {"setuser", "getuser", "deluser", "list", "users", "whoami", "cat", "load", "save"},
+	"config":  {"get", "set"},
+	"client":  {"id", "getname", "setname", "list", "kill"},
+	"slowlog": {"get", "len", "reset"},
+}
+
+// 每个分类包含的命令,read/write/all 根据命令表计算
+var aclCategoryCommands = map[string][]string{
+	"keyspace": {"del", "exists", "type", "expire", "pexpire", "expireat", "pexpireat", "ttl", "pttl", "persist",
+		"keys", "scan", "rename", "renamenx", "dbsize", "randomkey", "move", "swapdb", "flushdb", "flushall"},
+	"string": {"set", "setnx", "get", "getset", "getdel", "getex", "mset", "msetnx", "mget", "incr", "incrby",
+		"decr", "decrby", "incrbyfloat", "append", "strlen", "getrange", "setrange"},
+	"hash": {"hset", "hget", "hdel", "hmset", "hmget", "hsetnx", "hgetall", "hkeys", "hvals", "hlen", "hexists",
+		"hincrby", "hincrbyfloat", "hscan"},
+	"list": {"lpush", "rpush", "lpop", "rpop", "llen", "lindex", "lrange", "lset", "ltrim", "linsert", "lrem",
+		"lmove", "rpoplpush", "blpop", "brpop", "blmove", "brpoplpush"},
+	"set": {"sadd", "srem", "sismember", "scard", "smembers", "spop", "srandmember", "smove", "sinter", "sunion",
+		"sdiff", "sinterstore", "sunionstore", "sdiffstore", "sscan"},
+	"sortedset": {"zadd", "zscore", "zcard", "zincrby", "zrem", "zrange", "zrevrange", "zrangebyscore",
+		"zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zrank", "zrevrank", "zcount", "zpopmin", "zpopmax",
+		"zremrangebyscore"},
+	"pubsub":      {"subscribe", "unsubscribe", "psubscribe", "punsubscribe", "publish", "pubsub"},
+	"transaction": {"multi", "exec", "discard", "watch", "unwatch"},
+	"connection":  {"ping", "quit", "auth", "select", "acl|whoami", "client|id", "client|getname", "client|setname"},
+	"blocking":    {"blpop", "brpop", "blmove", "brpoplpush"},
+	"admin": {"config|get", "config|set", "acl|setuser", "acl|getuser", "acl|deluser", "acl|list", "acl|users",
+		"acl|load", "acl|save", "client|list", "client|kill", "slowlog|get", "slowlog|len", "slowlog|reset", "monitor"},
+	"dangerous": {"flushdb", "flushall", "swapdb", "keys", "info", "config|get", "config|set", "acl|setuser",
+		"acl|getuser", "acl|deluser", "acl|list", "acl|users", "acl|load", "acl|save", "client|list", "client|kill",
+		"slowlog|get", "slowlog|len", "slowlog|reset", "monitor"},
+}
+
+// 命令表中不需要写入 raft 日志,但是会修改数据的命令
+var aclExtraWriteCommands = map[string]bool{
+	"blpop": true, "brpop": true, "blmove": true, "brpoplpush": true, "move": true, "swapdb": true,
+}
+
+// 命令中 key 的位置,和 Redis 的 firstkey/lastkey/step 相同,last 为负数时从末尾开始计算,first 为0表示没有 key,
+// 不在表中的数据类型和键空间命令只有第一个参数是 key
+type keySpec struct {
+	first, last, step int
+}
+
+var commandKeySpecs = map[string]keySpec{
+	"del": {1, -1, 1}, "exists": {1, -1, 1}, "mget": {1, -1, 1}, "watch": {1, -1, 1},
+	"sinter": {1, -1, 1}, "sunion": {1, -1, 1}, "sdiff": {1, -1, 1},
+	"sinterstore": {1, -1, 1}, "sunionstore": {1, -1, 1}, "sdiffstore": {1, -1, 1},
+	"mset": {1, -1, 2}, "msetnx": {1, -1, 2},
+	"rename": {1, 2, 1}, "renamenx": {1, 2, 1}, "smove": {1, 2, 1}, "lmove": {1, 2, 1}, "rpoplpush": {1, 2, 1},
+	"blmove": {1, 2, 1}, "brpoplpush": {1, 2, 1},
+	"blpop": {1, -2, 1}, "brpop": {1, -2, 1},
+	"keys": {}, "scan": {}, "dbsize": {}, "randomkey": {}, "swapdb": {}, "flushdb": {}, "flushall": {},
+}
+
+// ACL 使用的命令名称和分类在第一次使用时根据命令表计算,exec 在 init 中才注册
+var (
+	aclTableOnce  sync.Once
+	aclCommands   map[string]bool            //所有的命令名称,包括 命令|子命令
+	aclCategories map[string]map[string]bool //分类 -> 命令
+)
+
+func initACLTables() {
+	aclTableOnce.Do(func() {
+		aclCommands = make(map[string]bool)
+		for name := range supportedCommands {
+			if subs, ok := aclSubcommands[name]; ok {
+				for _, sub := range subs {
+					aclCommands[name+"|"+sub] = true
+				}
+				continue
+			}
+			aclCommands[name] = true
+		}
+
+		aclCategories = make(map[string]map[string]bool)
+		for category, names := range aclCategoryCommands {
+			aclCategories[category] = make(map[string]bool)
+			for _, name := range names {
+				aclCategories[category][name] = true
+			}
+		}
+		aclCategories["all"] = make(map[string]bool)
+		aclCategories["read"] = make(map[string]bool)
+		aclCategories["write"] = make(map[string]bool)
+		for name := range aclCommands {
+			aclCategories["all"][name] = true
+			base, _, _ := strings.Cut(name, "|")
+			if supportedCommands[base].write || aclExtraWriteCommands[base] {
+				aclCategories["write"][name] = true
+				continue
+			}
+			for _, category := range []string{"keyspace", "string", "hash", "list", "set", "sortedset"} {
+				if aclCategories[category][name] {
+					aclCategories["read"][name] = true
+				}
+			}
+		}
+	})
+}
+
+// ACL 中使用的命令名称,有子命令的命令返回 命令|子命令,未知的子命令返回空,由命令本身返回错误
+func aclCommandName(command string, args [][]byte) string {
+	subs, ok := aclSubcommands[command]
+	if !ok {
+		return command
+	}
+	if len(args) < 2 {
+		return ""
+	}
+	sub := strings.ToLower(string(args[1]))
+	for _, s := range subs {
+		if s == sub {
+			return command + "|" + sub
+		}
+	}
+	return ""
+}
+
+// 命令中访问的 key
+func commandKeys(command string, args [][]byte) [][]byte {
+	initACLTables()
+	spec, ok := commandKeySpecs[command]
+	if !ok {
+		spec = keySpec{1, 1, 1}
+		isKeyCommand := false
+		for _, category := range []string{"keyspace", "string", "hash", "list", "set", "sortedset"} {
+			isKeyCommand = isKeyCommand || aclCategories[category][command]
+		}
+		if !isKeyCommand {
+			return nil
+		}
+	}
+	if spec.first == 0 {
+		return nil
+	}
+	last := spec.last
+	if last < 0 {
+		last += len(args)
+	}
+	var keys [][]byte
+	for i := spec.first; i <= last && i < len(args); i += spec.step {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+// ACL 用户,命令规则按照顺序执行之后得到允许执行的命令
+type aclUser struct {
+	name         string
+	enabled      bool
+	noPass       bool
+	passwords    []string //密码的 sha256
+	allKeys      bool
+	keyPatterns  []string
+	commandRules []string
+	allowed      map[string]bool
+}
+
+// 新创建的用户没有启用,没有密码,不能访问任何 key 和命令
+func newACLUser(name string) *aclUser {
+	return &aclUser{name: name, allowed: make(map[string]bool)}
+}
+
+// 默认用户可以不使用密码执行所有的命令
+func newDefaultACLUser() *aclUser {
+	user := newACLUser(defaultUserName)
+	for _, rule := range []string{"on", "nopass", "allkeys", "allcommands"} {
+		_ = user.applyRule(rule)
+	}
+	return user
+}
+
+func (u *aclUser) clone() *aclUser {
+	c := *u
+	c.passwords = append([]string(nil), u.passwords...)
+	c.keyPatterns = append([]string(nil), u.keyPatterns...)
+	c.commandRules = append([]string(nil), u.commandRules...)
+	c.allowed = make(map[string]bool, len(u.allowed))
+	for name, ok := range u.allowed {
+		c.allowed[name] = ok
+	}
+	return &c
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func (u *aclUser) addPassword(hash string) {
+	u.noPass = false
+	for _, p := range u.passwords {
+		if p == hash {
+			return
+		}
+	}
+	u.passwords = append(u.passwords, hash)
+}
+
+func (u *aclUser) removePassword(hash string) error {
+	for i, p := range u.passwords {
+		if p == hash {
+			u.passwords = append(u.passwords[:i], u.passwords[i+1:]...)
+			return nil
+		}
+	}
+	return errACLNoSuchPassword
+}
+
+// 执行一条 ACL SETUSER 的规则
+func (u *aclUser) applyRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.enabled = true
+	case "off":
+		u.enabled = false
+	case "nopass":
+		u.noPass = true
+		u.passwords = nil
+	case "resetpass":
+		u.noPass = false
+		u.passwords = nil
+	case "allkeys":
+		u.allKeys = true
+		u.keyPatterns = []string{"*"}
+	case "resetkeys":
+		u.allKeys = false
+		u.keyPatterns = nil
+	case "allcommands":
+		return u.applyRule("+@all")
+	case "nocommands":
+		return u.applyRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "off", "-@all"} {
+			_ = u.applyRule(r)
+		}
+	default:
+		if rule == "" {
+			return errACLSyntax
+		}
+		switch rule[0] {
+		case '>':
+			u.addPassword(hashPassword(rule[1:]))
+		case '<':
+			return u.removePassword(hashPassword(rule[1:]))
+		case '#':
+			if !isPasswordHash(rule[1:]) {
+				return errACLInvalidHash
+			}
+			u.addPassword(rule[1:])
+		case '!':
+			return u.removePassword(rule[1:])
+		case '~':
+			if !u.allKeys {
+				u.keyPatterns = append(u.keyPatterns, rule[1:])
+				u.allKeys = rule[1:] == "*"
+				if u.allKeys {
+					u.keyPatterns = []string{"*"}
+				}
+			}
+		case '+', '-':
+			return u.applyCommandRule(strings.ToLower(rule))
+		default:
+			return errACLSyntax
+		}
+	}
+	return nil
+}
+
+func isPasswordHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// +command -command +@category -@category,+@all 和 -@all 会覆盖之前所有的命令规则
+func (u *aclUser) applyCommandRule(rule string) error {
+	names, err := expandCommandRule(rule[1:])
+	if err != nil {
+		return err
+	}
+	if rule[1:] == "@all" {
+		u.commandRules = nil
+		u.allowed = make(map[string]bool)
+	}
+	for _, name := range names {
+		u.allowed[name] = rule[0] == '+'
+	}
+	u.commandRules = append(u.commandRules, rule)
+	return nil
+}
+
+// 规则中的命令或者分类包含的所有命令
+func expandCommandRule(name string) ([]string, error) {
+	initACLTables()
+	var names []string
+	switch {
+	case strings.HasPrefix(name, "@"):
+		commands, ok := aclCategories[name[1:]]
+		if !ok {
+			return nil, errACLUnknownName
+		}
+		for command := range commands {
+			names = append(names, command)
+		}
+	case aclCommands[name]:
+		names = append(names, name)
+	case aclSubcommands[name] != nil:
+		for _, sub := range aclSubcommands[name] {
+			names = append(names, name+"|"+sub)
+		}
+	default:
+		return nil, errACLUnknownName
+	}
+	return names, nil
+}
+
+func (u *aclUser) checkPassword(password string) bool {
+	if u.noPass {
+		return true
+	}
+	hash := hashPassword(password)
+	var ok bool
+	for _, p := range u.passwords {
+		if subtle.ConstantTimeCompare([]byte(p), []byte(hash)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+func (u *aclUser) canAccessKey(key []byte) bool {
+	if u.allKeys {
+		return true
+	}
+	for _, pattern := range u.keyPatterns {
+		if utils.GlobMatch([]byte(pattern), key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) flags() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.noPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) keysRule() string {
+	var rules []string
+	for _, pattern := range u.keyPatterns {
+		rules = append(rules, "~"+pattern)
+	}
+	return strings.Join(rules, " ")
+}
+
+func (u *aclUser) commandsRule() string {
+	if len(u.commandRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.commandRules, " ")
+}
+
+// 用户的所有规则,ACL LIST 和 ACL 文件使用相同的格式
+func (u *aclUser) describe() string {
+	rules := u.flags()
+	for _, p := range u.passwords {
+		rules = append(rules, "#"+p)
+	}
+	if keys := u.keysRule(); keys != "" {
+		rules = append(rules, keys)
+	}
+	rules = append(rules, u.commandsRule())
+	return strings.Join(rules, " ")
+}
+
+// 所有的 ACL 用户,配置了 aclfile 时修改用户之后保存到文件中
+type aclStore struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+	file  string
+}
+
+// 创建 ACL 用户,requirepass 不为空时作为默认用户的密码
+func newACLStore(file, requirepass string) (*aclStore, error) {
+	store := &aclStore{
+		users: map[string]*aclUser{defaultUserName: newDefaultACLUser()},
+		file:  file,
+	}
+	if file != "" {
+		if err := store.load(); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if requirepass != "" {
+		store.setDefaultPassword(requirepass)
+	}
+	return store, nil
+}
+
+// 从 ACL 文件中读取用户,格式和 Redis 的 aclfile 相同: user <name> <rule> ...
+func (store *aclStore) load() error {
+	if store.file == "" {
+		return errNoACLFile
+	}
+	file, err := os.Open(store.file)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	users := make(map[string]*aclUser)
+	scanner := bufio.NewScanner(file)
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "user" {
+			return fmt.Errorf("%s:%d: %w", store.file, lineNo, errACLInvalidFileLine)
+		}
+		user := newACLUser(fields[1])
+		for _, rule := range fields[2:] {
+			if err := user.applyRule(rule); err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", store.file, lineNo, rule, err)
+			}
+		}
+		users[user.name] = user
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := users[defaultUserName]; !ok {
+		users[defaultUserName] = newDefaultACLUser()
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.users = users
+	return nil
+}
+
+// 按用户名的顺序写入 ACL 文件,先写入临时文件再重命名
+func (store *aclStore) save() error {
+	if store.file == "" {
+		return errNoACLFile
+	}
+	store.mu.RLock()
+	var sb strings.Builder
+	for _, name := range store.userNames() {
+		sb.WriteString(fmt.Sprintf("user %s %s\n", name, store.users[name].describe()))
+	}
+	store.mu.RUnlock()
+
+	tmpPath := store.file + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(sb.String()), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, store.file)
+}
+
+// 修改之后自动保存
+func (store *aclStore) persist() error {
+	if store.file == "" {
+		return nil
+	}
+	return store.save()
+}
+
+// 调用方需要持有锁
+func (store *aclStore) userNames() []string {
+	names := make([]string, 0, len(store.users))
+	for name := range store.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// requirepass 只是设置默认用户的密码,为空时默认用户不需要密码
+func (store *aclStore) setDefaultPassword(password string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	user := store.users[defaultUserName].clone()
+	user.noPass = password == ""
+	user.passwords = nil
+	if password != "" {
+		user.addPassword(hashPassword(password))
+	}
+	store.users[defaultUserName] = user
+}
+
+// 默认用户不需要密码时,新的连接自动以默认用户登录
+func (store *aclStore) defaultNoPass() bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user := store.users[defaultUserName]
+	return user.enabled && user.noPass
+}
+
+func (store *aclStore) authenticate(name, password string) bool {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user, ok := store.users[name]
+	return ok && user.enabled && user.checkPassword(password)
+}
+
+// 检查用户是否可以执行命令以及访问命令中的 key
+func (store *aclStore) check(name, command string, args [][]byte) error {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user, ok := store.users[name]
+	if !ok || !user.enabled {
+		return errNoAuth
+	}
+	aclName := aclCommandName(command, args)
+	if aclName == "" {
+		return nil
+	}
+	if !user.allowed[aclName] {
+		return newNoPermError(name, aclName)
+	}
+	for _, key := range commandKeys(command, args) {
+		if !user.canAccessKey(key) {
+			return errNoKeyPermission
+		}
+	}
+	return nil
+}
+
+// 创建或者修改用户,所有的规则都合法时才会生效
+func (store *aclStore) setUser(name string, rules []string) error {
+	store.mu.Lock()
+	user, ok := store.users[name]
+	if ok {
+		user = user.clone()
+	} else {
+		user = newACLUser(name)
+	}
+	for _, rule := range rules {
+		if err := user.applyRule(rule); err != nil {
+			store.mu.Unlock()
+			return newACLRuleError(rule, err)
+		}
+	}
+	store.users[name] = user
+	store.mu.Unlock()
+	return store.persist()
+}
+
+func (store *aclStore) delUsers(names []string) (int, error) {
+	store.mu.Lock()
+	var count int
+	for _, name := range names {
+		if name == defaultUserName {
+			store.mu.Unlock()
+			return 0, errDeleteDefaultUser
+		}
+	}
+	for _, name := range names {
+		if _, ok := store.users[name]; ok {
+			delete(store.users, name)
+			count++
+		}
+	}
+	store.mu.Unlock()
+	if count == 0 {
+		return 0, nil
+	}
+	return count, store.persist()
+}
+
+// 检查客户端是否可以执行命令,AUTH 和 QUIT 不需要登录
+func (cli *BitcaskClient) checkACL(command string, args [][]byte) error {
+	if _, ok := supportedCommands[command]; !ok || command == "auth" || command == "quit" {
+		return nil
+	}
+	if cli.user == "" {
+		return errNoAuth
+	}
+	return cli.server.acl.check(cli.user, command, args)
+}
+
+// AUTH [username] password
+func auth(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	var name, password string
+	switch len(args) {
+	case 1:
+		if cli.server.acl.defaultNoPass() {
+			return nil, errNoPasswordConfigured
+		}
+		name, password = defaultUserName, string(args[0])
+	case 2:
+		name, password = string(args[0]), string(args[1])
+	default:
+		return nil, newWrongNumberOfArgsError("auth")
+	}
+
+	if !cli.server.acl.authenticate(name, password) {
+		return nil, errWrongPass
+	}
+	cli.user = name
+	return redcon.SimpleString("OK"), nil
+}
+
+// ACL SETUSER|GETUSER|DELUSER|LIST|USERS|WHOAMI|CAT|LOAD|SAVE
+func acl(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("acl")
+	}
+
+	store := cli.server.acl
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "setuser":
+		if len(args) < 2 {
+			return nil, newWrongNumberOfArgsError("acl|setuser")
+		}
+		rules := make([]string, 0, len(args)-2)
+		for _, rule := range args[2:] {
+			rules = append(rules, string(rule))
+		}
+		if err := store.setUser(string(args[1]), rules); err != nil {
+			return nil, err
+		}
+		return redcon.SimpleString("OK"), nil
+	case "getuser":
+		if len(args) != 2 {
+			return nil, newWrongNumberOfArgsError("acl|getuser")
+		}
+		return store.getUser(string(args[1])), nil
+	case "deluser":
+		if len(args) < 2 {
+			return nil, newWrongNumberOfArgsError("acl|deluser")
+		}
+		names := make([]string, 0, len(args)-1)
+		for _, name := range args[1:] {
+			names = append(names, string(name))
+		}
+		count, err := store.delUsers(names)
+		if err != nil {
+			return nil, err
+		}
+		return redcon.SimpleInt(count), nil
+	case "list", "users":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("acl|" + sub)
+		}
+		store.mu.RLock()
+		defer store.mu.RUnlock()
+		var res []interface{}
+		for _, name := range store.userNames() {
+			if sub == "list" {
+				res = append(res, fmt.Sprintf("user %s %s", name, store.users[name].describe()))
+			} else {
+				res = append(res, name)
+			}
+		}
+		return res, nil
+	case "whoami":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("acl|whoami")
+		}
+		return cli.user, nil
+	case "cat":
+		if len(args) > 2 {
+			return nil, newWrongNumberOfArgsError("acl|cat")
+		}
+		return aclCat(args[1:])
+	case "load", "save":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("acl|" + sub)
+		}
+		var err error
+		if sub == "load" {
+			err = store.load()
+		} else {
+			err = store.save()
+		}
+		if err != nil {
+			if errors.Is(err, errNoACLFile) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("ERR %v", err)
+		}
+		return redcon.SimpleString("OK"), nil
+	default:
+		return nil, errUnknownACLCommand
+	}
+}
+
+// 用户的配置,用户不存在时返回空值
+func (store *aclStore) getUser(name string) interface{} {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+	user, ok := store.users[name]
+	if !ok {
+		return nil
+	}
+	flags := make([]interface{}, 0, 2)
+	for _, flag := range user.flags() {
+		flags = append(flags, flag)
+	}
+	passwords := make([]interface{}, 0, len(user.passwords))
+	for _, p := range user.passwords {
+		passwords = append(passwords, p)
+	}
+	return []interface{}{
+		"flags", flags,
+		"passwords", passwords,
+		"commands", user.commandsRule(),
+		"keys", user.keysRule(),
+	}
+}
+
+// 不带参数时返回所有的分类,否则返回分类中的所有命令
+func aclCat(args [][]byte) (interface{}, error) {
+	initACLTables()
+	var names []string
+	if len(args) == 0 {
+		for category := range aclCategories {
+			names = append(names, category)
+		}
+	} else {
+		commands, ok := aclCategories[strings.ToLower(string(args[0]))]
+		if !ok {
+			return nil, errUnknownACLCategory
+		}
+		for command := range commands {
+			names = append(names, command)
+		}
+	}
+	sort.Strings(names)
+	res := make([]interface{}, len(names))
+	for i, name := range names {
+		res[i] = name
+	}
+	return res, nil
+}
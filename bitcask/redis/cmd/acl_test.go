@@ -0,0 +1,169 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBitcaskServer_Auth(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	_, err := cli.do("AUTH", "secret")
+	assert.NotNil(t, err)
+	res, err := cli.do("CONFIG", "SET", "requirepass", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+
+	// 设置密码之后新的连接需要认证
+	other := newTestClient(t, addr)
+	defer other.close()
+	_, err = other.do("GET", "k")
+	assert.True(t, strings.HasPrefix(err.Error(), "NOAUTH"))
+	_, err = other.do("AUTH", "wrong")
+	assert.True(t, strings.HasPrefix(err.Error(), "WRONGPASS"))
+	res, err = other.do("AUTH", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = other.do("AUTH", "default", "secret")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = other.do("ACL", "WHOAMI")
+	assert.Nil(t, err)
+	assert.Equal(t, "default", res)
+
+	// 已经登录的连接不受影响
+	res, err = cli.do("SET", "k", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+
+	// AUTH 不能在事务中执行
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("AUTH", "secret")
+	assert.NotNil(t, err)
+	_, err = cli.do("EXEC")
+	assert.NotNil(t, err)
+
+	_, err = cli.do("CONFIG", "SET", "requirepass", "")
+	assert.Nil(t, err)
+	third := newTestClient(t, addr)
+	defer third.close()
+	res, err = third.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", res)
+}
+
+func TestBitcaskServer_ACL(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-acl")
+	defer removeTestDirs(dir)
+	aclFile := filepath.Join(filepath.Dir(dir), filepath.Base(dir)+".acl")
+	defer os.Remove(aclFile)
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	cfg.aclFile = aclFile
+	svr, addr := startTestServerWithConfig(t, cfg)
+	admin := newTestClient(t, addr)
+
+	res, err := admin.do("ACL", "SETUSER", "alice", "on", ">pw", "~app:*", "+@read", "+@transaction", "+@connection", "+set", "-@dangerous")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	_, err = admin.do("ACL", "SETUSER", "bob", "on", "#bad")
+	assert.NotNil(t, err)
+	_, err = admin.do("ACL", "SETUSER", "bob", "+unknown")
+	assert.NotNil(t, err)
+	res, err = admin.do("ACL", "USERS")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"alice", "default"}, res)
+	res, err = admin.do("ACL", "GETUSER", "alice")
+	assert.Nil(t, err)
+	user := res.([]interface{})
+	assert.Equal(t, []interface{}{"on"}, user[1])
+	assert.Equal(t, []interface{}{hashPassword("pw")}, user[3])
+	assert.Equal(t, "+@read +@transaction +@connection +set -@dangerous", user[5])
+	assert.Equal(t, "~app:*", user[7])
+	res, err = admin.do("ACL", "GETUSER", "nobody")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	cli := newTestClient(t, addr)
+	_, err = cli.do("AUTH", "alice", "wrong")
+	assert.NotNil(t, err)
+	_, err = cli.do("AUTH", "alice", "pw")
+	assert.Nil(t, err)
+	res, err = cli.do("SET", "app:1", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("GET", "app:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", res)
+	_, err = cli.do("GET", "other")
+	assert.Equal(t, errNoKeyPermission.Error(), err.Error())
+	_, err = cli.do("MGET", "app:1", "other")
+	assert.Equal(t, errNoKeyPermission.Error(), err.Error())
+	_, err = cli.do("DEL", "app:1")
+	assert.True(t, strings.HasPrefix(err.Error(), "NOPERM User alice"))
+	_, err = cli.do("KEYS", "*")
+	assert.NotNil(t, err)
+	_, err = cli.do("ACL", "LIST")
+	assert.NotNil(t, err)
+	_, err = cli.do("CONFIG", "GET", "dir")
+	assert.NotNil(t, err)
+
+	// 排队时没有权限的命令会让事务失败
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "app:1", "v1")
+	assert.Nil(t, err)
+	_, err = cli.do("DEL", "app:1")
+	assert.NotNil(t, err)
+	_, err = cli.do("EXEC")
+	assert.NotNil(t, err)
+	cli.close()
+
+	res, err = admin.do("ACL", "LIST")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{
+		"user alice on #" + hashPassword("pw") + " ~app:* +@read +@transaction +@connection +set -@dangerous",
+		"user default on nopass ~* +@all",
+	}, res)
+	res, err = admin.do("ACL", "CAT", "blocking")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"blmove", "blpop", "brpop", "brpoplpush"}, res)
+	_, err = admin.do("ACL", "CAT", "unknown")
+	assert.NotNil(t, err)
+	_, err = admin.do("ACL", "DELUSER", "default")
+	assert.NotNil(t, err)
+	admin.close()
+	svr.shutdown()
+
+	// 重启之后从 ACL 文件中恢复用户
+	_, addr = startTestServerWithConfig(t, cfg)
+	cli = newTestClient(t, addr)
+	defer cli.close()
+	_, err = cli.do("AUTH", "alice", "pw")
+	assert.Nil(t, err)
+	res, err = cli.do("GET", "app:1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", res)
+	res, err = cli.do("ACL", "WHOAMI")
+	assert.Nil(t, err)
+	assert.Equal(t, "alice", res)
+
+	// 删除用户之后已经登录的连接需要重新认证
+	admin = newTestClient(t, addr)
+	defer admin.close()
+	res, err = admin.do("ACL", "DELUSER", "alice", "nobody")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	_, err = cli.do("GET", "app:1")
+	assert.True(t, strings.HasPrefix(err.Error(), "NOAUTH"))
+	data, err := os.ReadFile(aclFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "user default on nopass ~* +@all\n", string(data))
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	bitcask_redis "kv-go/bitcask/redis"
+	"math"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+var (
+	errTimeoutNegative = errors.New("ERR timeout is negative")
+	errTimeoutInvalid  = errors.New("ERR timeout is not a float or out of range")
+)
+
+// 会阻塞等待的命令,等待的时间不计入慢日志
+var blockingCommands = map[string]bool{
+	"blpop":      true,
+	"brpop":      true,
+	"blmove":     true,
+	"brpoplpush": true,
+}
+
+// 阻塞超时返回的空数组
+type nullArray struct{}
+
+func (nullArray) MarshalRESP() []byte {
+	return []byte("*-1\r\n")
+}
+
+// 阻塞在列表上的客户端
+type blockingWaiter struct {
+	db     *bitcask_redis.RedisDataStructure
+	keys   []string
+	notify chan struct{} //有新元素写入时收到通知
+}
+
+// 不同的数据库中可能有相同的 key
+type blockingKey struct {
+	db  *bitcask_redis.RedisDataStructure
+	key string
+}
+
+// 按照阻塞的先后顺序记录每个 key 上等待的客户端,新元素写入时只唤醒最早的客户端,
+// 这个客户端取到元素之后再唤醒下一个,避免所有客户端同时争抢
+type blockingRegistry struct {
+	mu      sync.Mutex
+	waiters map[blockingKey][]*blockingWaiter
+	closed  chan struct{}
+}
+
+func newBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{
+		waiters: make(map[blockingKey][]*blockingWaiter),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (br *blockingRegistry) register(db *bitcask_redis.RedisDataStructure, keys [][]byte) *blockingWaiter {
+	w := &blockingWaiter{db: db, notify: make(chan struct{}, 1)}
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	for _, key := range keys {
+		w.keys = append(w.keys, string(key))
+		bk := blockingKey{db: db, key: string(key)}
+		br.waiters[bk] = append(br.waiters[bk], w)
+	}
+	return w
+}
+
+// 移除等待的客户端,并把可能没有被处理的通知传递给下一个客户端
+func (br *blockingRegistry) unregister(w *blockingWaiter) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	for _, key := range w.keys {
+		bk := blockingKey{db: w.db, key: key}
+		queue := br.waiters[bk]
+		for i, waiter := range queue {
+			if waiter == w {
+				queue = append(queue[:i:i], queue[i+1:]...)
+				break
+			}
+		}
+		if len(queue) == 0 {
+			delete(br.waiters, bk)
+			continue
+		}
+		br.waiters[bk] = queue
+		br.signal(queue[0])
+	}
+}
+
+// 列表写入新元素之后唤醒最早等待这个 key 的客户端
+func (br *blockingRegistry) notify(db *bitcask_redis.RedisDataStructure, key []byte) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	if queue := br.waiters[blockingKey{db: db, key: string(key)}]; len(queue) > 0 {
+		br.signal(queue[0])
+	}
+}
+
+// 唤醒所有阻塞的客户端重新检查,SWAPDB 之后调用
+func (br *blockingRegistry) wakeAll() {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	for _, queue := range br.waiters {
+		for _, w := range queue {
+			br.signal(w)
+		}
+	}
+}
+
+// 阻塞中的客户端数量,同一个客户端可能等待多个 key
+func (br *blockingRegistry) numBlocked() int {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	waiters := make(map[*blockingWaiter]struct{})
+	for _, queue := range br.waiters {
+		for _, w := range queue {
+			waiters[w] = struct{}{}
+		}
+	}
+	return len(waiters)
+}
+
+func (br *blockingRegistry) signal(w *blockingWaiter) {
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// 唤醒所有阻塞的客户端,服务关闭时调用
+func (br *blockingRegistry) close() {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+	select {
+	case <-br.closed:
+	default:
+		close(br.closed)
+	}
+}
+
+// 依次尝试 keys 中的每一个 key,直到 pop 返回元素、超时或者 cancel 被关闭,timeout 为0表示一直等待,
+// db 返回客户端当前使用的数据库,SWAPDB 之后需要在新的数据库上重新注册
+func (br *blockingRegistry) wait(db func() *bitcask_redis.RedisDataStructure, keys [][]byte, timeout time.Duration,
+	cancel <-chan struct{}, pop func(key []byte) (interface{}, error)) (interface{}, []byte, error) {
+	//先注册再尝试,避免错过两者之间写入的元素
+	w := br.register(db(), keys)
+	defer func() {
+		br.unregister(w)
+	}()
+
+	var timer <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	for {
+		if current := db(); current != w.db {
+			br.unregister(w)
+			w = br.register(current, keys)
+		}
+		for _, key := range keys {
+			res, err := pop(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			if res != nil {
+				return res, key, nil
+			}
+		}
+		select {
+		case <-w.notify:
+		case <-timer:
+			return nil, nil, nil
+		case <-br.closed:
+			return nil, nil, nil
+		case <-cancel:
+			//客户端已经断开,不再取出元素,留给其他等待的客户端
+			return nil, nil, nil
+		}
+	}
+}
+
+// 阻塞期间监视客户端是否断开了连接: 阻塞的命令占用着读取命令的 goroutine,
+// 客户端断开时 redcon 要等命令返回之后才会发现,这里预读底层的 socket,
+// 读到 EOF 时取消等待。返回的函数停止监视
+func (cli *BitcaskClient) watchDisconnect() (stop func()) {
+	if cli.conn == nil {
+		return func() {}
+	}
+	conn := cli.conn.NetConn()
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 1)
+		var n int
+		var peekErr error
+		//MSG_PEEK 不会消费数据,之后的命令仍然由 redcon 读取
+		err := raw.Read(func(fd uintptr) bool {
+			n, _, peekErr = syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK)
+			return !errors.Is(peekErr, syscall.EAGAIN)
+		})
+		//有新的数据时无法判断连接是否会关闭,停止监视;被 stop 打断时 err 不为空
+		if err == nil && (n == 0 || peekErr != nil) {
+			cli.cancelBlocking()
+		}
+	}()
+	return func() {
+		//让等待中的预读立即返回
+		_ = conn.SetReadDeadline(time.Now())
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// 解析以秒为单位的超时时间
+func parseBlockingTimeout(arg []byte) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errTimeoutInvalid
+	}
+	if seconds < 0 {
+		return 0, errTimeoutNegative
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// BLPOP key [key ...] timeout
+func blpop(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("blpop")
+	}
+	return blockingPop(cli, args, command{lpop, true}, "lpop")
+}
+
+// BRPOP key [key ...] timeout
+func brpop(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("brpop")
+	}
+	return blockingPop(cli, args, command{rpop, true}, "rpop")
+}
+
+func blockingPop(cli *BitcaskClient, args [][]byte, popCmd command, name string) (interface{}, error) {
+	timeout, err := parseBlockingTimeout(args[len(args)-1])
+	if err != nil {
+		return nil, err
+	}
+	keys := args[:len(args)-1]
+	stop := cli.watchDisconnect()
+	defer stop()
+	res, key, err := cli.server.blocking.wait(cli.currentDB, keys, timeout, cli.cancel, func(key []byte) (interface{}, error) {
+		return cli.exec(popCmd, [][]byte{[]byte(name), key})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nullArray{}, nil
+	}
+	return []interface{}{key, res}, nil
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func blmove(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 5 {
+		return nil, newWrongNumberOfArgsError("blmove")
+	}
+	if _, err := parseListSide(args[2]); err != nil {
+		return nil, err
+	}
+	if _, err := parseListSide(args[3]); err != nil {
+		return nil, err
+	}
+	return blockingMove(cli, args[0], args[1], args[2], args[3], args[4])
+}
+
+// BRPOPLPUSH source destination timeout
+func brpoplpush(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("brpoplpush")
+	}
+	return blockingMove(cli, args[0], args[1], []byte("right"), []byte("left"), args[2])
+}
+
+func blockingMove(cli *BitcaskClient, source, destination, srcSide, dstSide, timeoutArg []byte) (interface{}, error) {
+	timeout, err := parseBlockingTimeout(timeoutArg)
+	if err != nil {
+		return nil, err
+	}
+	stop := cli.watchDisconnect()
+	defer stop()
+	res, _, err := cli.server.blocking.wait(cli.currentDB, [][]byte{source}, timeout, cli.cancel,
+		func(key []byte) (interface{}, error) {
+			return cli.exec(command{lmove, true}, [][]byte{[]byte("lmove"), source, destination, srcSide, dstSide})
+		})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBitcaskServer_BLPop(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	// 列表不为空时直接返回
+	_, err := cli.do("RPUSH", "list-1", "a")
+	assert.Nil(t, err)
+	res, err := cli.do("BLPOP", "list-0", "list-1", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"list-1", "a"}, res)
+
+	// 超时返回空值
+	start := time.Now()
+	res, err = cli.do("BRPOP", "list-1", "0.1")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	_, err = cli.do("BLPOP", "list-1", "-1")
+	assert.NotNil(t, err)
+	_, err = cli.do("BLPOP", "list-1", "abc")
+	assert.NotNil(t, err)
+
+	// 多个客户端按阻塞的先后顺序获得元素
+	waiters := make([]*testClient, 3)
+	results := make([]chan interface{}, 3)
+	for i := range waiters {
+		waiters[i] = newTestClient(t, addr)
+		defer waiters[i].close()
+		results[i] = make(chan interface{}, 1)
+		go func(i int) {
+			res, err := waiters[i].do("BLPOP", "queue", "other", "0")
+			assert.Nil(t, err)
+			results[i] <- res
+		}(i)
+		assert.Eventually(t, func() bool {
+			svr.blocking.mu.Lock()
+			defer svr.blocking.mu.Unlock()
+			return len(svr.blocking.waiters[blockingKey{db: svr.db(0), key: "queue"}]) == i+1
+		}, time.Second, 5*time.Millisecond)
+	}
+	_, err = cli.do("RPUSH", "queue", "job-1", "job-2")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"queue", "job-1"}, <-results[0])
+	assert.Equal(t, []interface{}{"queue", "job-2"}, <-results[1])
+	_, err = cli.do("LPUSH", "other", "job-3")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"other", "job-3"}, <-results[2])
+
+	svr.blocking.mu.Lock()
+	assert.Equal(t, 0, len(svr.blocking.waiters))
+	svr.blocking.mu.Unlock()
+}
+
+func TestBitcaskServer_BLMove(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	waiter := newTestClient(t, addr)
+	defer waiter.close()
+
+	result := make(chan interface{}, 1)
+	go func() {
+		res, err := waiter.do("BLMOVE", "src", "dst", "LEFT", "RIGHT", "5")
+		assert.Nil(t, err)
+		result <- res
+	}()
+	assert.Eventually(t, func() bool {
+		svr.blocking.mu.Lock()
+		defer svr.blocking.mu.Unlock()
+		return len(svr.blocking.waiters[blockingKey{db: svr.db(0), key: "src"}]) == 1
+	}, time.Second, 5*time.Millisecond)
+	_, err := cli.do("RPUSH", "src", "a", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", <-result)
+
+	res, err := cli.do("BRPOPLPUSH", "src", "dst", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", res)
+	res, err = cli.do("LRANGE", "dst", "0", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "a"}, res)
+	res, err = cli.do("BRPOPLPUSH", "src", "dst", "0.05")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+}
+
+func TestBitcaskServer_BLPopDisconnected(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	numWaiters := func() int {
+		svr.blocking.mu.Lock()
+		defer svr.blocking.mu.Unlock()
+		return len(svr.blocking.waiters[blockingKey{db: svr.db(0), key: "queue"}])
+	}
+
+	// 断开连接的客户端不再等待,不会取走之后写入的元素
+	waiter := newTestClient(t, addr)
+	assert.Nil(t, waiter.send("BLPOP", "queue", "0"))
+	assert.Eventually(t, func() bool { return numWaiters() == 1 }, time.Second, 5*time.Millisecond)
+	waiter.close()
+	assert.Eventually(t, func() bool { return numWaiters() == 0 }, time.Second, 5*time.Millisecond)
+	_, err := cli.do("RPUSH", "queue", "job-1")
+	assert.Nil(t, err)
+	res, err := cli.do("LLEN", "queue")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+
+	// 被 CLIENT KILL 断开的客户端同样不会取走元素
+	killed := newTestClient(t, addr)
+	defer killed.close()
+	id, err := killed.do("CLIENT", "ID")
+	assert.Nil(t, err)
+	_, err = cli.do("LPOP", "queue")
+	assert.Nil(t, err)
+	assert.Nil(t, killed.send("BLMOVE", "queue", "dst", "LEFT", "RIGHT", "0"))
+	assert.Eventually(t, func() bool { return numWaiters() == 1 }, time.Second, 5*time.Millisecond)
+	res, err = cli.do("CLIENT", "KILL", "ID", fmt.Sprint(id))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	assert.Eventually(t, func() bool { return numWaiters() == 0 }, time.Second, 5*time.Millisecond)
+	_, err = cli.do("RPUSH", "queue", "job-2")
+	assert.Nil(t, err)
+	res, err = cli.do("LRANGE", "queue", "0", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"job-2"}, res)
+}
@@ -6,8 +6,20 @@ import (
 	"github.com/tidwall/redcon"
 	"kv-go/bitcask"
 	bitcask_redis "kv-go/bitcask/redis"
-	"kv-go/bitcask/utils"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errNotInteger  = errors.New("ERR value is not an integer or out of range")
+	errNotFloat    = errors.New("ERR value is not a valid float")
+	errSyntax      = errors.New("ERR syntax error")
+	errInvalidScan = errors.New("ERR invalid cursor")
+
+	errMinMaxNotFloat  = errors.New("ERR min or max is not a float")
+	errInvalidLexRange = errors.New("ERR min or max not valid string range item")
 )
 
 func newWrongNumberOfArgsError(cmd string) error {
@@ -16,36 +28,227 @@ func newWrongNumberOfArgsError(cmd string) error {
 
 type cmdHandler func(cli *BitcaskClient, args [][]byte) (interface{}, error)
 
-var supportedCommands = map[string]cmdHandler{
-	"set":   set,
-	"get":   get,
-	"hset":  hset,
-	"sadd":  sadd,
-	"lpush": lpush,
-	"zadd":  zadd,
+type command struct {
+	handler cmdHandler
+	write   bool //是否会修改数据,集群模式下写命令需要通过 raft 日志执行
+}
+
+var supportedCommands = map[string]command{
+	"ping": {ping, false},
+	"quit": {nil, false},
+
+	//事务中的写命令在 EXEC 时一起写入 raft 日志,exec 在 multi.go 中注册
+	"multi":   {multi, false},
+	"discard": {discard, false},
+	"watch":   {watch, false},
+	"unwatch": {unwatch, false},
+
+	//订阅命令需要分离连接,在 execClientCommand 中直接处理
+	"subscribe":    {nil, false},
+	"unsubscribe":  {nil, false},
+	"psubscribe":   {nil, false},
+	"punsubscribe": {nil, false},
+	"publish":      {publish, false},
+	"pubsub":       {pubsub, false},
+	"config":       {config, false},
+
+	//MONITOR 需要分离连接,在 execClientCommand 中直接处理
+	"info":    {info, false},
+	"client":  {clientCmd, false},
+	"slowlog": {slowlog, false},
+	"monitor": {nil, false},
+
+	//集群模式下只有数据库0,SELECT/SWAPDB/MOVE 只在单机模式下执行
+	"select":   {selectDB, false},
+	"swapdb":   {swapdb, false},
+	"move":     {move, false},
+	"flushdb":  {flushdb, true},
+	"flushall": {flushall, true},
+
+	"set":         {set, true},
+	"setnx":       {setnx, true},
+	"get":         {get, false},
+	"getset":      {getset, true},
+	"getdel":      {getdel, true},
+	"getex":       {getex, true},
+	"mset":        {mset, true},
+	"msetnx":      {msetnx, true},
+	"mget":        {mget, false},
+	"incr":        {incr, true},
+	"incrby":      {incrby, true},
+	"decr":        {decr, true},
+	"decrby":      {decrby, true},
+	"incrbyfloat": {incrbyfloat, true},
+	"append":      {appendValue, true},
+	"strlen":      {strlen, false},
+	"getrange":    {getrange, false},
+	"setrange":    {setrange, true},
+
+	"del":       {del, true},
+	"exists":    {exists, false},
+	"type":      {typeCmd, false},
+	"expire":    {expire, true},
+	"pexpire":   {pexpire, true},
+	"expireat":  {expireat, true},
+	"pexpireat": {pexpireat, true},
+	"ttl":       {ttl, false},
+	"pttl":      {pttl, false},
+	"persist":   {persist, true},
+	"keys":      {keys, false},
+	"scan":      {scan, false},
+	"rename":    {rename, true},
+	"renamenx":  {renamenx, true},
+	"dbsize":    {dbsize, false},
+	"randomkey": {randomkey, false},
+
+	"hset": {hset, true},
+
+	"hget":         {hget, false},
+	"hdel":         {hdel, true},
+	"hmset":        {hmset, true},
+	"hmget":        {hmget, false},
+	"hsetnx":       {hsetnx, true},
+	"hgetall":      {hgetall, false},
+	"hkeys":        {hkeys, false},
+	"hvals":        {hvals, false},
+	"hlen":         {hlen, false},
+	"hexists":      {hexists, false},
+	"hincrby":      {hincrby, true},
+	"hincrbyfloat": {hincrbyfloat, true},
+	"hscan":        {hscan, false},
+
+	"srem":        {srem, true},
+	"sismember":   {sismember, false},
+	"scard":       {scard, false},
+	"smembers":    {smembers, false},
+	"spop":        {spop, true},
+	"srandmember": {srandmember, false},
+	"smove":       {smove, true},
+	"sinter":      {sinter, false},
+	"sunion":      {sunion, false},
+	"sdiff":       {sdiff, false},
+	"sinterstore": {sinterstore, true},
+	"sunionstore": {sunionstore, true},
+	"sdiffstore":  {sdiffstore, true},
+	"sscan":       {sscan, false},
+
+	"rpush":     {rpush, true},
+	"lpop":      {lpop, true},
+	"rpop":      {rpop, true},
+	"llen":      {llen, false},
+	"lindex":    {lindex, false},
+	"lrange":    {lrange, false},
+	"lset":      {lset, true},
+	"ltrim":     {ltrim, true},
+	"linsert":   {linsert, true},
+	"lrem":      {lrem, true},
+	"lmove":     {lmove, true},
+	"rpoplpush": {rpoplpush, true},
+
+	//阻塞命令本身不写入 raft 日志,而是在等待期间通过对应的非阻塞命令写入
+	"blpop":      {blpop, false},
+	"brpop":      {brpop, false},
+	"blmove":     {blmove, false},
+	"brpoplpush": {brpoplpush, false},
+
+	"zadd":             {zadd, true},
+	"zscore":           {zscore, false},
+	"zcard":            {zcard, false},
+	"zincrby":          {zincrby, true},
+	"zrem":             {zrem, true},
+	"zrange":           {zrange, false},
+	"zrevrange":        {zrevrange, false},
+	"zrangebyscore":    {zrangebyscore, false},
+	"zrevrangebyscore": {zrevrangebyscore, false},
+	"zrangebylex":      {zrangebylex, false},
+	"zrevrangebylex":   {zrevrangebylex, false},
+	"zrank":            {zrank, false},
+	"zrevrank":         {zrevrank, false},
+	"zcount":           {zcount, false},
+	"zpopmin":          {zpopmin, true},
+	"zpopmax":          {zpopmax, true},
+	"zremrangebyscore": {zremrangebyscore, true},
+	"sadd":             {sadd, true},
+	"lpush":            {lpush, true},
 }
 
 type BitcaskClient struct {
-	server *BitcaskServer
-	db     *bitcask_redis.RedisDataStructure
+	server  *BitcaskServer
+	db      *bitcask_redis.RedisDataStructure
+	dbIndex int //SELECT 选择的数据库
+
+	tx         *transaction                      //MULTI 之后排队的命令,为空表示不在事务中
+	watchDB    *bitcask_redis.RedisDataStructure //WATCH 时使用的 DB
+	watchIndex int                               //WATCH 时选择的数据库
+	watched    []watchedKey                      //WATCH 的 key 和当时的修改版本
+
+	sub *subscriber //订阅过频道之后从事件循环中分离出来的连接
+
+	user string //登录的 ACL 用户,为空表示还没有通过认证
+
+	id        int64       //连接的编号
+	conn      redcon.Conn //CLIENT KILL 时关闭底层的连接
+	addr      string
+	createdAt time.Time
+	info      *clientInfo //CLIENT LIST 读取的状态,事务中执行命令时共用
+	monitor   *monitor    //执行 MONITOR 之后从事件循环中分离出来的连接
+
+	cancel     chan struct{} //连接断开或者被 CLIENT KILL 时关闭,取消阻塞的命令
+	cancelOnce sync.Once
+
+	logIndex uint64 //集群模式下正在应用的 raft 日志的索引,为 0 表示不是在状态机中执行
 }
 
 func execClientCommand(conn redcon.Conn, cmd redcon.Command) {
 	command := strings.ToLower(string(cmd.Args[0]))
+	client, _ := conn.Context().(*BitcaskClient)
+	if !client.server.beginCommand() {
+		conn.WriteError(errShuttingDown.Error())
+		return
+	}
+	defer client.server.endCommand()
+	client.touch(command, cmd.Args)
+	if client.sub != nil && client.sub.count() > 0 && !subscribeModeCommands[command] {
+		conn.WriteError(newSubscribeModeError(command).Error())
+		return
+	}
+	if err := client.checkACL(command, cmd.Args); err != nil {
+		if client.tx != nil {
+			client.tx.aborted = true
+		}
+		conn.WriteError(err.Error())
+		return
+	}
+	hidden := monitorHidden(command, cmd.Args)
+	if !hidden {
+		client.server.monitors.feed(client, cmd.Args)
+	}
+	if client.queueCommand(conn, command, cmd.Args) {
+		client.updateInfo()
+		return
+	}
 	cmdFunc, ok := supportedCommands[command]
 	if !ok {
 		conn.WriteError("Err unsupported command: '" + command + "'")
 		return
 	}
+	client.server.stats.commands.Add(1)
 
-	client, _ := conn.Context().(*BitcaskClient)
 	switch command {
 	case "quit":
 		_ = conn.Close()
-	case "ping":
-		conn.WriteString("PONG")
+	case "subscribe", "unsubscribe", "psubscribe", "punsubscribe":
+		client.subscribeCommand(conn, command, cmd.Args[1:])
+	case "monitor":
+		client.monitorCommand(conn, cmd.Args[1:])
 	default:
-		res, err := cmdFunc(client, cmd.Args[1:])
+		start := time.Now()
+		res, err := client.exec(cmdFunc, cmd.Args)
+		//阻塞命令的等待时间不计入慢日志
+		if !hidden && !blockingCommands[command] {
+			client.server.slowlog.record(client, cmd.Args, time.Since(start))
+		}
+		client.updateInfo()
 		if err != nil {
 			if errors.Is(err, bitcask.ErrKeyNotFound) {
 				conn.WriteNull()
@@ -58,90 +261,122 @@ func execClientCommand(conn redcon.Conn, cmd redcon.Command) {
 	}
 }
 
-func set(cli *BitcaskClient, args [][]byte) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, newWrongNumberOfArgsError("set")
+// 执行一条命令,集群模式下写命令通过 raft 日志执行
+func (cli *BitcaskClient) exec(cmd command, args [][]byte) (interface{}, error) {
+	//阻塞命令等待期间 DB 可能被替换,每次执行时重新获取
+	cli.db = cli.currentDB()
+	if cmd.write && cli.server.cluster != nil {
+		return cli.server.cluster.apply(args)
 	}
-
-	key, value := args[0], args[1]
-	if err := cli.db.Set(key, value, 0); err != nil {
-		return nil, err
+	//阻塞命令等待期间不能持有读锁,每次尝试时再通过 exec 执行;
+	//集群模式下的 EXEC 需要等待 raft 应用日志,而恢复快照和应用日志在同一个 goroutine 中
+	name := strings.ToLower(string(args[0]))
+	if !blockingCommands[name] && !(name == "exec" && cli.server.cluster != nil) {
+		cli.server.restoreMu.RLock()
+		defer cli.server.restoreMu.RUnlock()
+		//获取读锁之前 DB 可能已经被恢复的快照替换
+		cli.db = cli.currentDB()
 	}
-	return redcon.SimpleString("OK"), nil
+	return cmd.handler(cli, args[1:])
 }
 
-func get(cli *BitcaskClient, args [][]byte) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, newWrongNumberOfArgsError("get")
-	}
-
-	value, err := cli.db.Get(args[0])
-	if err != nil {
-		return nil, err
-	}
-	return value, nil
+// 客户端当前选择的数据库,快照恢复和 SWAPDB 之后会发生变化
+func (cli *BitcaskClient) currentDB() *bitcask_redis.RedisDataStructure {
+	return cli.server.db(cli.dbIndex)
 }
 
-func hset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
-	if len(args) != 3 {
-		return nil, newWrongNumberOfArgsError("hset")
-	}
-
-	var ok = 0
-	key, field, value := args[0], args[1], args[2]
-	res, err := cli.db.HSet(key, field, value)
-	if err != nil {
-		return nil, err
+func ping(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	//订阅模式下以数组的形式回复
+	if cli.sub != nil && cli.sub.count() > 0 {
+		if len(args) > 1 {
+			return nil, newWrongNumberOfArgsError("ping")
+		}
+		message := []byte{}
+		if len(args) == 1 {
+			message = args[0]
+		}
+		return []interface{}{"pong", message}, nil
 	}
-	if res {
-		ok = 1
+	switch len(args) {
+	case 0:
+		return redcon.SimpleString("PONG"), nil
+	case 1:
+		return args[0], nil
+	default:
+		return nil, newWrongNumberOfArgsError("ping")
 	}
-	return redcon.SimpleInt(ok), nil
 }
 
-func sadd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, newWrongNumberOfArgsError("sadd")
+// 作为数组中的一个结果返回的错误,key 不存在时返回空值
+func commandError(err error) interface{} {
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil
 	}
+	return err
+}
 
-	var ok = 0
-	key, member := args[0], args[1]
-	res, err := cli.db.SAdd(key, member)
+// 解析 SCAN 类命令的参数: cursor [MATCH pattern] [COUNT count]
+func parseScanArgs(args [][]byte) (uint64, string, int, error) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
 	if err != nil {
-		return nil, err
+		return 0, "", 0, errInvalidScan
 	}
-	if res {
-		ok = 1
+	var pattern string
+	var count int
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return 0, "", 0, errSyntax
+		}
+		switch strings.ToLower(string(args[i])) {
+		case "match":
+			pattern = string(args[i+1])
+		case "count":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return 0, "", 0, errNotInteger
+			}
+			if count < 1 {
+				return 0, "", 0, errSyntax
+			}
+		default:
+			return 0, "", 0, errSyntax
+		}
 	}
-	return redcon.SimpleInt(ok), nil
+	return cursor, pattern, count, nil
 }
 
-func lpush(cli *BitcaskClient, args [][]byte) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, newWrongNumberOfArgsError("lpush")
+// 解析下标范围 start stop
+func parseRange(startArg, stopArg []byte) (int64, int64, error) {
+	start, err := strconv.ParseInt(string(startArg), 10, 64)
+	if err != nil {
+		return 0, 0, errNotInteger
 	}
-
-	key, value := args[0], args[1]
-	res, err := cli.db.LPush(key, value)
+	stop, err := strconv.ParseInt(string(stopArg), 10, 64)
 	if err != nil {
-		return nil, err
+		return 0, 0, errNotInteger
 	}
-	return redcon.SimpleInt(res), nil
+	return start, stop, nil
 }
 
-func zadd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
-	if len(args) != 3 {
-		return nil, newWrongNumberOfArgsError("zadd")
+// nil 需要返回 RESP 的空值,而不是空字符串
+func bulkOrNil(value []byte) interface{} {
+	if value == nil {
+		return nil
 	}
+	return value
+}
 
-	var ok = 0
-	key, score, member := args[0], args[1], args[2]
-	res, err := cli.db.ZAdd(key, utils.FloatFromBytes(score), member)
-	if err != nil {
-		return nil, err
+func bulkArray(values [][]byte) []interface{} {
+	res := make([]interface{}, len(values))
+	for i, value := range values {
+		res[i] = bulkOrNil(value)
 	}
-	if res {
-		ok = 1
+	return res
+}
+
+func boolInt(ok bool) redcon.SimpleInt {
+	if ok {
+		return 1
 	}
-	return redcon.SimpleInt(ok), nil
+	return 0
 }
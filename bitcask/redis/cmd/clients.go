@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/redcon"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errUnknownClientCommand = errors.New("ERR unknown subcommand for 'client'")
+	errInvalidClientName    = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+	errNoSuchClient         = errors.New("ERR No such client")
+)
+
+// 所有连接的客户端,CLIENT LIST/KILL 和 INFO 使用
+type clientRegistry struct {
+	mu      sync.RWMutex
+	clients map[int64]*BitcaskClient
+	nextID  int64
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[int64]*BitcaskClient)}
+}
+
+// 记录新的连接并分配编号
+func (reg *clientRegistry) add(cli *BitcaskClient) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.nextID++
+	cli.id = reg.nextID
+	reg.clients[cli.id] = cli
+}
+
+func (reg *clientRegistry) remove(cli *BitcaskClient) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	delete(reg.clients, cli.id)
+}
+
+func (reg *clientRegistry) count() int {
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	return len(reg.clients)
+}
+
+// 按照编号排序的所有客户端
+func (reg *clientRegistry) list() []*BitcaskClient {
+	reg.mu.RLock()
+	clients := make([]*BitcaskClient, 0, len(reg.clients))
+	for _, cli := range reg.clients {
+		clients = append(clients, cli)
+	}
+	reg.mu.RUnlock()
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].id < clients[j].id
+	})
+	return clients
+}
+
+// 其他连接执行 CLIENT LIST 时读取的状态,由连接所在的 goroutine 加锁更新
+type clientInfo struct {
+	mu         sync.Mutex
+	name       string
+	user       string
+	db         int
+	flags      string
+	sub        int
+	psub       int
+	multi      int //事务中排队的命令数量,不在事务中为 -1
+	lastCmd    string
+	lastActive time.Time
+}
+
+// 开始执行命令时记录命令和时间
+func (cli *BitcaskClient) touch(command string, args [][]byte) {
+	if name := aclCommandName(command, args); name != "" {
+		command = name
+	}
+	cli.info.mu.Lock()
+	defer cli.info.mu.Unlock()
+	cli.info.lastCmd = command
+	cli.info.lastActive = time.Now()
+}
+
+// 命令执行完之后记录客户端的状态,订阅的数量在修改订阅时记录
+func (cli *BitcaskClient) updateInfo() {
+	cli.info.mu.Lock()
+	defer cli.info.mu.Unlock()
+	cli.info.user = cli.user
+	cli.info.db = cli.dbIndex
+	cli.info.flags, cli.info.multi = "N", -1
+	switch {
+	case cli.monitor != nil:
+		cli.info.flags = "O"
+	case cli.tx != nil:
+		cli.info.flags, cli.info.multi = "x", len(cli.tx.commands)
+	case cli.info.sub+cli.info.psub > 0:
+		cli.info.flags = "P"
+	}
+}
+
+func (cli *BitcaskClient) name() string {
+	cli.info.mu.Lock()
+	defer cli.info.mu.Unlock()
+	return cli.info.name
+}
+
+// CLIENT LIST 中的一行
+func (cli *BitcaskClient) describe(now time.Time) string {
+	cli.info.mu.Lock()
+	defer cli.info.mu.Unlock()
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d multi=%d cmd=%s user=%s",
+		cli.id, cli.addr, cli.info.name, int64(now.Sub(cli.createdAt).Seconds()),
+		int64(now.Sub(cli.info.lastActive).Seconds()), cli.info.flags, cli.info.db, cli.info.sub, cli.info.psub,
+		cli.info.multi, cli.info.lastCmd, cli.info.user)
+}
+
+// 断开客户端的连接,关闭底层的连接之后由连接所在的 goroutine 负责清理
+func (cli *BitcaskClient) kill() {
+	cli.cancelBlocking()
+	_ = cli.conn.NetConn().Close()
+}
+
+// 取消客户端正在阻塞的命令,状态机中执行命令的客户端没有 cancel
+func (cli *BitcaskClient) cancelBlocking() {
+	if cli.cancel == nil {
+		return
+	}
+	cli.cancelOnce.Do(func() {
+		close(cli.cancel)
+	})
+}
+
+// CLIENT ID|GETNAME|SETNAME|LIST|KILL
+func clientCmd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("client")
+	}
+
+	switch strings.ToLower(string(args[0])) {
+	case "id":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("client|id")
+		}
+		return redcon.SimpleInt(cli.id), nil
+	case "getname":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("client|getname")
+		}
+		if name := cli.name(); name != "" {
+			return name, nil
+		}
+		return nil, nil
+	case "setname":
+		if len(args) != 2 {
+			return nil, newWrongNumberOfArgsError("client|setname")
+		}
+		//名字中不能有空格和不可见字符,为空时清除名字
+		for _, c := range args[1] {
+			if c <= ' ' || c > '~' {
+				return nil, errInvalidClientName
+			}
+		}
+		cli.info.mu.Lock()
+		cli.info.name = string(args[1])
+		cli.info.mu.Unlock()
+		return redcon.SimpleString("OK"), nil
+	case "list":
+		return clientList(cli, args[1:])
+	case "kill":
+		return clientKill(cli, args[1:])
+	default:
+		return nil, errUnknownClientCommand
+	}
+}
+
+// CLIENT LIST [ID id ...]
+func clientList(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	var ids map[int64]bool
+	if len(args) > 0 {
+		if strings.ToLower(string(args[0])) != "id" || len(args) == 1 {
+			return nil, errSyntax
+		}
+		ids = make(map[int64]bool)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseInt(string(arg), 10, 64)
+			if err != nil || id <= 0 {
+				return nil, errNotInteger
+			}
+			ids[id] = true
+		}
+	}
+
+	var sb strings.Builder
+	now := time.Now()
+	for _, c := range cli.server.clients.list() {
+		if ids == nil || ids[c.id] {
+			sb.WriteString(c.describe(now))
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String(), nil
+}
+
+// CLIENT KILL addr | CLIENT KILL [ID id] [ADDR addr] [USER username] [SKIPME yes|no]
+func clientKill(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("client|kill")
+	}
+	//旧的格式只有一个地址参数
+	if len(args) == 1 {
+		for _, c := range cli.server.clients.list() {
+			if c.addr == string(args[0]) {
+				c.kill()
+				return redcon.SimpleString("OK"), nil
+			}
+		}
+		return nil, errNoSuchClient
+	}
+
+	if len(args)%2 != 0 {
+		return nil, errSyntax
+	}
+	var id int64
+	var addr, user string
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			var err error
+			id, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, errNotInteger
+			}
+		case "addr":
+			addr = value
+		case "user":
+			user = value
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return nil, errSyntax
+			}
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	var killed int
+	for _, c := range cli.server.clients.list() {
+		if (id != 0 && c.id != id) || (addr != "" && c.addr != addr) {
+			continue
+		}
+		if user != "" {
+			c.info.mu.Lock()
+			matched := c.info.user == user
+			c.info.mu.Unlock()
+			if !matched {
+				continue
+			}
+		}
+		if skipMe && c.id == cli.id {
+			continue
+		}
+		c.kill()
+		killed++
+	}
+	return redcon.SimpleInt(killed), nil
+}
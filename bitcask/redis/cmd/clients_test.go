@@ -0,0 +1,93 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBitcaskServer_Client(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	other := newTestClient(t, addr)
+	defer other.close()
+
+	id, err := cli.do("CLIENT", "ID")
+	assert.Nil(t, err)
+	otherID, err := other.do("CLIENT", "ID")
+	assert.Nil(t, err)
+	assert.Equal(t, id.(int64)+1, otherID)
+
+	res, err := cli.do("CLIENT", "GETNAME")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	res, err = cli.do("CLIENT", "SETNAME", "worker-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("CLIENT", "GETNAME")
+	assert.Nil(t, err)
+	assert.Equal(t, "worker-1", res)
+	_, err = cli.do("CLIENT", "SETNAME", "bad name")
+	assert.NotNil(t, err)
+
+	_, err = other.do("SELECT", "2")
+	assert.Nil(t, err)
+	_, err = other.do("MULTI")
+	assert.Nil(t, err)
+	_, err = other.do("SET", "k", "v")
+	assert.Nil(t, err)
+
+	res, err = cli.do("CLIENT", "LIST")
+	assert.Nil(t, err)
+	lines := strings.Split(strings.TrimSuffix(res.(string), "\n"), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "id="+strconv.FormatInt(id.(int64), 10)+" addr="+cli.conn.LocalAddr().String()+" name=worker-1 "))
+	assert.Contains(t, lines[0], " flags=N db=0 sub=0 psub=0 multi=-1 cmd=client|list user=default")
+	assert.Contains(t, lines[1], " name= ")
+	assert.Contains(t, lines[1], " flags=x db=2 sub=0 psub=0 multi=1 cmd=set ")
+	res, err = cli.do("CLIENT", "LIST", "ID", strconv.FormatInt(otherID.(int64), 10))
+	assert.Nil(t, err)
+	assert.Equal(t, lines[1]+"\n", res)
+
+	// 事务中执行的 CLIENT 命令作用于同一个客户端
+	_, err = other.do("CLIENT", "SETNAME", "tx")
+	assert.Nil(t, err)
+	res, err = other.do("EXEC")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"OK", "OK"}, res)
+	res, err = other.do("CLIENT", "GETNAME")
+	assert.Nil(t, err)
+	assert.Equal(t, "tx", res)
+
+	// 默认不会断开自己的连接
+	res, err = cli.do("CLIENT", "KILL", "ID", strconv.FormatInt(id.(int64), 10))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	res, err = cli.do("CLIENT", "KILL", "USER", "default", "SKIPME", "yes")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	_, err = other.do("PING")
+	assert.NotNil(t, err)
+	assert.Eventually(t, func() bool {
+		return svr.clients.count() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	third := newTestClient(t, addr)
+	defer third.close()
+	res, err = cli.do("CLIENT", "KILL", third.conn.LocalAddr().String())
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	_, err = third.do("PING")
+	assert.NotNil(t, err)
+	_, err = cli.do("CLIENT", "KILL", "127.0.0.1:1")
+	assert.NotNil(t, err)
+	_, err = cli.do("CLIENT", "KILL", "ID", "x")
+	assert.NotNil(t, err)
+	_, err = cli.do("CLIENT", "UNKNOWN")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,585 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"hash/fnv"
+	"io"
+	"kv-go/bitcask"
+	"kv-go/bitcask/raftstore"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// raft 集群模式,写命令通过 raft 日志复制到所有节点之后再应用,读命令直接读取本地数据
+const (
+	raftApplyTimeout   = 5 * time.Second
+	raftSnapshotRetain = 2
+)
+
+var errNoLeader = errors.New("CLUSTERDOWN no leader elected")
+
+// 事务中被 WATCH 的 key 在 FSM 中检查,所有的节点根据相同的日志得出相同的结果:
+// 记录每个 key 最后一次被写命令修改时的日志索引,为了限制内存按照 key 的哈希值分桶,
+// 哈希冲突只会让事务多放弃一次,不会漏掉修改
+const (
+	watchBuckets = 1 << 14
+
+	//快照中保存修改索引的文件,恢复时从数据目录中移除
+	watchIndexFile = "raft-watch-index"
+)
+
+// 集群中的一个节点
+type clusterPeer struct {
+	id       string
+	raftAddr string //raft 通信的地址
+	respAddr string //redis 协议服务的地址,用于写命令的重定向
+}
+
+type clusterOptions struct {
+	nodeId    string
+	raftAddr  string
+	raftDir   string
+	peers     []clusterPeer
+	bootstrap bool //是否用 peers 初始化集群,只需要在第一次启动的时候由一个节点执行
+}
+
+type cluster struct {
+	raft      *raft.Raft
+	fsm       *clusterFSM
+	logStore  *raftstore.Store
+	transport *raft.NetworkTransport
+	respAddrs map[raft.ServerAddress]string
+}
+
+// 解析 id=raftAddr=respAddr,id=raftAddr=respAddr 格式的节点列表
+func parseClusterPeers(s string) ([]clusterPeer, error) {
+	var peers []clusterPeer
+	for _, item := range strings.Split(s, ",") {
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, "=")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid cluster peer: %s", item)
+		}
+		peers = append(peers, clusterPeer{id: parts[0], raftAddr: parts[1], respAddr: parts[2]})
+	}
+	return peers, nil
+}
+
+// 状态机的数据完全由快照和 raft 日志决定,启动时 raft 会恢复最近的快照并重新应用之后的日志,
+// 所以数据目录需要在打开之前清空,否则已经应用过的 INCR、RPUSH 等命令会被重复应用
+func newCluster(svr *BitcaskServer, fsm *clusterFSM, opts clusterOptions) (*cluster, error) {
+	if err := os.MkdirAll(opts.raftDir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	config := raft.DefaultConfig()
+	config.LocalID = raft.ServerID(opts.nodeId)
+
+	logOptions := bitcask.DefaultOptions
+	logOptions.DirPath = filepath.Join(opts.raftDir, "log")
+	logStore, err := raftstore.New(logOptions)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, err := raft.NewFileSnapshotStore(opts.raftDir, raftSnapshotRetain, os.Stderr)
+	if err != nil {
+		_ = logStore.Close()
+		return nil, err
+	}
+	transport, err := raft.NewTCPTransport(opts.raftAddr, nil, 3, 10*time.Second, os.Stderr)
+	if err != nil {
+		_ = logStore.Close()
+		return nil, err
+	}
+
+	r, err := raft.NewRaft(config, fsm, logStore, logStore, snapshots, transport)
+	if err != nil {
+		_ = transport.Close()
+		_ = logStore.Close()
+		return nil, err
+	}
+
+	c := &cluster{
+		raft:      r,
+		fsm:       fsm,
+		logStore:  logStore,
+		transport: transport,
+		respAddrs: make(map[raft.ServerAddress]string),
+	}
+	var servers []raft.Server
+	for _, peer := range opts.peers {
+		c.respAddrs[raft.ServerAddress(peer.raftAddr)] = peer.respAddr
+		servers = append(servers, raft.Server{
+			ID:      raft.ServerID(peer.id),
+			Address: raft.ServerAddress(peer.raftAddr),
+		})
+	}
+	if opts.bootstrap {
+		err := r.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+		if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+			_ = c.shutdown()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// 通过 raft 日志执行写命令,当前节点不是 leader 时返回重定向的错误
+func (c *cluster) apply(args [][]byte) (interface{}, error) {
+	if c.raft.State() != raft.Leader {
+		leaderAddr, _ := c.raft.LeaderWithID()
+		respAddr, ok := c.respAddrs[leaderAddr]
+		if leaderAddr == "" || !ok {
+			return nil, errNoLeader
+		}
+		return nil, fmt.Errorf("MOVED 0 %s", respAddr)
+	}
+	now := time.Now()
+	future := c.raft.ApplyLog(raft.Log{
+		Data:       encodeCommandArgs(absoluteTTLArgs(args, now)),
+		Extensions: encodeLogTime(now),
+	}, raftApplyTimeout)
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+	result := future.Response().(*applyResult)
+	return result.res, result.err
+}
+
+func (c *cluster) shutdown() error {
+	err := c.raft.Shutdown().Error()
+	_ = c.transport.Close()
+	if closeErr := c.logStore.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// 命令执行的结果,通过 ApplyFuture 返回给客户端
+type applyResult struct {
+	res interface{}
+	err error
+}
+
+// 基于 RedisDataStructure 的状态机
+// Apply、Snapshot 和 Restore 都在 raft 的同一个 goroutine 中调用,只有 applied 和 clock 会被其他 goroutine 读取
+type clusterFSM struct {
+	server   *BitcaskServer
+	applied  atomic.Uint64        //已经应用的最后一条日志的索引,WATCH 时记录
+	modified [watchBuckets]uint64 //每个桶中的 key 最后一次被修改时的日志索引
+	//最后一次修改所有 key(如 FLUSHDB)时的日志索引
+	modifiedAll uint64
+	//已经应用的日志中最大的 leader 时间,纳秒时间戳,应用日志和后台清理都用它判断过期,
+	//取最大值保证切换 leader 之后时间不会倒退,所有的节点按照相同的日志得到相同的时间
+	clock atomic.Int64
+}
+
+// 判断过期使用的时间,还没有应用日志时为零点,不会有 key 被判断为过期
+func (fsm *clusterFSM) now() time.Time {
+	return time.Unix(0, fsm.clock.Load())
+}
+
+// 用日志中 leader 的时间推进状态机的时间
+func (fsm *clusterFSM) advanceClock(log *raft.Log) time.Time {
+	if t := decodeLogTime(log).UnixNano(); t > fsm.clock.Load() {
+		fsm.clock.Store(t)
+	}
+	return fsm.now()
+}
+
+// 日志的 Extensions 中保存 leader 提交命令时的时间: 8字节小端序的纳秒时间戳
+func encodeLogTime(t time.Time) []byte {
+	return binary.LittleEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+// 没有时间的日志使用 leader 写入日志时记录的 AppendedAt
+func decodeLogTime(log *raft.Log) time.Time {
+	if len(log.Extensions) == 8 {
+		return time.Unix(0, int64(binary.LittleEndian.Uint64(log.Extensions)))
+	}
+	return log.AppendedAt
+}
+
+// 将命令中相对的过期时间改写成以 now 为起点的绝对时间,在 leader 提交命令之前调用,
+// 所有的节点应用日志时得到相同的过期时间;参数不合法时保持不变,由命令在应用时返回错误
+func absoluteTTLArgs(args [][]byte, now time.Time) [][]byte {
+	switch strings.ToLower(string(args[0])) {
+	case "set":
+		//SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | ...]
+		for i := 3; i+1 < len(args); i++ {
+			switch strings.ToLower(string(args[i])) {
+			case "ex", "px":
+				return replaceTTLArg(args, i, now)
+			case "exat", "pxat":
+				return args
+			}
+		}
+	case "getex":
+		if len(args) == 4 {
+			if option := strings.ToLower(string(args[2])); option == "ex" || option == "px" {
+				return replaceTTLArg(args, 2, now)
+			}
+		}
+	case "expire", "pexpire":
+		//EXPIRE key seconds 改写为 PEXPIREAT key unix-time-milliseconds
+		if len(args) != 3 {
+			return args
+		}
+		unit := time.Second
+		if strings.EqualFold(string(args[0]), "pexpire") {
+			unit = time.Millisecond
+		}
+		n, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil || n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+			return args
+		}
+		at, ok := unixMilliCeil(now.Add(time.Duration(n) * unit))
+		if !ok {
+			return args
+		}
+		return [][]byte{[]byte("pexpireat"), args[1], []byte(strconv.FormatInt(at, 10))}
+	}
+	return args
+}
+
+// 将 args[i] 处的 EX seconds 或者 PX milliseconds 改写为 PXAT unix-time-milliseconds
+func replaceTTLArg(args [][]byte, i int, now time.Time) [][]byte {
+	ttl, err := parseTTL(args[i+1], strings.EqualFold(string(args[i]), "ex"))
+	if err != nil {
+		return args
+	}
+	at, ok := unixMilliCeil(now.Add(ttl))
+	if !ok {
+		return args
+	}
+	rewritten := slices.Clone(args)
+	rewritten[i] = []byte("pxat")
+	rewritten[i+1] = []byte(strconv.FormatInt(at, 10))
+	return rewritten
+}
+
+// 向上取整到毫秒,改写之后的过期时间不会早于原来的时间;超出 PXAT 的范围时返回 false
+func unixMilliCeil(t time.Time) (int64, bool) {
+	ms := t.UnixMilli()
+	if t.After(time.UnixMilli(ms)) {
+		ms++
+	}
+	return ms, ms <= math.MaxInt64/int64(time.Millisecond)
+}
+
+func watchBucket(key []byte) int {
+	h := fnv.New64a()
+	_, _ = h.Write(key)
+	return int(h.Sum64() % watchBuckets)
+}
+
+// 记录写命令修改的 key,没有 key 的写命令视为修改了所有的 key
+func (fsm *clusterFSM) touch(index uint64, args [][]byte) {
+	keys := commandKeys(strings.ToLower(string(args[0])), args)
+	if len(keys) == 0 {
+		fsm.modifiedAll = index
+		return
+	}
+	for _, key := range keys {
+		fsm.modified[watchBucket(key)] = index
+	}
+}
+
+// 在日志索引 applied 之后被监视的 key 是否被修改过
+func (fsm *clusterFSM) watchedKeyChanged(applied uint64, keys [][]byte) bool {
+	if fsm.modifiedAll > applied {
+		return true
+	}
+	for _, key := range keys {
+		if fsm.modified[watchBucket(key)] > applied {
+			return true
+		}
+	}
+	return false
+}
+
+// 事务日志中被监视的 key: watch <WATCH 时已经应用的日志索引> <key>...,
+// WATCH 不能在事务中排队,不会和事务中的命令混淆
+func encodeWatchArgs(applied uint64, keys [][]byte) [][]byte {
+	args := [][]byte{[]byte("watch"), []byte(strconv.FormatUint(applied, 10))}
+	return append(args, keys...)
+}
+
+func decodeWatchArgs(args [][]byte) (uint64, [][]byte, bool) {
+	if len(args) < 2 || !strings.EqualFold(string(args[0]), "watch") {
+		return 0, nil, false
+	}
+	applied, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return 0, nil, false
+	}
+	return applied, args[2:], true
+}
+
+func (fsm *clusterFSM) Apply(log *raft.Log) interface{} {
+	defer fsm.applied.Store(log.Index)
+	args, err := decodeCommandArgs(log.Data)
+	if err != nil {
+		return &applyResult{err: err}
+	}
+	command := strings.ToLower(string(args[0]))
+	cmd, ok := supportedCommands[command]
+	if !ok {
+		return &applyResult{err: fmt.Errorf("Err unsupported command: '%s'", command)}
+	}
+	//命令使用 leader 提交时的时间判断过期,不依赖各个节点本地的时间
+	now := fsm.advanceClock(log)
+	db := fsm.server.db(0).WithClock(func() time.Time { return now })
+	cli := &BitcaskClient{server: fsm.server, db: db, logIndex: log.Index}
+	if command == "exec" {
+		//事务中的每个命令分别编码之后作为参数
+		commands := make([][][]byte, 0, len(args)-1)
+		for _, buf := range args[1:] {
+			cmdArgs, err := decodeCommandArgs(buf)
+			if err != nil {
+				return &applyResult{err: err}
+			}
+			commands = append(commands, cmdArgs)
+		}
+		if len(commands) > 0 {
+			if applied, keys, ok := decodeWatchArgs(commands[0]); ok {
+				commands = commands[1:]
+				if fsm.watchedKeyChanged(applied, keys) {
+					return &applyResult{res: nullArray{}}
+				}
+			}
+		}
+		res, err := execTransaction(cli, commands, nil)
+		for _, cmdArgs := range commands {
+			fsm.touch(log.Index, cmdArgs)
+		}
+		return &applyResult{res: res, err: err}
+	}
+	res, err := cmd.handler(cli, args[1:])
+	fsm.touch(log.Index, args)
+	return &applyResult{res: res, err: err}
+}
+
+// 修改索引的编码: applied + modifiedAll + 每个桶的索引 + 状态机的时间,都是8字节的小端序
+func (fsm *clusterFSM) encodeWatchIndex() []byte {
+	buf := make([]byte, 0, (watchBuckets+3)*8)
+	buf = binary.LittleEndian.AppendUint64(buf, fsm.applied.Load())
+	buf = binary.LittleEndian.AppendUint64(buf, fsm.modifiedAll)
+	for _, index := range fsm.modified {
+		buf = binary.LittleEndian.AppendUint64(buf, index)
+	}
+	return binary.LittleEndian.AppendUint64(buf, uint64(fsm.clock.Load()))
+}
+
+// 之前的快照中没有状态机的时间,从零点开始
+func (fsm *clusterFSM) decodeWatchIndex(buf []byte) error {
+	if len(buf) != (watchBuckets+2)*8 && len(buf) != (watchBuckets+3)*8 {
+		return errors.New("invalid watch index in snapshot")
+	}
+	fsm.applied.Store(binary.LittleEndian.Uint64(buf))
+	fsm.modifiedAll = binary.LittleEndian.Uint64(buf[8:])
+	for i := range fsm.modified {
+		fsm.modified[i] = binary.LittleEndian.Uint64(buf[(i+2)*8:])
+	}
+	var clock int64
+	if len(buf) == (watchBuckets+3)*8 {
+		clock = int64(binary.LittleEndian.Uint64(buf[(watchBuckets+2)*8:]))
+	}
+	fsm.clock.Store(clock)
+	return nil
+}
+
+// 快照使用 DB.Backup 拷贝数据目录,之后打包写入到 raft 的快照中
+func (fsm *clusterFSM) Snapshot() (raft.FSMSnapshot, error) {
+	dir, err := os.MkdirTemp("", "bitcask-raft-snapshot")
+	if err != nil {
+		return nil, err
+	}
+	if err := fsm.server.db(0).Backup(dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	//修改索引和数据一起保存,恢复快照的节点对 WATCH 的判断和其他节点相同
+	if err := os.WriteFile(filepath.Join(dir, watchIndexFile), fsm.encodeWatchIndex(), 0644); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+	return &clusterSnapshot{dir: dir}, nil
+}
+
+// 用快照中的数据替换本地的数据目录
+func (fsm *clusterFSM) Restore(snapshot io.ReadCloser) error {
+	defer snapshot.Close()
+	dirPath := fsm.server.dirs[0]
+	restoreDir := filepath.Clean(dirPath) + "-restore"
+	_ = os.RemoveAll(restoreDir)
+	if err := untarDir(snapshot, restoreDir); err != nil {
+		return err
+	}
+	watchIndexPath := filepath.Join(restoreDir, watchIndexFile)
+	watchIndex, err := os.ReadFile(watchIndexPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := fsm.decodeWatchIndex(watchIndex); err != nil {
+			return err
+		}
+		if err := os.Remove(watchIndexPath); err != nil {
+			return err
+		}
+	}
+
+	//等待正在使用旧的 DB 的命令执行完成之后再关闭,恢复期间新的命令会等待
+	fsm.server.restoreMu.Lock()
+	defer fsm.server.restoreMu.Unlock()
+	fsm.server.mu.Lock()
+	defer fsm.server.mu.Unlock()
+	if err := fsm.server.dbs[0].Close(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dirPath); err != nil {
+		return err
+	}
+	if err := os.Rename(restoreDir, dirPath); err != nil {
+		return err
+	}
+	options := fsm.server.config.options
+	options.DirPath = dirPath
+	rds, err := fsm.server.openDB(options)
+	if err != nil {
+		return err
+	}
+	fsm.server.dbs[0] = rds
+	return nil
+}
+
+type clusterSnapshot struct {
+	dir string
+}
+
+func (s *clusterSnapshot) Persist(sink raft.SnapshotSink) error {
+	if err := tarDir(s.dir, sink); err != nil {
+		_ = sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *clusterSnapshot) Release() {
+	_ = os.RemoveAll(s.dir)
+}
+
+// 将目录中的文件打包写入到 w
+func tarDir(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// 将打包的文件解压到目录中
+func untarDir(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, filepath.Clean(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid file name in snapshot: %s", header.Name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, os.FileMode(header.Mode))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+}
+
+// 命令参数的编码: 参数个数 + 每个参数的长度和内容
+func encodeCommandArgs(args [][]byte) []byte {
+	var size = binary.MaxVarintLen64
+	for _, arg := range args {
+		size += binary.MaxVarintLen64 + len(arg)
+	}
+	buf := make([]byte, size)
+	var index = binary.PutUvarint(buf, uint64(len(args)))
+	for _, arg := range args {
+		index += binary.PutUvarint(buf[index:], uint64(len(arg)))
+		index += copy(buf[index:], arg)
+	}
+	return buf[:index]
+}
+
+func decodeCommandArgs(buf []byte) ([][]byte, error) {
+	errInvalid := errors.New("invalid command in raft log")
+	count, n := binary.Uvarint(buf)
+	if n <= 0 || count == 0 {
+		return nil, errInvalid
+	}
+	var index = n
+	args := make([][]byte, 0, count)
+	for i := uint64(0); i < count; i++ {
+		size, n := binary.Uvarint(buf[index:])
+		if n <= 0 || uint64(len(buf)-index-n) < size {
+			return nil, errInvalid
+		}
+		index += n
+		args = append(args, buf[index:index+int(size)])
+		index += int(size)
+	}
+	return args, nil
+}
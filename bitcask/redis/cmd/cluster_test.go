@@ -0,0 +1,495 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"kv-go/bitcask"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 获取一个空闲的本地端口
+func freeAddr(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := ln.Addr().String()
+	_ = ln.Close()
+	return addr
+}
+
+type testNode struct {
+	server   *BitcaskServer
+	respAddr string
+	dir      string
+}
+
+func startTestCluster(t *testing.T, n int) []*testNode {
+	var peers []clusterPeer
+	for i := 0; i < n; i++ {
+		peers = append(peers, clusterPeer{
+			id:       fmt.Sprintf("node-%d", i),
+			raftAddr: freeAddr(t),
+			respAddr: freeAddr(t),
+		})
+	}
+	var peerList []string
+	for _, peer := range peers {
+		peerList = append(peerList, peer.id+"="+peer.raftAddr+"="+peer.respAddr)
+	}
+	var nodes []*testNode
+	for i, peer := range peers {
+		dir, _ := os.MkdirTemp("", "bitcask-go-raft-node")
+		cfg := defaultServerConfig
+		cfg.options.DirPath = dir + "/data"
+		cfg.raftId = peer.id
+		cfg.raftAddr = peer.raftAddr
+		cfg.raftDir = dir + "/raft"
+		cfg.raftPeers = strings.Join(peerList, ",")
+		cfg.raftBootstrap = i == 0
+		svr, err := newBitcaskServer(cfg)
+		assert.Nil(t, err)
+		ln, err := net.Listen("tcp", peer.respAddr)
+		assert.Nil(t, err)
+		go func() {
+			_ = svr.serve(ln)
+		}()
+		nodes = append(nodes, &testNode{server: svr, respAddr: peer.respAddr, dir: dir})
+	}
+	return nodes
+}
+
+func stopTestCluster(nodes []*testNode) {
+	for _, node := range nodes {
+		node.server.shutdown()
+		_ = os.RemoveAll(node.dir)
+	}
+}
+
+func waitForLeader(t *testing.T, nodes []*testNode) *testNode {
+	var leader *testNode
+	assert.Eventually(t, func() bool {
+		for _, node := range nodes {
+			if node.server.cluster.raft.State() == raft.Leader {
+				leader = node
+				return true
+			}
+		}
+		return false
+	}, 10*time.Second, 50*time.Millisecond)
+	return leader
+}
+
+func TestCluster(t *testing.T) {
+	nodes := startTestCluster(t, 3)
+	defer stopTestCluster(nodes)
+
+	leader := waitForLeader(t, nodes)
+	var followers []*testNode
+	for _, node := range nodes {
+		if node != leader {
+			followers = append(followers, node)
+		}
+	}
+
+	// 写入 leader
+	leaderCli := newTestClient(t, leader.respAddr)
+	res, err := leaderCli.do("SET", "name", "bitcask")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = leaderCli.do("HSET", "user", "age", "18")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+
+	// 事务作为一条 raft 日志执行
+	_, err = leaderCli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = leaderCli.do("INCR", "counter")
+	assert.Nil(t, err)
+	_, err = leaderCli.do("HGET", "user", "age")
+	assert.Nil(t, err)
+	res, err = leaderCli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), "18"}, res)
+
+	// follower 上的写入被重定向到 leader
+	followerCli := newTestClient(t, followers[0].respAddr)
+	_, err = followerCli.do("SET", "name", "other")
+	assert.NotNil(t, err)
+	assert.Equal(t, "MOVED 0 "+leader.respAddr, err.Error())
+
+	// follower 上可以读到复制过来的数据
+	assert.Eventually(t, func() bool {
+		res, err := followerCli.do("GET", "name")
+		return err == nil && res == "bitcask"
+	}, 5*time.Second, 20*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		res, err := followerCli.do("GET", "counter")
+		return err == nil && res == "1"
+	}, 5*time.Second, 20*time.Millisecond)
+
+	// leader 宕机之后剩下的两个节点选出新的 leader 继续提供服务
+	_ = leader.server.cluster.shutdown()
+	newLeader := waitForLeader(t, followers)
+	newLeaderCli := newTestClient(t, newLeader.respAddr)
+	res, err = newLeaderCli.do("SET", "name", "bitcask-2")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	for _, follower := range followers {
+		cli := newTestClient(t, follower.respAddr)
+		defer cli.close()
+		assert.Eventually(t, func() bool {
+			res, err := cli.do("GET", "name")
+			return err == nil && res == "bitcask-2"
+		}, 5*time.Second, 20*time.Millisecond)
+	}
+}
+
+// 用于测试的快照存储
+type bufferSink struct {
+	bytes.Buffer
+}
+
+func (s *bufferSink) ID() string    { return "test" }
+func (s *bufferSink) Cancel() error { return nil }
+func (s *bufferSink) Close() error  { return nil }
+
+func TestClusterFSM_SnapshotRestore(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	for i := 0; i < 100; i++ {
+		_, err := cli.do("SET", fmt.Sprintf("key-%d", i), strings.Repeat("v", i))
+		assert.Nil(t, err)
+	}
+
+	fsm := &clusterFSM{server: svr}
+	snapshot, err := fsm.Snapshot()
+	assert.Nil(t, err)
+	sink := new(bufferSink)
+	err = snapshot.Persist(sink)
+	assert.Nil(t, err)
+	snapshot.Release()
+
+	svr2, addr2 := startTestServer(t)
+	defer os.RemoveAll(svr2.config.options.DirPath)
+	cli2 := newTestClient(t, addr2)
+	_, err = cli2.do("SET", "stale", "value")
+	assert.Nil(t, err)
+
+	fsm2 := &clusterFSM{server: svr2}
+	err = fsm2.Restore(io.NopCloser(&sink.Buffer))
+	assert.Nil(t, err)
+
+	// 恢复之后原来的数据被丢弃
+	res, err := cli2.do("GET", "stale")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	res, err = cli2.do("GET", "key-99")
+	assert.Nil(t, err)
+	assert.Equal(t, strings.Repeat("v", 99), res)
+}
+
+// 把命令作为一条日志应用到状态机
+func applyTestLog(fsm *clusterFSM, index uint64, commands ...[]string) interface{} {
+	return applyTestLogAt(fsm, index, time.Time{}, commands...)
+}
+
+// 把命令作为一条 leader 时间为 at 的日志应用到状态机
+func applyTestLogAt(fsm *clusterFSM, index uint64, at time.Time, commands ...[]string) interface{} {
+	encode := func(args []string) []byte {
+		buf := make([][]byte, len(args))
+		for i, arg := range args {
+			buf[i] = []byte(arg)
+		}
+		return encodeCommandArgs(buf)
+	}
+	data := encode(commands[0])
+	if len(commands) > 1 {
+		//事务: exec 之后是每个命令的编码
+		args := [][]byte{[]byte("exec")}
+		for _, command := range commands[1:] {
+			args = append(args, encode(command))
+		}
+		data = encodeCommandArgs(args)
+	}
+	log := &raft.Log{Index: index, Data: data}
+	if !at.IsZero() {
+		log.Extensions = encodeLogTime(at)
+	}
+	result := fsm.Apply(log).(*applyResult)
+	if result.err != nil {
+		return result.err
+	}
+	return result.res
+}
+
+func TestClusterFSM_Watch(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	fsm := &clusterFSM{server: svr}
+
+	applyTestLog(fsm, 1, []string{"set", "k", "v1"})
+	watched := fsm.applied.Load()
+	assert.Equal(t, uint64(1), watched)
+
+	// WATCH 之后、事务日志之前写入的修改让事务放弃
+	applyTestLog(fsm, 2, []string{"set", "k", "v2"})
+	res := applyTestLog(fsm, 3, []string{"exec"}, []string{"watch", "1", "k"}, []string{"set", "k", "v3"})
+	assert.Equal(t, nullArray{}, res)
+	val, err := cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", val)
+
+	// 没有被修改时正常执行
+	res = applyTestLog(fsm, 4, []string{"exec"}, []string{"watch", "3", "k", "other"}, []string{"set", "k", "v4"})
+	assert.Equal(t, []interface{}{"OK"}, toStrings(res))
+	val, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v4", val)
+
+	// 事务中的写入也会被记录
+	res = applyTestLog(fsm, 5, []string{"exec"}, []string{"watch", "3", "k"}, []string{"set", "k", "v5"})
+	assert.Equal(t, nullArray{}, res)
+
+	// 没有 key 的写命令修改所有的 key
+	applyTestLog(fsm, 6, []string{"flushdb"})
+	res = applyTestLog(fsm, 7, []string{"exec"}, []string{"watch", "5", "other"}, []string{"set", "other", "v"})
+	assert.Equal(t, nullArray{}, res)
+
+	// 修改索引随快照一起恢复,恢复快照的节点得出相同的结果
+	snapshot, err := fsm.Snapshot()
+	assert.Nil(t, err)
+	sink := new(bufferSink)
+	assert.Nil(t, snapshot.Persist(sink))
+	snapshot.Release()
+	svr2, _ := startTestServer(t)
+	defer os.RemoveAll(svr2.config.options.DirPath)
+	fsm2 := &clusterFSM{server: svr2}
+	assert.Nil(t, fsm2.Restore(io.NopCloser(&sink.Buffer)))
+	assert.Equal(t, fsm.applied.Load(), fsm2.applied.Load())
+	assert.True(t, fsm2.watchedKeyChanged(5, [][]byte{[]byte("other")}))
+	assert.False(t, fsm2.watchedKeyChanged(6, [][]byte{[]byte("other")}))
+	_, err = os.Stat(filepath.Join(svr2.config.options.DirPath, watchIndexFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestClusterFSM_SPop(t *testing.T) {
+	add := []string{"sadd", "s"}
+	for i := 0; i < 100; i++ {
+		add = append(add, strconv.Itoa(i))
+	}
+	// 每个节点应用相同的日志之后弹出相同的元素
+	var popped []interface{}
+	for i := 0; i < 2; i++ {
+		svr, _ := startTestServer(t)
+		defer os.RemoveAll(svr.config.options.DirPath)
+		fsm := &clusterFSM{server: svr}
+		applyTestLog(fsm, 1, add)
+		popped = append(popped, fmt.Sprint(applyTestLog(fsm, 2, []string{"spop", "s", "10"})))
+		//集合的版本号由写入时的时间决定,在每个节点上都不相同
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, popped[0], popped[1])
+}
+
+// 事务的结果中简单字符串转换为 string
+func toStrings(res interface{}) interface{} {
+	items, ok := res.([]interface{})
+	if !ok {
+		return res
+	}
+	converted := make([]interface{}, len(items))
+	for i, item := range items {
+		converted[i] = fmt.Sprint(item)
+	}
+	return converted
+}
+
+func TestCluster_Watch(t *testing.T) {
+	nodes := startTestCluster(t, 1)
+	defer stopTestCluster(nodes)
+	leader := waitForLeader(t, nodes)
+
+	cli := newTestClient(t, leader.respAddr)
+	defer cli.close()
+	other := newTestClient(t, leader.respAddr)
+	defer other.close()
+	_, err := cli.do("SET", "k", "v1")
+	assert.Nil(t, err)
+
+	// 其他客户端修改了被监视的 key
+	_, err = cli.do("WATCH", "k")
+	assert.Nil(t, err)
+	_, err = other.do("SET", "k", "v2")
+	assert.Nil(t, err)
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "k", "v3")
+	assert.Nil(t, err)
+	res, err := cli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	// EXEC 之后不再监视
+	_, err = cli.do("WATCH", "k")
+	assert.Nil(t, err)
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "k", "v3")
+	assert.Nil(t, err)
+	res, err = cli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"OK"}, res)
+	res, err = other.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", res)
+}
+
+func TestClusterFSM_RestoreWhileReading(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	// 读取较大的 hash 需要较长的时间,恢复快照很可能发生在读取的过程中
+	const fields = 20000
+	for i := 0; i < fields; i += 5000 {
+		args := []string{"HSET", "user"}
+		for j := i; j < i+5000; j++ {
+			args = append(args, fmt.Sprintf("field-%d", j), "value")
+		}
+		_, err := cli.do(args...)
+		assert.Nil(t, err)
+	}
+
+	fsm := &clusterFSM{server: svr}
+	snapshot, err := fsm.Snapshot()
+	assert.Nil(t, err)
+	sink := new(bufferSink)
+	assert.Nil(t, snapshot.Persist(sink))
+	snapshot.Release()
+	data := sink.Bytes()
+
+	// 恢复快照的同时不断读取,旧的 DB 不会在读取的时候被关闭
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		reader := newTestClient(t, addr)
+		defer reader.close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				res, err := reader.do("HGETALL", "user")
+				if !assert.Nil(t, err) {
+					return
+				}
+				assert.Equal(t, 2*fields, len(res.([]interface{})))
+			}
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		err := fsm.Restore(io.NopCloser(bytes.NewReader(data)))
+		assert.Nil(t, err)
+	}
+	close(stop)
+	wg.Wait()
+}
+
+func TestCluster_Restart(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-raft-restart")
+	defer os.RemoveAll(dir)
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir + "/data"
+	cfg.raftId = "node-0"
+	cfg.raftAddr = freeAddr(t)
+	cfg.raftDir = dir + "/raft"
+	cfg.raftBootstrap = true
+	start := func() (*BitcaskServer, *testClient) {
+		respAddr := freeAddr(t)
+		cfg.raftPeers = cfg.raftId + "=" + cfg.raftAddr + "=" + respAddr
+		svr, err := newBitcaskServer(cfg)
+		assert.Nil(t, err)
+		ln, err := net.Listen("tcp", respAddr)
+		assert.Nil(t, err)
+		go func() {
+			_ = svr.serve(ln)
+		}()
+		waitForLeader(t, []*testNode{{server: svr}})
+		return svr, newTestClient(t, respAddr)
+	}
+
+	svr, cli := start()
+	_, err := cli.do("INCR", "counter")
+	assert.Nil(t, err)
+	_, err = cli.do("RPUSH", "list", "a")
+	assert.Nil(t, err)
+	cli.close()
+	svr.shutdown()
+
+	// 重启之后重新应用日志,已经应用过的命令不会被重复应用
+	svr, cli = start()
+	defer svr.shutdown()
+	defer cli.close()
+	assert.Eventually(t, func() bool {
+		res, err := cli.do("GET", "counter")
+		return err == nil && res == "1"
+	}, 5*time.Second, 20*time.Millisecond)
+	res, err := cli.do("LLEN", "list")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+}
+
+func TestClusterFSM_Clock(t *testing.T) {
+	// 不同的节点在不同的本地时间应用相同的日志,过期的结果由日志中 leader 的时间决定
+	leaderTime := time.Now().Add(-time.Hour)
+	set := absoluteTTLArgs([][]byte{[]byte("SET"), []byte("k"), []byte("v"), []byte("EX"), []byte("10")}, leaderTime)
+	assert.Equal(t, "pxat", string(set[3]))
+	assert.Equal(t, strconv.FormatInt(leaderTime.Add(10*time.Second).UnixMilli()+1, 10), string(set[4]))
+	expire := absoluteTTLArgs([][]byte{[]byte("EXPIRE"), []byte("h"), []byte("10")}, leaderTime)
+	assert.Equal(t, "pexpireat", string(expire[0]))
+	assert.Equal(t, string(set[4]), string(expire[2]))
+
+	var results []interface{}
+	for i := 0; i < 2; i++ {
+		svr, _ := startTestServer(t)
+		defer os.RemoveAll(svr.config.options.DirPath)
+		fsm := &clusterFSM{server: svr}
+		toArgs := func(args [][]byte) []string {
+			strs := make([]string, len(args))
+			for i, arg := range args {
+				strs[i] = string(arg)
+			}
+			return strs
+		}
+		applyTestLogAt(fsm, 1, leaderTime, toArgs(set))
+		applyTestLogAt(fsm, 2, leaderTime, []string{"hset", "h", "f", "v"})
+		applyTestLogAt(fsm, 3, leaderTime, toArgs(expire))
+		// 按照本地时间早已过期,按照 leader 的时间还没有过期
+		results = append(results, applyTestLogAt(fsm, 4, leaderTime.Add(5*time.Second), []string{"get", "k"}))
+		results = append(results, applyTestLogAt(fsm, 5, leaderTime.Add(5*time.Second), []string{"hget", "h", "f"}))
+		// leader 的时间超过过期时间之后过期
+		results = append(results, applyTestLogAt(fsm, 6, leaderTime.Add(11*time.Second), []string{"get", "k"}))
+		results = append(results, applyTestLogAt(fsm, 7, leaderTime.Add(11*time.Second), []string{"hget", "h", "f"}))
+		// 时间较早的日志不会让状态机的时间倒退
+		results = append(results, applyTestLogAt(fsm, 8, leaderTime, []string{"get", "k"}))
+		assert.Equal(t, leaderTime.Add(11*time.Second).UnixNano(), fsm.now().UnixNano())
+	}
+	assert.Equal(t, results[:5], results[5:])
+	assert.Equal(t, []interface{}{[]byte("v"), []byte("v"), bitcask.ErrKeyNotFound, nil, bitcask.ErrKeyNotFound}, results[:5])
+}
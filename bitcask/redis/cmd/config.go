@@ -0,0 +1,639 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/tidwall/redcon"
+	"kv-go/bitcask"
+	"kv-go/bitcask/utils"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errUnknownConfigCommand = errors.New("ERR unknown subcommand for 'config'")
+	errInvalidBool          = errors.New("argument must be 'yes' or 'no'")
+	errInvalidSize          = errors.New("argument must be a memory value")
+	errInvalidIndexType     = errors.New("argument must be one of btree, art, bptree")
+	errInvalidMergeRatio    = errors.New("argument must be between 0 and 1")
+	errNotPositive          = errors.New("argument must be greater than 0")
+	errNegative             = errors.New("argument must not be negative")
+)
+
+// 服务的配置,依次从默认值、配置文件和命令行参数中读取,命令行参数优先
+type serverConfig struct {
+	addr            string
+	options         bitcask.Options
+	databases       int
+	shutdownTimeout time.Duration //优雅关闭时等待正在执行的命令完成的时间
+	requirePass     string        //默认用户的密码,为空时不需要认证
+	aclFile         string        //保存 ACL 用户的文件,为空时不保存
+
+	//证书和私钥都设置时使用 TLS,设置了 CA 时要求客户端提供证书
+	tlsCertFile   string
+	tlsKeyFile    string
+	tlsCACertFile string
+
+	//Prometheus 指标的 HTTP 监听地址,为空时不收集指标
+	metricsAddr string
+
+	//执行时间超过 slowlogSlowerThan 微秒的命令记录到慢日志中
+	slowlogSlowerThan int64
+	slowlogMaxLen     int
+
+	//订阅者和 monitor 的输出缓冲区积压超过这个大小时断开连接,0 表示不限制
+	pubsubOutputLimit  int64
+	monitorOutputLimit int64
+
+	//raft 集群模式,raftId 为空时以单机模式运行
+	raftId        string
+	raftAddr      string
+	raftDir       string
+	raftPeers     string
+	raftBootstrap bool
+}
+
+var defaultServerConfig = serverConfig{
+	addr:            "127.0.0.1:6380",
+	options:         bitcask.DefaultOptions,
+	databases:       defaultDatabases,
+	shutdownTimeout: 10 * time.Second,
+
+	slowlogSlowerThan: defaultSlowlogSlowerThan,
+	slowlogMaxLen:     defaultSlowlogMaxLen,
+
+	pubsubOutputLimit:  32 << 20,
+	monitorOutputLimit: 32 << 20,
+}
+
+// path 是否是 dir 或者 dir 中的子目录
+func isSubDir(dir, path string) bool {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(absDir, absPath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// 集群模式的配置,单机模式下返回空
+func (cfg *serverConfig) clusterOptions() (*clusterOptions, error) {
+	if cfg.raftId == "" {
+		return nil, nil
+	}
+	peers, err := parseClusterPeers(cfg.raftPeers)
+	if err != nil {
+		return nil, err
+	}
+	//状态机的数据目录在启动时会被清空,raft 的日志和快照不能放在里面
+	if isSubDir(cfg.options.DirPath, cfg.raftDir) {
+		return nil, fmt.Errorf("raft-dir %s must not be inside the data directory %s", cfg.raftDir, cfg.options.DirPath)
+	}
+	return &clusterOptions{
+		nodeId:    cfg.raftId,
+		raftAddr:  cfg.raftAddr,
+		raftDir:   cfg.raftDir,
+		peers:     peers,
+		bootstrap: cfg.raftBootstrap,
+	}, nil
+}
+
+// 一个配置项,配置文件、命令行参数和 CONFIG GET/SET 使用相同的名字和格式
+type configParam struct {
+	name    string
+	usage   string
+	isBool  bool
+	mutable bool //是否可以通过 CONFIG SET 在运行时修改
+	get     func(cfg *serverConfig) string
+	set     func(cfg *serverConfig, value string) error
+}
+
+var configParams = []*configParam{
+	{
+		name:  "addr",
+		usage: "redis 协议服务监听的地址",
+		get:   func(cfg *serverConfig) string { return cfg.addr },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.addr = value
+			return nil
+		},
+	},
+	{
+		name:  "dir",
+		usage: "数据目录",
+		get:   func(cfg *serverConfig) string { return cfg.options.DirPath },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.options.DirPath = value
+			return nil
+		},
+	},
+	{
+		name:  "databases",
+		usage: "数据库的数量,集群模式下只能使用数据库0",
+		get:   func(cfg *serverConfig) string { return strconv.Itoa(cfg.databases) },
+		set: func(cfg *serverConfig, value string) error {
+			n, err := parsePositive(value)
+			cfg.databases = int(n)
+			return err
+		},
+	},
+	{
+		name:  "index-type",
+		usage: "内存索引的类型: btree, art, bptree",
+		get:   func(cfg *serverConfig) string { return formatIndexType(cfg.options.IndexType) },
+		set: func(cfg *serverConfig, value string) error {
+			indexType, err := parseIndexType(value)
+			cfg.options.IndexType = indexType
+			return err
+		},
+	},
+	{
+		name:    "data-file-size",
+		usage:   "单个数据文件的大小,支持 kb/mb/gb 单位",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return strconv.FormatInt(cfg.options.DataFileSize, 10) },
+		set: func(cfg *serverConfig, value string) error {
+			size, err := parseSize(value)
+			if err == nil && size <= 0 {
+				err = errNotPositive
+			}
+			cfg.options.DataFileSize = size
+			return err
+		},
+	},
+	{
+		name:    "sync-writes",
+		usage:   "是否在每次写入之后持久化",
+		isBool:  true,
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return formatBool(cfg.options.SyncWrites) },
+		set: func(cfg *serverConfig, value string) error {
+			sync, err := parseBool(value)
+			cfg.options.SyncWrites = sync
+			return err
+		},
+	},
+	{
+		name:    "bytes-per-sync",
+		usage:   "累计写入多少字节之后持久化,0表示不主动持久化",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return strconv.FormatUint(uint64(cfg.options.BytesPerSync), 10) },
+		set: func(cfg *serverConfig, value string) error {
+			size, err := parseSize(value)
+			cfg.options.BytesPerSync = uint(size)
+			return err
+		},
+	},
+	{
+		name:   "mmap-at-startup",
+		usage:  "启动时是否使用 mmap 加载数据文件",
+		isBool: true,
+		get:    func(cfg *serverConfig) string { return formatBool(cfg.options.MMapAtStartup) },
+		set: func(cfg *serverConfig, value string) error {
+			mmap, err := parseBool(value)
+			cfg.options.MMapAtStartup = mmap
+			return err
+		},
+	},
+	{
+		name:    "data-file-merge-ratio",
+		usage:   "无效数据占比达到多少时才允许 merge",
+		mutable: true,
+		get: func(cfg *serverConfig) string {
+			return strconv.FormatFloat(float64(cfg.options.DataFileMergeRatio), 'f', -1, 32)
+		},
+		set: func(cfg *serverConfig, value string) error {
+			ratio, err := strconv.ParseFloat(value, 32)
+			if err != nil || ratio < 0 || ratio > 1 {
+				return errInvalidMergeRatio
+			}
+			cfg.options.DataFileMergeRatio = float32(ratio)
+			return nil
+		},
+	},
+	{
+		name:    "shutdown-timeout",
+		usage:   "关闭服务时等待正在执行的命令完成的时间",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return cfg.shutdownTimeout.String() },
+		set: func(cfg *serverConfig, value string) error {
+			timeout, err := time.ParseDuration(value)
+			cfg.shutdownTimeout = timeout
+			return err
+		},
+	},
+	{
+		name:    "requirepass",
+		usage:   "默认用户的密码,为空时不需要认证",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return cfg.requirePass },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.requirePass = value
+			return nil
+		},
+	},
+	{
+		name:  "aclfile",
+		usage: "保存 ACL 用户的文件",
+		get:   func(cfg *serverConfig) string { return cfg.aclFile },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.aclFile = value
+			return nil
+		},
+	},
+	{
+		name:    "slowlog-log-slower-than",
+		usage:   "执行时间超过多少微秒的命令记录到慢日志中,负数表示不记录",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return strconv.FormatInt(cfg.slowlogSlowerThan, 10) },
+		set: func(cfg *serverConfig, value string) error {
+			slowerThan, err := strconv.ParseInt(value, 10, 64)
+			cfg.slowlogSlowerThan = slowerThan
+			return err
+		},
+	},
+	{
+		name:    "slowlog-max-len",
+		usage:   "慢日志最多保留的记录数",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return strconv.Itoa(cfg.slowlogMaxLen) },
+		set: func(cfg *serverConfig, value string) error {
+			maxLen, err := strconv.Atoi(value)
+			if err == nil && maxLen < 0 {
+				err = errNegative
+			}
+			cfg.slowlogMaxLen = maxLen
+			return err
+		},
+	},
+	{
+		name:    "pubsub-output-buffer-limit",
+		usage:   "订阅者积压的消息超过这个大小时断开连接,0表示不限制,修改之后对新的订阅者生效",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return strconv.FormatInt(cfg.pubsubOutputLimit, 10) },
+		set: func(cfg *serverConfig, value string) error {
+			size, err := parseSize(value)
+			cfg.pubsubOutputLimit = size
+			return err
+		},
+	},
+	{
+		name:    "monitor-output-buffer-limit",
+		usage:   "monitor 积压的命令超过这个大小时断开连接,0表示不限制,修改之后对新的 monitor 生效",
+		mutable: true,
+		get:     func(cfg *serverConfig) string { return strconv.FormatInt(cfg.monitorOutputLimit, 10) },
+		set: func(cfg *serverConfig, value string) error {
+			size, err := parseSize(value)
+			cfg.monitorOutputLimit = size
+			return err
+		},
+	},
+	{
+		name:  "tls-cert-file",
+		usage: "TLS 证书文件,和 tls-key-file 一起设置时使用 TLS",
+		get:   func(cfg *serverConfig) string { return cfg.tlsCertFile },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.tlsCertFile = value
+			return nil
+		},
+	},
+	{
+		name:  "tls-key-file",
+		usage: "TLS 私钥文件",
+		get:   func(cfg *serverConfig) string { return cfg.tlsKeyFile },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.tlsKeyFile = value
+			return nil
+		},
+	},
+	{
+		name:  "tls-ca-cert-file",
+		usage: "验证客户端证书的 CA 文件,设置之后要求客户端提供证书",
+		get:   func(cfg *serverConfig) string { return cfg.tlsCACertFile },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.tlsCACertFile = value
+			return nil
+		},
+	},
+	{
+		name:  "metrics-addr",
+		usage: "在这个地址的 /metrics 上提供 Prometheus 指标,为空时不收集指标",
+		get:   func(cfg *serverConfig) string { return cfg.metricsAddr },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.metricsAddr = value
+			return nil
+		},
+	},
+	{
+		name:  "raft-id",
+		usage: "raft 节点 id,为空时以单机模式运行",
+		get:   func(cfg *serverConfig) string { return cfg.raftId },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.raftId = value
+			return nil
+		},
+	},
+	{
+		name:  "raft-addr",
+		usage: "raft 通信的地址",
+		get:   func(cfg *serverConfig) string { return cfg.raftAddr },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.raftAddr = value
+			return nil
+		},
+	},
+	{
+		name:  "raft-dir",
+		usage: "raft 日志和快照的目录",
+		get:   func(cfg *serverConfig) string { return cfg.raftDir },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.raftDir = value
+			return nil
+		},
+	},
+	{
+		name:  "raft-peers",
+		usage: "集群的所有节点: id=raftAddr=respAddr,...",
+		get:   func(cfg *serverConfig) string { return cfg.raftPeers },
+		set: func(cfg *serverConfig, value string) error {
+			cfg.raftPeers = value
+			return nil
+		},
+	},
+	{
+		name:   "raft-bootstrap",
+		usage:  "是否初始化集群,只需要一个节点在第一次启动时指定",
+		isBool: true,
+		get:    func(cfg *serverConfig) string { return formatBool(cfg.raftBootstrap) },
+		set: func(cfg *serverConfig, value string) error {
+			bootstrap, err := parseBool(value)
+			cfg.raftBootstrap = bootstrap
+			return err
+		},
+	},
+}
+
+func lookupConfigParam(name string) *configParam {
+	for _, p := range configParams {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+func setConfigParam(cfg *serverConfig, name, value string) error {
+	p := lookupConfigParam(strings.ToLower(name))
+	if p == nil {
+		return fmt.Errorf("unknown config: %s", name)
+	}
+	if err := p.set(cfg, value); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", p.name, err)
+	}
+	return nil
+}
+
+// 命令行参数按照出现的顺序记录下来,读取完配置文件之后再覆盖
+type configFlag struct {
+	param     *configParam
+	overrides *[][2]string
+}
+
+func (f *configFlag) String() string {
+	if f.param == nil {
+		return ""
+	}
+	return f.param.get(&defaultServerConfig)
+}
+
+func (f *configFlag) Set(value string) error {
+	//先用一个临时的配置检查格式,出错时由 flag 打印用法
+	cfg := defaultServerConfig
+	if err := f.param.set(&cfg, value); err != nil {
+		return err
+	}
+	*f.overrides = append(*f.overrides, [2]string{f.param.name, value})
+	return nil
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.param != nil && f.param.isBool
+}
+
+// 解析命令行参数,-config 指定的配置文件中的配置会被命令行参数覆盖
+func loadServerConfig(name string, args []string) (serverConfig, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	configPath := fs.String("config", "", "配置文件的路径,每行一个配置: 名字 值")
+	var overrides [][2]string
+	for _, p := range configParams {
+		fs.Var(&configFlag{param: p, overrides: &overrides}, p.name, p.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return serverConfig{}, err
+	}
+
+	cfg := defaultServerConfig
+	if *configPath != "" {
+		if err := loadConfigFile(&cfg, *configPath); err != nil {
+			return serverConfig{}, err
+		}
+	}
+	for _, override := range overrides {
+		if err := setConfigParam(&cfg, override[0], override[1]); err != nil {
+			return serverConfig{}, err
+		}
+	}
+	return cfg, nil
+}
+
+// 读取 redis.conf 格式的配置文件: 每行为名字和值,# 开头的行为注释,值可以用双引号包围
+func loadConfigFile(cfg *serverConfig, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		if err := setConfigParam(cfg, name, value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "true":
+		return true, nil
+	case "no", "false":
+		return false, nil
+	default:
+		return false, errInvalidBool
+	}
+}
+
+func formatBool(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+func parsePositive(value string) (int64, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, errNotPositive
+	}
+	return n, nil
+}
+
+// 解析带单位的大小,和 redis.conf 一样 k/m/g 为1000的倍数,kb/mb/gb 为1024的倍数
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000}, {"b", 1},
+	}
+	value = strings.ToLower(value)
+	var multiple int64 = 1
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSuffix(value, unit.suffix)
+			multiple = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, errInvalidSize
+	}
+	return n * multiple, nil
+}
+
+func parseIndexType(value string) (bitcask.IndexerType, error) {
+	switch strings.ToLower(value) {
+	case "btree":
+		return bitcask.BTree, nil
+	case "art":
+		return bitcask.ART, nil
+	case "bptree":
+		return bitcask.BPlusTree, nil
+	default:
+		return 0, errInvalidIndexType
+	}
+}
+
+func formatIndexType(indexType bitcask.IndexerType) string {
+	switch indexType {
+	case bitcask.ART:
+		return "art"
+	case bitcask.BPlusTree:
+		return "bptree"
+	default:
+		return "btree"
+	}
+}
+
+// CONFIG GET pattern [pattern ...] | CONFIG SET name value [name value ...]
+func config(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("config")
+	}
+
+	switch strings.ToLower(string(args[0])) {
+	case "get":
+		if len(args) < 2 {
+			return nil, newWrongNumberOfArgsError("config|get")
+		}
+		return cli.server.configGet(args[1:]), nil
+	case "set":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return nil, newWrongNumberOfArgsError("config|set")
+		}
+		if err := cli.server.configSet(args[1:]); err != nil {
+			return nil, err
+		}
+		return redcon.SimpleString("OK"), nil
+	default:
+		return nil, errUnknownConfigCommand
+	}
+}
+
+func (svr *BitcaskServer) configGet(patterns [][]byte) []interface{} {
+	svr.mu.RLock()
+	defer svr.mu.RUnlock()
+	var res []interface{}
+	for _, p := range configParams {
+		for _, pattern := range patterns {
+			if utils.GlobMatch([]byte(strings.ToLower(string(pattern))), []byte(p.name)) {
+				res = append(res, p.name, p.get(&svr.config))
+				break
+			}
+		}
+	}
+	if res == nil {
+		res = []interface{}{}
+	}
+	return res
+}
+
+// 所有的配置项都合法时才会生效,存储引擎的配置会应用到所有打开的数据库
+func (svr *BitcaskServer) configSet(args [][]byte) error {
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	cfg := svr.config
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(string(args[i]))
+		p := lookupConfigParam(name)
+		if p == nil {
+			return fmt.Errorf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", name)
+		}
+		if !p.mutable {
+			return fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", name)
+		}
+		if err := p.set(&cfg, string(args[i+1])); err != nil {
+			return fmt.Errorf("ERR CONFIG SET failed (possibly related to argument '%s') - %v", name, err)
+		}
+	}
+	//先检查所有的数据库,都合法之后再修改,避免只有一部分数据库生效
+	for _, rds := range svr.dbs {
+		if err := rds.CheckReconfigure(cfg.options); err != nil {
+			return err
+		}
+	}
+	for _, rds := range svr.dbs {
+		if err := rds.Reconfigure(cfg.options); err != nil {
+			return err
+		}
+	}
+	if cfg.requirePass != svr.config.requirePass {
+		svr.acl.setDefaultPassword(cfg.requirePass)
+	}
+	svr.slowlog.configure(cfg.slowlogSlowerThan, cfg.slowlogMaxLen)
+	svr.config = cfg
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadServerConfig(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-config")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "bitcask.conf")
+	content := `# 示例配置
+addr 127.0.0.1:7000
+dir "/tmp/bitcask data"
+databases 4
+index-type bptree
+data-file-size 64mb
+sync-writes yes
+raft-bootstrap no
+`
+	err := os.WriteFile(path, []byte(content), 0644)
+	assert.Nil(t, err)
+
+	// 命令行参数覆盖配置文件
+	cfg, err := loadServerConfig("test", []string{"-config", path, "-databases", "8", "-raft-bootstrap"})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:7000", cfg.addr)
+	assert.Equal(t, "/tmp/bitcask data", cfg.options.DirPath)
+	assert.Equal(t, 8, cfg.databases)
+	assert.Equal(t, bitcask.BPlusTree, cfg.options.IndexType)
+	assert.Equal(t, int64(64<<20), cfg.options.DataFileSize)
+	assert.True(t, cfg.options.SyncWrites)
+	assert.True(t, cfg.raftBootstrap)
+	assert.Equal(t, defaultServerConfig.shutdownTimeout, cfg.shutdownTimeout)
+
+	_, err = loadServerConfig("test", []string{"-databases", "0"})
+	assert.NotNil(t, err)
+	err = os.WriteFile(path, []byte("unknown 1\n"), 0644)
+	assert.Nil(t, err)
+	_, err = loadServerConfig("test", []string{"-config", path})
+	assert.NotNil(t, err)
+}
+
+func TestParseSize(t *testing.T) {
+	for value, size := range map[string]int64{"1024": 1024, "1k": 1000, "1kb": 1024, "2MB": 2 << 20, "1g": 1000 * 1000 * 1000, "1gb": 1 << 30} {
+		res, err := parseSize(value)
+		assert.Nil(t, err)
+		assert.Equal(t, size, res)
+	}
+	_, err := parseSize("-1")
+	assert.NotNil(t, err)
+	_, err = parseSize("1tb")
+	assert.NotNil(t, err)
+}
+
+func TestBitcaskServer_Config(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("CONFIG", "GET", "sync-writes")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"sync-writes", "no"}, res)
+	res, err = cli.do("CONFIG", "GET", "data-file-*", "databases")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"databases", "16", "data-file-size", "268435456", "data-file-merge-ratio", "0.5"}, res)
+	res, err = cli.do("CONFIG", "GET", "unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{}, res)
+
+	res, err = cli.do("CONFIG", "SET", "sync-writes", "yes", "data-file-size", "1mb")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("CONFIG", "GET", "sync-writes")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"sync-writes", "yes"}, res)
+
+	// 新打开的数据库也使用修改之后的配置
+	_, err = cli.do("SELECT", "1")
+	assert.Nil(t, err)
+	svr.mu.RLock()
+	assert.Equal(t, int64(1<<20), svr.config.options.DataFileSize)
+	svr.mu.RUnlock()
+
+	// 不可修改的配置和非法的值都不会生效
+	_, err = cli.do("CONFIG", "SET", "dir", "/tmp")
+	assert.NotNil(t, err)
+	_, err = cli.do("CONFIG", "SET", "bytes-per-sync", "1024", "data-file-merge-ratio", "2")
+	assert.NotNil(t, err)
+	res, err = cli.do("CONFIG", "GET", "bytes-per-sync")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"bytes-per-sync", "8"}, res)
+	_, err = cli.do("CONFIG", "SET", "unknown", "1")
+	assert.NotNil(t, err)
+	_, err = cli.do("CONFIG", "SET", "sync-writes")
+	assert.NotNil(t, err)
+	_, err = cli.do("CONFIG", "REWRITE")
+	assert.NotNil(t, err)
+}
+
+func TestBitcaskServer_Shutdown(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	_, err := cli.do("SET", "k", "v")
+	assert.Nil(t, err)
+
+	// 阻塞的命令在关闭时被唤醒并正常返回
+	result := make(chan interface{}, 1)
+	go func() {
+		res, err := cli.do("BLPOP", "queue", "0")
+		assert.Nil(t, err)
+		result <- res
+	}()
+	assert.Eventually(t, func() bool {
+		svr.blocking.mu.Lock()
+		defer svr.blocking.mu.Unlock()
+		return len(svr.blocking.waiters) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	svr.shutdown()
+	assert.Nil(t, <-result)
+	_, err = cli.do("GET", "k")
+	assert.NotNil(t, err)
+	// 重复关闭没有影响
+	svr.shutdown()
+}
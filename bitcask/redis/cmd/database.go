@@ -0,0 +1,292 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/redcon"
+	bitcask_redis "kv-go/bitcask/redis"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultDatabases = 16
+
+	//编号不为0的数据库保存在数据目录旁边的 DirPath-db<n> 目录中
+	dbDirSuffix = "-db"
+	//SWAPDB 之后保存数据库编号和目录的对应关系
+	dbMappingSuffix = "-databases"
+)
+
+var (
+	errDBIndexOutOfRange    = errors.New("ERR DB index is out of range")
+	errInvalidFirstDBIndex  = errors.New("ERR invalid first DB index")
+	errInvalidSecondDBIndex = errors.New("ERR invalid second DB index")
+	errInvalidDBMapping     = errors.New("invalid database mapping file")
+)
+
+// 集群模式下只有数据库0
+func newClusterSingleDBError(cmd string) error {
+	return fmt.Errorf("ERR %s is not allowed in cluster mode", strings.ToUpper(cmd))
+}
+
+// 数据库的默认目录,数据库0直接使用 DirPath,和只有一个数据库时的目录保持兼容
+func defaultDBDir(dirPath string, index int) string {
+	if index == 0 {
+		return dirPath
+	}
+	return filepath.Clean(dirPath) + dbDirSuffix + strconv.Itoa(index)
+}
+
+func dbMappingPath(dirPath string) string {
+	return filepath.Clean(dirPath) + dbMappingSuffix
+}
+
+// 读取每个数据库的目录,SWAPDB 交换过的数据库从对应关系文件中读取,其他的使用默认目录
+func loadDBDirs(dirPath string, databases int) ([]string, error) {
+	dirs := make([]string, databases)
+	for i := range dirs {
+		dirs[i] = defaultDBDir(dirPath, i)
+	}
+	data, err := os.ReadFile(dbMappingPath(dirPath))
+	if os.IsNotExist(err) {
+		return dirs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	//每行为: 数据库编号 目录名,目录和 DirPath 在同一个父目录下
+	parent := filepath.Dir(filepath.Clean(dirPath))
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, errInvalidDBMapping
+		}
+		index, err := strconv.Atoi(fields[0])
+		if err != nil || index < 0 {
+			return nil, errInvalidDBMapping
+		}
+		//减少数据库的数量之后忽略多出来的数据库
+		if index < databases {
+			dirs[index] = filepath.Join(parent, fields[1])
+		}
+	}
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		if seen[dir] {
+			return nil, errInvalidDBMapping
+		}
+		seen[dir] = true
+	}
+	return dirs, nil
+}
+
+// 保存和默认目录不同的对应关系,先写入临时文件再重命名,避免写入一半时崩溃
+func saveDBDirs(dirPath string, dirs []string) error {
+	var sb strings.Builder
+	for i, dir := range dirs {
+		if dir != defaultDBDir(dirPath, i) {
+			sb.WriteString(fmt.Sprintf("%d %s\n", i, filepath.Base(dir)))
+		}
+	}
+	path := dbMappingPath(dirPath)
+	if sb.Len() == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(sb.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// 获取数据库,第一次使用时才打开对应的目录
+func (svr *BitcaskServer) openDatabase(index int) (*bitcask_redis.RedisDataStructure, error) {
+	svr.mu.Lock()
+	defer svr.mu.Unlock()
+	if rds, ok := svr.dbs[index]; ok {
+		return rds, nil
+	}
+	options := svr.config.options
+	options.DirPath = svr.dirs[index]
+	rds, err := svr.openDB(options)
+	if err != nil {
+		return nil, err
+	}
+	svr.dbs[index] = rds
+	return rds, nil
+}
+
+// 交换两个数据库的数据,使用这两个数据库的客户端会立即看到对方的数据
+func (svr *BitcaskServer) swapDatabases(a, b int) error {
+	if _, err := svr.openDatabase(a); err != nil {
+		return err
+	}
+	if _, err := svr.openDatabase(b); err != nil {
+		return err
+	}
+
+	svr.mu.Lock()
+	svr.dirs[a], svr.dirs[b] = svr.dirs[b], svr.dirs[a]
+	if err := saveDBDirs(svr.config.options.DirPath, svr.dirs); err != nil {
+		svr.dirs[a], svr.dirs[b] = svr.dirs[b], svr.dirs[a]
+		svr.mu.Unlock()
+		return err
+	}
+	svr.dbs[a], svr.dbs[b] = svr.dbs[b], svr.dbs[a]
+	svr.mu.Unlock()
+
+	//阻塞的客户端需要在新的数据库上重新等待
+	svr.blocking.wakeAll()
+	return nil
+}
+
+// 清空所有的数据库,没有打开过的数据库直接删除目录
+func (svr *BitcaskServer) flushAll() error {
+	svr.mu.Lock()
+	var opened []*bitcask_redis.RedisDataStructure
+	for i, dir := range svr.dirs {
+		if rds, ok := svr.dbs[i]; ok {
+			opened = append(opened, rds)
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			svr.mu.Unlock()
+			return err
+		}
+	}
+	svr.mu.Unlock()
+
+	for _, rds := range opened {
+		if err := rds.FlushDB(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析数据库编号,不是整数时返回 invalidErr
+func (svr *BitcaskServer) parseDBIndex(arg []byte, invalidErr error) (int, error) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return 0, invalidErr
+	}
+	if index < 0 || index >= len(svr.dirs) {
+		return 0, errDBIndexOutOfRange
+	}
+	return index, nil
+}
+
+func selectDB(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("select")
+	}
+	index, err := cli.server.parseDBIndex(args[0], errNotInteger)
+	if err != nil {
+		return nil, err
+	}
+	if cli.server.cluster != nil && index != 0 {
+		return nil, newClusterSingleDBError("select")
+	}
+
+	db, err := cli.server.openDatabase(index)
+	if err != nil {
+		return nil, err
+	}
+	cli.dbIndex = index
+	cli.db = db
+	return redcon.SimpleString("OK"), nil
+}
+
+func swapdb(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("swapdb")
+	}
+	a, err := cli.server.parseDBIndex(args[0], errInvalidFirstDBIndex)
+	if err != nil {
+		return nil, err
+	}
+	b, err := cli.server.parseDBIndex(args[1], errInvalidSecondDBIndex)
+	if err != nil {
+		return nil, err
+	}
+	if cli.server.cluster != nil {
+		return nil, newClusterSingleDBError("swapdb")
+	}
+
+	if a != b {
+		if err := cli.server.swapDatabases(a, b); err != nil {
+			return nil, err
+		}
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// MOVE key db
+func move(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("move")
+	}
+	index, err := cli.server.parseDBIndex(args[1], errNotInteger)
+	if err != nil {
+		return nil, err
+	}
+	if cli.server.cluster != nil {
+		return nil, newClusterSingleDBError("move")
+	}
+	if index == cli.dbIndex {
+		return nil, bitcask_redis.ErrSameObject
+	}
+
+	dst, err := cli.server.openDatabase(index)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := cli.db.Move(args[0], dst)
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+// 解析 FLUSHDB/FLUSHALL 的 ASYNC|SYNC 参数,两种方式都同步执行
+func parseFlushMode(cmd string, args [][]byte) error {
+	if len(args) > 1 {
+		return newWrongNumberOfArgsError(cmd)
+	}
+	if len(args) == 1 {
+		mode := strings.ToLower(string(args[0]))
+		if mode != "async" && mode != "sync" {
+			return errSyntax
+		}
+	}
+	return nil
+}
+
+func flushdb(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if err := parseFlushMode("flushdb", args); err != nil {
+		return nil, err
+	}
+
+	if err := cli.db.FlushDB(); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func flushall(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if err := parseFlushMode("flushall", args); err != nil {
+		return nil, err
+	}
+
+	if err := cli.server.flushAll(); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 删除数据目录以及其他数据库的目录
+func removeTestDirs(dir string) {
+	paths, _ := filepath.Glob(filepath.Clean(dir) + "*")
+	for _, path := range paths {
+		_ = os.RemoveAll(path)
+	}
+}
+
+func TestBitcaskServer_Select(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-select")
+	defer removeTestDirs(dir)
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	cfg.databases = 4
+	svr, addr := startTestServerWithConfig(t, cfg)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	_, err := cli.do("SET", "k", "v0")
+	assert.Nil(t, err)
+	res, err := cli.do("SELECT", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	_, err = cli.do("SET", "k", "v1")
+	assert.Nil(t, err)
+	_, err = cli.do("SELECT", "4")
+	assert.NotNil(t, err)
+	_, err = cli.do("SELECT", "abc")
+	assert.NotNil(t, err)
+
+	// 其他客户端默认使用数据库0
+	other := newTestClient(t, addr)
+	defer other.close()
+	res, err = other.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v0", res)
+
+	// 阻塞的客户端只会被同一个数据库中的写入唤醒
+	result := make(chan interface{}, 1)
+	go func() {
+		res, err := cli.do("BLPOP", "queue", "0")
+		assert.Nil(t, err)
+		result <- res
+	}()
+	assert.Eventually(t, func() bool {
+		svr.blocking.mu.Lock()
+		defer svr.blocking.mu.Unlock()
+		return len(svr.blocking.waiters[blockingKey{db: svr.db(1), key: "queue"}]) == 1
+	}, time.Second, 5*time.Millisecond)
+	_, err = other.do("RPUSH", "queue", "job-0")
+	assert.Nil(t, err)
+	_, err = other.do("SELECT", "1")
+	assert.Nil(t, err)
+	_, err = other.do("RPUSH", "queue", "job-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"queue", "job-1"}, <-result)
+}
+
+func TestBitcaskServer_Move(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-move")
+	defer removeTestDirs(dir)
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	_, addr := startTestServerWithConfig(t, cfg)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	_, err := cli.do("HSET", "h", "f", "v")
+	assert.Nil(t, err)
+	res, err := cli.do("MOVE", "h", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("EXISTS", "h")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	res, err = cli.do("MOVE", "h", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	_, err = cli.do("MOVE", "h", "0")
+	assert.NotNil(t, err)
+	_, err = cli.do("MOVE", "h", "16")
+	assert.NotNil(t, err)
+
+	_, err = cli.do("SELECT", "2")
+	assert.Nil(t, err)
+	res, err = cli.do("HGET", "h", "f")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", res)
+}
+
+func TestBitcaskServer_SwapDB(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-swapdb")
+	defer removeTestDirs(dir)
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	svr, addr := startTestServerWithConfig(t, cfg)
+	cli := newTestClient(t, addr)
+
+	_, err := cli.do("SET", "k", "v0")
+	assert.Nil(t, err)
+	_, err = cli.do("WATCH", "k")
+	assert.Nil(t, err)
+	res, err := cli.do("SWAPDB", "0", "3")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	_, err = cli.do("SWAPDB", "0", "x")
+	assert.NotNil(t, err)
+
+	// 交换之后监视的数据库被替换
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "k", "v1")
+	assert.Nil(t, err)
+	res, err = cli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	_, err = cli.do("SELECT", "3")
+	assert.Nil(t, err)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v0", res)
+	cli.close()
+	svr.shutdown()
+
+	// 重启之后交换仍然有效
+	svr, addr = startTestServerWithConfig(t, cfg)
+	cli = newTestClient(t, addr)
+	defer cli.close()
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	_, err = cli.do("SELECT", "3")
+	assert.Nil(t, err)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v0", res)
+
+	// 换回来之后删除对应关系文件
+	_, err = cli.do("SWAPDB", "3", "0")
+	assert.Nil(t, err)
+	_, err = os.Stat(dbMappingPath(dir))
+	assert.True(t, os.IsNotExist(err))
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+}
+
+func TestBitcaskServer_Flush(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-flush")
+	defer removeTestDirs(dir)
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	svr, addr := startTestServerWithConfig(t, cfg)
+	cli := newTestClient(t, addr)
+
+	for _, db := range []string{"0", "1", "2"} {
+		_, err := cli.do("SELECT", db)
+		assert.Nil(t, err)
+		_, err = cli.do("SET", "k", db)
+		assert.Nil(t, err)
+		_, err = cli.do("SADD", "s", "a", "b")
+		assert.Nil(t, err)
+	}
+	res, err := cli.do("FLUSHDB")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("DBSIZE")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	_, err = cli.do("FLUSHDB", "LAZY")
+	assert.NotNil(t, err)
+
+	_, err = cli.do("SELECT", "1")
+	assert.Nil(t, err)
+	res, err = cli.do("DBSIZE")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	cli.close()
+	svr.shutdown()
+
+	// 重启之后数据库1和2都没有打开,FLUSHALL 直接删除它们的目录
+	svr, addr = startTestServerWithConfig(t, cfg)
+	cli = newTestClient(t, addr)
+	defer cli.close()
+	res, err = cli.do("FLUSHALL", "SYNC")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	for _, db := range []string{"0", "1", "2"} {
+		_, err := cli.do("SELECT", db)
+		assert.Nil(t, err)
+		res, err = cli.do("DBSIZE")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), res)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"github.com/tidwall/redcon"
+	"kv-go/bitcask"
+	bitcask_redis "kv-go/bitcask/redis"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errNoSuchKey       = errors.New("ERR no such key")
+	errUnknownTypeName = errors.New("ERR unknown type name")
+)
+
+// 数据类型在 TYPE 和 SCAN 命令中的名称
+var dataTypeNames = map[bitcask_redis.RedisDataType]string{
+	bitcask_redis.String: "string",
+	bitcask_redis.Hash:   "hash",
+	bitcask_redis.Set:    "set",
+	bitcask_redis.List:   "list",
+	bitcask_redis.ZSet:   "zset",
+}
+
+func del(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("del")
+	}
+
+	count, err := cli.db.DelKeys(args...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func exists(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("exists")
+	}
+
+	count, err := cli.db.Exists(args...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func typeCmd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("type")
+	}
+
+	typ, err := cli.db.Type(args[0])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return redcon.SimpleString("none"), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString(dataTypeNames[typ]), nil
+}
+
+func expire(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return expireCmd(cli, args, "expire", time.Second, false)
+}
+
+func pexpire(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return expireCmd(cli, args, "pexpire", time.Millisecond, false)
+}
+
+func expireat(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return expireCmd(cli, args, "expireat", time.Second, true)
+}
+
+func pexpireat(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return expireCmd(cli, args, "pexpireat", time.Millisecond, true)
+}
+
+// 设置过期时间,absolute 为 true 时参数是 unix 时间戳,否则是相对于当前的时间
+func expireCmd(cli *BitcaskClient, args [][]byte, name string, unit time.Duration, absolute bool) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError(name)
+	}
+
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) {
+		return nil, errInvalidExpire
+	}
+	var at time.Time
+	if absolute {
+		at = time.Unix(0, n*int64(unit))
+	} else {
+		at = cli.db.Now().Add(time.Duration(n) * unit)
+	}
+	ok, err := cli.db.ExpireAt(args[0], at)
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func ttl(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return ttlCmd(cli, args, "ttl", time.Second)
+}
+
+func pttl(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return ttlCmd(cli, args, "pttl", time.Millisecond)
+}
+
+// key 不存在时返回 -2,没有过期时间时返回 -1
+func ttlCmd(cli *BitcaskClient, args [][]byte, name string, unit time.Duration) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError(name)
+	}
+
+	res, err := cli.db.TTL(args[0])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return redcon.SimpleInt(-2), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res == bitcask_redis.NoExpiration {
+		return redcon.SimpleInt(-1), nil
+	}
+	//四舍五入到对应的单位
+	return redcon.SimpleInt((res + unit/2) / unit), nil
+}
+
+func persist(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("persist")
+	}
+
+	ok, err := cli.db.Persist(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func keys(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("keys")
+	}
+
+	res, err := cli.db.Keys(string(args[0]))
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(res), nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func scan(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("scan")
+	}
+
+	//TYPE 参数单独解析,剩下的参数与其他 SCAN 类命令相同
+	var dataTypes []bitcask_redis.RedisDataType
+	scanArgs := [][]byte{args[0]}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 < len(args) && strings.ToLower(string(args[i])) == "type" {
+			typ, ok := parseDataType(string(args[i+1]))
+			if !ok {
+				return nil, errUnknownTypeName
+			}
+			dataTypes = []bitcask_redis.RedisDataType{typ}
+			continue
+		}
+		scanArgs = append(scanArgs, args[i:min(i+2, len(args))]...)
+	}
+	cursor, pattern, count, err := parseScanArgs(scanArgs)
+	if err != nil {
+		return nil, err
+	}
+	next, res, err := cli.db.Scan(cursor, pattern, count, dataTypes...)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{strconv.FormatUint(next, 10), bulkArray(res)}, nil
+}
+
+func rename(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("rename")
+	}
+
+	err := cli.db.Rename(args[0], args[1])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, errNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func renamenx(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("renamenx")
+	}
+
+	ok, err := cli.db.RenameNX(args[0], args[1])
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, errNoSuchKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func dbsize(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumberOfArgsError("dbsize")
+	}
+
+	size, err := cli.db.DBSize()
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func randomkey(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumberOfArgsError("randomkey")
+	}
+
+	key, err := cli.db.RandomKey()
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseDataType(name string) (bitcask_redis.RedisDataType, bool) {
+	for typ, typeName := range dataTypeNames {
+		if strings.EqualFold(name, typeName) {
+			return typ, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBitcaskServer_Keyspace(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	_, err := cli.do("MSET", "k1", "v1", "k2", "v2")
+	assert.Nil(t, err)
+	_, err = cli.do("HSET", "h", "f", "v")
+	assert.Nil(t, err)
+	_, err = cli.do("RPUSH", "l", "a", "b")
+	assert.Nil(t, err)
+
+	res, err := cli.do("EXISTS", "k1", "h", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = cli.do("TYPE", "h")
+	assert.Nil(t, err)
+	assert.Equal(t, "hash", res)
+	res, err = cli.do("TYPE", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, "none", res)
+	res, err = cli.do("KEYS", "k*")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"k1", "k2"}, res)
+	res, err = cli.do("DBSIZE")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), res)
+	res, err = cli.do("SCAN", "0", "TYPE", "list")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"0", []interface{}{"l"}}, res)
+	res, err = cli.do("SCAN", "0", "MATCH", "k*", "COUNT", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"1", []interface{}{}}, res)
+	_, err = cli.do("SCAN", "0", "TYPE", "unknown")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("TTL", "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), res)
+	res, err = cli.do("TTL", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-2), res)
+	res, err = cli.do("EXPIRE", "k1", "100")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("TTL", "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), res)
+	res, err = cli.do("PERSIST", "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("PEXPIREAT", "l", strconv.FormatInt(time.Now().Add(time.Minute).UnixMilli(), 10))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("PTTL", "l")
+	assert.Nil(t, err)
+	assert.True(t, res.(int64) > 59000)
+	res, err = cli.do("PEXPIRE", "k2", "10")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	time.Sleep(20 * time.Millisecond)
+	res, err = cli.do("GET", "k2")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	res, err = cli.do("EXPIREAT", "x", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+
+	res, err = cli.do("RENAME", "h", "h2")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("HGET", "h2", "f")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", res)
+	_, err = cli.do("RENAME", "h", "h3")
+	assert.NotNil(t, err)
+	res, err = cli.do("RENAMENX", "h2", "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+
+	res, err = cli.do("DEL", "k1", "h2", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = cli.do("RANDOMKEY")
+	assert.Nil(t, err)
+	assert.Equal(t, "l", res)
+	_, err = cli.do("DEL", "l")
+	assert.Nil(t, err)
+	res, err = cli.do("RANDOMKEY")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+}
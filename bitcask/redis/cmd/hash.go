@@ -0,0 +1,193 @@
+package main
+
+import (
+	"github.com/tidwall/redcon"
+	"math"
+	"strconv"
+)
+
+func hset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, newWrongNumberOfArgsError("hset")
+	}
+
+	res, err := cli.db.HMSet(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+func hget(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("hget")
+	}
+
+	value, err := cli.db.HGet(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(value), nil
+}
+
+func hdel(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("hdel")
+	}
+
+	var count = 0
+	for _, field := range args[1:] {
+		ok, err := cli.db.HDel(args[0], field)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func hmset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, newWrongNumberOfArgsError("hmset")
+	}
+
+	if _, err := cli.db.HMSet(args[0], args[1:]...); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func hmget(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("hmget")
+	}
+
+	values, err := cli.db.HMGet(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(values), nil
+}
+
+func hsetnx(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("hsetnx")
+	}
+
+	ok, err := cli.db.HSetNX(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func hgetall(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hgetall")
+	}
+
+	values, err := cli.db.HGetAll(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(values), nil
+}
+
+func hkeys(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hkeys")
+	}
+
+	values, err := cli.db.HKeys(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(values), nil
+}
+
+func hvals(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hvals")
+	}
+
+	values, err := cli.db.HVals(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(values), nil
+}
+
+func hlen(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("hlen")
+	}
+
+	size, err := cli.db.HLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func hexists(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("hexists")
+	}
+
+	ok, err := cli.db.HExists(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func hincrby(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("hincrby")
+	}
+
+	incr, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	res, err := cli.db.HIncrBy(args[0], args[1], incr)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+func hincrbyfloat(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("hincrbyfloat")
+	}
+
+	incr, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(incr) || math.IsInf(incr, 0) {
+		return nil, errNotFloat
+	}
+	res, err := cli.db.HIncrByFloat(args[0], args[1], incr)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(res, 'f', -1, 64), nil
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count]
+func hscan(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("hscan")
+	}
+
+	cursor, pattern, count, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	next, values, err := cli.db.HScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{strconv.FormatUint(next, 10), bulkArray(values)}, nil
+}
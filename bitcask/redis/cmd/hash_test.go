@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestBitcaskServer_Hash(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("HSET", "user", "name", "bitcask", "age", "18")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = cli.do("HMSET", "user", "age", "19", "city", "beijing")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("HGET", "user", "age")
+	assert.Nil(t, err)
+	assert.Equal(t, "19", res)
+	res, err = cli.do("HGET", "user", "unknown")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	res, err = cli.do("HMGET", "user", "name", "unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"bitcask", nil}, res)
+	res, err = cli.do("HLEN", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("HGETALL", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"age", "19", "city", "beijing", "name", "bitcask"}, res)
+	res, err = cli.do("HKEYS", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"age", "city", "name"}, res)
+	res, err = cli.do("HVALS", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"19", "beijing", "bitcask"}, res)
+	res, err = cli.do("HEXISTS", "user", "city")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+
+	res, err = cli.do("HINCRBY", "user", "age", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(21), res)
+	res, err = cli.do("HINCRBYFLOAT", "user", "age", "0.5")
+	assert.Nil(t, err)
+	assert.Equal(t, "21.5", res)
+	_, err = cli.do("HINCRBY", "user", "age", "1")
+	assert.NotNil(t, err)
+	res, err = cli.do("HSETNX", "user", "name", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+
+	res, err = cli.do("HSCAN", "user", "0", "MATCH", "c*", "COUNT", "10")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"0", []interface{}{"city", "beijing"}}, res)
+	_, err = cli.do("HSCAN", "user", "0", "COUNT")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("HDEL", "user", "name", "city", "unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = cli.do("HLEN", "user")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	bitcask_redis "kv-go/bitcask/redis"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	//客户端根据版本号判断可以使用的命令
+	redisVersion = "7.0.0"
+
+	//和 Redis 一样每 100ms 采样一次,取最近16次采样的平均值作为每秒执行的命令数
+	statsSampleInterval = 100 * time.Millisecond
+	statsSamples        = 16
+)
+
+// INFO 中各个部分的顺序,不带参数时返回所有的部分
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "keyspace"}
+
+// 服务运行期间的统计数据
+type serverStats struct {
+	startTime   time.Time
+	connections atomic.Int64 //接受过的连接数量
+	commands    atomic.Int64 //执行过的命令数量
+
+	mu           sync.Mutex
+	samples      [statsSamples]int64
+	sampleIndex  int
+	lastSample   time.Time
+	lastCommands int64
+	stop         chan struct{}
+}
+
+func newServerStats() *serverStats {
+	now := time.Now()
+	return &serverStats{startTime: now, lastSample: now, stop: make(chan struct{})}
+}
+
+// 定期采样执行的命令数,直到 close
+func (s *serverStats) run() {
+	ticker := time.NewTicker(statsSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			s.sample(now)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *serverStats) sample(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := s.commands.Load()
+	elapsed := now.Sub(s.lastSample)
+	if elapsed <= 0 {
+		return
+	}
+	s.samples[s.sampleIndex] = (commands - s.lastCommands) * int64(time.Second) / int64(elapsed)
+	s.sampleIndex = (s.sampleIndex + 1) % statsSamples
+	s.lastSample, s.lastCommands = now, commands
+}
+
+// 最近一段时间平均每秒执行的命令数
+func (s *serverStats) opsPerSec() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum int64
+	for _, sample := range s.samples {
+		sum += sample
+	}
+	return sum / statsSamples
+}
+
+func (s *serverStats) close() {
+	close(s.stop)
+}
+
+// INFO [section ...]
+func info(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	sections := make(map[string]bool)
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		if section == "all" || section == "default" || section == "everything" {
+			sections = nil
+			break
+		}
+		sections[section] = true
+	}
+	if len(args) == 0 {
+		sections = nil
+	}
+
+	svr := cli.server
+	var parts []string
+	for _, section := range infoSections {
+		if sections != nil && !sections[section] {
+			continue
+		}
+		fields, err := svr.infoSection(section)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		sb.WriteString("# " + strings.ToUpper(section[:1]) + section[1:] + "\r\n")
+		for _, field := range fields {
+			sb.WriteString(field[0] + ":" + field[1] + "\r\n")
+		}
+		parts = append(parts, sb.String())
+	}
+	return strings.Join(parts, "\r\n"), nil
+}
+
+// INFO 中一个部分的所有字段
+func (svr *BitcaskServer) infoSection(section string) ([][2]string, error) {
+	switch section {
+	case "server":
+		mode := "standalone"
+		if svr.cluster != nil {
+			mode = "cluster"
+		}
+		var port string
+		svr.mu.RLock()
+		if svr.listenAddr != nil {
+			_, port, _ = net.SplitHostPort(svr.listenAddr.String())
+		}
+		svr.mu.RUnlock()
+		uptime := time.Since(svr.stats.startTime)
+		return [][2]string{
+			{"redis_version", redisVersion},
+			{"redis_mode", mode},
+			{"os", runtime.GOOS + " " + runtime.GOARCH},
+			{"arch_bits", strconv.Itoa(strconv.IntSize)},
+			{"go_version", runtime.Version()},
+			{"process_id", strconv.Itoa(os.Getpid())},
+			{"tcp_port", port},
+			{"uptime_in_seconds", strconv.FormatInt(int64(uptime.Seconds()), 10)},
+			{"uptime_in_days", strconv.FormatInt(int64(uptime.Hours()/24), 10)},
+		}, nil
+	case "clients":
+		return [][2]string{
+			{"connected_clients", strconv.Itoa(svr.clients.count())},
+			{"blocked_clients", strconv.Itoa(svr.blocking.numBlocked())},
+			{"pubsub_clients", strconv.Itoa(svr.pubsub.numClients())},
+			{"monitor_clients", strconv.Itoa(svr.monitors.count())},
+		}, nil
+	case "memory":
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		return [][2]string{
+			{"used_memory", strconv.FormatUint(ms.HeapAlloc, 10)},
+			{"used_memory_human", bytesToHuman(ms.HeapAlloc)},
+			{"used_memory_sys", strconv.FormatUint(ms.Sys, 10)},
+			{"used_memory_sys_human", bytesToHuman(ms.Sys)},
+			{"num_gc", strconv.FormatUint(uint64(ms.NumGC), 10)},
+		}, nil
+	case "persistence":
+		//只统计已经打开的数据库
+		var keys, dataFiles uint
+		var reclaimable, diskSize int64
+		for _, rds := range svr.openedDatabases() {
+			stat := rds.Stat()
+			keys += stat.KeyNum
+			dataFiles += stat.DataFileNum
+			reclaimable += stat.ReclaimSize
+			diskSize += stat.DisSize
+		}
+		return [][2]string{
+			{"engine_keys", strconv.FormatUint(uint64(keys), 10)},
+			{"data_files", strconv.FormatUint(uint64(dataFiles), 10)},
+			{"reclaimable_size", strconv.FormatInt(reclaimable, 10)},
+			{"disk_size", strconv.FormatInt(diskSize, 10)},
+			{"disk_size_human", bytesToHuman(uint64(diskSize))},
+		}, nil
+	case "stats":
+		return [][2]string{
+			{"total_connections_received", strconv.FormatInt(svr.stats.connections.Load(), 10)},
+			{"total_commands_processed", strconv.FormatInt(svr.stats.commands.Load(), 10)},
+			{"instantaneous_ops_per_sec", strconv.FormatInt(svr.stats.opsPerSec(), 10)},
+			{"pubsub_channels", strconv.Itoa(len(svr.pubsub.activeChannels(nil)))},
+			{"pubsub_patterns", strconv.Itoa(svr.pubsub.numPatterns())},
+			{"slowlog_len", strconv.Itoa(svr.slowlog.len())},
+		}, nil
+	case "keyspace":
+		//遍历所有的 key,只列出已经打开并且不为空的数据库
+		svr.mu.RLock()
+		indexes := make([]int, 0, len(svr.dbs))
+		dbs := make(map[int]*bitcask_redis.RedisDataStructure, len(svr.dbs))
+		for index, rds := range svr.dbs {
+			indexes = append(indexes, index)
+			dbs[index] = rds
+		}
+		svr.mu.RUnlock()
+		sort.Ints(indexes)
+		var fields [][2]string
+		for _, index := range indexes {
+			keys, expires, err := dbs[index].KeyspaceStat()
+			if err != nil {
+				return nil, err
+			}
+			if keys > 0 {
+				fields = append(fields, [2]string{"db" + strconv.Itoa(index), fmt.Sprintf("keys=%d,expires=%d", keys, expires)})
+			}
+		}
+		return fields, nil
+	}
+	return nil, nil
+}
+
+// 已经打开的数据库
+func (svr *BitcaskServer) openedDatabases() []*bitcask_redis.RedisDataStructure {
+	svr.mu.RLock()
+	defer svr.mu.RUnlock()
+	dbs := make([]*bitcask_redis.RedisDataStructure, 0, len(svr.dbs))
+	for _, rds := range svr.dbs {
+		dbs = append(dbs, rds)
+	}
+	return dbs
+}
+
+// 和 Redis 相同的可读格式,如 1.50M
+func bytesToHuman(n uint64) string {
+	switch {
+	case n < 1<<10:
+		return strconv.FormatUint(n, 10) + "B"
+	case n < 1<<20:
+		return fmt.Sprintf("%.2fK", float64(n)/(1<<10))
+	case n < 1<<30:
+		return fmt.Sprintf("%.2fM", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%.2fG", float64(n)/(1<<30))
+	}
+}
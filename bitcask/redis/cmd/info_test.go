@@ -0,0 +1,71 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 解析 INFO 的回复
+func parseInfo(res interface{}) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(res.(string), "\r\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, value, _ := strings.Cut(line, ":")
+		fields[name] = value
+	}
+	return fields
+}
+
+func TestBitcaskServer_Info(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	_, err := cli.do("SET", "k", "v")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "tmp", "v", "EX", "100")
+	assert.Nil(t, err)
+	_, err = cli.do("HSET", "h", "f", "v")
+	assert.Nil(t, err)
+
+	res, err := cli.do("INFO")
+	assert.Nil(t, err)
+	for _, section := range []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Stats", "# Keyspace"} {
+		assert.Contains(t, res, section)
+	}
+	fields := parseInfo(res)
+	assert.Equal(t, "standalone", fields["redis_mode"])
+	assert.Equal(t, "1", fields["connected_clients"])
+	assert.Equal(t, "keys=3,expires=1", fields["db0"])
+	assert.Equal(t, "4", fields["total_commands_processed"])
+	//包括格式版本 key
+	assert.Equal(t, "5", fields["engine_keys"])
+	assert.NotEmpty(t, fields["used_memory"])
+	assert.NotEmpty(t, fields["tcp_port"])
+
+	// 只返回指定的部分
+	res, err = cli.do("INFO", "keyspace", "CLIENTS")
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(res.(string), "# Clients\r\n"))
+	assert.Contains(t, res, "# Keyspace\r\ndb0:keys=3,expires=1\r\n")
+	assert.NotContains(t, res, "# Server")
+	res, err = cli.do("INFO", "unknown")
+	assert.Nil(t, err)
+	assert.Equal(t, "", res)
+
+	// 根据采样计算每秒执行的命令数
+	for i := 0; i < 100; i++ {
+		_, err = cli.do("PING")
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool {
+		res, err := cli.do("INFO", "stats")
+		return err == nil && parseInfo(res)["instantaneous_ops_per_sec"] != "0"
+	}, 2*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"kv-go/bitcask/client"
+	"kv-go/bitcask/utils"
+	"os"
+	"testing"
+)
+
+func TestRESPClient(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+
+	opts := client.DefaultOptions
+	opts.PoolSize = 2
+	cli, err := client.NewRESP(addr, opts)
+	assert.Nil(t, err)
+	defer cli.Close()
+	var kv client.KV = cli
+	ctx := context.Background()
+
+	key := []byte{'a', 0, 0xff, '\r', '\n'}
+	assert.Nil(t, kv.Put(ctx, key, []byte{0, 1, 2}))
+	value, err := kv.Get(ctx, key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, value)
+	_, err = kv.Get(ctx, []byte("missing"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	assert.Nil(t, kv.Delete(ctx, key))
+	assert.Nil(t, kv.Delete(ctx, key))
+	assert.Equal(t, bitcask.ErrKeyIsEmpty, kv.Put(ctx, nil, []byte("v")))
+
+	wb := kv.NewWriteBatch()
+	for i := 0; i < 1500; i++ {
+		assert.Nil(t, wb.Put(utils.GetTestKey(i), []byte{byte(i)}))
+	}
+	assert.Nil(t, wb.Commit(ctx))
+
+	// 其他类型的 key 不会被遍历,对它们执行 Get 返回服务端的错误
+	test := newTestClient(t, addr)
+	defer test.close()
+	_, err = test.do("HSET", "hash", "field", "value")
+	assert.Nil(t, err)
+	_, err = kv.Get(ctx, []byte("hash"))
+	assert.IsType(t, &client.ServerError{}, err)
+
+	keys, err := kv.ListKeys(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1500, len(keys))
+	var count int
+	assert.Nil(t, kv.Fold(ctx, func(key, value []byte) bool {
+		assert.Equal(t, utils.GetTestKey(count), key)
+		assert.Equal(t, []byte{byte(count)}, value)
+		count++
+		return count < 1200
+	}))
+	assert.Equal(t, 1200, count)
+
+	stat, err := kv.Stat(ctx)
+	assert.Nil(t, err)
+	assert.True(t, stat.KeyNum >= 1500)
+	assert.True(t, stat.DataFileNum > 0)
+	assert.True(t, stat.DisSize > 0)
+}
+
+func TestRESPClient_AuthSelect(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	test := newTestClient(t, addr)
+	defer test.close()
+	_, err := test.do("CONFIG", "SET", "requirepass", "secret")
+	assert.Nil(t, err)
+
+	cli, err := client.NewRESP(addr, client.DefaultOptions)
+	assert.Nil(t, err)
+	defer cli.Close()
+	_, err = cli.Get(context.Background(), []byte("key"))
+	assert.IsType(t, &client.ServerError{}, err)
+
+	opts := client.DefaultOptions
+	opts.Password = "secret"
+	opts.DB = 1
+	cli, err = client.NewRESP(addr, opts)
+	assert.Nil(t, err)
+	defer cli.Close()
+	assert.Nil(t, cli.Put(context.Background(), []byte("key"), []byte("value")))
+
+	// 写入的是数据库 1
+	_, err = test.do("AUTH", "secret")
+	assert.Nil(t, err)
+	res, err := test.do("GET", "key")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	_, err = test.do("SELECT", "1")
+	assert.Nil(t, err)
+	res, err = test.do("GET", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", res)
+}
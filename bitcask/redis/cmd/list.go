@@ -0,0 +1,212 @@
+package main
+
+import (
+	"github.com/tidwall/redcon"
+	"strconv"
+	"strings"
+)
+
+func lpush(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("lpush")
+	}
+
+	res, err := cli.db.LPush(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+func rpush(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("rpush")
+	}
+
+	res, err := cli.db.RPush(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+func lpop(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("lpop")
+	}
+
+	element, err := cli.db.LPop(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(element), nil
+}
+
+func rpop(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("rpop")
+	}
+
+	element, err := cli.db.RPop(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(element), nil
+}
+
+func llen(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("llen")
+	}
+
+	size, err := cli.db.LLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func lindex(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("lindex")
+	}
+
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	element, err := cli.db.LIndex(args[0], index)
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(element), nil
+}
+
+func lrange(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("lrange")
+	}
+
+	start, stop, err := parseRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	elements, err := cli.db.LRange(args[0], start, stop)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(elements), nil
+}
+
+func lset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("lset")
+	}
+
+	index, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if err = cli.db.LSet(args[0], index, args[2]); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func ltrim(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("ltrim")
+	}
+
+	start, stop, err := parseRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	if err = cli.db.LTrim(args[0], start, stop); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func linsert(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, newWrongNumberOfArgsError("linsert")
+	}
+
+	var before bool
+	switch strings.ToLower(string(args[1])) {
+	case "before":
+		before = true
+	case "after":
+		before = false
+	default:
+		return nil, errSyntax
+	}
+	res, err := cli.db.LInsert(args[0], before, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+func lrem(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("lrem")
+	}
+
+	count, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	res, err := cli.db.LRem(args[0], count, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func lmove(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 4 {
+		return nil, newWrongNumberOfArgsError("lmove")
+	}
+
+	srcLeft, err := parseListSide(args[2])
+	if err != nil {
+		return nil, err
+	}
+	dstLeft, err := parseListSide(args[3])
+	if err != nil {
+		return nil, err
+	}
+	element, err := cli.db.LMove(args[0], args[1], srcLeft, dstLeft)
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(element), nil
+}
+
+func rpoplpush(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("rpoplpush")
+	}
+
+	element, err := cli.db.RPopLPush(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(element), nil
+}
+
+// 解析 LEFT|RIGHT,LEFT 返回 true
+func parseListSide(arg []byte) (bool, error) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, nil
+	case "right":
+		return false, nil
+	default:
+		return false, errSyntax
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestBitcaskServer_List(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("RPUSH", "list", "a", "b", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("LPUSH", "list", "z")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), res)
+	res, err = cli.do("LRANGE", "list", "0", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"z", "a", "b", "c"}, res)
+	res, err = cli.do("LINDEX", "list", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", res)
+	res, err = cli.do("LSET", "list", "0", "y")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("LINSERT", "list", "BEFORE", "b", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), res)
+	res, err = cli.do("LREM", "list", "0", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("LTRIM", "list", "1", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("LLEN", "list")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+
+	res, err = cli.do("LMOVE", "list", "other", "LEFT", "RIGHT")
+	assert.Nil(t, err)
+	assert.Equal(t, "a", res)
+	res, err = cli.do("RPOPLPUSH", "list", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, "c", res)
+	res, err = cli.do("LRANGE", "other", "0", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"c", "a"}, res)
+	_, err = cli.do("LMOVE", "list", "other", "UP", "RIGHT")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("LPOP", "list")
+	assert.Nil(t, err)
+	assert.Equal(t, "b", res)
+	res, err = cli.do("RPOP", "list")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"kv-go/bitcask/metrics"
+	"log"
+	"net"
+	"net/http"
+)
+
+// 创建收集指标的 Collector,除了存储引擎的指标之外还导出服务的连接数和命令数
+func newServerMetrics(svr *BitcaskServer) *metrics.Collector {
+	collector := metrics.NewCollector()
+	gauges := []struct {
+		name  string
+		help  string
+		value func() int
+	}{
+		{"bitcask_redis_connected_clients", "Number of client connections.", svr.clients.count},
+		{"bitcask_redis_blocked_clients", "Number of clients blocked on list commands.", svr.blocking.numBlocked},
+		{"bitcask_redis_pubsub_clients", "Number of clients in subscribe mode.", svr.pubsub.numClients},
+		{"bitcask_redis_monitor_clients", "Number of clients in monitor mode.", svr.monitors.count},
+		{"bitcask_redis_slowlog_length", "Number of entries in the slow log.", svr.slowlog.len},
+	}
+	for _, gauge := range gauges {
+		value := gauge.value
+		_ = collector.GaugeFunc(gauge.name, gauge.help, func() float64 { return float64(value()) })
+	}
+	_ = collector.CounterFunc("bitcask_redis_connections_received_total", "Number of accepted connections.",
+		func() float64 { return float64(svr.stats.connections.Load()) })
+	_ = collector.CounterFunc("bitcask_redis_commands_processed_total", "Number of processed commands.",
+		func() float64 { return float64(svr.stats.commands.Load()) })
+	return collector
+}
+
+// 监听 metrics-addr 并在 /metrics 上提供指标,直到服务被关闭
+func (svr *BitcaskServer) listenMetrics(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Println("metrics server running on", ln.Addr())
+	return svr.serveMetrics(ln)
+}
+
+// 配置了证书时和 RESP 服务一样使用 TLS
+func (svr *BitcaskServer) serveMetrics(ln net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", svr.metrics)
+	server := &http.Server{Handler: mux, TLSConfig: svr.tlsConfig}
+
+	svr.mu.Lock()
+	svr.metricsServer = server
+	svr.mu.Unlock()
+	var err error
+	if svr.tlsConfig != nil {
+		err = server.ServeTLS(ln, "", "")
+	} else {
+		err = server.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
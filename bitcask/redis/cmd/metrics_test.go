@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBitcaskServer_Metrics(t *testing.T) {
+	cfg := defaultServerConfig
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-metrics")
+	defer removeTestDirs(dir)
+	cfg.options.DirPath = dir
+	cfg.metricsAddr = "127.0.0.1:0"
+	svr, err := newBitcaskServer(cfg)
+	assert.Nil(t, err)
+	defer svr.shutdown()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		_ = svr.serve(ln)
+	}()
+	metricsLn, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		_ = svr.serveMetrics(metricsLn)
+	}()
+
+	cli := newTestClient(t, ln.Addr().String())
+	defer cli.close()
+	_, err = cli.do("SET", "k", "v")
+	assert.Nil(t, err)
+	_, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+
+	resp, err := http.Get("http://" + metricsLn.Addr().String() + "/metrics")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain"))
+	body, err := io.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	res := string(body)
+
+	// 数据库0的目录就是 DirPath,打开时写入了格式版本 key
+	assert.Contains(t, res, `bitcask_operations_total{db="`+dir+`",op="put",result="ok"} 2`+"\n")
+	assert.Contains(t, res, `bitcask_operation_duration_seconds_count{db="`+dir+`",op="get"}`)
+	assert.Contains(t, res, `bitcask_index_keys{db="`+dir+`"} 2`+"\n")
+	assert.Contains(t, res, `bitcask_data_files{db="`+dir+`"} 1`+"\n")
+	assert.Contains(t, res, "bitcask_redis_connected_clients 1\n")
+	assert.Contains(t, res, "bitcask_redis_commands_processed_total 2\n")
+	assert.Contains(t, res, "# TYPE bitcask_fsync_duration_seconds histogram\n")
+
+	// 没有设置 metrics-addr 时不收集指标
+	plain, _ := startTestServer(t)
+	defer removeTestDirs(plain.config.options.DirPath)
+	assert.Nil(t, plain.metrics)
+}
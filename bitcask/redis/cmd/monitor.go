@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/redcon"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errMonitorMode        = errors.New("ERR only QUIT is allowed in MONITOR mode")
+	errMonitorInSubscribe = errors.New("ERR MONITOR is not allowed on a connection used for SUBSCRIBE")
+)
+
+// 执行 MONITOR 的客户端,连接从 redcon 的事件循环中分离出来,只接收其他客户端执行的命令,
+// 命令写入连接的输出缓冲区,客户端读取太慢导致积压超过限制时断开连接
+type monitor struct {
+	conn *outputBuffer
+}
+
+type monitorHub struct {
+	mu       sync.RWMutex
+	monitors map[*monitor]struct{}
+	closed   bool
+}
+
+func newMonitorHub() *monitorHub {
+	return &monitorHub{monitors: make(map[*monitor]struct{})}
+}
+
+// 分离连接并开始接收命令,limit 是输出缓冲区的限制,服务已经关闭时返回 false
+func (hub *monitorHub) detach(conn redcon.Conn, limit int64) (*monitor, bool) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closed {
+		return nil, false
+	}
+	m := &monitor{conn: newOutputBuffer(conn.Detach(), limit)}
+	hub.monitors[m] = struct{}{}
+	return m, true
+}
+
+func (hub *monitorHub) remove(m *monitor) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.monitors, m)
+}
+
+func (hub *monitorHub) count() int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.monitors)
+}
+
+// 把客户端收到的命令发送给所有的 monitor,格式和 Redis 相同:
+// +1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func (hub *monitorHub) feed(cli *BitcaskClient, args [][]byte) {
+	hub.mu.RLock()
+	if len(hub.monitors) == 0 {
+		hub.mu.RUnlock()
+		return
+	}
+	monitors := make([]*monitor, 0, len(hub.monitors))
+	for m := range hub.monitors {
+		monitors = append(monitors, m)
+	}
+	hub.mu.RUnlock()
+
+	now := time.Now()
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, cli.dbIndex, cli.addr))
+	for _, arg := range args {
+		sb.WriteByte(' ')
+		sb.WriteString(reprArg(arg))
+	}
+	line := sb.String()
+	for _, m := range monitors {
+		m.write(line)
+	}
+}
+
+// 只追加到输出缓冲区,超过限制时连接被断开,读取命令的 goroutine 随之退出并移除 monitor
+func (m *monitor) write(line string) {
+	m.conn.WriteString(line)
+	_ = m.conn.Flush()
+}
+
+func (m *monitor) close() {
+	_ = m.conn.Close()
+}
+
+// 关闭所有的 monitor,服务关闭时调用
+func (hub *monitorHub) close() {
+	hub.mu.Lock()
+	hub.closed = true
+	monitors := make([]*monitor, 0, len(hub.monitors))
+	for m := range hub.monitors {
+		monitors = append(monitors, m)
+	}
+	hub.mu.Unlock()
+
+	for _, m := range monitors {
+		m.close()
+	}
+}
+
+// 和 Redis 的 sdscatrepr 一样转义参数
+func reprArg(arg []byte) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range arg {
+		switch c {
+		case '\\', '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n':
+			sb.WriteString("\\n")
+		case '\r':
+			sb.WriteString("\\r")
+		case '\t':
+			sb.WriteString("\\t")
+		case '\a':
+			sb.WriteString("\\a")
+		case '\b':
+			sb.WriteString("\\b")
+		default:
+			if c >= ' ' && c <= '~' {
+				sb.WriteByte(c)
+			} else {
+				sb.WriteString(fmt.Sprintf("\\x%02x", c))
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// 不会发送给 monitor 的命令: 认证和管理命令的参数中可能有密码
+func monitorHidden(command string, args [][]byte) bool {
+	if command == "auth" {
+		return true
+	}
+	initACLTables()
+	return aclCategories["admin"][aclCommandName(command, args)]
+}
+
+// 执行 MONITOR,把连接从 redcon 的事件循环中分离出来
+func (cli *BitcaskClient) monitorCommand(conn redcon.Conn, args [][]byte) {
+	if len(args) != 0 {
+		conn.WriteError(newWrongNumberOfArgsError("monitor").Error())
+		return
+	}
+	if cli.sub != nil {
+		conn.WriteError(errMonitorInSubscribe.Error())
+		return
+	}
+
+	cli.server.mu.RLock()
+	limit := cli.server.config.monitorOutputLimit
+	cli.server.mu.RUnlock()
+	m, ok := cli.server.monitors.detach(conn, limit)
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+	cli.monitor = m
+	cli.updateInfo()
+	m.conn.WriteString("OK")
+	if err := m.conn.Flush(); err != nil {
+		cli.closeMonitor()
+		return
+	}
+	go cli.serveMonitor()
+}
+
+// 读取 monitor 连接上的命令,只允许执行 QUIT
+func (cli *BitcaskClient) serveMonitor() {
+	defer cli.closeMonitor()
+	m := cli.monitor
+	for {
+		cmd, err := m.conn.ReadCommand()
+		if err != nil {
+			return
+		}
+		quit := strings.EqualFold(string(cmd.Args[0]), "quit")
+		if quit {
+			m.conn.WriteString("OK")
+		} else {
+			m.conn.WriteError(errMonitorMode.Error())
+		}
+		err = m.conn.Flush()
+		if quit || err != nil {
+			return
+		}
+	}
+}
+
+func (cli *BitcaskClient) closeMonitor() {
+	cli.server.monitors.remove(cli.monitor)
+	cli.server.clients.remove(cli)
+	cli.unwatchAll()
+	cli.monitor.close()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBitcaskServer_Monitor(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	monitor := newTestClient(t, addr)
+	defer monitor.close()
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := monitor.do("MONITOR")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+
+	_, err = cli.do("SET", "k", "a \"quoted\"\nvalue")
+	assert.Nil(t, err)
+	_, err = cli.do("SELECT", "1")
+	assert.Nil(t, err)
+	// 认证和管理命令不会被发送给 monitor
+	_, err = cli.do("AUTH", "secret")
+	assert.NotNil(t, err)
+	_, err = cli.do("CONFIG", "GET", "dir")
+	assert.Nil(t, err)
+	_, err = cli.do("GET", "\x01")
+	assert.Nil(t, err)
+
+	clientAddr := regexp.QuoteMeta(cli.conn.LocalAddr().String())
+	for _, expected := range []string{
+		`^\d+\.\d{6} \[0 ` + clientAddr + `\] "SET" "k" "a \\"quoted\\"\\nvalue"$`,
+		`^\d+\.\d{6} \[0 ` + clientAddr + `\] "SELECT" "1"$`,
+		`^\d+\.\d{6} \[1 ` + clientAddr + `\] "GET" "\\x01"$`,
+	} {
+		res, err := monitor.read()
+		assert.Nil(t, err)
+		assert.Regexp(t, expected, res)
+	}
+
+	// monitor 中只能执行 QUIT
+	_, err = monitor.do("GET", "k")
+	assert.NotNil(t, err)
+	res, err = cli.do("INFO", "clients")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", parseInfo(res)["monitor_clients"])
+	res, err = monitor.read()
+	assert.Nil(t, err)
+	assert.Regexp(t, `"INFO" "clients"$`, res)
+	res, err = monitor.do("QUIT")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	assert.Eventually(t, func() bool {
+		return svr.monitors.count() == 0 && svr.clients.count() == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// 事务中不能执行 MONITOR
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("MONITOR")
+	assert.NotNil(t, err)
+	_, err = cli.do("DISCARD")
+	assert.Nil(t, err)
+}
+
+func TestBitcaskServer_MonitorSlowClient(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	_, err := cli.do("CONFIG", "SET", "monitor-output-buffer-limit", "1mb")
+	assert.Nil(t, err)
+
+	// 一直不读取的 monitor
+	monitor := newTestClient(t, addr)
+	defer monitor.close()
+	res, err := monitor.do("MONITOR")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+
+	// 积压超过限制之后断开 monitor,执行命令不会被阻塞
+	value := strings.Repeat("v", 16*1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			_, err := cli.do("SET", "k", value)
+			assert.Nil(t, err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("commands blocked by a slow monitor")
+	}
+	assert.Eventually(t, func() bool {
+		return svr.monitors.count() == 0 && svr.clients.count() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/tidwall/redcon"
+	bitcask_redis "kv-go/bitcask/redis"
+	"strings"
+	"time"
+)
+
+var (
+	errNestedMulti      = errors.New("ERR MULTI calls can not be nested")
+	errExecWithoutMulti = errors.New("ERR EXEC without MULTI")
+	errDiscardNoMulti   = errors.New("ERR DISCARD without MULTI")
+	errWatchInMulti     = errors.New("ERR WATCH inside MULTI is not allowed")
+	errExecAbort        = errors.New("EXECABORT Transaction discarded because of previous errors.")
+	errNotInMulti       = errors.New("ERR command not allowed inside a transaction")
+
+	//事务执行之前被监视的 key 已经被修改
+	errWatchedKeyChanged = errors.New("watched key changed")
+)
+
+// 控制事务本身的命令,在事务中直接执行而不是排队
+var txControlCommands = map[string]bool{
+	"multi":   true,
+	"exec":    true,
+	"discard": true,
+	"watch":   true,
+	"quit":    true,
+}
+
+// 不能在事务中执行的命令
+var txForbiddenCommands = map[string]bool{
+	"blpop":      true,
+	"brpop":      true,
+	"blmove":     true,
+	"brpoplpush": true,
+
+	"select":   true,
+	"swapdb":   true,
+	"move":     true,
+	"flushall": true,
+	"auth":     true,
+	"monitor":  true,
+
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+}
+
+// EXEC 需要通过命令表执行排队的命令,在 init 中注册以避免初始化循环
+func init() {
+	supportedCommands["exec"] = command{execCmd, false}
+}
+
+// MULTI 之后排队等待 EXEC 的命令
+type transaction struct {
+	commands [][][]byte
+	aborted  bool //排队时出现了错误,EXEC 时直接放弃
+}
+
+type watchedKey struct {
+	key      []byte
+	revision uint64
+	applied  uint64 //集群模式下 WATCH 时已经应用的日志索引
+}
+
+// 事务中的命令进入队列,返回是否已经处理
+func (cli *BitcaskClient) queueCommand(conn redcon.Conn, command string, args [][]byte) bool {
+	if cli.tx == nil || txControlCommands[command] {
+		return false
+	}
+	if _, ok := supportedCommands[command]; !ok {
+		cli.tx.aborted = true
+		conn.WriteError("Err unsupported command: '" + command + "'")
+		return true
+	}
+	if txForbiddenCommands[command] {
+		cli.tx.aborted = true
+		conn.WriteError(errNotInMulti.Error())
+		return true
+	}
+	//redcon 会复用读取的缓冲区,排队的参数需要拷贝
+	queued := make([][]byte, len(args))
+	for i, arg := range args {
+		queued[i] = bytes.Clone(arg)
+	}
+	cli.tx.commands = append(cli.tx.commands, queued)
+	conn.WriteString("QUEUED")
+	return true
+}
+
+func multi(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumberOfArgsError("multi")
+	}
+	if cli.tx != nil {
+		return nil, errNestedMulti
+	}
+
+	cli.tx = &transaction{}
+	return redcon.SimpleString("OK"), nil
+}
+
+func discard(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumberOfArgsError("discard")
+	}
+	if cli.tx == nil {
+		return nil, errDiscardNoMulti
+	}
+
+	cli.tx = nil
+	cli.unwatchAll()
+	return redcon.SimpleString("OK"), nil
+}
+
+func watch(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("watch")
+	}
+	if cli.tx != nil {
+		return nil, errWatchInMulti
+	}
+
+	//集群模式下快照恢复之后 DB 会被替换,之前监视的版本不再有效
+	if cli.watchDB != cli.db {
+		cli.unwatchAll()
+		cli.watchDB = cli.db
+		cli.watchIndex = cli.dbIndex
+	}
+	var applied uint64
+	if cli.server.cluster != nil {
+		applied = cli.server.cluster.fsm.applied.Load()
+	}
+	for _, key := range args {
+		key = bytes.Clone(key)
+		cli.watched = append(cli.watched, watchedKey{key: key, revision: cli.db.Watch(key), applied: applied})
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func unwatch(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumberOfArgsError("unwatch")
+	}
+
+	cli.unwatchAll()
+	return redcon.SimpleString("OK"), nil
+}
+
+// EXEC 原子地执行排队的命令,被监视的 key 被修改时放弃执行并返回空值
+// 集群模式下在 leader 上检查被监视的 key 之后,所有的命令作为一条 raft 日志执行
+func execCmd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, newWrongNumberOfArgsError("exec")
+	}
+	if cli.tx == nil {
+		return nil, errExecWithoutMulti
+	}
+	tx := cli.tx
+	cli.tx = nil
+	defer cli.unwatchAll()
+	if tx.aborted {
+		return nil, errExecAbort
+	}
+
+	if cli.server.cluster != nil {
+		//被监视的 key 在 FSM 应用这条日志时检查,检查和执行之间不会有其他的写入
+		txArgs := [][]byte{[]byte("exec")}
+		if len(cli.watched) > 0 {
+			txArgs = append(txArgs, encodeCommandArgs(cli.watchArgs()))
+		}
+		now := time.Now()
+		for _, cmdArgs := range tx.commands {
+			txArgs = append(txArgs, encodeCommandArgs(absoluteTTLArgs(cmdArgs, now)))
+		}
+		return cli.server.cluster.apply(txArgs)
+	}
+	res, err := execTransaction(cli, tx.commands, cli.watchedKeyChanged)
+	if errors.Is(err, errWatchedKeyChanged) {
+		return nullArray{}, nil
+	}
+	return res, err
+}
+
+// 在一个 Writebatch 中依次执行命令,返回每个命令的结果,单个命令的错误不影响其他的命令
+// changed 不为空时在获取写锁之后检查被监视的 key 是否被修改
+func execTransaction(cli *BitcaskClient, commands [][][]byte, changed func() bool) ([]interface{}, error) {
+	var results []interface{}
+	err := cli.db.Multi(func(tx *bitcask_redis.RedisDataStructure) error {
+		if changed != nil && changed() {
+			return errWatchedKeyChanged
+		}
+		txCli := &BitcaskClient{server: cli.server, db: tx, dbIndex: cli.dbIndex, user: cli.user,
+			id: cli.id, addr: cli.addr, info: cli.info, logIndex: cli.logIndex}
+		results = make([]interface{}, 0, len(commands))
+		for _, cmdArgs := range commands {
+			cmd := supportedCommands[strings.ToLower(string(cmdArgs[0]))]
+			res, err := cmd.handler(txCli, cmdArgs[1:])
+			if err != nil {
+				res = commandError(err)
+			}
+			results = append(results, res)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// 集群模式下随事务一起写入日志的被监视的 key,使用最早的一次 WATCH 的日志索引
+func (cli *BitcaskClient) watchArgs() [][]byte {
+	applied := cli.watched[0].applied
+	keys := make([][]byte, 0, len(cli.watched))
+	for _, w := range cli.watched {
+		applied = min(applied, w.applied)
+		keys = append(keys, w.key)
+	}
+	return encodeWatchArgs(applied, keys)
+}
+
+// 被监视的 key 是否在 WATCH 之后被修改过
+func (cli *BitcaskClient) watchedKeyChanged() bool {
+	if len(cli.watched) == 0 {
+		return false
+	}
+	//快照恢复或者 SWAPDB 之后监视的数据库被替换
+	if cli.watchDB != cli.server.db(cli.watchIndex) {
+		return true
+	}
+	for _, w := range cli.watched {
+		if cli.watchDB.Revision(w.key) != w.revision {
+			return true
+		}
+	}
+	return false
+}
+
+func (cli *BitcaskClient) unwatchAll() {
+	for _, w := range cli.watched {
+		cli.watchDB.Unwatch(w.key)
+	}
+	cli.watched = nil
+	cli.watchDB = nil
+}
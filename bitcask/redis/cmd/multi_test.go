@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestBitcaskServer_Multi(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("MULTI")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	_, err = cli.do("MULTI")
+	assert.NotNil(t, err)
+	res, err = cli.do("SET", "k", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "QUEUED", res)
+	for _, args := range [][]string{{"INCR", "k"}, {"HSET", "h", "f", "v"}, {"INCR", "h"}, {"HGETALL", "h"},
+		{"GET", "missing"}, {"PING"}} {
+		res, err = cli.do(args...)
+		assert.Nil(t, err)
+		assert.Equal(t, "QUEUED", res)
+	}
+	// 单个命令的错误不影响其他的命令
+	res, err = cli.do("EXEC")
+	assert.Nil(t, err)
+	results := res.([]interface{})
+	assert.Equal(t, 7, len(results))
+	assert.Equal(t, []interface{}{"OK", int64(2), int64(1)}, results[:3])
+	_, ok := results[3].(error)
+	assert.True(t, ok)
+	assert.Equal(t, []interface{}{[]interface{}{"f", "v"}, nil, "PONG"}, results[4:])
+
+	// 排队时出错的事务被放弃
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "k", "2")
+	assert.Nil(t, err)
+	_, err = cli.do("UNKNOWN")
+	assert.NotNil(t, err)
+	_, err = cli.do("EXEC")
+	assert.NotNil(t, err)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", res)
+
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "k", "3")
+	assert.Nil(t, err)
+	res, err = cli.do("DISCARD")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "2", res)
+	_, err = cli.do("EXEC")
+	assert.NotNil(t, err)
+	_, err = cli.do("DISCARD")
+	assert.NotNil(t, err)
+}
+
+func TestBitcaskServer_Watch(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+	other := newTestClient(t, addr)
+	defer other.close()
+
+	// 被监视的 key 被其他客户端修改之后放弃执行
+	res, err := cli.do("WATCH", "k", "h")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	_, err = other.do("HSET", "h", "f", "v")
+	assert.Nil(t, err)
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("WATCH", "k")
+	assert.NotNil(t, err)
+	_, err = cli.do("SET", "k", "1")
+	assert.Nil(t, err)
+	res, err = cli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	// 没有被修改时正常执行, EXEC 之后不再监视
+	_, err = cli.do("WATCH", "k")
+	assert.Nil(t, err)
+	_, err = other.do("SET", "other", "v")
+	assert.Nil(t, err)
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "k", "1")
+	assert.Nil(t, err)
+	res, err = cli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"OK"}, res)
+
+	// UNWATCH 之后的修改不影响事务
+	_, err = cli.do("WATCH", "k")
+	assert.Nil(t, err)
+	_, err = cli.do("UNWATCH")
+	assert.Nil(t, err)
+	_, err = other.do("SET", "k", "2")
+	assert.Nil(t, err)
+	_, err = cli.do("MULTI")
+	assert.Nil(t, err)
+	_, err = cli.do("INCR", "k")
+	assert.Nil(t, err)
+	res, err = cli.do("EXEC")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(3)}, res)
+}
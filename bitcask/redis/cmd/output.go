@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"github.com/tidwall/redcon"
+	"sync"
+	"time"
+)
+
+// 关闭连接时等待客户端读取缓冲区中剩余数据的最长时间
+const outputCloseTimeout = 5 * time.Second
+
+var errOutputBufferLimit = errors.New("output buffer limit reached")
+
+// 分离出来的连接的输出缓冲区,写入只追加到内存中,由单独的 goroutine 写入连接,
+// 一个读取缓慢的客户端不会阻塞向它写入的其他客户端。
+// 和 Redis 的 client-output-buffer-limit 一样,积压的数据超过 limit 时立即断开连接
+type outputBuffer struct {
+	redcon.DetachedConn
+	mu      sync.Mutex
+	buf     []byte //还没有写入连接的数据
+	limit   int64  //0 表示不限制
+	err     error  //连接已经断开或者积压的数据超过了限制
+	closing bool   //写完缓冲区中的数据之后关闭连接
+	wake    chan struct{}
+}
+
+func newOutputBuffer(conn redcon.DetachedConn, limit int64) *outputBuffer {
+	ob := &outputBuffer{
+		DetachedConn: conn,
+		limit:        limit,
+		wake:         make(chan struct{}, 1),
+	}
+	go ob.writeLoop()
+	return ob
+}
+
+func (ob *outputBuffer) append(fn func(b []byte) []byte) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.err != nil || ob.closing {
+		return
+	}
+	ob.buf = fn(ob.buf)
+	if ob.limit > 0 && int64(len(ob.buf)) > ob.limit {
+		ob.fail(errOutputBufferLimit)
+	}
+}
+
+// 丢弃缓冲区并断开连接,读取命令的 goroutine 随之退出并清理客户端,调用方需要持有 ob.mu
+func (ob *outputBuffer) fail(err error) {
+	ob.err = err
+	ob.buf = nil
+	//写入的 goroutine 可能正阻塞在写入上,直接关闭底层的连接
+	_ = ob.NetConn().Close()
+	ob.notify()
+}
+
+func (ob *outputBuffer) notify() {
+	select {
+	case ob.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 不断地把缓冲区中的数据写入连接,只有这个 goroutine 使用 redcon 的写缓冲区
+func (ob *outputBuffer) writeLoop() {
+	for range ob.wake {
+		ob.mu.Lock()
+		data, closing, err := ob.buf, ob.closing, ob.err
+		ob.buf = nil
+		ob.mu.Unlock()
+		if err != nil {
+			return
+		}
+		if len(data) > 0 {
+			ob.DetachedConn.WriteRaw(data)
+			if err := ob.DetachedConn.Flush(); err != nil {
+				ob.mu.Lock()
+				ob.fail(err)
+				ob.mu.Unlock()
+				return
+			}
+		}
+		if closing {
+			_ = ob.NetConn().Close()
+			return
+		}
+	}
+}
+
+// Flush 唤醒写入的 goroutine,不等待数据写入连接
+func (ob *outputBuffer) Flush() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.err != nil {
+		return ob.err
+	}
+	ob.notify()
+	return nil
+}
+
+// Close 写完缓冲区中的数据之后关闭连接,客户端不读取时最多等待 outputCloseTimeout
+func (ob *outputBuffer) Close() error {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.err != nil || ob.closing {
+		return nil
+	}
+	ob.closing = true
+	_ = ob.NetConn().SetWriteDeadline(time.Now().Add(outputCloseTimeout))
+	ob.notify()
+	return nil
+}
+
+func (ob *outputBuffer) WriteError(msg string) {
+	ob.append(func(b []byte) []byte { return redcon.AppendError(b, msg) })
+}
+
+func (ob *outputBuffer) WriteString(str string) {
+	ob.append(func(b []byte) []byte { return redcon.AppendString(b, str) })
+}
+
+func (ob *outputBuffer) WriteBulk(bulk []byte) {
+	ob.append(func(b []byte) []byte { return redcon.AppendBulk(b, bulk) })
+}
+
+func (ob *outputBuffer) WriteBulkString(bulk string) {
+	ob.append(func(b []byte) []byte { return redcon.AppendBulkString(b, bulk) })
+}
+
+func (ob *outputBuffer) WriteInt(num int) {
+	ob.WriteInt64(int64(num))
+}
+
+func (ob *outputBuffer) WriteInt64(num int64) {
+	ob.append(func(b []byte) []byte { return redcon.AppendInt(b, num) })
+}
+
+func (ob *outputBuffer) WriteUint64(num uint64) {
+	ob.append(func(b []byte) []byte { return redcon.AppendUint(b, num) })
+}
+
+func (ob *outputBuffer) WriteArray(count int) {
+	ob.append(func(b []byte) []byte { return redcon.AppendArray(b, count) })
+}
+
+func (ob *outputBuffer) WriteNull() {
+	ob.append(redcon.AppendNull)
+}
+
+func (ob *outputBuffer) WriteRaw(data []byte) {
+	ob.append(func(b []byte) []byte { return append(b, data...) })
+}
+
+func (ob *outputBuffer) WriteAny(v interface{}) {
+	ob.append(func(b []byte) []byte { return redcon.AppendAny(b, v) })
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/redcon"
+	"kv-go/bitcask/utils"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var errUnknownPubSubCommand = errors.New("ERR unknown subcommand for 'pubsub'")
+
+// 订阅模式下允许执行的命令
+var subscribeModeCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+}
+
+func newSubscribeModeError(cmd string) error {
+	return fmt.Errorf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context", cmd)
+}
+
+// 订阅过频道的客户端,连接从 redcon 的事件循环中分离出来,由单独的 goroutine 读取命令,
+// 发布的消息写入连接的输出缓冲区,客户端读取太慢导致积压超过限制时断开连接
+type subscriber struct {
+	mu       sync.Mutex //命令的回复和发布的消息按照顺序写入同一个输出缓冲区
+	conn     *outputBuffer
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+// 订阅的频道和模式的数量,为0时客户端退出订阅模式
+func (sub *subscriber) count() int {
+	return len(sub.channels) + len(sub.patterns)
+}
+
+// 记录每个频道和模式的订阅者
+type pubSubHub struct {
+	mu          sync.RWMutex
+	channels    map[string]map[*subscriber]struct{}
+	patterns    map[string]map[*subscriber]struct{}
+	subscribers map[*subscriber]struct{} //所有分离出来的连接,服务关闭时需要关闭
+	closed      bool
+}
+
+func newPubSubHub() *pubSubHub {
+	return &pubSubHub{
+		channels:    make(map[string]map[*subscriber]struct{}),
+		patterns:    make(map[string]map[*subscriber]struct{}),
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+// 分离连接并创建订阅者,limit 是输出缓冲区的限制,服务已经关闭时返回 false
+func (hub *pubSubHub) detach(conn redcon.Conn, limit int64) (*subscriber, bool) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if hub.closed {
+		return nil, false
+	}
+	sub := &subscriber{
+		conn:     newOutputBuffer(conn.Detach(), limit),
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+	}
+	hub.subscribers[sub] = struct{}{}
+	return sub, true
+}
+
+// 订阅频道或者模式,调用方需要持有 sub.mu
+func (hub *pubSubHub) subscribe(sub *subscriber, name string, pattern bool) {
+	subs, registry := sub.channels, hub.channels
+	if pattern {
+		subs, registry = sub.patterns, hub.patterns
+	}
+	if _, ok := subs[name]; ok {
+		return
+	}
+	subs[name] = struct{}{}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	if registry[name] == nil {
+		registry[name] = make(map[*subscriber]struct{})
+	}
+	registry[name][sub] = struct{}{}
+}
+
+// 取消订阅频道或者模式,调用方需要持有 sub.mu
+func (hub *pubSubHub) unsubscribe(sub *subscriber, name string, pattern bool) {
+	subs, registry := sub.channels, hub.channels
+	if pattern {
+		subs, registry = sub.patterns, hub.patterns
+	}
+	if _, ok := subs[name]; !ok {
+		return
+	}
+	delete(subs, name)
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(registry[name], sub)
+	if len(registry[name]) == 0 {
+		delete(registry, name)
+	}
+}
+
+// 连接断开之后移除订阅者的所有订阅
+func (hub *pubSubHub) remove(sub *subscriber) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for channel := range sub.channels {
+		hub.unsubscribe(sub, channel, false)
+	}
+	for pattern := range sub.patterns {
+		hub.unsubscribe(sub, pattern, true)
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	delete(hub.subscribers, sub)
+}
+
+// 向频道发布消息,返回收到消息的客户端数量
+func (hub *pubSubHub) publish(channel string, message []byte) int {
+	type delivery struct {
+		sub     *subscriber
+		pattern string
+	}
+	//先取出订阅者再写入,写入只会追加到订阅者的输出缓冲区,不会等待连接
+	hub.mu.RLock()
+	var deliveries []delivery
+	for sub := range hub.channels[channel] {
+		deliveries = append(deliveries, delivery{sub: sub})
+	}
+	for pattern, subs := range hub.patterns {
+		if !utils.GlobMatch([]byte(pattern), []byte(channel)) {
+			continue
+		}
+		for sub := range subs {
+			deliveries = append(deliveries, delivery{sub: sub, pattern: pattern})
+		}
+	}
+	hub.mu.RUnlock()
+
+	var received int
+	for _, d := range deliveries {
+		if d.sub.deliver(d.pattern, channel, message) {
+			received++
+		}
+	}
+	return received
+}
+
+// 把消息写入输出缓冲区,pattern 为空表示通过频道订阅收到的消息,缓冲区超过限制时返回 false
+func (sub *subscriber) deliver(pattern, channel string, message []byte) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	//取出订阅者之后客户端可能已经取消了订阅
+	if pattern == "" {
+		if _, ok := sub.channels[channel]; !ok {
+			return false
+		}
+		sub.conn.WriteArray(3)
+		sub.conn.WriteBulkString("message")
+	} else {
+		if _, ok := sub.patterns[pattern]; !ok {
+			return false
+		}
+		sub.conn.WriteArray(4)
+		sub.conn.WriteBulkString("pmessage")
+		sub.conn.WriteBulkString(pattern)
+	}
+	sub.conn.WriteBulkString(channel)
+	sub.conn.WriteBulk(message)
+	return sub.conn.Flush() == nil
+}
+
+// 被订阅的模式的数量
+func (hub *pubSubHub) numPatterns() int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.patterns)
+}
+
+// 订阅过频道的客户端数量
+func (hub *pubSubHub) numClients() int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.subscribers)
+}
+
+func (hub *pubSubHub) numSubscribers(channel string) int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.channels[channel])
+}
+
+// 至少有一个订阅者的频道,pattern 为空时返回所有的频道
+func (hub *pubSubHub) activeChannels(pattern []byte) []string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	var channels []string
+	for channel := range hub.channels {
+		if len(pattern) == 0 || utils.GlobMatch(pattern, []byte(channel)) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// 关闭所有分离出来的连接,服务关闭时调用
+func (hub *pubSubHub) close() {
+	hub.mu.Lock()
+	hub.closed = true
+	subs := make([]*subscriber, 0, len(hub.subscribers))
+	for sub := range hub.subscribers {
+		subs = append(subs, sub)
+	}
+	hub.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.close()
+	}
+}
+
+func (sub *subscriber) close() {
+	_ = sub.conn.Close()
+}
+
+// 执行 SUBSCRIBE/UNSUBSCRIBE/PSUBSCRIBE/PUNSUBSCRIBE,第一次订阅时把连接从 redcon 的事件循环中分离出来
+func (cli *BitcaskClient) subscribeCommand(conn redcon.Conn, command string, args [][]byte) {
+	subscribing := command == "subscribe" || command == "psubscribe"
+	if subscribing && len(args) == 0 {
+		conn.WriteError(newWrongNumberOfArgsError(command).Error())
+		return
+	}
+	if cli.sub != nil {
+		//分离之后的命令都在 serveSubscriber 中持有 sub.mu 执行
+		cli.writeSubscribeReplies(command, args)
+		return
+	}
+	if !subscribing {
+		//没有订阅任何频道时取消订阅
+		conn.WriteArray(3)
+		conn.WriteBulkString(command)
+		conn.WriteNull()
+		conn.WriteInt(0)
+		return
+	}
+
+	cli.server.mu.RLock()
+	limit := cli.server.config.pubsubOutputLimit
+	cli.server.mu.RUnlock()
+	sub, ok := cli.server.pubsub.detach(conn, limit)
+	if !ok {
+		_ = conn.Close()
+		return
+	}
+	cli.sub = sub
+	sub.mu.Lock()
+	cli.writeSubscribeReplies(command, args)
+	err := sub.conn.Flush()
+	sub.mu.Unlock()
+	if err != nil {
+		cli.closeSubscriber()
+		return
+	}
+	go cli.serveSubscriber()
+}
+
+// 修改订阅并逐个回复订阅之后的数量,调用方需要持有 sub.mu
+func (cli *BitcaskClient) writeSubscribeReplies(command string, args [][]byte) {
+	hub, sub := cli.server.pubsub, cli.sub
+	defer func() {
+		cli.info.mu.Lock()
+		cli.info.sub, cli.info.psub = len(sub.channels), len(sub.patterns)
+		cli.info.mu.Unlock()
+		cli.updateInfo()
+	}()
+	pattern := strings.HasPrefix(command, "p")
+	names := make([]string, 0, len(args))
+	for _, arg := range args {
+		names = append(names, string(arg))
+	}
+	if len(names) == 0 {
+		//不带参数时取消所有的订阅
+		subs := sub.channels
+		if pattern {
+			subs = sub.patterns
+		}
+		for name := range subs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	if len(names) == 0 {
+		sub.conn.WriteArray(3)
+		sub.conn.WriteBulkString(command)
+		sub.conn.WriteNull()
+		sub.conn.WriteInt(sub.count())
+		return
+	}
+
+	for _, name := range names {
+		if command == "subscribe" || command == "psubscribe" {
+			hub.subscribe(sub, name, pattern)
+		} else {
+			hub.unsubscribe(sub, name, pattern)
+		}
+		sub.conn.WriteArray(3)
+		sub.conn.WriteBulkString(command)
+		sub.conn.WriteBulkString(name)
+		sub.conn.WriteInt(sub.count())
+	}
+}
+
+// 读取并执行分离出来的连接上的命令,取消所有订阅之后可以继续执行普通命令
+func (cli *BitcaskClient) serveSubscriber() {
+	defer cli.closeSubscriber()
+	sub := cli.sub
+	for {
+		cmd, err := sub.conn.ReadCommand()
+		if err != nil {
+			return
+		}
+		sub.mu.Lock()
+		execClientCommand(sub.conn, cmd)
+		err = sub.conn.Flush()
+		sub.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (cli *BitcaskClient) closeSubscriber() {
+	cli.server.pubsub.remove(cli.sub)
+	cli.server.clients.remove(cli)
+	cli.unwatchAll()
+	cli.sub.close()
+}
+
+func publish(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("publish")
+	}
+
+	return redcon.SimpleInt(cli.server.pubsub.publish(string(args[0]), args[1])), nil
+}
+
+// PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func pubsub(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("pubsub")
+	}
+
+	hub := cli.server.pubsub
+	switch strings.ToLower(string(args[0])) {
+	case "channels":
+		if len(args) > 2 {
+			return nil, newWrongNumberOfArgsError("pubsub|channels")
+		}
+		var pattern []byte
+		if len(args) == 2 {
+			pattern = args[1]
+		}
+		channels := hub.activeChannels(pattern)
+		res := make([]interface{}, len(channels))
+		for i, channel := range channels {
+			res[i] = channel
+		}
+		return res, nil
+	case "numsub":
+		res := make([]interface{}, 0, 2*(len(args)-1))
+		for _, channel := range args[1:] {
+			res = append(res, channel, redcon.SimpleInt(hub.numSubscribers(string(channel))))
+		}
+		return res, nil
+	case "numpat":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("pubsub|numpat")
+		}
+		return redcon.SimpleInt(hub.numPatterns()), nil
+	default:
+		return nil, errUnknownPubSubCommand
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBitcaskServer_PubSub(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	subscriber := newTestClient(t, addr)
+	defer subscriber.close()
+	publisher := newTestClient(t, addr)
+	defer publisher.close()
+
+	// 没有订阅时取消订阅
+	res, err := subscriber.do("UNSUBSCRIBE")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"unsubscribe", nil, int64(0)}, res)
+
+	err = subscriber.send("SUBSCRIBE", "news", "sports")
+	assert.Nil(t, err)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"subscribe", "news", int64(1)}, res)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"subscribe", "sports", int64(2)}, res)
+	res, err = subscriber.do("PSUBSCRIBE", "new?")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"psubscribe", "new?", int64(3)}, res)
+
+	// 订阅模式下只能执行订阅相关的命令
+	_, err = subscriber.do("GET", "k")
+	assert.NotNil(t, err)
+	res, err = subscriber.do("PING")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"pong", ""}, res)
+
+	res, err = publisher.do("PUBLISH", "news", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"message", "news", "hello"}, res)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"pmessage", "new?", "news", "hello"}, res)
+
+	res, err = publisher.do("PUBLISH", "other", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+
+	res, err = publisher.do("PUBSUB", "CHANNELS")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"news", "sports"}, res)
+	res, err = publisher.do("PUBSUB", "CHANNELS", "s*")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"sports"}, res)
+	res, err = publisher.do("PUBSUB", "NUMSUB", "news", "other")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"news", int64(1), "other", int64(0)}, res)
+	res, err = publisher.do("PUBSUB", "NUMPAT")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+
+	// 取消所有订阅之后可以执行普通命令
+	err = subscriber.send("UNSUBSCRIBE")
+	assert.Nil(t, err)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"unsubscribe", "news", int64(2)}, res)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"unsubscribe", "sports", int64(1)}, res)
+	res, err = subscriber.do("PUNSUBSCRIBE", "new?")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"punsubscribe", "new?", int64(0)}, res)
+
+	res, err = publisher.do("PUBLISH", "news", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	res, err = subscriber.do("SET", "k", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = subscriber.do("PING")
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", res)
+
+	// 再次订阅
+	res, err = subscriber.do("SUBSCRIBE", "news")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"subscribe", "news", int64(1)}, res)
+	res, err = publisher.do("PUBLISH", "news", "again")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = subscriber.read()
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"message", "news", "again"}, res)
+
+	// 断开连接之后移除订阅
+	subscriber.close()
+	assert.Eventually(t, func() bool {
+		res, err := publisher.do("PUBSUB", "NUMSUB", "news")
+		return err == nil && assert.ObjectsAreEqual([]interface{}{"news", int64(0)}, res)
+	}, 5*time.Second, 20*time.Millisecond)
+
+	_, err = publisher.do("SUBSCRIBE")
+	assert.NotNil(t, err)
+	_, err = publisher.do("PUBSUB", "UNKNOWN")
+	assert.NotNil(t, err)
+}
+
+func TestBitcaskServer_PubSubSlowSubscriber(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	publisher := newTestClient(t, addr)
+	defer publisher.close()
+	_, err := publisher.do("CONFIG", "SET", "pubsub-output-buffer-limit", "1mb")
+	assert.Nil(t, err)
+
+	// 一直不读取消息的订阅者
+	slow := newTestClient(t, addr)
+	defer slow.close()
+	_, err = slow.do("SUBSCRIBE", "news")
+	assert.Nil(t, err)
+	fast := newTestClient(t, addr)
+	defer fast.close()
+	_, err = fast.do("SUBSCRIBE", "news")
+	assert.Nil(t, err)
+
+	const count = 1000
+	message := strings.Repeat("m", 16*1024)
+	received := make(chan int, 1)
+	go func() {
+		var n int
+		for n < count {
+			res, err := fast.read()
+			if err != nil {
+				break
+			}
+			if assert.Equal(t, []interface{}{"message", "news", message}, res) {
+				n++
+			}
+		}
+		received <- n
+	}()
+
+	// 积压超过限制之后断开缓慢的订阅者,发布不会被阻塞
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < count; i++ {
+			_, err := publisher.do("PUBLISH", "news", message)
+			assert.Nil(t, err)
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(10 * time.Second):
+		t.Fatal("publish blocked by a slow subscriber")
+	}
+	assert.Equal(t, count, <-received)
+	assert.Eventually(t, func() bool {
+		res, err := publisher.do("PUBSUB", "NUMSUB", "news")
+		return err == nil && res.([]interface{})[1] == int64(1)
+	}, 5*time.Second, 10*time.Millisecond)
+	res, err := publisher.do("PUBLISH", "news", "hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+}
@@ -1,59 +1,315 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"github.com/tidwall/redcon"
 	"kv-go/bitcask"
+	"kv-go/bitcask/metrics"
 	bitcask_redis "kv-go/bitcask/redis"
+	"kv-go/bitcask/utils"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
+	"time"
 )
 
-const addr = "127.0.0.1:6380"
+var errShuttingDown = errors.New("ERR server is shutting down")
 
 type BitcaskServer struct {
-	dbs    map[int]*bitcask_redis.RedisDataStructure
-	server *redcon.Server
-	mu     sync.RWMutex
+	dbs     map[int]*bitcask_redis.RedisDataStructure
+	server  *redcon.Server
+	mu      sync.RWMutex
+	dirs    []string     //每个数据库的目录,第一次使用时打开
+	config  serverConfig //CONFIG SET 会修改其中可以动态调整的配置项
+	cluster *cluster     //raft 集群模式,单机模式下为空
+	//集群模式下后台清理使用状态机的时间判断过期,单机模式下为空
+	clock func() time.Time
+
+	//命令使用 DB 期间持有读锁,恢复快照时持有写锁,旧的 DB 不会在使用中被关闭
+	restoreMu sync.RWMutex
+
+	blocking *blockingRegistry //阻塞在列表上的客户端
+	pubsub   *pubSubHub        //频道和模式的订阅者
+	acl      *aclStore         //ACL 用户,requirepass 是默认用户的密码
+
+	tlsConfig  *tls.Config //为空时不使用 TLS
+	listenAddr net.Addr
+
+	clients  *clientRegistry //所有连接的客户端
+	monitors *monitorHub     //执行了 MONITOR 的客户端
+	slowlog  *slowLog
+	stats    *serverStats
+
+	metrics       *metrics.Collector //没有设置 metrics-addr 时为空
+	metricsServer *http.Server
+
+	//关闭服务时不再接受新的命令,等待正在执行的命令完成
+	drainMu   sync.RWMutex
+	closing   bool
+	inflight  sync.WaitGroup
+	closeOnce sync.Once
 }
 
 func main() {
-	// 打开 Redis 数据结构服务
-	redisDataStructure, err := bitcask_redis.NewRedisDataStructure(bitcask.DefaultOptions)
+	cfg, err := loadServerConfig(os.Args[0], os.Args[1:])
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatalln(err)
+	}
+
+	bitcaskServer, err := newBitcaskServer(cfg)
 	if err != nil {
 		panic(err)
 	}
 
-	// 初始化 BitcaskServer
+	//收到 SIGINT 或者 SIGTERM 之后优雅关闭,再次收到信号时直接退出
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	if cfg.metricsAddr != "" {
+		go func() {
+			if err := bitcaskServer.listenMetrics(cfg.metricsAddr); err != nil {
+				log.Println("metrics listen failed:", err)
+			}
+		}()
+	}
+	go func() {
+		if err := bitcaskServer.listen(cfg.addr); err != nil {
+			log.Println("listen failed:", err)
+		}
+		stop()
+	}()
+	<-ctx.Done()
+	stop()
+	log.Println("bitcask server shutting down.")
+	bitcaskServer.shutdown()
+}
+
+// 打开数据库0并初始化 BitcaskServer,其他的数据库在第一次 SELECT 时打开
+func newBitcaskServer(cfg serverConfig) (*BitcaskServer, error) {
+	if cfg.databases < 1 {
+		return nil, errDBIndexOutOfRange
+	}
+	clusterOpts, err := cfg.clusterOptions()
+	if err != nil {
+		return nil, err
+	}
+	dirs, err := loadDBDirs(cfg.options.DirPath, cfg.databases)
+	if err != nil {
+		return nil, err
+	}
+	aclStore, err := newACLStore(cfg.aclFile, cfg.requirePass)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := utils.NewServerTLSConfig(cfg.tlsCertFile, cfg.tlsKeyFile, cfg.tlsCACertFile)
+	if err != nil {
+		return nil, err
+	}
 	bitcaskServer := &BitcaskServer{
-		dbs: make(map[int]*bitcask_redis.RedisDataStructure),
+		dbs:       make(map[int]*bitcask_redis.RedisDataStructure),
+		dirs:      dirs,
+		config:    cfg,
+		blocking:  newBlockingRegistry(),
+		pubsub:    newPubSubHub(),
+		acl:       aclStore,
+		tlsConfig: tlsConfig,
+		clients:   newClientRegistry(),
+		monitors:  newMonitorHub(),
+		slowlog:   newSlowLog(cfg.slowlogSlowerThan, cfg.slowlogMaxLen),
+		stats:     newServerStats(),
 	}
-	bitcaskServer.dbs[0] = redisDataStructure
+	if cfg.metricsAddr != "" {
+		bitcaskServer.metrics = newServerMetrics(bitcaskServer)
+	}
+	var fsm *clusterFSM
+	if clusterOpts != nil {
+		//状态机的数据由 raft 的快照和日志重新生成
+		if err := os.RemoveAll(bitcaskServer.dirs[0]); err != nil {
+			return nil, err
+		}
+		fsm = &clusterFSM{server: bitcaskServer}
+		bitcaskServer.clock = fsm.now
+	}
+	redisDataStructure, err := bitcaskServer.openDatabase(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if clusterOpts != nil {
+		if bitcaskServer.cluster, err = newCluster(bitcaskServer, fsm, *clusterOpts); err != nil {
+			_ = redisDataStructure.Close()
+			return nil, err
+		}
+	}
+	go bitcaskServer.stats.run()
+	return bitcaskServer, nil
+}
 
-	// 初始化一个 Redis 服务端
-	bitcaskServer.server = redcon.NewServer(addr, execClientCommand, bitcaskServer.accept, bitcaskServer.close)
-	bitcaskServer.listen()
+// 打开 Redis 数据结构服务,列表写入新元素时唤醒阻塞的客户端,并在后台清理过期的 key,
+// 收集指标时以数据目录作为 db 标签,SWAPDB 之后指标仍然跟随数据
+func (svr *BitcaskServer) openDB(options bitcask.Options) (*bitcask_redis.RedisDataStructure, error) {
+	//存储引擎的事件和服务的日志输出到同一个地方
+	options.Logger = slog.Default()
+	if svr.metrics != nil {
+		options.Metrics = svr.metrics.Metrics(options.DirPath)
+	}
+	rds, err := bitcask_redis.NewRedisDataStructure(options)
+	if err != nil {
+		return nil, err
+	}
+	if svr.metrics != nil {
+		svr.metrics.AddDatabase(options.DirPath, rds.Stat)
+	}
+	rds.SetListPushHook(func(key []byte) {
+		svr.blocking.notify(rds, key)
+	})
+	gcOptions := bitcask_redis.DefaultGCOptions
+	gcOptions.Now = svr.clock
+	rds.StartGC(gcOptions)
+	return rds, nil
 }
 
-func (svr *BitcaskServer) listen() {
+// 监听地址并提供服务,直到服务被关闭
+func (svr *BitcaskServer) listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
 	log.Println("bitcask server running, ready to accept connections.")
-	_ = svr.server.ListenAndServe()
+	return svr.serve(ln)
+}
+
+// 在已经创建好的 listener 上提供服务,配置了证书时在 listener 上使用 TLS
+func (svr *BitcaskServer) serve(ln net.Listener) error {
+	if svr.tlsConfig != nil {
+		ln = tls.NewListener(ln, svr.tlsConfig)
+	}
+	svr.mu.Lock()
+	svr.listenAddr = ln.Addr()
+	svr.server = redcon.NewServer(ln.Addr().String(), execClientCommand, svr.accept, svr.close)
+	svr.mu.Unlock()
+	return svr.server.Serve(ln)
 }
 
 func (svr *BitcaskServer) accept(conn redcon.Conn) bool {
-	cli := new(BitcaskClient)
+	//正在关闭时拒绝新的连接
+	svr.drainMu.RLock()
+	defer svr.drainMu.RUnlock()
+	if svr.closing {
+		return false
+	}
+
+	cli := &BitcaskClient{
+		server:    svr,
+		conn:      conn,
+		addr:      conn.RemoteAddr(),
+		createdAt: time.Now(),
+		info:      &clientInfo{multi: -1, flags: "N", lastActive: time.Now()},
+		cancel:    make(chan struct{}),
+	}
+	svr.clients.add(cli)
+	svr.stats.connections.Add(1)
 	svr.mu.Lock()
 	defer svr.mu.Unlock()
-	cli.server = svr
 	cli.db = svr.dbs[0]
+	//默认用户不需要密码时自动登录
+	if svr.acl.defaultNoPass() {
+		cli.user = defaultUserName
+	}
+	cli.updateInfo()
 	conn.SetContext(cli)
 	return true
 }
 
+// 开始执行一条命令,服务正在关闭时返回 false
+func (svr *BitcaskServer) beginCommand() bool {
+	svr.drainMu.RLock()
+	defer svr.drainMu.RUnlock()
+	if svr.closing {
+		return false
+	}
+	svr.inflight.Add(1)
+	return true
+}
+
+func (svr *BitcaskServer) endCommand() {
+	svr.inflight.Done()
+}
+
+// 集群模式下快照恢复会替换掉 DB,所以每次执行命令时重新获取
+func (svr *BitcaskServer) db(index int) *bitcask_redis.RedisDataStructure {
+	svr.mu.RLock()
+	defer svr.mu.RUnlock()
+	return svr.dbs[index]
+}
+
+// 客户端断开连接,阻塞中的客户端会在超时之后退出,
+// 订阅频道和 MONITOR 时分离出来的连接由 serveSubscriber 和 serveMonitor 负责清理
 func (svr *BitcaskServer) close(conn redcon.Conn, err error) {
-	for _, db := range svr.dbs {
-		_ = db.Close()
+	cli, ok := conn.Context().(*BitcaskClient)
+	if !ok {
+		return
+	}
+	cli.cancelBlocking()
+	if cli.sub == nil && cli.monitor == nil {
+		cli.unwatchAll()
+		svr.clients.remove(cli)
 	}
-	_ = svr.server.Close()
+}
+
+// 优雅地关闭服务: 拒绝新的连接和命令,唤醒阻塞的客户端,等待正在执行的命令完成之后
+// 断开所有的连接,最后关闭数据库,多次调用时只会执行一次
+func (svr *BitcaskServer) shutdown() {
+	svr.closeOnce.Do(func() {
+		svr.drainMu.Lock()
+		svr.closing = true
+		svr.drainMu.Unlock()
+
+		svr.blocking.close()
+		svr.pubsub.close()
+		svr.monitors.close()
+		svr.stats.close()
+
+		svr.mu.RLock()
+		timeout := svr.config.shutdownTimeout
+		server := svr.server
+		metricsServer := svr.metricsServer
+		svr.mu.RUnlock()
+		done := make(chan struct{})
+		go func() {
+			svr.inflight.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(timeout):
+			log.Println("timed out waiting for running commands, closing anyway.")
+		}
+
+		if server != nil {
+			_ = server.Close()
+		}
+		if metricsServer != nil {
+			_ = metricsServer.Close()
+		}
+		if svr.cluster != nil {
+			_ = svr.cluster.shutdown()
+		}
+		svr.mu.Lock()
+		defer svr.mu.Unlock()
+		for _, db := range svr.dbs {
+			_ = db.Close()
+		}
+	})
 }
 
 // redis 协议解析的示例
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 测试用的简单 redis 协议客户端
+type testClient struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+func newTestClient(t *testing.T, addr string) *testClient {
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	return &testClient{conn: conn, rd: bufio.NewReader(conn)}
+}
+
+func (c *testClient) do(args ...string) (interface{}, error) {
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+	return c.read()
+}
+
+func (c *testClient) send(args ...string) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		sb.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg))
+	}
+	_, err := c.conn.Write([]byte(sb.String()))
+	return err
+}
+
+// 读取一个回复,错误回复以 error 返回,空值返回 nil
+func (c *testClient) read() (interface{}, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, _ := strconv.Atoi(line[1:])
+		if size < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(c.rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:size]), nil
+	case '*':
+		count, _ := strconv.Atoi(line[1:])
+		if count < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			item, err := c.read()
+			if err != nil {
+				// 数组中的错误回复作为元素返回
+				item = err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unknown reply: %s", line)
+}
+
+func (c *testClient) close() {
+	_ = c.conn.Close()
+}
+
+// 在随机端口上启动一个单机模式的服务
+func startTestServer(t *testing.T) (*BitcaskServer, string) {
+	cfg := defaultServerConfig
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-server")
+	cfg.options.DirPath = dir
+	return startTestServerWithConfig(t, cfg)
+}
+
+// 使用指定的配置启动服务,测试结束时关闭服务
+func startTestServerWithConfig(t *testing.T, cfg serverConfig) (*BitcaskServer, string) {
+	svr, err := newBitcaskServer(cfg)
+	assert.Nil(t, err)
+	t.Cleanup(svr.shutdown)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	go func() {
+		_ = svr.serve(ln)
+	}()
+	return svr, ln.Addr().String()
+}
+
+func TestBitcaskServer_SetGet(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+
+	res, err := cli.do("SET", "name", "bitcask")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("GET", "name")
+	assert.Nil(t, err)
+	assert.Equal(t, "bitcask", res)
+	res, err = cli.do("GET", "unknown")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	_, err = cli.do("SET", "name")
+	assert.NotNil(t, err)
+	_, err = cli.do("UNKNOWN")
+	assert.NotNil(t, err)
+	cli.close()
+}
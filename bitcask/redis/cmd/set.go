@@ -0,0 +1,237 @@
+package main
+
+import (
+	"github.com/tidwall/redcon"
+	"math/rand"
+	"strconv"
+)
+
+func sadd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sadd")
+	}
+
+	var count = 0
+	for _, member := range args[1:] {
+		ok, err := cli.db.SAdd(args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func srem(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("srem")
+	}
+
+	var count = 0
+	for _, member := range args[1:] {
+		ok, err := cli.db.SRem(args[0], member)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func sismember(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("sismember")
+	}
+
+	ok, err := cli.db.SIsMember(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func scard(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("scard")
+	}
+
+	size, err := cli.db.SCard(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func smembers(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("smembers")
+	}
+
+	members, err := cli.db.SMembers(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+// SPOP key [count],不指定 count 时返回单个元素
+func spop(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("spop")
+	}
+
+	var count = 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil || count < 0 {
+			return nil, errNotInteger
+		}
+	}
+	//集群模式下随机数的种子由日志的索引决定,每个节点弹出相同的元素
+	var r *rand.Rand
+	if cli.logIndex > 0 {
+		r = rand.New(rand.NewSource(int64(cli.logIndex)))
+	}
+	members, err := cli.db.SPopWithRand(args[0], count, r)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return members[0], nil
+	}
+	return bulkArray(members), nil
+}
+
+// SRANDMEMBER key [count],不指定 count 时返回单个元素
+func srandmember(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("srandmember")
+	}
+
+	var count = 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil {
+			return nil, errNotInteger
+		}
+	}
+	members, err := cli.db.SRandMember(args[0], count)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		if len(members) == 0 {
+			return nil, nil
+		}
+		return members[0], nil
+	}
+	return bulkArray(members), nil
+}
+
+func smove(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("smove")
+	}
+
+	ok, err := cli.db.SMove(args[0], args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func sinter(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("sinter")
+	}
+
+	members, err := cli.db.SInter(args...)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func sunion(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("sunion")
+	}
+
+	members, err := cli.db.SUnion(args...)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func sdiff(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("sdiff")
+	}
+
+	members, err := cli.db.SDiff(args...)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(members), nil
+}
+
+func sinterstore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sinterstore")
+	}
+
+	size, err := cli.db.SInterStore(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func sunionstore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sunionstore")
+	}
+
+	size, err := cli.db.SUnionStore(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func sdiffstore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sdiffstore")
+	}
+
+	size, err := cli.db.SDiffStore(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count]
+func sscan(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("sscan")
+	}
+
+	cursor, pattern, count, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	next, members, err := cli.db.SScan(args[0], cursor, pattern, count)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{strconv.FormatUint(next, 10), bulkArray(members)}, nil
+}
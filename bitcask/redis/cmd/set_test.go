@@ -0,0 +1,64 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestBitcaskServer_Set(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("SADD", "s1", "a", "b", "c", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("SADD", "s2", "b", "c", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("SCARD", "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("SMEMBERS", "s1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c"}, res)
+	res, err = cli.do("SISMEMBER", "s1", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+
+	res, err = cli.do("SINTER", "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "c"}, res)
+	res, err = cli.do("SUNION", "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a", "b", "c", "d"}, res)
+	res, err = cli.do("SDIFF", "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"a"}, res)
+	res, err = cli.do("SUNIONSTORE", "s3", "s1", "s2")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), res)
+
+	res, err = cli.do("SMOVE", "s3", "s1", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("SREM", "s1", "a", "d", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+
+	res, err = cli.do("SRANDMEMBER", "s1")
+	assert.Nil(t, err)
+	assert.Contains(t, []interface{}{"b", "c"}, res)
+	res, err = cli.do("SPOP", "s1", "5")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(res.([]interface{})))
+	res, err = cli.do("SPOP", "s1")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	res, err = cli.do("SSCAN", "s3", "0", "MATCH", "[ab]")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"0", []interface{}{"a", "b"}}, res)
+}
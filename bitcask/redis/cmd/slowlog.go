@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/tidwall/redcon"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultSlowlogSlowerThan = 10000 //微秒
+	defaultSlowlogMaxLen     = 128
+
+	//和 Redis 一样只保存前32个参数,每个参数只保存前128个字节
+	slowlogMaxArgs   = 32
+	slowlogMaxArgLen = 128
+)
+
+var errUnknownSlowlogCommand = errors.New("ERR unknown subcommand for 'slowlog'")
+
+// 一条执行缓慢的命令
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     [][]byte
+	addr     string
+	name     string
+}
+
+// 记录执行时间超过 slowlog-log-slower-than 的命令,最多保留 slowlog-max-len 条,新的在前面
+type slowLog struct {
+	mu         sync.Mutex
+	entries    []*slowlogEntry
+	nextID     int64
+	slowerThan atomic.Int64 //微秒,负数表示不记录,0表示记录所有的命令
+	maxLen     atomic.Int64
+}
+
+func newSlowLog(slowerThan int64, maxLen int) *slowLog {
+	l := &slowLog{}
+	l.configure(slowerThan, maxLen)
+	return l
+}
+
+// CONFIG SET 修改配置之后调用
+func (l *slowLog) configure(slowerThan int64, maxLen int) {
+	l.slowerThan.Store(slowerThan)
+	l.maxLen.Store(int64(maxLen))
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) > maxLen {
+		l.entries = l.entries[:maxLen]
+	}
+}
+
+// 执行时间超过阈值时记录命令,参数会被复制,redcon 会复用读取命令的缓冲区
+func (l *slowLog) record(cli *BitcaskClient, args [][]byte, duration time.Duration) {
+	slowerThan := l.slowerThan.Load()
+	if slowerThan < 0 || duration < time.Duration(slowerThan)*time.Microsecond {
+		return
+	}
+
+	n := len(args)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs
+	}
+	entryArgs := make([][]byte, n)
+	for i := 0; i < n; i++ {
+		switch {
+		case i == slowlogMaxArgs-1 && len(args) > slowlogMaxArgs:
+			entryArgs[i] = []byte(fmt.Sprintf("... (%d more arguments)", len(args)-slowlogMaxArgs+1))
+		case len(args[i]) > slowlogMaxArgLen:
+			entryArgs[i] = []byte(fmt.Sprintf("%s... (%d more bytes)", args[i][:slowlogMaxArgLen],
+				len(args[i])-slowlogMaxArgLen))
+		default:
+			entryArgs[i] = append([]byte(nil), args[i]...)
+		}
+	}
+	entry := &slowlogEntry{
+		time:     time.Now(),
+		duration: duration,
+		args:     entryArgs,
+		addr:     cli.addr,
+		name:     cli.name(),
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry.id = l.nextID
+	l.nextID++
+	l.entries = append([]*slowlogEntry{entry}, l.entries...)
+	if maxLen := int(l.maxLen.Load()); len(l.entries) > maxLen {
+		l.entries = l.entries[:maxLen]
+	}
+}
+
+func (l *slowLog) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (l *slowLog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = nil
+}
+
+// 最新的 count 条记录,count 为负数时返回所有的记录
+func (l *slowLog) get(count int) []interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if count < 0 || count > len(l.entries) {
+		count = len(l.entries)
+	}
+	res := make([]interface{}, count)
+	for i, entry := range l.entries[:count] {
+		res[i] = []interface{}{
+			redcon.SimpleInt(entry.id),
+			redcon.SimpleInt(entry.time.Unix()),
+			redcon.SimpleInt(entry.duration.Microseconds()),
+			bulkArray(entry.args),
+			entry.addr,
+			entry.name,
+		}
+	}
+	return res
+}
+
+// SLOWLOG GET [count] | LEN | RESET
+func slowlog(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("slowlog")
+	}
+
+	l := cli.server.slowlog
+	switch strings.ToLower(string(args[0])) {
+	case "get":
+		if len(args) > 2 {
+			return nil, newWrongNumberOfArgsError("slowlog|get")
+		}
+		count := 10
+		if len(args) == 2 {
+			var err error
+			if count, err = strconv.Atoi(string(args[1])); err != nil || count < -1 {
+				return nil, errNotInteger
+			}
+		}
+		return l.get(count), nil
+	case "len":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("slowlog|len")
+		}
+		return redcon.SimpleInt(l.len()), nil
+	case "reset":
+		if len(args) != 1 {
+			return nil, newWrongNumberOfArgsError("slowlog|reset")
+		}
+		l.reset()
+		return redcon.SimpleString("OK"), nil
+	default:
+		return nil, errUnknownSlowlogCommand
+	}
+}
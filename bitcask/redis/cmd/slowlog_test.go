@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestBitcaskServer_Slowlog(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	// 默认的阈值下不会记录普通的命令
+	_, err := cli.do("SET", "k", "v")
+	assert.Nil(t, err)
+	res, err := cli.do("SLOWLOG", "LEN")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+
+	_, err = cli.do("CONFIG", "SET", "slowlog-log-slower-than", "0", "slowlog-max-len", "3")
+	assert.Nil(t, err)
+	_, err = cli.do("CLIENT", "SETNAME", "worker")
+	assert.Nil(t, err)
+	_, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	_, err = cli.do("SET", "big", strings.Repeat("x", 200))
+	assert.Nil(t, err)
+	args := []string{"DEL"}
+	for i := 0; i < 40; i++ {
+		args = append(args, "key")
+	}
+	_, err = cli.do(args...)
+	assert.Nil(t, err)
+
+	// 只保留最新的3条记录
+	res, err = cli.do("SLOWLOG", "LEN")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("SLOWLOG", "GET", "2")
+	assert.Nil(t, err)
+	entries := res.([]interface{})
+	assert.Len(t, entries, 2)
+
+	// 参数的数量和长度都会被截断
+	entry := entries[1].([]interface{})
+	entryArgs := entry[3].([]interface{})
+	assert.Equal(t, []interface{}{"SET", "big", strings.Repeat("x", 128) + "... (72 more bytes)"}, entryArgs)
+	assert.Equal(t, cli.conn.LocalAddr().String(), entry[4])
+	assert.Equal(t, "worker", entry[5])
+	entry = entries[0].([]interface{})
+	assert.Equal(t, entry[0].(int64), entries[1].([]interface{})[0].(int64)+1)
+	entryArgs = entry[3].([]interface{})
+	assert.Len(t, entryArgs, 32)
+	assert.Equal(t, "... (10 more arguments)", entryArgs[31])
+
+	res, err = cli.do("SLOWLOG", "GET", "-1")
+	assert.Nil(t, err)
+	assert.Len(t, res, 3)
+	res, err = cli.do("SLOWLOG", "RESET")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("SLOWLOG", "GET")
+	assert.Nil(t, err)
+	assert.Len(t, res, 0)
+
+	// 负数表示不记录,AUTH 和管理命令不会被记录
+	_, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	_, err = cli.do("AUTH", "secret")
+	assert.NotNil(t, err)
+	res, err = cli.do("SLOWLOG", "LEN")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	_, err = cli.do("CONFIG", "SET", "slowlog-log-slower-than", "-1")
+	assert.Nil(t, err)
+	_, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	res, err = cli.do("SLOWLOG", "LEN")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+
+	_, err = cli.do("SLOWLOG", "GET", "x")
+	assert.NotNil(t, err)
+	_, err = cli.do("CONFIG", "SET", "slowlog-max-len", "-1")
+	assert.NotNil(t, err)
+	_, err = cli.do("SLOWLOG", "UNKNOWN")
+	assert.NotNil(t, err)
+}
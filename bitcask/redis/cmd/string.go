@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"github.com/tidwall/redcon"
+	bitcask_redis "kv-go/bitcask/redis"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidExpire = errors.New("ERR invalid expire time")
+
+// SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL]
+func set(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("set")
+	}
+
+	var opts bitcask_redis.SetOptions
+	var hasTTL bool
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToLower(string(args[i])); option {
+		case "nx":
+			opts.NX = true
+		case "xx":
+			opts.XX = true
+		case "get":
+			opts.Get = true
+		case "keepttl":
+			opts.KeepTTL = true
+		case "ex", "px", "exat", "pxat":
+			if hasTTL || i+1 >= len(args) {
+				return nil, errSyntax
+			}
+			ttl, at, err := parseExpireOption(option, args[i+1])
+			if err != nil {
+				return nil, err
+			}
+			opts.TTL, opts.ExpireAt, hasTTL = ttl, at, true
+			i++
+		default:
+			return nil, errSyntax
+		}
+	}
+	if (opts.NX && opts.XX) || (opts.KeepTTL && hasTTL) {
+		return nil, errSyntax
+	}
+
+	old, ok, err := cli.db.SetWithOptions(args[0], args[1], opts)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Get {
+		return bulkOrNil(old), nil
+	}
+	if !ok {
+		return nil, nil
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func setnx(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("setnx")
+	}
+
+	ok, err := cli.db.SetNX(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func get(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("get")
+	}
+
+	value, err := cli.db.Get(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func getset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("getset")
+	}
+
+	old, err := cli.db.GetSet(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return bulkOrNil(old), nil
+}
+
+func getdel(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("getdel")
+	}
+
+	value, err := cli.db.GetDel(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST]
+func getex(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 1 {
+		return nil, newWrongNumberOfArgsError("getex")
+	}
+
+	var ttl time.Duration
+	var at time.Time
+	var persist bool
+	if len(args) > 1 {
+		switch option := strings.ToLower(string(args[1])); {
+		case len(args) == 2 && option == "persist":
+			persist = true
+		case len(args) == 3 && (option == "ex" || option == "px" || option == "exat" || option == "pxat"):
+			var err error
+			if ttl, at, err = parseExpireOption(option, args[2]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errSyntax
+		}
+	}
+
+	if !at.IsZero() {
+		value, err := cli.db.GetExAt(args[0], at)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	value, err := cli.db.GetEx(args[0], ttl, persist)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func mset(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, newWrongNumberOfArgsError("mset")
+	}
+
+	if err := cli.db.MSet(args...); err != nil {
+		return nil, err
+	}
+	return redcon.SimpleString("OK"), nil
+}
+
+func msetnx(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, newWrongNumberOfArgsError("msetnx")
+	}
+
+	ok, err := cli.db.MSetNX(args...)
+	if err != nil {
+		return nil, err
+	}
+	return boolInt(ok), nil
+}
+
+func mget(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, newWrongNumberOfArgsError("mget")
+	}
+
+	values, err := cli.db.MGet(args...)
+	if err != nil {
+		return nil, err
+	}
+	return bulkArray(values), nil
+}
+
+func incr(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("incr")
+	}
+	return incrBy(cli, args[0], 1)
+}
+
+func decr(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("decr")
+	}
+	return incrBy(cli, args[0], -1)
+}
+
+func incrby(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("incrby")
+	}
+
+	incr, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	return incrBy(cli, args[0], incr)
+}
+
+func decrby(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("decrby")
+	}
+
+	decr, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	if decr == math.MinInt64 {
+		return nil, bitcask_redis.ErrIncrOverflow
+	}
+	return incrBy(cli, args[0], -decr)
+}
+
+func incrBy(cli *BitcaskClient, key []byte, incr int64) (interface{}, error) {
+	res, err := cli.db.IncrBy(key, incr)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(res), nil
+}
+
+func incrbyfloat(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("incrbyfloat")
+	}
+
+	incr, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(incr) || math.IsInf(incr, 0) {
+		return nil, errNotFloat
+	}
+	res, err := cli.db.IncrByFloat(args[0], incr)
+	if err != nil {
+		return nil, err
+	}
+	return strconv.FormatFloat(res, 'f', -1, 64), nil
+}
+
+func appendValue(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("append")
+	}
+
+	size, err := cli.db.Append(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func strlen(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("strlen")
+	}
+
+	size, err := cli.db.StrLen(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func getrange(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("getrange")
+	}
+
+	start, end, err := parseRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	value, err := cli.db.GetRange(args[0], start, end)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func setrange(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("setrange")
+	}
+
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return nil, errNotInteger
+	}
+	size, err := cli.db.SetRange(args[0], offset, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+// 解析 EX|PX|EXAT|PXAT 的过期时间,EX 和 PX 返回 ttl,EXAT 和 PXAT 返回 unix 时间戳对应的时间点
+func parseExpireOption(option string, arg []byte) (time.Duration, time.Time, error) {
+	if option == "exat" || option == "pxat" {
+		sinceEpoch, err := parseTTL(arg, option == "exat")
+		if err != nil {
+			return 0, time.Time{}, err
+		}
+		return 0, time.Unix(0, int64(sinceEpoch)), nil
+	}
+	ttl, err := parseTTL(arg, option == "ex")
+	return ttl, time.Time{}, err
+}
+
+// 解析过期时间,seconds 为 true 时单位是秒,否则是毫秒
+func parseTTL(arg []byte, seconds bool) (time.Duration, error) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, errNotInteger
+	}
+	unit := time.Millisecond
+	if seconds {
+		unit = time.Second
+	}
+	if n <= 0 || n > int64(math.MaxInt64/unit) {
+		return 0, errInvalidExpire
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestBitcaskServer_String(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("SET", "k1", "v1", "NX", "EX", "100")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("SET", "k1", "v2", "NX")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	res, err = cli.do("SET", "k1", "v2", "XX", "GET", "KEEPTTL")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", res)
+	res, err = cli.do("SET", "k2", "v2", "XX", "GET")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+	_, err = cli.do("SET", "k1", "v", "NX", "XX")
+	assert.NotNil(t, err)
+	_, err = cli.do("SET", "k1", "v", "EX", "0")
+	assert.NotNil(t, err)
+	_, err = cli.do("SET", "k1", "v", "PX", "10", "KEEPTTL")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("SET", "tmp", "v", "PX", "10")
+	assert.Nil(t, err)
+	time.Sleep(20 * time.Millisecond)
+	res, err = cli.do("GET", "tmp")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	res, err = cli.do("SETNX", "k1", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	res, err = cli.do("GETSET", "k1", "v3")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", res)
+	res, err = cli.do("GETEX", "k1", "PERSIST")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", res)
+	res, err = cli.do("GETDEL", "k1")
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", res)
+	res, err = cli.do("GETDEL", "k1")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	res, err = cli.do("MSET", "a", "1", "b", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("MSETNX", "b", "3", "c", "3")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+	res, err = cli.do("MGET", "a", "b", "c")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"1", "2", nil}, res)
+
+	res, err = cli.do("INCR", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = cli.do("INCRBY", "a", "10")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(12), res)
+	res, err = cli.do("DECR", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), res)
+	res, err = cli.do("DECRBY", "a", "20")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-9), res)
+	res, err = cli.do("INCRBYFLOAT", "a", "0.5")
+	assert.Nil(t, err)
+	assert.Equal(t, "-8.5", res)
+	_, err = cli.do("INCR", "a")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("APPEND", "s", "Hello")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(5), res)
+	res, err = cli.do("SETRANGE", "s", "5", " World")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), res)
+	res, err = cli.do("STRLEN", "s")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), res)
+	res, err = cli.do("GETRANGE", "s", "-5", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "World", res)
+	res, err = cli.do("GETRANGE", "missing", "0", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "", res)
+}
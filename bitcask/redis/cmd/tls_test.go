@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask/utils"
+	"kv-go/bitcask/utils/certtest"
+	"os"
+	"testing"
+)
+
+func newTestTLSClient(addr string, config *tls.Config) (*testClient, error) {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return &testClient{conn: conn, rd: bufio.NewReader(conn)}, nil
+}
+
+func TestBitcaskServer_TLS(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-tls")
+	defer removeTestDirs(dir)
+	certDir, _ := os.MkdirTemp("", "bitcask-go-redis-tls-certs")
+	defer os.RemoveAll(certDir)
+	certFile, keyFile, err := certtest.GenerateSelfSignedCert(certDir, "server")
+	assert.Nil(t, err)
+	pool, err := utils.LoadCertPool(certFile)
+	assert.Nil(t, err)
+
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	cfg.tlsCertFile, cfg.tlsKeyFile = certFile, keyFile
+	_, addr := startTestServerWithConfig(t, cfg)
+
+	cli, err := newTestTLSClient(addr, &tls.Config{RootCAs: pool})
+	assert.Nil(t, err)
+	defer cli.close()
+	res, err := cli.do("SET", "k", "v")
+	assert.Nil(t, err)
+	assert.Equal(t, "OK", res)
+	res, err = cli.do("GET", "k")
+	assert.Nil(t, err)
+	assert.Equal(t, "v", res)
+
+	// 不信任服务端证书的客户端无法连接
+	_, err = newTestTLSClient(addr, &tls.Config{})
+	assert.NotNil(t, err)
+
+	// 明文的客户端收不到回复
+	plain := newTestClient(t, addr)
+	defer plain.close()
+	_, err = plain.do("PING")
+	assert.NotNil(t, err)
+
+	// 证书和私钥需要同时设置
+	cfg = defaultServerConfig
+	cfg.options.DirPath = dir + "-invalid"
+	cfg.tlsCertFile = certFile
+	_, err = newBitcaskServer(cfg)
+	assert.Equal(t, utils.ErrTLSCertKeyPair, err)
+}
+
+func TestBitcaskServer_MutualTLS(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-mtls")
+	defer removeTestDirs(dir)
+	certDir, _ := os.MkdirTemp("", "bitcask-go-redis-mtls-certs")
+	defer os.RemoveAll(certDir)
+	certFile, keyFile, err := certtest.GenerateSelfSignedCert(certDir, "server")
+	assert.Nil(t, err)
+	clientCertFile, clientKeyFile, err := certtest.GenerateSelfSignedCert(certDir, "client")
+	assert.Nil(t, err)
+	otherCertFile, otherKeyFile, err := certtest.GenerateSelfSignedCert(certDir, "other")
+	assert.Nil(t, err)
+	pool, err := utils.LoadCertPool(certFile)
+	assert.Nil(t, err)
+
+	cfg := defaultServerConfig
+	cfg.options.DirPath = dir
+	cfg.tlsCertFile, cfg.tlsKeyFile, cfg.tlsCACertFile = certFile, keyFile, clientCertFile
+	_, addr := startTestServerWithConfig(t, cfg)
+
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	assert.Nil(t, err)
+	cli, err := newTestTLSClient(addr, &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}})
+	assert.Nil(t, err)
+	defer cli.close()
+	res, err := cli.do("PING")
+	assert.Nil(t, err)
+	assert.Equal(t, "PONG", res)
+
+	// 没有证书或者证书不是由 CA 签发的客户端在握手时被拒绝
+	for _, certs := range [][]tls.Certificate{nil, {mustLoadKeyPair(t, otherCertFile, otherKeyFile)}} {
+		other, err := newTestTLSClient(addr, &tls.Config{RootCAs: pool, Certificates: certs})
+		if err == nil {
+			//TLS 1.3 中客户端在第一次读取时才会收到握手失败
+			_, err = other.do("PING")
+			other.close()
+		}
+		assert.NotNil(t, err)
+	}
+}
+
+func mustLoadKeyPair(t *testing.T, certFile, keyFile string) tls.Certificate {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.Nil(t, err)
+	return cert
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"github.com/tidwall/redcon"
+	bitcask_redis "kv-go/bitcask/redis"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ZADD key score member [score member ...]
+func zadd(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return nil, newWrongNumberOfArgsError("zadd")
+	}
+
+	//先校验所有的分数,避免写入一部分之后失败
+	scores := make([]float64, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		score, err := parseScore(args[i])
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+	var count = 0
+	for i, score := range scores {
+		ok, err := cli.db.ZAdd(args[0], score, args[2*i+2])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			count++
+		}
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+func zscore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("zscore")
+	}
+
+	score, err := cli.db.ZScore(args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return formatScore(score), nil
+}
+
+func zcard(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, newWrongNumberOfArgsError("zcard")
+	}
+
+	size, err := cli.db.ZCard(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(size), nil
+}
+
+func zincrby(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("zincrby")
+	}
+
+	incr, err := parseScore(args[1])
+	if err != nil {
+		return nil, err
+	}
+	score, err := cli.db.ZIncrBy(args[0], incr, args[2])
+	if err != nil {
+		return nil, err
+	}
+	return formatScore(score), nil
+}
+
+func zrem(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, newWrongNumberOfArgsError("zrem")
+	}
+
+	count, err := cli.db.ZRem(args[0], args[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+// ZRANGE key start stop [WITHSCORES]
+func zrange(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zrangeGeneric(cli, args, "zrange", false)
+}
+
+// ZREVRANGE key start stop [WITHSCORES]
+func zrevrange(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zrangeGeneric(cli, args, "zrevrange", true)
+}
+
+func zrangeGeneric(cli *BitcaskClient, args [][]byte, name string, reverse bool) (interface{}, error) {
+	if len(args) != 3 && len(args) != 4 {
+		return nil, newWrongNumberOfArgsError(name)
+	}
+
+	start, stop, err := parseRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	var withScores bool
+	if len(args) == 4 {
+		if strings.ToLower(string(args[3])) != "withscores" {
+			return nil, errSyntax
+		}
+		withScores = true
+	}
+	members, err := cli.db.ZRange(args[0], start, stop, reverse)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(members, withScores), nil
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func zrangebyscore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zrangeByScoreGeneric(cli, args, "zrangebyscore", false)
+}
+
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func zrevrangebyscore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zrangeByScoreGeneric(cli, args, "zrevrangebyscore", true)
+}
+
+func zrangeByScoreGeneric(cli *BitcaskClient, args [][]byte, name string, reverse bool) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumberOfArgsError(name)
+	}
+
+	minArg, maxArg := args[1], args[2]
+	if reverse {
+		minArg, maxArg = maxArg, minArg
+	}
+	r, err := parseScoreRange(minArg, maxArg)
+	if err != nil {
+		return nil, err
+	}
+	withScores, offset, count, err := parseRangeOptions(args[3:], true)
+	if err != nil {
+		return nil, err
+	}
+	members, err := cli.db.ZRangeByScore(args[0], r, reverse, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(members, withScores), nil
+}
+
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func zrangebylex(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zrangeByLexGeneric(cli, args, "zrangebylex", false)
+}
+
+// ZREVRANGEBYLEX key max min [LIMIT offset count]
+func zrevrangebylex(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zrangeByLexGeneric(cli, args, "zrevrangebylex", true)
+}
+
+func zrangeByLexGeneric(cli *BitcaskClient, args [][]byte, name string, reverse bool) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, newWrongNumberOfArgsError(name)
+	}
+
+	minArg, maxArg := args[1], args[2]
+	if reverse {
+		minArg, maxArg = maxArg, minArg
+	}
+	r, err := parseLexRange(minArg, maxArg)
+	if err != nil {
+		return nil, err
+	}
+	_, offset, count, err := parseRangeOptions(args[3:], false)
+	if err != nil {
+		return nil, err
+	}
+	members, err := cli.db.ZRangeByLex(args[0], r, reverse, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(members, false), nil
+}
+
+func zrank(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("zrank")
+	}
+	return zrankGeneric(cli, args, false)
+}
+
+func zrevrank(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, newWrongNumberOfArgsError("zrevrank")
+	}
+	return zrankGeneric(cli, args, true)
+}
+
+func zrankGeneric(cli *BitcaskClient, args [][]byte, reverse bool) (interface{}, error) {
+	rank, ok, err := cli.db.ZRank(args[0], args[1], reverse)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return redcon.SimpleInt(rank), nil
+}
+
+func zcount(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("zcount")
+	}
+
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	count, err := cli.db.ZCount(args[0], r)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+// ZPOPMIN key [count]
+func zpopmin(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zpopGeneric(cli, args, "zpopmin", false)
+}
+
+// ZPOPMAX key [count]
+func zpopmax(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	return zpopGeneric(cli, args, "zpopmax", true)
+}
+
+func zpopGeneric(cli *BitcaskClient, args [][]byte, name string, max bool) (interface{}, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, newWrongNumberOfArgsError(name)
+	}
+
+	var count = 1
+	if len(args) == 2 {
+		var err error
+		if count, err = strconv.Atoi(string(args[1])); err != nil {
+			return nil, errNotInteger
+		}
+	}
+	var members []bitcask_redis.ZSetMember
+	var err error
+	if max {
+		members, err = cli.db.ZPopMax(args[0], count)
+	} else {
+		members, err = cli.db.ZPopMin(args[0], count)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return zsetReply(members, true), nil
+}
+
+func zremrangebyscore(cli *BitcaskClient, args [][]byte) (interface{}, error) {
+	if len(args) != 3 {
+		return nil, newWrongNumberOfArgsError("zremrangebyscore")
+	}
+
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return nil, err
+	}
+	count, err := cli.db.ZRemRangeByScore(args[0], r)
+	if err != nil {
+		return nil, err
+	}
+	return redcon.SimpleInt(count), nil
+}
+
+// 解析分数,支持 inf/+inf/-inf
+func parseScore(arg []byte) (float64, error) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, errNotFloat
+	}
+	return score, nil
+}
+
+// 解析分数的范围,( 开头表示不包含边界
+func parseScoreRange(minArg, maxArg []byte) (bitcask_redis.ScoreRange, error) {
+	var r bitcask_redis.ScoreRange
+	var err error
+	if bytes.HasPrefix(minArg, []byte("(")) {
+		r.MinExclusive = true
+		minArg = minArg[1:]
+	}
+	if bytes.HasPrefix(maxArg, []byte("(")) {
+		r.MaxExclusive = true
+		maxArg = maxArg[1:]
+	}
+	if r.Min, err = parseScore(minArg); err != nil {
+		return r, errMinMaxNotFloat
+	}
+	if r.Max, err = parseScore(maxArg); err != nil {
+		return r, errMinMaxNotFloat
+	}
+	return r, nil
+}
+
+// 解析字典序的范围,- 和 + 表示没有边界,[ 表示包含边界,( 表示不包含边界
+func parseLexRange(minArg, maxArg []byte) (bitcask_redis.LexRange, error) {
+	var r bitcask_redis.LexRange
+	var err error
+	if r.Min, r.MinExclusive, r.MinUnbounded, err = parseLexBound(minArg, '-'); err != nil {
+		return r, err
+	}
+	if r.Max, r.MaxExclusive, r.MaxUnbounded, err = parseLexBound(maxArg, '+'); err != nil {
+		return r, err
+	}
+	//- 作为上界或者 + 作为下界时范围为空
+	if (len(minArg) == 1 && minArg[0] == '+') || (len(maxArg) == 1 && maxArg[0] == '-') {
+		r.MinUnbounded, r.MaxUnbounded = false, false
+		r.Min, r.Max = []byte{1}, []byte{0}
+	}
+	return r, nil
+}
+
+func parseLexBound(arg []byte, unbounded byte) ([]byte, bool, bool, error) {
+	if len(arg) == 0 {
+		return nil, false, false, errInvalidLexRange
+	}
+	switch arg[0] {
+	case '-', '+':
+		if len(arg) != 1 {
+			return nil, false, false, errInvalidLexRange
+		}
+		return nil, false, arg[0] == unbounded, nil
+	case '[':
+		return arg[1:], false, false, nil
+	case '(':
+		return arg[1:], true, false, nil
+	default:
+		return nil, false, false, errInvalidLexRange
+	}
+}
+
+// 解析 [WITHSCORES] [LIMIT offset count]
+func parseRangeOptions(args [][]byte, allowWithScores bool) (bool, int64, int64, error) {
+	var withScores bool
+	var offset, count int64 = 0, -1
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "withscores":
+			if !allowWithScores {
+				return false, 0, 0, errSyntax
+			}
+			withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return false, 0, 0, errSyntax
+			}
+			var err error
+			if offset, err = strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return false, 0, 0, errNotInteger
+			}
+			if count, err = strconv.ParseInt(string(args[i+2]), 10, 64); err != nil {
+				return false, 0, 0, errNotInteger
+			}
+			if offset < 0 {
+				//偏移量为负数时返回空结果
+				count = 0
+			}
+			i += 2
+		default:
+			return false, 0, 0, errSyntax
+		}
+	}
+	return withScores, offset, count, nil
+}
+
+func zsetReply(members []bitcask_redis.ZSetMember, withScores bool) []interface{} {
+	res := make([]interface{}, 0, len(members)*2)
+	for _, m := range members {
+		res = append(res, m.Member)
+		if withScores {
+			res = append(res, formatScore(m.Score))
+		}
+	}
+	return res
+}
+
+// 按照 redis 的格式输出分数
+func formatScore(score float64) string {
+	if math.IsInf(score, 1) {
+		return "inf"
+	}
+	if math.IsInf(score, -1) {
+		return "-inf"
+	}
+	return strconv.FormatFloat(score, 'f', -1, 64)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestBitcaskServer_ZSet(t *testing.T) {
+	svr, addr := startTestServer(t)
+	defer os.RemoveAll(svr.config.options.DirPath)
+	cli := newTestClient(t, addr)
+	defer cli.close()
+
+	res, err := cli.do("ZADD", "z1", "1", "a", "2.5", "b", "-3", "c", "+inf", "d")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), res)
+	res, err = cli.do("ZADD", "z1", "2", "a", "nan", "e")
+	assert.NotNil(t, err)
+	res, err = cli.do("ZSCORE", "z1", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "1", res)
+	res, err = cli.do("ZCARD", "z1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), res)
+	res, err = cli.do("ZINCRBY", "z1", "1.5", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "2.5", res)
+
+	res, err = cli.do("ZRANGE", "z1", "0", "-1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"c", "a", "b", "d"}, res)
+	res, err = cli.do("ZREVRANGE", "z1", "0", "1", "WITHSCORES")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"d", "inf", "b", "2.5"}, res)
+	res, err = cli.do("ZRANGEBYSCORE", "z1", "(-3", "+inf", "LIMIT", "1", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "d"}, res)
+	res, err = cli.do("ZREVRANGEBYSCORE", "z1", "2.5", "-inf", "WITHSCORES")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "2.5", "a", "2.5", "c", "-3"}, res)
+	res, err = cli.do("ZCOUNT", "z1", "(2.5", "inf")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	_, err = cli.do("ZCOUNT", "z1", "x", "1")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("ZRANK", "z1", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), res)
+	res, err = cli.do("ZREVRANK", "z1", "b")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("ZRANK", "z1", "x")
+	assert.Nil(t, err)
+	assert.Nil(t, res)
+
+	res, err = cli.do("ZADD", "z2", "0", "a", "0", "b", "0", "c")
+	assert.Nil(t, err)
+	res, err = cli.do("ZRANGEBYLEX", "z2", "(a", "+")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "c"}, res)
+	res, err = cli.do("ZREVRANGEBYLEX", "z2", "[b", "-")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"b", "a"}, res)
+	_, err = cli.do("ZRANGEBYLEX", "z2", "a", "+")
+	assert.NotNil(t, err)
+
+	res, err = cli.do("ZPOPMIN", "z1")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"c", "-3"}, res)
+	res, err = cli.do("ZPOPMAX", "z1", "2")
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"d", "inf", "b", "2.5"}, res)
+	res, err = cli.do("ZREMRANGEBYSCORE", "z2", "-inf", "+inf")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), res)
+	res, err = cli.do("ZREM", "z1", "a", "x")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), res)
+	res, err = cli.do("ZCARD", "z1")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+}
@@ -0,0 +1,259 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"kv-go/bitcask"
+	"time"
+)
+
+// GCOptions 后台清理的配置项
+type GCOptions struct {
+	//每一轮清理之间的间隔
+	Interval time.Duration
+
+	//每次检查是否过期的 key 的数量,过期的比例超过 1/4 时在同一轮中继续检查
+	ExpireSamples int
+
+	//每一轮检查的数据部分的 key 的数量
+	ScanSize int
+
+	//每个批次删除的 key 的数量
+	BatchSize int
+
+	//判断 key 是否过期使用的当前时间,为空时使用本地时间
+	Now func() time.Time
+}
+
+// 每一轮都需要遍历索引,所以间隔比 redis 的主动过期更长,每次检查更多的 key
+var DefaultGCOptions = GCOptions{
+	Interval:      time.Second,
+	ExpireSamples: 100,
+	ScanSize:      5000,
+	BatchSize:     1000,
+}
+
+// 一轮中最多连续检查过期 key 的次数,避免长时间占用锁
+const maxExpireRounds = 16
+
+type gcWorker struct {
+	options GCOptions
+	stop    chan struct{}
+	done    chan struct{}
+
+	expireCursor []byte //下一个检查是否过期的元数据 key,为空时从头开始
+	orphanCursor []byte //下一个检查的数据部分的 key,为空时从头开始
+}
+
+// StartGC 启动后台清理:
+// 1. 像 redis 的主动过期一样依次抽样检查 key,删除已经过期的 key
+// 2. 遍历数据部分的 key,删除 key 被删除、覆盖或者过期之后遗留下来的旧版本数据
+// 删除之后的数据由 Merge 回收磁盘空间,Close 时会停止清理
+func (rds *RedisDataStructure) StartGC(options GCOptions) {
+	if rds.gc != nil {
+		return
+	}
+	rds.gc = &gcWorker{
+		options: options,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go rds.runGC()
+}
+
+func (rds *RedisDataStructure) stopGC() {
+	if rds.gc == nil {
+		return
+	}
+	close(rds.gc.stop)
+	<-rds.gc.done
+	rds.gc = nil
+}
+
+func (rds *RedisDataStructure) runGC() {
+	defer close(rds.gc.done)
+	if rds.gc.options.Now != nil {
+		rds = rds.WithClock(rds.gc.options.Now)
+	}
+	ticker := time.NewTicker(rds.gc.options.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rds.gc.stop:
+			return
+		case <-ticker.C:
+		}
+		//出错时上报给存储引擎,在下一轮重试
+		for i := 0; i < maxExpireRounds; i++ {
+			checked, expired, err := rds.deleteExpired()
+			if err != nil {
+				rds.engine.ReportBackgroundError(err)
+				break
+			}
+			if expired*4 <= checked {
+				break
+			}
+		}
+		if _, err := rds.deleteOrphans(); err != nil {
+			rds.engine.ReportBackgroundError(err)
+		}
+	}
+}
+
+// 从上次的位置开始检查一批 key,删除其中已经过期的 key,返回检查和删除的数量
+// 遍历时不加锁以免阻塞其他命令,删除之前再加锁重新检查
+func (rds *RedisDataStructure) deleteExpired() (int, int, error) {
+	var checked = 0
+	var candidates [][]byte
+	var next []byte
+	prefix := []byte{metaKeyMark}
+	err := rds.prefixScan(prefix, rds.gc.expireCursor, false, func(metaKey, encValue []byte) bool {
+		if checked == rds.gc.options.ExpireSamples {
+			next = bytes.Clone(metaKey)
+			return false
+		}
+		checked++
+		if rds.isExpired(decodeExpire(encValue)) {
+			candidates = append(candidates, bytes.Clone(metaKey))
+		}
+		return true
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	var expired = 0
+	for _, metaKey := range candidates {
+		deleted, err := rds.deleteIfExpired(metaKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		if deleted {
+			expired++
+		}
+	}
+	rds.gc.expireCursor = next
+	return checked, expired, nil
+}
+
+// 遍历之后 key 可能被重新写入或者修改了过期时间,检查和删除之间 key 不能被修改
+func (rds *RedisDataStructure) deleteIfExpired(metaKey []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	encValue, err := rds.db.Get(metaKey)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !rds.isExpired(decodeExpire(encValue)) {
+		return false, nil
+	}
+	return true, rds.db.Delete(metaKey)
+}
+
+// 同一个 key 的同一个版本的数据部分
+type orphanGroup struct {
+	key     []byte
+	version int64
+	subKeys [][]byte
+}
+
+// 从上次的位置开始检查一批数据部分的 key,删除不属于 key 当前版本的数据,返回删除的数量
+// 遍历时不加锁,删除之前加锁重新检查: MOVE 会保留原来的版本号,
+// key 被移走之后又被移回来时,遍历时失效的版本会再次生效
+func (rds *RedisDataStructure) deleteOrphans() (int, error) {
+	var checked = 0
+	var groups []*orphanGroup
+	var next []byte
+
+	//同一个 key 的数据是连续的,只需要在 key 或者版本变化时重新判断
+	var lastPrefix []byte
+	var last *orphanGroup
+	var err error
+	prefix := []byte{dataKeyMark}
+	scanErr := rds.prefixScan(prefix, rds.gc.orphanCursor, false, func(subKey, value []byte) bool {
+		if checked == rds.gc.options.ScanSize {
+			next = bytes.Clone(subKey)
+			return false
+		}
+		checked++
+		key, version, ok := decodeSubKey(subKey)
+		if !ok {
+			return true
+		}
+		if lastPrefix == nil || !bytes.HasPrefix(subKey, lastPrefix) {
+			lastPrefix = subKeyPrefix(key, version)
+			last = nil
+			var orphan bool
+			if orphan, err = rds.isOrphanVersion(key, version); err != nil {
+				return false
+			}
+			if orphan {
+				last = &orphanGroup{key: bytes.Clone(key), version: version}
+				groups = append(groups, last)
+			}
+		}
+		if last != nil {
+			last.subKeys = append(last.subKeys, bytes.Clone(subKey))
+		}
+		return true
+	})
+	if scanErr != nil {
+		return 0, scanErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	var orphans [][]byte
+	for _, group := range groups {
+		orphan, err := rds.isOrphanVersion(group.key, group.version)
+		if err != nil {
+			return 0, err
+		}
+		if orphan {
+			orphans = append(orphans, group.subKeys...)
+		}
+	}
+	if err := rds.deleteInBatches(orphans, rds.gc.options.BatchSize); err != nil {
+		return 0, err
+	}
+	rds.gc.orphanCursor = next
+	return len(orphans), nil
+}
+
+// key 不存在、已经过期、变成了字符串或者版本不一致时,对应版本的数据已经失效
+func (rds *RedisDataStructure) isOrphanVersion(key []byte, version int64) (bool, error) {
+	encValue, err := rds.getEncoded(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if encValue[0] == String {
+		return true, nil
+	}
+	return decodeMetadata(encValue).version != version, nil
+}
+
+// 按照 BatchSize 分批删除存储引擎中的 key
+func (rds *RedisDataStructure) deleteInBatches(encKeys [][]byte, batchSize int) error {
+	for len(encKeys) > 0 {
+		n := min(len(encKeys), batchSize)
+		wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+		for _, encKey := range encKeys[:n] {
+			if err := wb.Delete(encKey); err != nil {
+				return err
+			}
+		}
+		if err := wb.Commit(); err != nil {
+			return err
+		}
+		encKeys = encKeys[n:]
+	}
+	return nil
+}
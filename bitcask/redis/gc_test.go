@@ -0,0 +1,224 @@
+package redis
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"os"
+	"testing"
+	"time"
+)
+
+// 统计存储引擎中元数据 key 或者数据部分的 key 的数量
+func countEncodedKeys(t *testing.T, rds *RedisDataStructure, mark byte) int {
+	var count = 0
+	err := rds.prefixFold([]byte{mark}, func(encKey, value []byte) bool {
+		count++
+		return true
+	})
+	assert.Nil(t, err)
+	return count
+}
+
+func TestRedisDataStructure_DeleteOrphans(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-gc-orphans")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+	gcOpts := DefaultGCOptions
+	gcOpts.ScanSize = 3
+	gcOpts.BatchSize = 2
+	//不启动后台的清理,直接调用每一轮的清理
+	rds.gc = &gcWorker{options: gcOpts}
+	defer func() { rds.gc = nil }()
+
+	// 删除、覆盖和过期之后遗留的数据
+	_, err = rds.HMSet([]byte("h"), []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"), []byte("f3"), []byte("v3"))
+	assert.Nil(t, err)
+	err = rds.Del([]byte("h"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("s"), []byte("m"))
+	assert.Nil(t, err)
+	err = rds.Set([]byte("s"), []byte("v"), 0)
+	assert.Nil(t, err)
+	_, err = rds.RPush([]byte("l"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = rds.Expire([]byte("l"), time.Millisecond)
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("h"), 1, []byte("m"))
+	assert.Nil(t, err)
+	_, err = rds.HSet([]byte("live"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 9, countEncodedKeys(t, rds, dataKeyMark))
+
+	var deleted = 0
+	for {
+		n, err := rds.deleteOrphans()
+		assert.Nil(t, err)
+		deleted += n
+		if rds.gc.orphanCursor == nil {
+			break
+		}
+	}
+	assert.Equal(t, 6, deleted)
+	assert.Equal(t, 3, countEncodedKeys(t, rds, dataKeyMark))
+
+	// 当前版本的数据不受影响
+	score, err := rds.ZScore([]byte("h"), []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1), score)
+	val, err := rds.HGet([]byte("live"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
+
+func TestRedisDataStructure_DeleteOrphans_MovedBack(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-gc-moved")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+	opts.DirPath = dir + "-other"
+	other, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(opts.DirPath)
+	defer other.Close()
+	rds.gc = &gcWorker{options: DefaultGCOptions}
+	defer func() { rds.gc = nil }()
+
+	// 移走之后原来的数据部分失效
+	_, err = rds.HSet([]byte("h"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	ok, err := rds.Move([]byte("h"), other)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 清理在遍历之后、删除之前等待锁的时候,key 带着相同的版本号被移了回来
+	rds.mu.Lock()
+	result := make(chan int, 1)
+	go func() {
+		n, err := rds.deleteOrphans()
+		assert.Nil(t, err)
+		result <- n
+	}()
+	time.Sleep(50 * time.Millisecond)
+	encValue, err := other.getEncoded([]byte("h"))
+	assert.Nil(t, err)
+	assert.Nil(t, rds.db.Put(encodeMetaKey([]byte("h")), encValue))
+	rds.mu.Unlock()
+	assert.Equal(t, 0, <-result)
+
+	val, err := rds.HGet([]byte("h"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+}
+
+func TestRedisDataStructure_DeleteExpired(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-gc-expired")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+	gcOpts := DefaultGCOptions
+	gcOpts.ExpireSamples = 20
+	rds.gc = &gcWorker{options: gcOpts}
+	defer func() { rds.gc = nil }()
+
+	for i := 0; i < 50; i++ {
+		var ttl time.Duration
+		if i%2 == 0 {
+			ttl = time.Millisecond
+		}
+		err := rds.Set([]byte(fmt.Sprintf("key-%02d", i)), []byte("v"), ttl)
+		assert.Nil(t, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	checked, expired, err := rds.deleteExpired()
+	assert.Nil(t, err)
+	assert.Equal(t, 20, checked)
+	assert.Equal(t, 10, expired)
+	assert.NotNil(t, rds.gc.expireCursor)
+	for rds.gc.expireCursor != nil {
+		_, _, err := rds.deleteExpired()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 25, countEncodedKeys(t, rds, metaKeyMark))
+	size, err := rds.DBSize()
+	assert.Nil(t, err)
+	assert.Equal(t, 25, size)
+}
+
+func TestRedisDataStructure_DeleteExpired_Unlocked(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-gc-unlocked")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+	rds.gc = &gcWorker{options: DefaultGCOptions}
+	defer func() { rds.gc = nil }()
+
+	// 没有过期的 key 时遍历不需要等待锁
+	err = rds.Set([]byte("k"), []byte("v"), 0)
+	assert.Nil(t, err)
+	rds.mu.Lock()
+	checked, expired, err := rds.deleteExpired()
+	rds.mu.Unlock()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, checked)
+	assert.Equal(t, 0, expired)
+
+	// 遍历之后、删除之前重新写入的 key 不会被删除
+	err = rds.Set([]byte("k"), []byte("v"), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	rds.mu.Lock()
+	result := make(chan int, 1)
+	go func() {
+		_, expired, err := rds.deleteExpired()
+		assert.Nil(t, err)
+		result <- expired
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, rds.db.Put(encodeMetaKey([]byte("k")), encodeString([]byte("v2"), 0)))
+	rds.mu.Unlock()
+	assert.Equal(t, 0, <-result)
+	val, err := rds.Get([]byte("k"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v2"), val)
+}
+
+func TestRedisDataStructure_StartGC(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-gc")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	gcOpts := DefaultGCOptions
+	gcOpts.Interval = 10 * time.Millisecond
+	rds.StartGC(gcOpts)
+
+	for i := 0; i < 10; i++ {
+		_, err := rds.SAdd([]byte("s"), []byte(fmt.Sprintf("m%d", i)))
+		assert.Nil(t, err)
+	}
+	_, err = rds.Expire([]byte("s"), 20*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool {
+		return countEncodedKeys(t, rds, metaKeyMark) == 0 && countEncodedKeys(t, rds, dataKeyMark) == 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, rds.Close())
+}
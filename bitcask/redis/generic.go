@@ -1,15 +1,49 @@
 package redis
 
-import "errors"
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"kv-go/bitcask"
+	"kv-go/bitcask/utils"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// NoExpiration key 没有设置过期时间时 TTL 的返回值
+const NoExpiration time.Duration = -1
 
 func (rds *RedisDataStructure) Del(key []byte) error {
 
-	return rds.db.Delete(key)
+	return rds.db.Delete(encodeMetaKey(key))
+
+}
+
+// DelKeys 删除多个 key,返回实际删除的数量
+func (rds *RedisDataStructure) DelKeys(keys ...[]byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 
+	var count = 0
+	for _, key := range keys {
+		exist, err := rds.keyExists(key)
+		if err != nil {
+			return 0, err
+		}
+		if !exist {
+			continue
+		}
+		if err := rds.Del(key); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, nil
 }
 
 func (rds *RedisDataStructure) Type(key []byte) (RedisDataType, error) {
-	encValue, err := rds.db.Get(key)
+	encValue, err := rds.getEncoded(key)
 	if err != nil {
 		return 0, err
 	}
@@ -20,3 +54,390 @@ func (rds *RedisDataStructure) Type(key []byte) (RedisDataType, error) {
 	//第一个字节就是类型+
 	return encValue[0], nil
 }
+
+// Exists 返回存在的 key 的数量,重复的 key 会被计算多次
+func (rds *RedisDataStructure) Exists(keys ...[]byte) (int, error) {
+	var count = 0
+	for _, key := range keys {
+		exist, err := rds.keyExists(key)
+		if err != nil {
+			return 0, err
+		}
+		if exist {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Expire 设置 key 在 ttl 之后过期,ttl 小于等于 0 时直接删除 key
+func (rds *RedisDataStructure) Expire(key []byte, ttl time.Duration) (bool, error) {
+	return rds.ExpireAt(key, rds.Now().Add(ttl))
+}
+
+// ExpireAt 设置 key 在指定的时间点过期,时间点已经过去时直接删除 key,key 不存在时返回 false
+func (rds *RedisDataStructure) ExpireAt(key []byte, at time.Time) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	encValue, err := rds.getEncoded(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !at.After(rds.Now()) {
+		return true, rds.Del(key)
+	}
+	return true, rds.db.Put(encodeMetaKey(key), replaceExpire(encValue, at.UnixNano()))
+}
+
+// TTL 返回 key 的剩余存活时间,没有设置过期时间时返回 NoExpiration,key 不存在时返回 ErrKeyNotFound
+func (rds *RedisDataStructure) TTL(key []byte) (time.Duration, error) {
+	encValue, err := rds.getEncoded(key)
+	if err != nil {
+		return 0, err
+	}
+	expire := decodeExpire(encValue)
+	if expire == 0 {
+		return NoExpiration, nil
+	}
+	return time.Unix(0, expire).Sub(rds.Now()), nil
+}
+
+// Persist 移除 key 的过期时间,key 不存在或者没有过期时间时返回 false
+func (rds *RedisDataStructure) Persist(key []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	encValue, err := rds.getEncoded(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if decodeExpire(encValue) == 0 {
+		return false, nil
+	}
+	return true, rds.db.Put(encodeMetaKey(key), replaceExpire(encValue, 0))
+}
+
+// Keys 返回所有匹配 pattern 的 key
+func (rds *RedisDataStructure) Keys(pattern string) ([][]byte, error) {
+	var keys [][]byte
+	err := rds.keyFold(func(key, encValue []byte) bool {
+		if utils.GlobMatch([]byte(pattern), key) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Scan 按游标遍历 key,dataType 不为空时只返回对应类型的 key,返回下一次遍历的游标,为 0 表示遍历结束
+func (rds *RedisDataStructure) Scan(cursor uint64, pattern string, count int, dataType ...RedisDataType) (uint64, [][]byte, error) {
+	sc, err := rds.newScanCursor(nil, cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	var keys [][]byte
+	prefix := []byte{metaKeyMark}
+	err = rds.prefixScan(prefix, sc.seekKey(prefix), false, func(metaKey, encValue []byte) bool {
+		key := metaKey[len(prefix):]
+		match, next := sc.visit(key, key)
+		if match && !rds.isExpired(decodeExpire(encValue)) &&
+			(len(dataType) == 0 || bytes.IndexByte(dataType, encValue[0]) >= 0) {
+			keys = append(keys, key)
+		}
+		return next
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return rds.finishScan(sc), keys, nil
+}
+
+// Rename 将 key 重命名为 newKey,newKey 已经存在时会被覆盖
+func (rds *RedisDataStructure) Rename(key, newKey []byte) error {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	encValue, err := rds.getEncoded(key)
+	if err != nil {
+		return err
+	}
+	return rds.rename(key, newKey, encValue)
+}
+
+// RenameNX 只在 newKey 不存在时将 key 重命名为 newKey
+func (rds *RedisDataStructure) RenameNX(key, newKey []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	encValue, err := rds.getEncoded(key)
+	if err != nil {
+		return false, err
+	}
+	exist, err := rds.keyExists(newKey)
+	if err != nil || exist {
+		return false, err
+	}
+	if err := rds.rename(key, newKey, encValue); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DBSize 返回没有过期的 key 的数量
+func (rds *RedisDataStructure) DBSize() (int, error) {
+	var size = 0
+	err := rds.keyFold(func(key, encValue []byte) bool {
+		size++
+		return true
+	})
+	return size, err
+}
+
+// KeyspaceStat 返回没有过期的 key 的数量以及其中设置了过期时间的 key 的数量
+func (rds *RedisDataStructure) KeyspaceStat() (int, int, error) {
+	var keys, expires int
+	err := rds.keyFold(func(key, encValue []byte) bool {
+		keys++
+		if decodeExpire(encValue) != 0 {
+			expires++
+		}
+		return true
+	})
+	return keys, expires, err
+}
+
+// RandomKey 随机返回一个 key,没有 key 时返回 ErrKeyNotFound
+func (rds *RedisDataStructure) RandomKey() ([]byte, error) {
+	size, err := rds.DBSize()
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	var i = rand.Intn(size)
+	var res []byte
+	err = rds.keyFold(func(key, encValue []byte) bool {
+		if i == 0 {
+			res = key
+			return false
+		}
+		i--
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	//两次遍历之间 key 被删除了
+	if res == nil {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	return res, nil
+}
+
+// 同时只执行一个 Move,避免两个数据库之间相互移动 key 时死锁
+var moveMu sync.Mutex
+
+// Move 把 key 连同数据部分移动到另一个数据库,key 不存在或者在 dst 中已经存在时返回 false
+func (rds *RedisDataStructure) Move(key []byte, dst *RedisDataStructure) (bool, error) {
+	if rds == dst {
+		return false, ErrSameObject
+	}
+	moveMu.Lock()
+	defer moveMu.Unlock()
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	dst.mu.Lock()
+	defer dst.mu.Unlock()
+
+	encValue, err := rds.getEncoded(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	exist, err := dst.keyExists(key)
+	if err != nil || exist {
+		return false, err
+	}
+
+	//数据部分的 key 中的版本号不变,直接写入 dst
+	var subKeys, values [][]byte
+	if encValue[0] != String {
+		prefix := subKeyPrefix(key, decodeMetadata(encValue).version)
+		err := rds.prefixFold(prefix, func(subKey, value []byte) bool {
+			subKeys = append(subKeys, bytes.Clone(subKey))
+			values = append(values, bytes.Clone(value))
+			return true
+		})
+		if err != nil {
+			return false, err
+		}
+	}
+	wbOpts := bitcask.DefaultWriteBatchOptions
+	wbOpts.MaxBatchNum = max(wbOpts.MaxBatchNum, uint(len(subKeys)+1))
+	wb := dst.db.NewWriteBatch(wbOpts)
+	for i, subKey := range subKeys {
+		if err := wb.Put(subKey, values[i]); err != nil {
+			return false, err
+		}
+	}
+	if err := wb.Put(encodeMetaKey(key), encValue); err != nil {
+		return false, err
+	}
+	if err := wb.Commit(); err != nil {
+		return false, err
+	}
+	//旧的数据部分由后台清理
+	if err := rds.Del(key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// FlushDB 删除所有的 key 以及它们的数据部分
+func (rds *RedisDataStructure) FlushDB() error {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	var encKeys [][]byte
+	err := rds.prefixFold(nil, func(encKey, value []byte) bool {
+		//保留格式版本 key
+		if !bytes.Equal(encKey, formatVersionKey) {
+			encKeys = append(encKeys, bytes.Clone(encKey))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return rds.deleteInBatches(encKeys, int(bitcask.DefaultWriteBatchOptions.MaxBatchNum))
+}
+
+// Backup 备份数据到指定的目录
+func (rds *RedisDataStructure) Backup(dir string) error {
+	return rds.engine.Backup(dir)
+}
+
+// Stat 返回存储引擎的统计信息
+func (rds *RedisDataStructure) Stat() *bitcask.Stat {
+	return rds.engine.Stat()
+}
+
+// CheckReconfigure 检查 Reconfigure 使用的配置项是否合法,不修改配置
+func (rds *RedisDataStructure) CheckReconfigure(options bitcask.Options) error {
+	return rds.engine.CheckReconfigure(options)
+}
+
+// Reconfigure 在运行时修改存储引擎中可以动态调整的配置项
+func (rds *RedisDataStructure) Reconfigure(options bitcask.Options) error {
+	return rds.engine.Reconfigure(options)
+}
+
+// 字符串的数据部分保存在元数据 key 中,其他类型需要把数据部分移动到新的 key 下面
+func (rds *RedisDataStructure) rename(key, newKey, encValue []byte) error {
+	if bytes.Equal(key, newKey) {
+		return nil
+	}
+	var subKeys, values [][]byte
+	var newPrefix []byte
+	var oldPrefixLen int
+	if encValue[0] != String {
+		meta := decodeMetadata(encValue)
+		oldPrefix := subKeyPrefix(key, meta.version)
+		oldPrefixLen = len(oldPrefix)
+		meta.version = time.Now().UnixNano()
+		newPrefix = subKeyPrefix(newKey, meta.version)
+
+		err := rds.prefixFold(oldPrefix, func(subKey, value []byte) bool {
+			subKeys = append(subKeys, bytes.Clone(subKey))
+			values = append(values, bytes.Clone(value))
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		encValue = meta.encode()
+	}
+
+	//每个数据部分的 key 需要写入新的 key 并删除旧的 key
+	wbOpts := bitcask.DefaultWriteBatchOptions
+	wbOpts.MaxBatchNum = max(wbOpts.MaxBatchNum, uint(2*len(subKeys)+2))
+	wb := rds.db.NewWriteBatch(wbOpts)
+	for i, subKey := range subKeys {
+		newSubKey := append(bytes.Clone(newPrefix), subKey[oldPrefixLen:]...)
+		if err := wb.Put(newSubKey, values[i]); err != nil {
+			return err
+		}
+		if err := wb.Delete(subKey); err != nil {
+			return err
+		}
+	}
+	_ = wb.Delete(encodeMetaKey(key))
+	_ = wb.Put(encodeMetaKey(newKey), encValue)
+	return wb.Commit()
+}
+
+// 按顺序遍历所有没有过期的 key
+func (rds *RedisDataStructure) keyFold(fn func(key, encValue []byte) bool) error {
+	prefix := []byte{metaKeyMark}
+	return rds.prefixFold(prefix, func(metaKey, encValue []byte) bool {
+		if rds.isExpired(decodeExpire(encValue)) {
+			return true
+		}
+		return fn(metaKey[len(prefix):], encValue)
+	})
+}
+
+// 读取 key 编码之后的值,key 不存在或者已经过期时返回 ErrKeyNotFound
+func (rds *RedisDataStructure) getEncoded(key []byte) ([]byte, error) {
+	encValue, err := rds.db.Get(encodeMetaKey(key))
+	if err != nil {
+		return nil, err
+	}
+	if rds.isExpired(decodeExpire(encValue)) {
+		return nil, bitcask.ErrKeyNotFound
+	}
+	return encValue, nil
+}
+
+// 判断 key 是否存在并且没有过期,适用于所有的数据类型
+func (rds *RedisDataStructure) keyExists(key []byte) (bool, error) {
+	_, err := rds.getEncoded(key)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// 字符串和其他类型的元数据都以 type + expire 开头
+func decodeExpire(encValue []byte) int64 {
+	expire, _ := binary.Varint(encValue[1:])
+	return expire
+}
+
+// 替换编码之后的值中的过期时间
+func replaceExpire(encValue []byte, expire int64) []byte {
+	_, n := binary.Varint(encValue[1:])
+	buf := make([]byte, 1+binary.MaxVarintLen64+len(encValue)-1-n)
+	buf[0] = encValue[0]
+	var index = 1
+	index += binary.PutVarint(buf[index:], expire)
+	index += copy(buf[index:], encValue[1+n:])
+	return buf[:index]
+}
+
+func (rds *RedisDataStructure) isExpired(expire int64) bool {
+	return expire != 0 && expire <= rds.Now().UnixNano()
+}
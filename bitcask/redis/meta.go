@@ -2,6 +2,8 @@ package redis
 
 import (
 	"encoding/binary"
+	"errors"
+	"kv-go/bitcask"
 	"kv-go/bitcask/utils"
 	"math"
 )
@@ -77,21 +79,84 @@ type hashInternalKey struct {
 
 func (hk *hashInternalKey) encode() []byte {
 
-	buf := make([]byte, len(hk.key)+len(hk.filed)+8)
-	//key
-	var index = 0
-	copy(buf[index:index+len(hk.key)], hk.key)
-	index += len(hk.filed)
-
-	//version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(hk.version))
-	index += 8
+	prefix := subKeyPrefix(hk.key, hk.version)
+	buf := make([]byte, len(prefix)+len(hk.filed))
+	//key + version
+	var index = copy(buf, prefix)
 
 	//field
 	copy(buf[index:], hk.filed)
 	return buf
 }
 
+// 存储引擎中的 key 通过第一个字节分为互不重叠的三类:
+// 元数据 key: metaKeyMark + key,value 为元数据或者字符串
+// 数据 key:   dataKeyMark + len(key) + key + version + ...,保存 hash/set/list/zset 的元素
+// 格式 key:   formatKeyMark,value 为 key 布局的版本
+const (
+	metaKeyMark byte = iota
+	dataKeyMark
+	formatKeyMark
+)
+
+// 当前的 key 布局的版本,布局改变时需要增加
+const formatVersion byte = 1
+
+var formatVersionKey = []byte{formatKeyMark}
+
+// 检查数据目录中 key 的布局,空的目录写入当前的版本,
+// 没有版本 key 的非空目录是旧的布局(用户的 key 直接作为元数据 key)写入的,无法读取
+func checkFormatVersion(db *bitcask.DB) error {
+	val, err := db.Get(formatVersionKey)
+	if err == nil {
+		if len(val) != 1 || val[0] != formatVersion {
+			return ErrIncompatibleFormat
+		}
+		return nil
+	}
+	if !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return err
+	}
+	if db.Stat().KeyNum > 0 {
+		return ErrIncompatibleFormat
+	}
+	return db.Put(formatVersionKey, []byte{formatVersion})
+}
+
+// 用户的 key 在存储引擎中对应的元数据 key
+func encodeMetaKey(key []byte) []byte {
+	buf := make([]byte, 1+len(key))
+	buf[0] = metaKeyMark
+	copy(buf[1:], key)
+	return buf
+}
+
+// 数据部分的 key 的公共前缀: dataKeyMark + len(key) + key + version,用于遍历 key 当前版本下的所有数据
+func subKeyPrefix(key []byte, version int64) []byte {
+	buf := make([]byte, 1+binary.MaxVarintLen32+len(key)+8)
+	buf[0] = dataKeyMark
+	var index = 1
+	index += binary.PutUvarint(buf[index:], uint64(len(key)))
+	index += copy(buf[index:], key)
+	binary.LittleEndian.PutUint64(buf[index:], uint64(version))
+	return buf[:index+8]
+}
+
+// 从数据部分的 key 中解析出所属的 key 和 version
+func decodeSubKey(subKey []byte) ([]byte, int64, bool) {
+	if len(subKey) == 0 || subKey[0] != dataKeyMark {
+		return nil, 0, false
+	}
+	size, n := binary.Uvarint(subKey[1:])
+	if n <= 0 || uint64(len(subKey)-1-n) < size+8 {
+		return nil, 0, false
+	}
+	index := 1 + n
+	key := subKey[index : index+int(size)]
+	version := int64(binary.LittleEndian.Uint64(subKey[index+int(size):]))
+	return key, version, true
+}
+
 type setInternalKey struct {
 	key     []byte
 	version int64
@@ -100,15 +165,10 @@ type setInternalKey struct {
 
 func (sk *setInternalKey) encode() []byte {
 
-	buf := make([]byte, len(sk.key)+len(sk.member)+8+4)
-	//key
-	var index = 0
-	copy(buf[index:index+len(sk.key)], sk.key)
-	index += len(sk.member)
-
-	//version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(sk.version))
-	index += 8
+	prefix := subKeyPrefix(sk.key, sk.version)
+	buf := make([]byte, len(prefix)+len(sk.member)+4)
+	//key + version
+	var index = copy(buf, prefix)
 
 	//field
 	copy(buf[index:index+len(sk.member)], sk.member)
@@ -124,23 +184,26 @@ type listInternalKey struct {
 }
 
 func (lk *listInternalKey) encode() []byte {
-	buf := make([]byte, len(lk.key)+8+8)
+	prefix := subKeyPrefix(lk.key, lk.version)
+	buf := make([]byte, len(prefix)+8)
 
-	//key
-	var index = 0
-	copy(buf[index:index+len(lk.key)], lk.key)
-
-	index += len(lk.key)
-
-	//version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(lk.version))
-	index += 8
+	//key + version
+	var index = copy(buf, prefix)
 	//index
 	binary.LittleEndian.PutUint64(buf[index:index+8], lk.index)
 
 	return buf
 }
 
+// 有序集合的数据部分有两种 key,通过 key + version 之后的一个字节区分:
+// member key: key + version + 'm' + member,value 为分数
+// score key:  key + version + 's' + score + member,value 为空,按分数和 member 的顺序排列
+const (
+	zsetMemberMark byte = 'm'
+	zsetScoreMark  byte = 's'
+	zsetScoreSize       = 8
+)
+
 type zsetInternalKey struct {
 	key     []byte
 	version int64
@@ -150,16 +213,15 @@ type zsetInternalKey struct {
 
 func (zk *zsetInternalKey) encodeWithMember() []byte {
 
-	buf := make([]byte, len(zk.key)+len(zk.member)+8)
+	prefix := subKeyPrefix(zk.key, zk.version)
+	buf := make([]byte, len(prefix)+1+len(zk.member))
 
-	// key
-	var index = 0
-	copy(buf[index:index+len(zk.key)], zk.key)
-	index += len(zk.key)
+	// key + version
+	var index = copy(buf, prefix)
 
-	// version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(zk.version))
-	index += 8
+	// mark
+	buf[index] = zsetMemberMark
+	index++
 
 	// member
 	copy(buf[index:], zk.member)
@@ -169,28 +231,28 @@ func (zk *zsetInternalKey) encodeWithMember() []byte {
 }
 
 func (zk *zsetInternalKey) encodeWithScore() []byte {
-	scoreBuf := utils.Float64ToBytes(zk.score)
-	buf := make([]byte, len(zk.key)+len(zk.member)+len(scoreBuf)+8+4)
-
-	// key
-	var index = 0
-	copy(buf[index:index+len(zk.key)], zk.key)
-	index += len(zk.key)
+	prefix := zsetScorePrefix(zk.key, zk.version)
+	buf := make([]byte, len(prefix)+zsetScoreSize+len(zk.member))
 
-	// version
-	binary.LittleEndian.PutUint64(buf[index:index+8], uint64(zk.version))
-	index += 8
+	// key + version + mark
+	var index = copy(buf, prefix)
 
-	// score
-	copy(buf[index:index+len(scoreBuf)], scoreBuf)
-	index += len(scoreBuf)
+	// score,编码之后的字节序与分数的大小顺序一致
+	index += copy(buf[index:], utils.Float64ToSortableBytes(zk.score))
 
 	// member
-	copy(buf[index:index+len(zk.member)], zk.member)
-	index += len(zk.member)
-
-	// member size
-	binary.LittleEndian.PutUint32(buf[index:], uint32(len(zk.member)))
+	copy(buf[index:], zk.member)
 
 	return buf
 }
+
+// 所有 score key 的公共前缀
+func zsetScorePrefix(key []byte, version int64) []byte {
+	return append(subKeyPrefix(key, version), zsetScoreMark)
+}
+
+// 从 score key 中解析出分数和 member,prefix 为 zsetScorePrefix
+func decodeZSetScoreKey(prefix, scoreKey []byte) (float64, []byte) {
+	scoreBuf := scoreKey[len(prefix) : len(prefix)+zsetScoreSize]
+	return utils.SortableBytesToFloat64(scoreBuf), scoreKey[len(prefix)+zsetScoreSize:]
+}
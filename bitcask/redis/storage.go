@@ -0,0 +1,177 @@
+package redis
+
+import (
+	"kv-go/bitcask"
+	"sync"
+)
+
+// 存储引擎的读写接口,事务中使用先保存在内存中的实现
+type storage interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	NewWriteBatch(opts bitcask.WriteBatchOptions) writeBatch
+	NewIterator(opts bitcask.IteratorOptions) iterator
+}
+
+// 一次最多写入 writes 条数据的批量写入选项,超过默认上限时提高上限,避免大的 key 操作失败
+func writeBatchOptions(writes int) bitcask.WriteBatchOptions {
+	opts := bitcask.DefaultWriteBatchOptions
+	opts.MaxBatchNum = max(opts.MaxBatchNum, uint(writes))
+	return opts
+}
+
+type writeBatch interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	Commit() error
+}
+
+type iterator interface {
+	Rewind()
+	Seek(key []byte)
+	Next()
+	Valid() bool
+	Key() []byte
+	Value() ([]byte, error)
+	Close()
+}
+
+// 直接读写存储引擎,写入之后更新被监视的 key 的修改版本
+type dbStorage struct {
+	db        *bitcask.DB
+	revisions *keyRevisions
+}
+
+func (s *dbStorage) Get(key []byte) ([]byte, error) {
+	return s.db.Get(key)
+}
+
+func (s *dbStorage) Put(key, value []byte) error {
+	if err := s.db.Put(key, value); err != nil {
+		return err
+	}
+	s.revisions.touch(key)
+	return nil
+}
+
+func (s *dbStorage) Delete(key []byte) error {
+	if err := s.db.Delete(key); err != nil {
+		return err
+	}
+	s.revisions.touch(key)
+	return nil
+}
+
+func (s *dbStorage) NewWriteBatch(opts bitcask.WriteBatchOptions) writeBatch {
+	return &dbWriteBatch{wb: s.db.NewWriteBatch(opts), revisions: s.revisions}
+}
+
+func (s *dbStorage) NewIterator(opts bitcask.IteratorOptions) iterator {
+	return s.db.NewIterator(opts)
+}
+
+type dbWriteBatch struct {
+	wb        *bitcask.Writebatch
+	revisions *keyRevisions
+	keys      [][]byte //批次中写入的 key,提交之后更新修改版本
+}
+
+func (b *dbWriteBatch) Put(key, value []byte) error {
+	if err := b.wb.Put(key, value); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+func (b *dbWriteBatch) Delete(key []byte) error {
+	if err := b.wb.Delete(key); err != nil {
+		return err
+	}
+	b.keys = append(b.keys, key)
+	return nil
+}
+
+func (b *dbWriteBatch) Commit() error {
+	if err := b.wb.Commit(); err != nil {
+		return err
+	}
+	for _, key := range b.keys {
+		b.revisions.touch(key)
+	}
+	return nil
+}
+
+// 被监视的 key 的修改版本,只记录正在被 WATCH 的 key
+type keyRevisions struct {
+	mu   sync.Mutex
+	keys map[string]*keyRevision
+}
+
+type keyRevision struct {
+	refs     int    //监视这个 key 的客户端数量
+	revision uint64 //每次修改之后加一
+}
+
+func newKeyRevisions() *keyRevisions {
+	return &keyRevisions{keys: make(map[string]*keyRevision)}
+}
+
+// 存储引擎中的 key 被修改,更新对应的用户的 key 的修改版本
+func (kr *keyRevisions) touch(encKey []byte) {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if len(kr.keys) == 0 {
+		return
+	}
+	var key []byte
+	switch encKey[0] {
+	case metaKeyMark:
+		key = encKey[1:]
+	case dataKeyMark:
+		key, _, _ = decodeSubKey(encKey)
+	}
+	if rev, ok := kr.keys[string(key)]; ok {
+		rev.revision++
+	}
+}
+
+// Watch 开始监视 key 的修改,返回当前的修改版本,不再需要时调用 Unwatch
+func (rds *RedisDataStructure) Watch(key []byte) uint64 {
+	kr := rds.revisions
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	rev, ok := kr.keys[string(key)]
+	if !ok {
+		rev = &keyRevision{}
+		kr.keys[string(key)] = rev
+	}
+	rev.refs++
+	return rev.revision
+}
+
+// Unwatch 停止监视 key 的修改
+func (rds *RedisDataStructure) Unwatch(key []byte) {
+	kr := rds.revisions
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	rev, ok := kr.keys[string(key)]
+	if !ok {
+		return
+	}
+	if rev.refs--; rev.refs == 0 {
+		delete(kr.keys, string(key))
+	}
+}
+
+// Revision 返回被监视的 key 当前的修改版本,与 Watch 时的版本不同说明 key 被修改过
+func (rds *RedisDataStructure) Revision(key []byte) uint64 {
+	kr := rds.revisions
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if rev, ok := kr.keys[string(key)]; ok {
+		return rev.revision
+	}
+	return 0
+}
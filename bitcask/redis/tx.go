@@ -0,0 +1,249 @@
+package redis
+
+import (
+	"bytes"
+	"kv-go/bitcask"
+	"sort"
+	"sync"
+)
+
+// Multi 在一个事务中执行 fn,fn 中通过 tx 进行的写入先保存在内存中,并且可以被之后的读取看到
+// fn 正常返回之后所有的写入通过一个 Writebatch 原子地提交,返回错误时丢弃所有的写入
+// 事务执行期间其他的写操作会被阻塞
+func (rds *RedisDataStructure) Multi(fn func(tx *RedisDataStructure) error) error {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	txStore := &txStorage{base: rds.db, pending: make(map[string]*txWrite)}
+	var pushedKeys [][]byte
+	tx := &RedisDataStructure{
+		db:        txStore,
+		engine:    rds.engine,
+		mu:        new(sync.Mutex),
+		revisions: rds.revisions,
+		cursors:   rds.cursors,
+		clock:     rds.clock,
+		//提交之后才唤醒阻塞的客户端
+		listPushHook: func(key []byte) {
+			pushedKeys = append(pushedKeys, key)
+		},
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := txStore.commit(); err != nil {
+		return err
+	}
+	for _, key := range pushedKeys {
+		rds.notifyListPush(key)
+	}
+	return nil
+}
+
+type txWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// 事务中的读写,写入保存在 pending 中,读取时优先读取 pending
+type txStorage struct {
+	base    storage
+	pending map[string]*txWrite
+}
+
+func (s *txStorage) Get(key []byte) ([]byte, error) {
+	if w, ok := s.pending[string(key)]; ok {
+		if w.deleted {
+			return nil, bitcask.ErrKeyNotFound
+		}
+		return w.value, nil
+	}
+	return s.base.Get(key)
+}
+
+func (s *txStorage) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	s.pending[string(key)] = &txWrite{value: value}
+	return nil
+}
+
+func (s *txStorage) Delete(key []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	s.pending[string(key)] = &txWrite{deleted: true}
+	return nil
+}
+
+// 事务中的批次提交时写入到事务的 pending 中
+func (s *txStorage) NewWriteBatch(opts bitcask.WriteBatchOptions) writeBatch {
+	return &txWriteBatch{tx: s, pending: make(map[string]*txWrite)}
+}
+
+func (s *txStorage) NewIterator(opts bitcask.IteratorOptions) iterator {
+	var keys [][]byte
+	for key := range s.pending {
+		if bytes.HasPrefix([]byte(key), opts.Prefix) {
+			keys = append(keys, []byte(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if opts.Reverse {
+			return bytes.Compare(keys[i], keys[j]) > 0
+		}
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	return &txIterator{
+		base:    s.base.NewIterator(opts),
+		tx:      s,
+		keys:    keys,
+		reverse: opts.Reverse,
+	}
+}
+
+// 通过一个 Writebatch 提交事务中所有的写入
+func (s *txStorage) commit() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(s.pending))
+	for key := range s.pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	opts := bitcask.DefaultWriteBatchOptions
+	opts.MaxBatchNum = max(opts.MaxBatchNum, uint(len(keys)))
+	wb := s.base.NewWriteBatch(opts)
+	for _, key := range keys {
+		var err error
+		if w := s.pending[key]; w.deleted {
+			err = wb.Delete([]byte(key))
+		} else {
+			err = wb.Put([]byte(key), w.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return wb.Commit()
+}
+
+type txWriteBatch struct {
+	tx      *txStorage
+	pending map[string]*txWrite
+}
+
+func (b *txWriteBatch) Put(key, value []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	b.pending[string(key)] = &txWrite{value: value}
+	return nil
+}
+
+func (b *txWriteBatch) Delete(key []byte) error {
+	if len(key) == 0 {
+		return bitcask.ErrKeyIsEmpty
+	}
+	b.pending[string(key)] = &txWrite{deleted: true}
+	return nil
+}
+
+func (b *txWriteBatch) Commit() error {
+	for key, w := range b.pending {
+		b.tx.pending[key] = w
+	}
+	return nil
+}
+
+// 合并存储引擎中的数据和事务中没有提交的数据,相同的 key 以事务中的为准
+type txIterator struct {
+	base    iterator
+	tx      *txStorage
+	keys    [][]byte //事务中写入的 key,按照遍历的顺序排列
+	idx     int
+	reverse bool
+}
+
+func (it *txIterator) Rewind() {
+	it.base.Rewind()
+	it.idx = 0
+	it.skip()
+}
+
+func (it *txIterator) Seek(key []byte) {
+	it.base.Seek(key)
+	it.idx = sort.Search(len(it.keys), func(i int) bool {
+		if it.reverse {
+			return bytes.Compare(it.keys[i], key) <= 0
+		}
+		return bytes.Compare(it.keys[i], key) >= 0
+	})
+	it.skip()
+}
+
+func (it *txIterator) Next() {
+	if it.fromPending() {
+		it.idx++
+	} else {
+		it.base.Next()
+	}
+	it.skip()
+}
+
+func (it *txIterator) Valid() bool {
+	return it.base.Valid() || it.idx < len(it.keys)
+}
+
+func (it *txIterator) Key() []byte {
+	if it.fromPending() {
+		return it.keys[it.idx]
+	}
+	return it.base.Key()
+}
+
+func (it *txIterator) Value() ([]byte, error) {
+	if it.fromPending() {
+		return it.tx.pending[string(it.keys[it.idx])].value, nil
+	}
+	return it.base.Value()
+}
+
+func (it *txIterator) Close() {
+	it.base.Close()
+}
+
+// 当前位置是否是事务中写入的 key
+func (it *txIterator) fromPending() bool {
+	if it.idx >= len(it.keys) {
+		return false
+	}
+	if !it.base.Valid() {
+		return true
+	}
+	cmp := bytes.Compare(it.keys[it.idx], it.base.Key())
+	if it.reverse {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// 跳过事务中删除的 key,以及存储引擎中被事务覆盖的 key
+func (it *txIterator) skip() {
+	for {
+		for it.base.Valid() {
+			if _, ok := it.tx.pending[string(it.base.Key())]; !ok {
+				break
+			}
+			it.base.Next()
+		}
+		if it.idx < len(it.keys) && it.tx.pending[string(it.keys[it.idx])].deleted {
+			it.idx++
+			continue
+		}
+		return
+	}
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"os"
+	"testing"
+)
+
+func TestRedisDataStructure_Multi(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-multi")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	_, err = rds.HMSet([]byte("h"), []byte("f1"), []byte("v1"), []byte("f3"), []byte("v3"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("z"), 1, []byte("a"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("z"), 3, []byte("c"))
+	assert.Nil(t, err)
+
+	err = rds.Multi(func(tx *RedisDataStructure) error {
+		_, err := tx.HSet([]byte("h"), []byte("f2"), []byte("v2"))
+		assert.Nil(t, err)
+		_, err = tx.HDel([]byte("h"), []byte("f3"))
+		assert.Nil(t, err)
+		// 事务中的读取可以看到没有提交的写入,合并存储引擎中的数据
+		values, err := tx.HGetAll([]byte("h"))
+		assert.Nil(t, err)
+		assert.Equal(t, [][]byte{[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")}, values)
+
+		_, err = tx.ZAdd([]byte("z"), 2, []byte("b"))
+		assert.Nil(t, err)
+		res, err := tx.ZRange([]byte("z"), 0, -1, true)
+		assert.Nil(t, err)
+		assert.Equal(t, []ZSetMember{{Member: []byte("c"), Score: 3}, {Member: []byte("b"), Score: 2},
+			{Member: []byte("a"), Score: 1}}, res)
+
+		n, err := tx.IncrBy([]byte("counter"), 5)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(5), n)
+
+		// 提交之前事务之外看不到写入
+		_, err = rds.Get([]byte("counter"))
+		assert.Equal(t, bitcask.ErrKeyNotFound, err)
+		return nil
+	})
+	assert.Nil(t, err)
+
+	values, err := rds.HGetAll([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")}, values)
+	size, err := rds.ZCard([]byte("z"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+	val, err := rds.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("5"), val)
+
+	// 返回错误时丢弃所有的写入
+	errAbort := errors.New("abort")
+	err = rds.Multi(func(tx *RedisDataStructure) error {
+		_, err := tx.IncrBy([]byte("counter"), 1)
+		assert.Nil(t, err)
+		err = tx.Del([]byte("h"))
+		assert.Nil(t, err)
+		return errAbort
+	})
+	assert.Equal(t, errAbort, err)
+	val, err = rds.Get([]byte("counter"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("5"), val)
+	n, err := rds.HLen([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), n)
+}
+
+func TestRedisDataStructure_Watch(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-watch")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	rev := rds.Watch([]byte("h"))
+	rds.Watch([]byte("h"))
+	err = rds.Set([]byte("other"), []byte("v"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, rev, rds.Revision([]byte("h")))
+
+	// 修改数据部分和元数据都会更新修改版本
+	_, err = rds.HSet([]byte("h"), []byte("f"), []byte("v1"))
+	assert.Nil(t, err)
+	rev2 := rds.Revision([]byte("h"))
+	assert.NotEqual(t, rev, rev2)
+	_, err = rds.HSet([]byte("h"), []byte("f"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.NotEqual(t, rev2, rds.Revision([]byte("h")))
+	rev3 := rds.Revision([]byte("h"))
+	err = rds.Multi(func(tx *RedisDataStructure) error {
+		return tx.Del([]byte("h"))
+	})
+	assert.Nil(t, err)
+	assert.NotEqual(t, rev3, rds.Revision([]byte("h")))
+
+	rds.Unwatch([]byte("h"))
+	assert.Equal(t, 1, len(rds.revisions.keys))
+	rds.Unwatch([]byte("h"))
+	assert.Equal(t, 0, len(rds.revisions.keys))
+}
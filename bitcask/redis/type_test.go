@@ -1,10 +1,14 @@
 package redis
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"kv-go/bitcask"
 	"kv-go/bitcask/utils"
+	"math"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -124,6 +128,161 @@ func TestRedisDataStructure_HDel(t *testing.T) {
 	assert.True(t, del2)
 }
 
+func TestRedisDataStructure_HMSet_HGetAll(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hmset")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	n, err := rds.HMSet(key, []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"), []byte("f1"), []byte("v3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	n, err = rds.HMSet(key, []byte("f2"), []byte("v4"), []byte("f3"), []byte("v5"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	_, err = rds.HMSet(key, []byte("f1"))
+	assert.Equal(t, ErrInvalidArgs, err)
+
+	// 前缀相同的其他 key 不会被遍历到
+	_, err = rds.HSet([]byte(string(key)+"-other"), []byte("f1"), []byte("other"))
+	assert.Nil(t, err)
+
+	size, err := rds.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+
+	all, err := rds.HGetAll(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("f1"), []byte("v3"), []byte("f2"), []byte("v4"), []byte("f3"), []byte("v5")}, all)
+	keys, err := rds.HKeys(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("f1"), []byte("f2"), []byte("f3")}, keys)
+	vals, err := rds.HVals(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("v3"), []byte("v4"), []byte("v5")}, vals)
+
+	values, err := rds.HMGet(key, []byte("f1"), []byte("not-exist"), []byte("f3"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("v3"), nil, []byte("v5")}, values)
+
+	// 删除之后元数据中的数量同步更新
+	ok, err := rds.HDel(key, []byte("f2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	size, err = rds.HLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), size)
+	exist, err := rds.HExists(key, []byte("f2"))
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	exist, err = rds.HExists(key, []byte("f1"))
+	assert.Nil(t, err)
+	assert.True(t, exist)
+
+	err = rds.Set(utils.GetTestKey(2), []byte("str"), 0)
+	assert.Nil(t, err)
+	_, err = rds.HGetAll(utils.GetTestKey(2))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestRedisDataStructure_HMSet_Large(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hmset-large")
+	opts.DirPath = dir
+	opts.BytesPerSync = 0
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// field 的数量超过了默认的批量写入上限
+	const size = 15000
+	fieldValues := make([][]byte, 0, size*2)
+	for i := 0; i < size; i++ {
+		fieldValues = append(fieldValues, []byte("f"+strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	added, err := rds.HMSet([]byte("h"), fieldValues...)
+	assert.Nil(t, err)
+	assert.Equal(t, size, added)
+	n, err := rds.HLen([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(size), n)
+}
+
+func TestRedisDataStructure_HIncrBy_HSetNX(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hincrby")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	res, err := rds.HIncrBy(key, []byte("count"), 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(10), res)
+	res, err = rds.HIncrBy(key, []byte("count"), -3)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), res)
+
+	f, err := rds.HIncrByFloat(key, []byte("count"), 0.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 7.5, f)
+	_, err = rds.HIncrBy(key, []byte("count"), 1)
+	assert.Equal(t, ErrHashValueNotInteger, err)
+
+	_, err = rds.HSet(key, []byte("max"), []byte("9223372036854775807"))
+	assert.Nil(t, err)
+	_, err = rds.HIncrBy(key, []byte("max"), 1)
+	assert.Equal(t, ErrIncrOverflow, err)
+
+	ok, err := rds.HSetNX(key, []byte("count"), []byte("1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.HSetNX(key, []byte("new"), []byte("1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestRedisDataStructure_HScan(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-hscan")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	for i := 0; i < 25; i++ {
+		_, err := rds.HSet(key, []byte(fmt.Sprintf("field-%02d", i)), []byte("v"))
+		assert.Nil(t, err)
+	}
+
+	var cursor uint64
+	var fields int
+	for {
+		next, values, err := rds.HScan(key, cursor, "", 10)
+		assert.Nil(t, err)
+		fields += len(values) / 2
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 25, fields)
+
+	next, values, err := rds.HScan(key, 0, "field-1*", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), next)
+	assert.Equal(t, 20, len(values))
+}
+
 func TestRedisDataStructure_SIsMember(t *testing.T) {
 	opts := bitcask.DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-redis-sismember")
@@ -184,6 +343,192 @@ func TestRedisDataStructure_SRem(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestRedisDataStructure_SMembers_SPop(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-smembers")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	for _, member := range []string{"c", "a", "b", "d"} {
+		_, err := rds.SAdd(key, []byte(member))
+		assert.Nil(t, err)
+	}
+	_, err = rds.SAdd([]byte(string(key)+"-other"), []byte("a"))
+	assert.Nil(t, err)
+
+	members, err := rds.SMembers(key)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b"), []byte("c"), []byte("d")}, members)
+	size, err := rds.SCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), size)
+
+	random, err := rds.SRandMember(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(random))
+	random, err = rds.SRandMember(key, -10)
+	assert.Nil(t, err)
+	assert.Equal(t, 10, len(random))
+
+	popped, err := rds.SPop(key, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(popped))
+	for _, member := range popped {
+		ok, err := rds.SIsMember(key, member)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	size, err = rds.SCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), size)
+
+	popped, err = rds.SPop(key, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(popped))
+	popped, err = rds.SPop(key, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(popped))
+}
+
+func TestRedisDataStructure_SetAlgebra(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-set-algebra")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	add := func(key string, members ...string) {
+		for _, member := range members {
+			_, err := rds.SAdd([]byte(key), []byte(member))
+			assert.Nil(t, err)
+		}
+	}
+	toBytes := func(members ...string) [][]byte {
+		res := make([][]byte, 0, len(members))
+		for _, member := range members {
+			res = append(res, []byte(member))
+		}
+		return res
+	}
+	add("s1", "a", "b", "c", "d")
+	add("s2", "c", "d", "e")
+	add("s3", "d", "f")
+
+	res, err := rds.SInter([]byte("s1"), []byte("s2"), []byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("d"), res)
+	res, err = rds.SUnion([]byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "b", "c", "d", "e"), res)
+	res, err = rds.SDiff([]byte("s1"), []byte("s2"), []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "b"), res)
+
+	n, err := rds.SUnionStore([]byte("dst"), []byte("s2"), []byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, n)
+	// 覆盖已经存在的集合
+	n, err = rds.SInterStore([]byte("dst"), []byte("s1"), []byte("s2"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	res, err = rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("c", "d"), res)
+	n, err = rds.SDiffStore([]byte("dst"), []byte("s3"), []byte("s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	res, err = rds.SMembers([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("f"), res)
+
+	ok, err := rds.SMove([]byte("s1"), []byte("s3"), []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.SMove([]byte("s1"), []byte("s3"), []byte("a"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	res, err = rds.SMembers([]byte("s3"))
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "d", "f"), res)
+	size, err := rds.SCard([]byte("s1"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+
+	_, err = rds.HSet([]byte("hash"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	_, err = rds.SUnion([]byte("s1"), []byte("hash"))
+	assert.Equal(t, ErrWrongTypeOperation, err)
+}
+
+func TestRedisDataStructure_LargeSet(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-large-set")
+	opts.DirPath = dir
+	opts.BytesPerSync = 0
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// 元素的数量超过了默认的批量写入上限
+	const size = 15000
+	for i := 0; i < size; i++ {
+		_, err = rds.SAdd([]byte("s"), []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	n, err := rds.SUnionStore([]byte("dst"), []byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, size, n)
+	card, err := rds.SCard([]byte("dst"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(size), card)
+
+	members, err := rds.SPop([]byte("s"), size)
+	assert.Nil(t, err)
+	assert.Equal(t, size, len(members))
+	card, err = rds.SCard([]byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), card)
+}
+
+func TestRedisDataStructure_SScan(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-sscan")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	for i := 0; i < 25; i++ {
+		_, err := rds.SAdd(key, []byte(fmt.Sprintf("member-%02d", i)))
+		assert.Nil(t, err)
+	}
+	var cursor uint64
+	var members int
+	for {
+		next, res, err := rds.SScan(key, cursor, "", 7)
+		assert.Nil(t, err)
+		members += len(res)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 25, members)
+
+	_, res, err := rds.SScan(key, 0, "member-2*", 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(res))
+}
+
 func TestRedisDataStructure_LPop(t *testing.T) {
 	opts := bitcask.DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-redis-lpop")
@@ -240,6 +585,215 @@ func TestRedisDataStructure_RPop(t *testing.T) {
 	assert.NotNil(t, val)
 }
 
+func TestRedisDataStructure_LRange(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-lrange")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	toBytes := func(elements ...string) [][]byte {
+		res := make([][]byte, 0, len(elements))
+		for _, element := range elements {
+			res = append(res, []byte(element))
+		}
+		return res
+	}
+	n, err := rds.RPush(key, toBytes("b", "c", "d")...)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), n)
+	n, err = rds.LPush(key, toBytes("a", "z")...)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(5), n)
+
+	res, err := rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("z", "a", "b", "c", "d"), res)
+	res, err = rds.LRange(key, -2, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("c", "d"), res)
+	res, err = rds.LRange(key, 3, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(res))
+
+	element, err := rds.LIndex(key, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("d"), element)
+	element, err = rds.LIndex(key, 5)
+	assert.Nil(t, err)
+	assert.Nil(t, element)
+
+	err = rds.LSet(key, 0, []byte("y"))
+	assert.Nil(t, err)
+	err = rds.LSet(key, 5, []byte("y"))
+	assert.Equal(t, ErrIndexOutOfRange, err)
+	err = rds.LSet(utils.GetTestKey(2), 0, []byte("y"))
+	assert.Equal(t, ErrNoSuchKey, err)
+
+	err = rds.LTrim(key, 1, -2)
+	assert.Nil(t, err)
+	res, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "b", "c"), res)
+	size, err := rds.LLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+
+	// 弹出的元素被删除,列表为空之后 key 也被删除
+	for i := 0; i < 3; i++ {
+		_, err = rds.RPop(key)
+		assert.Nil(t, err)
+	}
+	_, err = rds.Type(key)
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
+
+func TestRedisDataStructure_LInsert_LRem(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-linsert")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	toBytes := func(elements ...string) [][]byte {
+		res := make([][]byte, 0, len(elements))
+		for _, element := range elements {
+			res = append(res, []byte(element))
+		}
+		return res
+	}
+	_, err = rds.RPush(key, toBytes("a", "x", "b", "x", "c", "x")...)
+	assert.Nil(t, err)
+
+	// 靠近头部的插入移动前半部分,靠近尾部的插入移动后半部分
+	n, err := rds.LInsert(key, true, []byte("b"), []byte("1"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), n)
+	n, err = rds.LInsert(key, false, []byte("c"), []byte("2"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(8), n)
+	n, err = rds.LInsert(key, false, []byte("a"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), n)
+	n, err = rds.LInsert(key, false, []byte("not-exist"), []byte("3"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-1), n)
+	res, err := rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "3", "x", "1", "b", "x", "c", "2", "x"), res)
+
+	removed, err := rds.LRem(key, -2, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, removed)
+	res, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "3", "x", "1", "b", "c", "2"), res)
+	removed, err = rds.LRem(key, 0, []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	res, err = rds.LRange(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, toBytes("a", "3", "1", "b", "c", "2"), res)
+	size, err := rds.LLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(6), size)
+}
+
+func TestRedisDataStructure_LargeList(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-large-list")
+	opts.DirPath = dir
+	//大量写入时不需要每次都持久化
+	opts.BytesPerSync = 0
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// 元素的数量超过了默认的批量写入上限
+	const size = 25000
+	elements := make([][]byte, size)
+	for i := range elements {
+		elements[i] = []byte(strconv.Itoa(i))
+	}
+	n, err := rds.RPush([]byte("l"), elements...)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(size), n)
+
+	// 在中间插入需要移动一半的元素
+	length, err := rds.LInsert([]byte("l"), true, []byte(strconv.Itoa(size/2)), []byte("x"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(size+1), length)
+	val, err := rds.LIndex([]byte("l"), size/2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("x"), val)
+
+	// 删除第一个元素需要移动其他所有的元素
+	removed, err := rds.LRem([]byte("l"), 0, []byte("0"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, removed)
+	val, err = rds.LIndex([]byte("l"), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("1"), val)
+
+	err = rds.LTrim([]byte("l"), 0, 9)
+	assert.Nil(t, err)
+	n, err = rds.LLen([]byte("l"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(10), n)
+	res, err := rds.LRange([]byte("l"), -1, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("10")}, res)
+}
+
+func TestRedisDataStructure_LMove(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-lmove")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	src, dst := []byte("src"), []byte("dst")
+	_, err = rds.RPush(src, []byte("a"), []byte("b"), []byte("c"))
+	assert.Nil(t, err)
+
+	element, err := rds.RPopLPush(src, dst)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), element)
+	element, err = rds.LMove(src, dst, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("a"), element)
+	res, err := rds.LRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("c"), []byte("a")}, res)
+
+	// 同一个列表中的轮转
+	element, err = rds.LMove(dst, dst, true, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("c"), element)
+	res, err = rds.LRange(dst, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("c")}, res)
+
+	element, err = rds.LMove(src, dst, true, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("b"), element)
+	element, err = rds.LMove(src, dst, true, true)
+	assert.Nil(t, err)
+	assert.Nil(t, element)
+	size, err := rds.LLen(dst)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(3), size)
+}
+
 func TestRedisDataStructure_ZScore(t *testing.T) {
 	opts := bitcask.DefaultOptions
 	dir, _ := os.MkdirTemp("", "bitcask-go-redis-zset")
@@ -264,3 +818,784 @@ func TestRedisDataStructure_ZScore(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, float64(98), score)
 }
+
+func TestRedisDataStructure_ZRange(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-zrange")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	scores := map[string]float64{"a": 1, "b": 2.5, "c": -3, "d": 2.5, "e": 100, "f": math.Inf(1)}
+	for member, score := range scores {
+		_, err := rds.ZAdd(key, score, []byte(member))
+		assert.Nil(t, err)
+	}
+	// 其他集合的元素不会被遍历到
+	_, err = rds.ZAdd([]byte(string(key)+"-other"), 0, []byte("x"))
+	assert.Nil(t, err)
+	members := func(res []ZSetMember) []string {
+		var s []string
+		for _, m := range res {
+			s = append(s, string(m.Member))
+		}
+		return s
+	}
+
+	res, err := rds.ZRange(key, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"c", "a", "b", "d", "e", "f"}, members(res))
+	assert.Equal(t, float64(-3), res[0].Score)
+	res, err = rds.ZRange(key, 0, 1, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"f", "e"}, members(res))
+
+	res, err = rds.ZRangeByScore(key, ScoreRange{Min: 1, Max: 100, MaxExclusive: true}, false, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "d"}, members(res))
+	res, err = rds.ZRangeByScore(key, ScoreRange{Min: 1, Max: 100, MinExclusive: true}, true, 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d", "b"}, members(res))
+	res, err = rds.ZRangeByScore(key, ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, false, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(res))
+
+	count, err := rds.ZCount(key, ScoreRange{Min: 2.5, Max: 2.5})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+
+	rank, ok, err := rds.ZRank(key, []byte("b"), false)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(2), rank)
+	rank, ok, err = rds.ZRank(key, []byte("b"), true)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, int64(3), rank)
+	_, ok, err = rds.ZRank(key, []byte("x"), false)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestRedisDataStructure_ZRangeByLex(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-zrangebylex")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	for _, member := range []string{"d", "a", "c", "b", "ab"} {
+		_, err := rds.ZAdd(key, 0, []byte(member))
+		assert.Nil(t, err)
+	}
+	members := func(res []ZSetMember) []string {
+		var s []string
+		for _, m := range res {
+			s = append(s, string(m.Member))
+		}
+		return s
+	}
+	res, err := rds.ZRangeByLex(key, LexRange{MinUnbounded: true, MaxUnbounded: true}, false, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "ab", "b", "c", "d"}, members(res))
+	res, err = rds.ZRangeByLex(key, LexRange{Min: []byte("ab"), Max: []byte("c"), MaxExclusive: true}, false, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ab", "b"}, members(res))
+	res, err = rds.ZRangeByLex(key, LexRange{Min: []byte("a"), MinExclusive: true, MaxUnbounded: true}, true, 0, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"d", "c"}, members(res))
+}
+
+func TestRedisDataStructure_ZRem_ZPop(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-zrem")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	for i := 0; i < 10; i++ {
+		_, err := rds.ZAdd(key, float64(i), []byte(fmt.Sprintf("m%d", i)))
+		assert.Nil(t, err)
+	}
+
+	score, err := rds.ZIncrBy(key, 10, []byte("m0"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(10), score)
+	score, err = rds.ZIncrBy(key, -1, []byte("new"))
+	assert.Nil(t, err)
+	assert.Equal(t, float64(-1), score)
+
+	n, err := rds.ZRem(key, []byte("new"), []byte("m1"), []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	popped, err := rds.ZPopMin(key, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZSetMember{{Member: []byte("m2"), Score: 2}, {Member: []byte("m3"), Score: 3}}, popped)
+	popped, err = rds.ZPopMax(key, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZSetMember{{Member: []byte("m0"), Score: 10}}, popped)
+
+	n, err = rds.ZRemRangeByScore(key, ScoreRange{Min: 5, Max: 7, MaxExclusive: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+	res, err := rds.ZRange(key, 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZSetMember{{Member: []byte("m4"), Score: 4}, {Member: []byte("m7"), Score: 7},
+		{Member: []byte("m8"), Score: 8}, {Member: []byte("m9"), Score: 9}}, res)
+	size, err := rds.ZCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(4), size)
+
+	// 集合为空之后 key 被删除
+	_, err = rds.ZPopMax(key, 10)
+	assert.Nil(t, err)
+	_, err = rds.ZScore(key, []byte("m4"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	_, err = rds.Type(key)
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
+
+func TestRedisDataStructure_LargeZSet(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-large-zset")
+	opts.DirPath = dir
+	opts.BytesPerSync = 0
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// 每个元素删除两个 key,一半的元素就超过了默认的批量写入上限
+	const size = 15000
+	for i := 0; i < size; i++ {
+		_, err = rds.ZAdd([]byte("z"), float64(i), []byte(strconv.Itoa(i)))
+		assert.Nil(t, err)
+	}
+	popped, err := rds.ZPopMin([]byte("z"), 6000)
+	assert.Nil(t, err)
+	assert.Equal(t, 6000, len(popped))
+	removed, err := rds.ZRemRangeByScore([]byte("z"), ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)})
+	assert.Nil(t, err)
+	assert.Equal(t, size-6000, removed)
+	card, err := rds.ZCard([]byte("z"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), card)
+}
+
+func TestRedisDataStructure_SetWithOptions(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-set-options")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	_, ok, err := rds.SetWithOptions(key, []byte("v1"), SetOptions{XX: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.SetNX(key, []byte("v1"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = rds.SetNX(key, []byte("v2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	old, ok, err := rds.SetWithOptions(key, []byte("v2"), SetOptions{TTL: time.Hour, Get: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("v1"), old)
+	// KEEPTTL 保留过期时间, 再次普通写入会清除过期时间
+	_, _, err = rds.SetWithOptions(key, []byte("v3"), SetOptions{KeepTTL: true})
+	assert.Nil(t, err)
+	_, expire, err := rds.getString(key)
+	assert.Nil(t, err)
+	assert.True(t, expire > time.Now().UnixNano())
+	old, err = rds.GetSet(key, []byte("v4"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v3"), old)
+	_, expire, err = rds.getString(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), expire)
+
+	// 过期的 key 不存在
+	err = rds.Set(key, []byte("v5"), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = rds.Get(key)
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	ok, err = rds.SetNX(key, []byte("v6"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// 其他类型的 key 会被覆盖, 需要返回旧值时报错
+	_, err = rds.HSet(utils.GetTestKey(2), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	_, _, err = rds.SetWithOptions(utils.GetTestKey(2), []byte("v"), SetOptions{Get: true})
+	assert.Equal(t, ErrWrongTypeOperation, err)
+	_, ok, err = rds.SetWithOptions(utils.GetTestKey(2), []byte("v"), SetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	val, err := rds.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+
+	val, err = rds.GetEx(key, time.Hour, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v6"), val)
+	val, err = rds.GetDel(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v6"), val)
+	_, err = rds.GetDel(key)
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
+
+func TestRedisDataStructure_MSet(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-mset")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	err = rds.MSet([]byte("k1"), []byte("v1"), []byte("k2"), []byte("v2"))
+	assert.Nil(t, err)
+	err = rds.MSet([]byte("k1"))
+	assert.Equal(t, ErrInvalidArgs, err)
+	ok, err := rds.MSetNX([]byte("k3"), []byte("v3"), []byte("k1"), []byte("x"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.SAdd([]byte("s"), []byte("m"))
+	assert.Nil(t, err)
+
+	values, err := rds.MGet([]byte("k1"), []byte("k2"), []byte("k3"), []byte("s"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("v1"), []byte("v2"), nil, nil}, values)
+	ok, err = rds.MSetNX([]byte("k3"), []byte("v3"), []byte("k4"), []byte("v4"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestRedisDataStructure_MSet_Large(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-mset-large")
+	opts.DirPath = dir
+	opts.BytesPerSync = 0
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// key 的数量超过了默认的批量写入上限
+	const size = 15000
+	keyValues := make([][]byte, 0, size*2)
+	for i := 0; i < size; i++ {
+		keyValues = append(keyValues, []byte("k"+strconv.Itoa(i)), []byte(strconv.Itoa(i)))
+	}
+	err = rds.MSet(keyValues...)
+	assert.Nil(t, err)
+	val, err := rds.Get([]byte("k" + strconv.Itoa(size-1)))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(strconv.Itoa(size-1)), val)
+	ok, err := rds.MSetNX(keyValues...)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestRedisDataStructure_IncrBy(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-incrby")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	// 并发自增不会丢失更新
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, err := rds.IncrBy(key, 1)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	res, err := rds.IncrBy(key, -500)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), res)
+
+	err = rds.Set(key, []byte(strconv.FormatInt(math.MaxInt64, 10)), 0)
+	assert.Nil(t, err)
+	_, err = rds.IncrBy(key, 1)
+	assert.Equal(t, ErrIncrOverflow, err)
+	err = rds.Set(key, []byte("abc"), 0)
+	assert.Nil(t, err)
+	_, err = rds.IncrBy(key, 1)
+	assert.Equal(t, ErrValueNotInteger, err)
+	_, err = rds.IncrByFloat(key, 1)
+	assert.Equal(t, ErrValueNotFloat, err)
+
+	// 自增保留过期时间
+	err = rds.Set(key, []byte("10.5"), time.Hour)
+	assert.Nil(t, err)
+	f, err := rds.IncrByFloat(key, 0.1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.6, f)
+	_, expire, err := rds.getString(key)
+	assert.Nil(t, err)
+	assert.NotEqual(t, int64(0), expire)
+}
+
+func TestRedisDataStructure_StringRange(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-string-range")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	key := utils.GetTestKey(1)
+	n, err := rds.Append(key, []byte("Hello"))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, n)
+	n, err = rds.Append(key, []byte(" World"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = rds.StrLen(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	n, err = rds.StrLen(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	val, err := rds.GetRange(key, 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("Hello"), val)
+	val, err = rds.GetRange(key, -5, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("World"), val)
+	val, err = rds.GetRange(key, 20, 30)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{}, val)
+
+	n, err = rds.SetRange(key, 6, []byte("Redis"))
+	assert.Nil(t, err)
+	assert.Equal(t, 11, n)
+	val, err = rds.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("Hello Redis"), val)
+
+	n, err = rds.SetRange(utils.GetTestKey(2), 3, []byte("abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, n)
+	val, err = rds.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("\x00\x00\x00abc"), val)
+	_, err = rds.SetRange(key, -1, []byte("a"))
+	assert.Equal(t, ErrOffsetOutOfRange, err)
+	n, err = rds.SetRange(utils.GetTestKey(3), 10, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+	_, err = rds.Get(utils.GetTestKey(3))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
+
+func TestRedisDataStructure_Expire(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-expire")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	ok, err := rds.Expire([]byte("not-exist"), time.Hour)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.TTL([]byte("not-exist"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	err = rds.Set([]byte("str"), []byte("v"), 0)
+	assert.Nil(t, err)
+	_, err = rds.HSet([]byte("hash"), []byte("f"), []byte("v"))
+	assert.Nil(t, err)
+	for _, key := range []string{"str", "hash"} {
+		ttl, err := rds.TTL([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, NoExpiration, ttl)
+
+		ok, err = rds.Expire([]byte(key), time.Hour)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ttl, err = rds.TTL([]byte(key))
+		assert.Nil(t, err)
+		assert.True(t, ttl > 59*time.Minute && ttl <= time.Hour)
+
+		ok, err = rds.Persist([]byte(key))
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = rds.Persist([]byte(key))
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+	// 设置过期时间不影响数据
+	val, err := rds.Get([]byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+	val, err = rds.HGet([]byte("hash"), []byte("f"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+
+	ok, err = rds.ExpireAt([]byte("hash"), time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	n, err := rds.Exists([]byte("hash"), []byte("str"), []byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, n)
+
+	ok, err = rds.Expire([]byte("str"), time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	time.Sleep(5 * time.Millisecond)
+	_, err = rds.Type([]byte("str"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
+
+func TestRedisDataStructure_KeysScan(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-keys")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// 数据部分的 key 不会出现在结果中
+	err = rds.Set([]byte("user:1"), []byte("v"), 0)
+	assert.Nil(t, err)
+	_, err = rds.HMSet([]byte("user:2"), []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	_, err = rds.SAdd([]byte("user:3"), []byte("m"))
+	assert.Nil(t, err)
+	_, err = rds.RPush([]byte("queue"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("rank"), 1, []byte("m"))
+	assert.Nil(t, err)
+	err = rds.Set([]byte("expired"), []byte("v"), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(5 * time.Millisecond)
+
+	keys, err := rds.Keys("*")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("queue"), []byte("rank"), []byte("user:1"), []byte("user:2"), []byte("user:3")}, keys)
+	keys, err = rds.Keys("user:[12]")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("user:1"), []byte("user:2")}, keys)
+	size, err := rds.DBSize()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, size)
+	_, err = rds.Expire([]byte("queue"), time.Hour)
+	assert.Nil(t, err)
+	keyNum, expires, err := rds.KeyspaceStat()
+	assert.Nil(t, err)
+	assert.Equal(t, 5, keyNum)
+	assert.Equal(t, 1, expires)
+	key, err := rds.RandomKey()
+	assert.Nil(t, err)
+	assert.Contains(t, []string{"queue", "rank", "user:1", "user:2", "user:3"}, string(key))
+
+	var all [][]byte
+	var cursor uint64
+	for {
+		next, res, err := rds.Scan(cursor, "", 2)
+		assert.Nil(t, err)
+		all = append(all, res...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	assert.Equal(t, 5, len(all))
+	_, res, err := rds.Scan(0, "*", 100, Hash, List)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("queue"), []byte("user:2")}, res)
+}
+
+func TestRedisDataStructure_ScanCursor(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-scan-cursor")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	for i := 0; i < 10; i++ {
+		err := rds.Set([]byte(fmt.Sprintf("key-%d", i)), []byte("v"), 0)
+		assert.Nil(t, err)
+	}
+	next, res, err := rds.Scan(0, "", 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(res))
+	assert.NotEqual(t, uint64(0), next)
+
+	// 游标记录的是下一个 key,删除已经返回的 key 不会导致之后的 key 被跳过
+	for _, key := range res {
+		assert.Nil(t, rds.Del(key))
+	}
+	var rest [][]byte
+	for cursor := next; cursor != 0; {
+		cursor, res, err = rds.Scan(cursor, "", 4)
+		assert.Nil(t, err)
+		rest = append(rest, res...)
+	}
+	assert.Equal(t, 6, len(rest))
+	assert.Equal(t, []byte("key-4"), rest[0])
+
+	// 不存在的游标和属于其他遍历的游标都是无效的
+	_, _, err = rds.Scan(next+100, "", 4)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, err = rds.HMSet([]byte("h"), []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	next, _, err = rds.HScan([]byte("h"), 0, "", 1)
+	assert.Nil(t, err)
+	assert.NotEqual(t, uint64(0), next)
+	_, _, err = rds.Scan(next, "", 4)
+	assert.Equal(t, ErrInvalidCursor, err)
+	_, res, err = rds.HScan([]byte("h"), next, "", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("f2"), []byte("v2")}, res)
+}
+
+func TestRedisDataStructure_Rename(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-rename")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	err = rds.Rename([]byte("not-exist"), []byte("k"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	err = rds.Set([]byte("str"), []byte("v"), time.Hour)
+	assert.Nil(t, err)
+	err = rds.Rename([]byte("str"), []byte("str2"))
+	assert.Nil(t, err)
+	val, err := rds.Get([]byte("str2"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+	ttl, err := rds.TTL([]byte("str2"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	_, err = rds.Get([]byte("str"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	_, err = rds.HMSet([]byte("h"), []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("z"), 1.5, []byte("m"))
+	assert.Nil(t, err)
+	_, err = rds.RPush([]byte("l"), []byte("a"), []byte("b"))
+	assert.Nil(t, err)
+
+	// 覆盖已经存在的其他类型的 key
+	err = rds.Rename([]byte("h"), []byte("str2"))
+	assert.Nil(t, err)
+	values, err := rds.HGetAll([]byte("str2"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")}, values)
+	n, err := rds.HLen([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), n)
+
+	ok, err := rds.RenameNX([]byte("z"), []byte("str2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = rds.RenameNX([]byte("z"), []byte("z2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	score, err := rds.ZScore([]byte("z2"), []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, score)
+	res, err := rds.ZRange([]byte("z2"), 0, -1, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []ZSetMember{{Member: []byte("m"), Score: 1.5}}, res)
+
+	err = rds.Rename([]byte("l"), []byte("l"))
+	assert.Nil(t, err)
+	err = rds.Rename([]byte("l"), []byte("l2"))
+	assert.Nil(t, err)
+	elements, err := rds.LRange([]byte("l2"), 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("a"), []byte("b")}, elements)
+
+	keys, err := rds.Keys("*")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("l2"), []byte("str2"), []byte("z2")}, keys)
+}
+
+func TestRedisDataStructure_Rename_LargeHash(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-rename-large")
+	opts.DirPath = dir
+	//大量写入时不需要每次都持久化
+	opts.BytesPerSync = 0
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+
+	// 每个字段需要一次写入和一次删除,超过了默认的批量写入上限
+	const fields = 6000
+	args := make([][]byte, 0, fields*2)
+	for i := 0; i < fields; i++ {
+		args = append(args, utils.GetTestKey(i), []byte(strconv.Itoa(i)))
+	}
+	_, err = rds.HMSet([]byte("h"), args...)
+	assert.Nil(t, err)
+
+	err = rds.Rename([]byte("h"), []byte("h2"))
+	assert.Nil(t, err)
+	n, err := rds.HLen([]byte("h2"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(fields), n)
+	val, err := rds.HGet([]byte("h2"), utils.GetTestKey(fields-1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte(strconv.Itoa(fields-1)), val)
+	n, err = rds.HLen([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), n)
+}
+
+func TestRedisDataStructure_Move_FlushDB(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-move")
+	opts.DirPath = dir
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	defer rds.Close()
+	dstDir, _ := os.MkdirTemp("", "bitcask-go-redis-move-dst")
+	opts.DirPath = dstDir
+	dst, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	defer os.RemoveAll(dstDir)
+	defer dst.Close()
+
+	ok, err := rds.Move([]byte("not-exist"), dst)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = rds.Move([]byte("k"), rds)
+	assert.Equal(t, ErrSameObject, err)
+
+	err = rds.Set([]byte("str"), []byte("v"), time.Hour)
+	assert.Nil(t, err)
+	_, err = rds.HMSet([]byte("h"), []byte("f1"), []byte("v1"), []byte("f2"), []byte("v2"))
+	assert.Nil(t, err)
+	_, err = rds.ZAdd([]byte("z"), 1.5, []byte("m"))
+	assert.Nil(t, err)
+
+	ok, err = rds.Move([]byte("str"), dst)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	val, err := dst.Get([]byte("str"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("v"), val)
+	ttl, err := dst.TTL([]byte("str"))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	_, err = rds.Get([]byte("str"))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	ok, err = rds.Move([]byte("h"), dst)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	values, err := dst.HGetAll([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("f1"), []byte("v1"), []byte("f2"), []byte("v2")}, values)
+	exist, err := rds.Exists([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, exist)
+
+	// 目标数据库中已经存在时不移动
+	_, err = dst.ZAdd([]byte("z"), 2, []byte("other"))
+	assert.Nil(t, err)
+	ok, err = rds.Move([]byte("z"), dst)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	score, err := rds.ZScore([]byte("z"), []byte("m"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1.5, score)
+
+	err = dst.FlushDB()
+	assert.Nil(t, err)
+	size, err := dst.DBSize()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, size)
+	n, err := dst.HLen([]byte("h"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0), n)
+	size, err = rds.DBSize()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, size)
+}
+
+func TestRedisDataStructure_FormatVersion(t *testing.T) {
+	opts := bitcask.DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-redis-format")
+	opts.DirPath = dir
+	defer os.RemoveAll(dir)
+
+	// FLUSHDB 之后保留格式版本,可以重新打开
+	rds, err := NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	err = rds.Set([]byte("k"), []byte("v"), 0)
+	assert.Nil(t, err)
+	assert.Nil(t, rds.FlushDB())
+	size, err := rds.DBSize()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, size)
+	assert.Nil(t, rds.Close())
+	rds, err = NewRedisDataStructure(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, rds.Close())
+
+	// 旧的布局中用户的 key 直接保存在存储引擎中,没有格式版本 key
+	oldDir, _ := os.MkdirTemp("", "bitcask-go-redis-format-old")
+	opts.DirPath = oldDir
+	defer os.RemoveAll(oldDir)
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Put([]byte("k"), encodeString([]byte("v"), 0)))
+	assert.Nil(t, db.Close())
+	_, err = NewRedisDataStructure(opts)
+	assert.Equal(t, ErrIncompatibleFormat, err)
+
+	// 版本不同的目录同样被拒绝
+	db, err = bitcask.Open(opts)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Delete([]byte("k")))
+	assert.Nil(t, db.Put(formatVersionKey, []byte{formatVersion + 1}))
+	assert.Nil(t, db.Close())
+	_, err = NewRedisDataStructure(opts)
+	assert.Equal(t, ErrIncompatibleFormat, err)
+}
@@ -1,17 +1,44 @@
 package redis
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"kv-go/bitcask"
 	"kv-go/bitcask/utils"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 )
 
 var (
-	ErrWrongTypeOperation = errors.New("wrong type operation")
+	ErrWrongTypeOperation  = errors.New("wrong type operation")
+	ErrHashValueNotInteger = errors.New("ERR hash value is not an integer")
+	ErrHashValueNotFloat   = errors.New("ERR hash value is not a float")
+	ErrIncrOverflow        = errors.New("ERR increment or decrement would overflow")
+	ErrInvalidArgs         = errors.New("ERR invalid arguments")
+	ErrNoSuchKey           = errors.New("ERR no such key")
+	ErrIndexOutOfRange     = errors.New("ERR index out of range")
+	ErrScoreNaN            = errors.New("ERR resulting score is not a number (NaN)")
+	ErrValueNotInteger     = errors.New("ERR value is not an integer or out of range")
+	ErrValueNotFloat       = errors.New("ERR value is not a valid float")
+	ErrIncrNaNOrInf        = errors.New("ERR increment would produce NaN or Infinity")
+	ErrOffsetOutOfRange    = errors.New("ERR offset is out of range")
+	ErrStringTooLong       = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	ErrSameObject          = errors.New("ERR source and destination objects are the same")
+	ErrIncompatibleFormat  = errors.New("the data directory was written with an incompatible key layout")
+	ErrInvalidCursor       = errors.New("ERR invalid cursor")
 )
 
+// SCAN 类命令默认每次遍历的数量
+const defaultScanCount = 10
+
+// 遍历时每次从索引中读取的 key 的数量
+const scanPageSize = 256
+
 type RedisDataType = byte
 
 const (
@@ -24,7 +51,20 @@ const (
 
 // redis数据结构服务
 type RedisDataStructure struct {
-	db *bitcask.DB
+	db     storage     //读写数据,事务中为没有提交的数据
+	engine *bitcask.DB //存储引擎
+	mu     *sync.Mutex //所有的写操作串行执行,避免读改写操作之间以及与后台清理之间的冲突
+
+	//向列表中添加元素之后的回调,用于唤醒阻塞等待的客户端
+	listPushHook func(key []byte)
+
+	gc *gcWorker //后台清理过期 key 和无效数据,没有启动时为空
+
+	revisions *keyRevisions //被 WATCH 的 key 的修改版本
+
+	cursors *scanCursors //SCAN 类命令的游标对应的位置
+
+	clock func() time.Time //判断过期使用的当前时间,为空时使用本地时间
 }
 
 func NewRedisDataStructure(options bitcask.Options) (*RedisDataStructure, error) {
@@ -33,63 +73,412 @@ func NewRedisDataStructure(options bitcask.Options) (*RedisDataStructure, error)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkFormatVersion(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
 
-	return &RedisDataStructure{db: db}, nil
+	revisions := newKeyRevisions()
+	return &RedisDataStructure{
+		db:        &dbStorage{db: db, revisions: revisions},
+		engine:    db,
+		mu:        new(sync.Mutex),
+		revisions: revisions,
+		cursors:   newScanCursors(),
+	}, nil
 }
 func (rds *RedisDataStructure) Close() error {
-	return rds.db.Close()
+	rds.stopGC()
+	return rds.engine.Close()
+}
+
+// WithClock 返回使用 clock 判断过期的视图,与原来的实例共享数据和锁,
+// 集群模式下状态机用 leader 写入日志时的时间执行命令,所有的节点得到相同的结果
+func (rds *RedisDataStructure) WithClock(clock func() time.Time) *RedisDataStructure {
+	view := *rds
+	view.clock = clock
+	return &view
+}
+
+// Now 返回判断过期使用的当前时间
+func (rds *RedisDataStructure) Now() time.Time {
+	if rds.clock != nil {
+		return rds.clock()
+	}
+	return time.Now()
+}
+
+// SetListPushHook 设置列表添加元素之后的回调,需要在使用之前设置
+func (rds *RedisDataStructure) SetListPushHook(fn func(key []byte)) {
+	rds.listPushHook = fn
+}
+
+func (rds *RedisDataStructure) notifyListPush(key []byte) {
+	if rds.listPushHook != nil {
+		rds.listPushHook(key)
+	}
 }
 
 //=============string 数据结构 ==================
 
+// 字符串最大的长度,与 redis 的 proto-max-bulk-len 保持一致
+const maxStringSize = 512 * 1024 * 1024
+
+// SetOptions SET 命令的可选参数
+type SetOptions struct {
+	TTL      time.Duration //大于 0 时设置过期时间
+	ExpireAt time.Time     //不为零值时在这个时间点过期,与 TTL 只能设置一个
+	KeepTTL  bool          //保留原来的过期时间
+	NX       bool          //只在 key 不存在时写入
+	XX       bool          //只在 key 存在时写入
+	Get      bool          //返回旧值,旧值不是字符串时返回 ErrWrongTypeOperation
+}
+
 func (rds *RedisDataStructure) Set(key []byte, value []byte, ttl time.Duration) error {
 
 	if value == nil {
 		return nil
 	}
 
-	//编码value:type +expire + payload
-	//字节切片储存编码之后的数据
-	buf := make([]byte, binary.MaxVarintLen64+1)
-	buf[0] = String
-	var index = 1
-	var expire int64 = 0
-	if ttl != 0 {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	//调用存储引擎接口进行写入
+	return rds.db.Put(encodeMetaKey(key), encodeString(value, rds.expireAt(ttl)))
+}
 
-		expire = time.Now().Add(ttl).UnixNano()
+// SetWithOptions 按照 SET 命令的参数写入,返回旧值以及是否写入成功
+func (rds *RedisDataStructure) SetWithOptions(key, value []byte, opts SetOptions) ([]byte, bool, error) {
+	if opts.NX && opts.XX {
+		return nil, false, ErrInvalidArgs
+	}
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 
+	old, expire, err := rds.getString(key)
+	exist := err == nil
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		//不是字符串类型的 key 同样会被覆盖,除非需要返回旧值
+		if !errors.Is(err, ErrWrongTypeOperation) || opts.Get {
+			return nil, false, err
+		}
+		exist = true
 	}
-	index += binary.PutVarint(buf[index:], expire)
-	encValue := make([]byte, index+len(value))
-	copy(encValue[:index], buf[:index])
-	copy(encValue[index:], value)
-	//调用存储引擎接口进行写入
-	return rds.db.Put(key, encValue)
+	if (opts.NX && exist) || (opts.XX && !exist) {
+		return old, false, nil
+	}
+	if !opts.KeepTTL {
+		expire = rds.expireAt(opts.TTL)
+		if !opts.ExpireAt.IsZero() {
+			expire = opts.ExpireAt.UnixNano()
+		}
+	}
+	if err := rds.db.Put(encodeMetaKey(key), encodeString(value, expire)); err != nil {
+		return nil, false, err
+	}
+	return old, true, nil
+}
+
+// SetNX 只在 key 不存在时写入
+func (rds *RedisDataStructure) SetNX(key, value []byte) (bool, error) {
+	_, ok, err := rds.SetWithOptions(key, value, SetOptions{NX: true})
+	return ok, err
 }
 
 func (rds *RedisDataStructure) Get(key []byte) ([]byte, error) {
-	encValue, err := rds.db.Get(key)
+	value, _, err := rds.getString(key)
+	return value, err
+}
+
+// GetSet 写入新值并返回旧值,key 不存在时旧值为 nil
+func (rds *RedisDataStructure) GetSet(key, value []byte) ([]byte, error) {
+	old, _, err := rds.SetWithOptions(key, value, SetOptions{Get: true})
+	return old, err
+}
+
+// GetDel 返回 key 的值并删除 key
+func (rds *RedisDataStructure) GetDel(key []byte) ([]byte, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	value, _, err := rds.getString(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := rds.db.Delete(encodeMetaKey(key)); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// GetEx 返回 key 的值,ttl 大于 0 时重新设置过期时间,persist 为 true 时移除过期时间
+func (rds *RedisDataStructure) GetEx(key []byte, ttl time.Duration, persist bool) ([]byte, error) {
+	var at time.Time
+	if ttl > 0 {
+		at = rds.Now().Add(ttl)
+	}
+	return rds.getEx(key, at, persist)
+}
+
+// GetExAt 返回 key 的值,并且设置 key 在 at 过期
+func (rds *RedisDataStructure) GetExAt(key []byte, at time.Time) ([]byte, error) {
+	return rds.getEx(key, at, false)
+}
+
+func (rds *RedisDataStructure) getEx(key []byte, at time.Time, persist bool) ([]byte, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	value, expire, err := rds.getString(key)
 	if err != nil {
 		return nil, err
 	}
+	if !at.IsZero() {
+		expire = at.UnixNano()
+	} else if persist {
+		expire = 0
+	} else {
+		return value, nil
+	}
+	if err := rds.db.Put(encodeMetaKey(key), encodeString(value, expire)); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// MSet 原子地写入多个键值对,参数为 key1, value1, key2, value2...
+func (rds *RedisDataStructure) MSet(keyValues ...[]byte) error {
+	if len(keyValues) == 0 || len(keyValues)%2 != 0 {
+		return ErrInvalidArgs
+	}
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	return rds.putStrings(keyValues)
+}
+
+// MSetNX 只在所有的 key 都不存在时写入
+func (rds *RedisDataStructure) MSetNX(keyValues ...[]byte) (bool, error) {
+	if len(keyValues) == 0 || len(keyValues)%2 != 0 {
+		return false, ErrInvalidArgs
+	}
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	for i := 0; i < len(keyValues); i += 2 {
+		exist, err := rds.keyExists(keyValues[i])
+		if err != nil {
+			return false, err
+		}
+		if exist {
+			return false, nil
+		}
+	}
+	if err := rds.putStrings(keyValues); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// MGet 获取多个 key 的值,不存在或者不是字符串的 key 对应的值为 nil
+func (rds *RedisDataStructure) MGet(keys ...[]byte) ([][]byte, error) {
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		value, _, err := rds.getString(key)
+		if err != nil {
+			if errors.Is(err, bitcask.ErrKeyNotFound) || errors.Is(err, ErrWrongTypeOperation) {
+				continue
+			}
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// IncrBy 将 key 的值加上 incr,key 不存在时从 0 开始,过期时间保持不变
+func (rds *RedisDataStructure) IncrBy(key []byte, incr int64) (int64, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	value, expire, err := rds.getString(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	var cur int64
+	if value != nil {
+		if cur, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, ErrValueNotInteger
+		}
+	}
+	if (incr > 0 && cur > math.MaxInt64-incr) || (incr < 0 && cur < math.MinInt64-incr) {
+		return 0, ErrIncrOverflow
+	}
+	cur += incr
+	if err := rds.db.Put(encodeMetaKey(key), encodeString([]byte(strconv.FormatInt(cur, 10)), expire)); err != nil {
+		return 0, err
+	}
+	return cur, nil
+}
+
+// IncrByFloat 将 key 的值加上浮点数 incr,key 不存在时从 0 开始
+func (rds *RedisDataStructure) IncrByFloat(key []byte, incr float64) (float64, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	value, expire, err := rds.getString(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	var cur float64
+	if value != nil {
+		if cur, err = strconv.ParseFloat(string(value), 64); err != nil || math.IsNaN(cur) || math.IsInf(cur, 0) {
+			return 0, ErrValueNotFloat
+		}
+	}
+	cur += incr
+	if math.IsNaN(cur) || math.IsInf(cur, 0) {
+		return 0, ErrIncrNaNOrInf
+	}
+	if err := rds.db.Put(encodeMetaKey(key), encodeString(utils.Float64ToBytes(cur), expire)); err != nil {
+		return 0, err
+	}
+	return cur, nil
+}
+
+// Append 在 key 的值后面追加数据,返回追加之后的长度
+func (rds *RedisDataStructure) Append(key, value []byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	old, expire, err := rds.getString(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	if len(old)+len(value) > maxStringSize {
+		return 0, ErrStringTooLong
+	}
+	newValue := make([]byte, 0, len(old)+len(value))
+	newValue = append(append(newValue, old...), value...)
+	if err := rds.db.Put(encodeMetaKey(key), encodeString(newValue, expire)); err != nil {
+		return 0, err
+	}
+	return len(newValue), nil
+}
+
+// StrLen 返回 key 的值的长度,key 不存在时返回 0
+func (rds *RedisDataStructure) StrLen(key []byte) (int, error) {
+	value, _, err := rds.getString(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+// GetRange 返回下标 [start, end] 之间的子串,支持负数下标
+func (rds *RedisDataStructure) GetRange(key []byte, start, end int64) ([]byte, error) {
+	value, _, err := rds.getString(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return nil, err
+	}
+	start, end, ok := normalizeRange(start, end, int64(len(value)))
+	if !ok {
+		return []byte{}, nil
+	}
+	return value[start : end+1], nil
+}
+
+// SetRange 从 offset 开始覆盖 key 的值,长度不够时用 0 填充,返回修改之后的长度
+func (rds *RedisDataStructure) SetRange(key []byte, offset int64, value []byte) (int, error) {
+	if offset < 0 {
+		return 0, ErrOffsetOutOfRange
+	}
+	if offset+int64(len(value)) > maxStringSize {
+		return 0, ErrStringTooLong
+	}
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+
+	old, expire, err := rds.getString(key)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	//空的值不会创建 key
+	if len(value) == 0 {
+		return len(old), nil
+	}
+	size := len(old)
+	if end := int(offset) + len(value); end > size {
+		size = end
+	}
+	newValue := make([]byte, size)
+	copy(newValue, old)
+	copy(newValue[offset:], value)
+	if err := rds.db.Put(encodeMetaKey(key), encodeString(newValue, expire)); err != nil {
+		return 0, err
+	}
+	return len(newValue), nil
+}
+
+// 读取字符串的值和过期时间,key 不存在或者已经过期时返回 ErrKeyNotFound
+func (rds *RedisDataStructure) getString(key []byte) ([]byte, int64, error) {
+	encValue, err := rds.db.Get(encodeMetaKey(key))
+	if err != nil {
+		return nil, 0, err
+	}
 
 	//解码
 	dateType := encValue[0]
 	if dateType != String {
-		return nil, ErrWrongTypeOperation
+		return nil, 0, ErrWrongTypeOperation
 	}
 	var index = 1
 	expire, n := binary.Varint(encValue[index:])
 	index += n
-	if expire > 0 && expire < time.Now().UnixNano() {
-		return nil, nil
+	if rds.isExpired(expire) {
+		return nil, 0, bitcask.ErrKeyNotFound
+	}
+	return encValue[index:], expire, nil
+}
+
+// 在一个批次中写入多个字符串,参数为 key1, value1, key2, value2...
+func (rds *RedisDataStructure) putStrings(keyValues [][]byte) error {
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(keyValues) / 2))
+	for i := 0; i < len(keyValues); i += 2 {
+		if err := wb.Put(encodeMetaKey(keyValues[i]), encodeString(keyValues[i+1], 0)); err != nil {
+			return err
+		}
+	}
+	return wb.Commit()
+}
+
+// 编码value:type +expire + payload
+func encodeString(value []byte, expire int64) []byte {
+	//字节切片储存编码之后的数据
+	buf := make([]byte, binary.MaxVarintLen64+1)
+	buf[0] = String
+	var index = 1
+	index += binary.PutVarint(buf[index:], expire)
+	encValue := make([]byte, index+len(value))
+	copy(encValue[:index], buf[:index])
+	copy(encValue[index:], value)
+	return encValue
+}
+
+// 根据 ttl 计算过期的时间点,ttl 为 0 时不过期
+func (rds *RedisDataStructure) expireAt(ttl time.Duration) int64 {
+	if ttl <= 0 {
+		return 0
 	}
-	//?
-	return encValue[index:], nil
+	return rds.Now().Add(ttl).UnixNano()
 }
 
 // ===================hash数据结构======================
 func (rds *RedisDataStructure) HSet(key, field, value []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	return rds.hset(key, field, value)
+}
+
+func (rds *RedisDataStructure) hset(key, field, value []byte) (bool, error) {
 	//查找元数据
 	meta, err := rds.findMetadata(key, Hash)
 	if err != nil {
@@ -113,7 +502,7 @@ func (rds *RedisDataStructure) HSet(key, field, value []byte) (bool, error) {
 	if !exist {
 		//这里数据量对应的是key下面的field value数量
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
 	}
 	_ = wb.Put(encKey, value)
 	if err = wb.Commit(); err != nil {
@@ -140,6 +529,8 @@ func (rds *RedisDataStructure) HGet(key, field []byte) ([]byte, error) {
 }
 
 func (rds *RedisDataStructure) HDel(key, field []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 	//找元数据
 	meta, err := rds.findMetadata(key, Hash)
 	if err != nil {
@@ -163,7 +554,7 @@ func (rds *RedisDataStructure) HDel(key, field []byte) (bool, error) {
 	if exist {
 		wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 		meta.size--
-		_ = wb.Put(encKey, meta.encode())
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
 		_ = wb.Delete(encKey)
 
 		if err = wb.Commit(); err != nil {
@@ -172,9 +563,227 @@ func (rds *RedisDataStructure) HDel(key, field []byte) (bool, error) {
 	}
 	return exist, nil
 }
+
+// HMSet 设置多个 field,fieldValues 为 field value 交替排列,返回新增的 field 数量
+func (rds *RedisDataStructure) HMSet(key []byte, fieldValues ...[]byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	if len(fieldValues) == 0 || len(fieldValues)%2 != 0 {
+		return 0, ErrInvalidArgs
+	}
+	meta, err := rds.findMetadata(key, Hash)
+	if err != nil {
+		return 0, err
+	}
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(fieldValues)/2 + 1))
+	//同一个批次中重复的 field 只计算一次
+	added := make(map[string]struct{})
+	for i := 0; i < len(fieldValues); i += 2 {
+		hk := &hashInternalKey{
+			key:     key,
+			version: meta.version,
+			filed:   fieldValues[i],
+		}
+		encKey := hk.encode()
+		_, err := rds.db.Get(encKey)
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return 0, err
+		}
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			added[string(fieldValues[i])] = struct{}{}
+		}
+		_ = wb.Put(encKey, fieldValues[i+1])
+	}
+	if len(added) > 0 {
+		meta.size += uint32(len(added))
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
+	}
+	if err = wb.Commit(); err != nil {
+		return 0, err
+	}
+	return len(added), nil
+}
+
+// HSetNX field 不存在时才设置
+func (rds *RedisDataStructure) HSetNX(key, field, value []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	exist, err := rds.HExists(key, field)
+	if err != nil || exist {
+		return false, err
+	}
+	return rds.hset(key, field, value)
+}
+
+// HMGet 获取多个 field 的值,不存在的 field 对应的值为 nil
+func (rds *RedisDataStructure) HMGet(key []byte, fields ...[]byte) ([][]byte, error) {
+	meta, err := rds.findMetadata(key, Hash)
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, len(fields))
+	if meta.size == 0 {
+		return values, nil
+	}
+	for i, field := range fields {
+		hk := &hashInternalKey{
+			key:     key,
+			version: meta.version,
+			filed:   field,
+		}
+		value, err := rds.db.Get(hk.encode())
+		if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+			return nil, err
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+// HExists field 是否存在
+func (rds *RedisDataStructure) HExists(key, field []byte) (bool, error) {
+	value, err := rds.HGet(key, field)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return value != nil, nil
+}
+
+// HLen field 的数量
+func (rds *RedisDataStructure) HLen(key []byte) (uint32, error) {
+	meta, err := rds.findMetadata(key, Hash)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// HGetAll 返回所有的 field 和 value,按 field value 交替排列
+func (rds *RedisDataStructure) HGetAll(key []byte) ([][]byte, error) {
+	var res [][]byte
+	err := rds.hashFold(key, func(field, value []byte) bool {
+		res = append(res, field, value)
+		return true
+	})
+	return res, err
+}
+
+// HKeys 返回所有的 field
+func (rds *RedisDataStructure) HKeys(key []byte) ([][]byte, error) {
+	var res [][]byte
+	err := rds.hashFold(key, func(field, value []byte) bool {
+		res = append(res, field)
+		return true
+	})
+	return res, err
+}
+
+// HVals 返回所有的 value
+func (rds *RedisDataStructure) HVals(key []byte) ([][]byte, error) {
+	var res [][]byte
+	err := rds.hashFold(key, func(field, value []byte) bool {
+		res = append(res, value)
+		return true
+	})
+	return res, err
+}
+
+// HIncrBy 将 field 的值加上 incr,field 不存在时当作0处理
+func (rds *RedisDataStructure) HIncrBy(key, field []byte, incr int64) (int64, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	value, err := rds.HGet(key, field)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	var num int64
+	if value != nil {
+		if num, err = strconv.ParseInt(string(value), 10, 64); err != nil {
+			return 0, ErrHashValueNotInteger
+		}
+	}
+	if (incr > 0 && num > math.MaxInt64-incr) || (incr < 0 && num < math.MinInt64-incr) {
+		return 0, ErrIncrOverflow
+	}
+	num += incr
+	if _, err = rds.hset(key, field, []byte(strconv.FormatInt(num, 10))); err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+// HIncrByFloat 将 field 的值加上浮点数 incr
+func (rds *RedisDataStructure) HIncrByFloat(key, field []byte, incr float64) (float64, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	value, err := rds.HGet(key, field)
+	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
+		return 0, err
+	}
+	var num float64
+	if value != nil {
+		if num, err = strconv.ParseFloat(string(value), 64); err != nil {
+			return 0, ErrHashValueNotFloat
+		}
+	}
+	num += incr
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return 0, ErrIncrOverflow
+	}
+	if _, err = rds.hset(key, field, utils.Float64ToBytes(num)); err != nil {
+		return 0, err
+	}
+	return num, nil
+}
+
+// HScan 从 cursor 开始遍历最多 count 个 field,只返回匹配 pattern 的 field 和 value
+// 返回下一次遍历的 cursor,为0表示遍历结束
+func (rds *RedisDataStructure) HScan(key []byte, cursor uint64, pattern string, count int) (uint64, [][]byte, error) {
+	sc, err := rds.newScanCursor(append([]byte{Hash}, key...), cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	meta, err := rds.findMetadata(key, Hash)
+	if err != nil || meta.size == 0 {
+		return 0, nil, err
+	}
+	var res [][]byte
+	prefix := subKeyPrefix(key, meta.version)
+	err = rds.prefixScan(prefix, sc.seekKey(prefix), false, func(subKey, value []byte) bool {
+		field := subKey[len(prefix):]
+		matched, cont := sc.visit(field, field)
+		if matched {
+			res = append(res, field, value)
+		}
+		return cont
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return rds.finishScan(sc), res, nil
+}
+
+// 遍历 hash 的所有 field 和 value
+func (rds *RedisDataStructure) hashFold(key []byte, fn func(field, value []byte) bool) error {
+	meta, err := rds.findMetadata(key, Hash)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return nil
+	}
+	prefix := subKeyPrefix(key, meta.version)
+	return rds.prefixFold(prefix, func(subKey, value []byte) bool {
+		return fn(subKey[len(prefix):], value)
+	})
+}
+
 func (rds *RedisDataStructure) findMetadata(key []byte, dataType RedisDataType) (*Metadata, error) {
 
-	metaBuf, err := rds.db.Get(key)
+	metaBuf, err := rds.db.Get(encodeMetaKey(key))
 	if err != nil && !errors.Is(err, bitcask.ErrKeyNotFound) {
 		return nil, err
 	}
@@ -190,7 +799,7 @@ func (rds *RedisDataStructure) findMetadata(key []byte, dataType RedisDataType)
 			return nil, ErrWrongTypeOperation
 		}
 		//判断过期时间,?
-		if meta.expire != 0 && meta.expire <= time.Now().UnixNano() {
+		if rds.isExpired(meta.expire) {
 			exist = false
 		}
 	}
@@ -211,8 +820,161 @@ func (rds *RedisDataStructure) findMetadata(key []byte, dataType RedisDataType)
 	return meta, nil
 }
 
-// ===============================Set 数据结构 ============================
-func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
+// 基于 key 的 SCAN 游标: 返回给客户端的 cursor 是一个编号,对应下一次遍历开始的位置,
+// 继续遍历时直接 Seek 到这个位置,不需要从头跳过已经遍历过的元素
+type scanCursor struct {
+	scope   []byte //遍历的范围,SCAN 为空,HSCAN 和 SSCAN 为数据类型加上 key
+	seek    []byte //开始遍历的位置,是前缀之后的部分,为空时从头开始
+	count   int
+	pattern []byte
+	visited int
+	next    []byte //下一次遍历开始的位置,为空表示遍历结束
+}
+
+// 解析客户端传入的 cursor,为0时从头开始遍历,游标已经失效或者属于其他的遍历时返回错误
+func (rds *RedisDataStructure) newScanCursor(scope []byte, cursor uint64, pattern string, count int) (*scanCursor, error) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	sc := &scanCursor{scope: scope, count: count, pattern: []byte(pattern)}
+	if cursor != 0 {
+		seek, ok := rds.cursors.get(scope, cursor)
+		if !ok {
+			return nil, ErrInvalidCursor
+		}
+		sc.seek = seek
+	}
+	return sc, nil
+}
+
+// 开始遍历的 key,为空时从前缀开始
+func (sc *scanCursor) seekKey(prefix []byte) []byte {
+	if sc.seek == nil {
+		return nil
+	}
+	return append(bytes.Clone(prefix), sc.seek...)
+}
+
+// 遍历到一个元素,pos 是元素的 key 在前缀之后的部分,返回是否需要返回这个元素以及是否继续遍历
+func (sc *scanCursor) visit(pos, elem []byte) (bool, bool) {
+	if sc.visited == sc.count {
+		sc.next = bytes.Clone(pos)
+		return false, false
+	}
+	sc.visited++
+	return len(sc.pattern) == 0 || utils.GlobMatch(sc.pattern, elem), true
+}
+
+// 保存下一次遍历开始的位置,返回给客户端的 cursor,遍历结束时为0
+func (rds *RedisDataStructure) finishScan(sc *scanCursor) uint64 {
+	if sc.next == nil {
+		return 0
+	}
+	return rds.cursors.add(sc.scope, sc.next)
+}
+
+// 最多保存的 SCAN 游标的数量,超过之后最早的游标失效
+const maxScanCursors = 4096
+
+// 还没有遍历完的 SCAN 游标对应的位置,编号递增,只保留最近的 maxScanCursors 个
+type scanCursors struct {
+	mu        sync.Mutex
+	last      uint64
+	positions map[uint64]*scanPosition
+}
+
+type scanPosition struct {
+	scope []byte
+	seek  []byte
+}
+
+func newScanCursors() *scanCursors {
+	return &scanCursors{positions: make(map[uint64]*scanPosition)}
+}
+
+func (c *scanCursors) add(scope, seek []byte) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last++
+	c.positions[c.last] = &scanPosition{scope: bytes.Clone(scope), seek: seek}
+	if c.last > maxScanCursors {
+		delete(c.positions, c.last-maxScanCursors)
+	}
+	return c.last
+}
+
+func (c *scanCursors) get(scope []byte, cursor uint64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pos, ok := c.positions[cursor]
+	if !ok || !bytes.Equal(pos.scope, scope) {
+		return nil, false
+	}
+	return pos.seek, true
+}
+
+// 按顺序遍历前缀为 prefix 的所有数据部分的 key
+func (rds *RedisDataStructure) prefixFold(prefix []byte, fn func(subKey, value []byte) bool) error {
+	return rds.prefixScan(prefix, nil, false, fn)
+}
+
+// 从 seek 开始遍历前缀为 prefix 的 key,seek 为空时从第一个(反向时为最后一个) key 开始
+// 反向遍历时从小于等于 seek 的第一个 key 开始
+func (rds *RedisDataStructure) prefixScan(prefix, seek []byte, reverse bool, fn func(subKey, value []byte) bool) error {
+	iterOpts := bitcask.DefaultIteratorOptions
+	iterOpts.Reverse = reverse
+	iterOpts.PageSize = scanPageSize
+	iter := rds.db.NewIterator(iterOpts)
+	defer iter.Close()
+
+	if seek == nil {
+		seek = prefix
+		if reverse {
+			seek = prefixUpperBound(prefix)
+		}
+	}
+	if seek == nil {
+		iter.Rewind()
+	} else {
+		iter.Seek(seek)
+	}
+	for ; iter.Valid(); iter.Next() {
+		subKey := iter.Key()
+		//key 是有序的,前缀不匹配说明已经遍历完了
+		if !bytes.HasPrefix(subKey, prefix) {
+			//反向遍历时跳过大于前缀范围的 key
+			if reverse && bytes.Compare(subKey, prefix) > 0 {
+				continue
+			}
+			break
+		}
+		value, err := iter.Value()
+		if err != nil {
+			return err
+		}
+		if !fn(subKey, value) {
+			break
+		}
+	}
+	return nil
+}
+
+// 大于所有以 prefix 开头的 key 的最小值,不存在时返回 nil
+func prefixUpperBound(prefix []byte) []byte {
+	bound := bytes.Clone(prefix)
+	for i := len(bound) - 1; i >= 0; i-- {
+		if bound[i] < 0xFF {
+			bound[i]++
+			return bound[:i+1]
+		}
+	}
+	return nil
+}
+
+// ===============================Set 数据结构 ============================
+func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 	meta, err := rds.findMetadata(key, Set)
 	if err != nil {
 		return false, err
@@ -229,7 +991,7 @@ func (rds *RedisDataStructure) SAdd(key, member []byte) (bool, error) {
 		//不存在的话则更新
 		wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
 		_ = wb.Put(sk.encode(), nil)
 		if err = wb.Commit(); err != nil {
 			return false, err
@@ -265,6 +1027,8 @@ func (rds *RedisDataStructure) SIsMember(key, member []byte) (bool, error) {
 }
 
 func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 
 	meta, err := rds.findMetadata(key, Set)
 	if err != nil {
@@ -285,7 +1049,7 @@ func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
 	//更新元数据和数据部分
 	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 	meta.size--
-	_ = wb.Put(sk.encode(), meta.encode())
+	_ = wb.Put(encodeMetaKey(key), meta.encode())
 	_ = wb.Delete(sk.encode())
 
 	if err = wb.Commit(); err != nil {
@@ -294,12 +1058,349 @@ func (rds *RedisDataStructure) SRem(key, member []byte) (bool, error) {
 	return true, nil
 }
 
+// SCard 集合中元素的数量
+func (rds *RedisDataStructure) SCard(key []byte) (uint32, error) {
+	meta, err := rds.findMetadata(key, Set)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// SMembers 返回集合中所有的元素
+func (rds *RedisDataStructure) SMembers(key []byte) ([][]byte, error) {
+	var members [][]byte
+	_, err := rds.setFold(key, func(member []byte) bool {
+		members = append(members, member)
+		return true
+	})
+	return members, err
+}
+
+// SPop 随机移除并返回 count 个元素
+func (rds *RedisDataStructure) SPop(key []byte, count int) ([][]byte, error) {
+	return rds.SPopWithRand(key, count, nil)
+}
+
+// SPopWithRand 使用 r 选择要移除的元素,r 为空时使用全局的随机数,
+// 多个节点使用相同种子的 r 执行时会弹出相同的元素
+func (rds *RedisDataStructure) SPopWithRand(key []byte, count int, r *rand.Rand) ([][]byte, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	if count <= 0 {
+		return nil, nil
+	}
+	var members [][]byte
+	meta, err := rds.setFold(key, func(member []byte) bool {
+		members = append(members, member)
+		return true
+	})
+	if err != nil || len(members) == 0 {
+		return nil, err
+	}
+	swap := func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	}
+	if r == nil {
+		rand.Shuffle(len(members), swap)
+	} else {
+		r.Shuffle(len(members), swap)
+	}
+	if count < len(members) {
+		members = members[:count]
+	}
+
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(members) + 1))
+	for _, member := range members {
+		sk := &setInternalKey{
+			key:     key,
+			version: meta.version,
+			member:  member,
+		}
+		_ = wb.Delete(sk.encode())
+	}
+	meta.size -= uint32(len(members))
+	if meta.size == 0 {
+		_ = wb.Delete(encodeMetaKey(key))
+	} else {
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
+	}
+	if err = wb.Commit(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// SRandMember 随机返回元素但不移除,count 为正数时返回不重复的元素,为负数时元素可能重复
+func (rds *RedisDataStructure) SRandMember(key []byte, count int) ([][]byte, error) {
+	members, err := rds.SMembers(key)
+	if err != nil || len(members) == 0 || count == 0 {
+		return nil, err
+	}
+	if count < 0 {
+		res := make([][]byte, -count)
+		for i := range res {
+			res[i] = members[rand.Intn(len(members))]
+		}
+		return res, nil
+	}
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if count < len(members) {
+		members = members[:count]
+	}
+	return members, nil
+}
+
+// SMove 将元素从 source 原子地移动到 destination
+func (rds *RedisDataStructure) SMove(source, destination, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	srcMeta, err := rds.findMetadata(source, Set)
+	if err != nil {
+		return false, err
+	}
+	dstMeta, err := rds.findMetadata(destination, Set)
+	if err != nil {
+		return false, err
+	}
+	srcKey := &setInternalKey{
+		key:     source,
+		version: srcMeta.version,
+		member:  member,
+	}
+	exist, err := rds.subKeyExists(srcKey.encode())
+	if err != nil || !exist {
+		return false, err
+	}
+	if bytes.Equal(source, destination) {
+		return true, nil
+	}
+	dstKey := &setInternalKey{
+		key:     destination,
+		version: dstMeta.version,
+		member:  member,
+	}
+	dstExist, err := rds.subKeyExists(dstKey.encode())
+	if err != nil {
+		return false, err
+	}
+
+	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+	srcMeta.size--
+	if srcMeta.size == 0 {
+		_ = wb.Delete(encodeMetaKey(source))
+	} else {
+		_ = wb.Put(encodeMetaKey(source), srcMeta.encode())
+	}
+	_ = wb.Delete(srcKey.encode())
+	if !dstExist {
+		dstMeta.size++
+		_ = wb.Put(encodeMetaKey(destination), dstMeta.encode())
+		_ = wb.Put(dstKey.encode(), nil)
+	}
+	if err = wb.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SInter 多个集合的交集
+func (rds *RedisDataStructure) SInter(keys ...[]byte) ([][]byte, error) {
+	return rds.setAlgebra(setInter, keys)
+}
+
+// SUnion 多个集合的并集
+func (rds *RedisDataStructure) SUnion(keys ...[]byte) ([][]byte, error) {
+	return rds.setAlgebra(setUnion, keys)
+}
+
+// SDiff 第一个集合与其他集合的差集
+func (rds *RedisDataStructure) SDiff(keys ...[]byte) ([][]byte, error) {
+	return rds.setAlgebra(setDiff, keys)
+}
+
+// SInterStore 将交集保存到 destination 中,返回结果集合的元素数量
+func (rds *RedisDataStructure) SInterStore(destination []byte, keys ...[]byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	members, err := rds.SInter(keys...)
+	if err != nil {
+		return 0, err
+	}
+	if err = rds.storeSet(destination, members); err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
+
+// SUnionStore 将并集保存到 destination 中,返回结果集合的元素数量
+func (rds *RedisDataStructure) SUnionStore(destination []byte, keys ...[]byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	members, err := rds.SUnion(keys...)
+	if err != nil {
+		return 0, err
+	}
+	if err = rds.storeSet(destination, members); err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
+
+// SDiffStore 将差集保存到 destination 中,返回结果集合的元素数量
+func (rds *RedisDataStructure) SDiffStore(destination []byte, keys ...[]byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	members, err := rds.SDiff(keys...)
+	if err != nil {
+		return 0, err
+	}
+	if err = rds.storeSet(destination, members); err != nil {
+		return 0, err
+	}
+	return len(members), nil
+}
+
+// SScan 从 cursor 开始遍历最多 count 个元素,只返回匹配 pattern 的元素
+func (rds *RedisDataStructure) SScan(key []byte, cursor uint64, pattern string, count int) (uint64, [][]byte, error) {
+	sc, err := rds.newScanCursor(append([]byte{Set}, key...), cursor, pattern, count)
+	if err != nil {
+		return 0, nil, err
+	}
+	meta, err := rds.findMetadata(key, Set)
+	if err != nil || meta.size == 0 {
+		return 0, nil, err
+	}
+	var res [][]byte
+	prefix := subKeyPrefix(key, meta.version)
+	err = rds.prefixScan(prefix, sc.seekKey(prefix), false, func(subKey, value []byte) bool {
+		//末尾的4个字节是 member 的长度
+		member := subKey[len(prefix) : len(subKey)-4]
+		matched, cont := sc.visit(subKey[len(prefix):], member)
+		if matched {
+			res = append(res, member)
+		}
+		return cont
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return rds.finishScan(sc), res, nil
+}
+
+type setOperation = byte
+
+const (
+	setInter setOperation = iota
+	setUnion
+	setDiff
+)
+
+// 集合运算,结果按元素的字节序排列
+func (rds *RedisDataStructure) setAlgebra(op setOperation, keys [][]byte) ([][]byte, error) {
+	if len(keys) == 0 {
+		return nil, ErrInvalidArgs
+	}
+	//先读取所有的集合,保证类型错误的 key 一定会返回错误
+	sets := make([]map[string]struct{}, len(keys))
+	for i, key := range keys {
+		set := make(map[string]struct{})
+		if _, err := rds.setFold(key, func(member []byte) bool {
+			set[string(member)] = struct{}{}
+			return true
+		}); err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	res := sets[0]
+	for _, set := range sets[1:] {
+		switch op {
+		case setInter:
+			for member := range res {
+				if _, ok := set[member]; !ok {
+					delete(res, member)
+				}
+			}
+		case setUnion:
+			for member := range set {
+				res[member] = struct{}{}
+			}
+		case setDiff:
+			for member := range set {
+				delete(res, member)
+			}
+		}
+	}
+	members := make([][]byte, 0, len(res))
+	for member := range res {
+		members = append(members, []byte(member))
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return bytes.Compare(members[i], members[j]) < 0
+	})
+	return members, nil
+}
+
+// 用 members 覆盖 destination,原来的数据通过新的版本号失效
+func (rds *RedisDataStructure) storeSet(destination []byte, members [][]byte) error {
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(members) + 1))
+	if len(members) == 0 {
+		_ = wb.Delete(encodeMetaKey(destination))
+		return wb.Commit()
+	}
+	meta := &Metadata{
+		dateType: Set,
+		version:  time.Now().UnixNano(),
+		size:     uint32(len(members)),
+	}
+	_ = wb.Put(encodeMetaKey(destination), meta.encode())
+	for _, member := range members {
+		sk := &setInternalKey{
+			key:     destination,
+			version: meta.version,
+			member:  member,
+		}
+		_ = wb.Put(sk.encode(), nil)
+	}
+	return wb.Commit()
+}
+
+// 遍历集合中所有的元素,返回集合的元数据
+func (rds *RedisDataStructure) setFold(key []byte, fn func(member []byte) bool) (*Metadata, error) {
+	meta, err := rds.findMetadata(key, Set)
+	if err != nil {
+		return nil, err
+	}
+	if meta.size == 0 {
+		return meta, nil
+	}
+	prefix := subKeyPrefix(key, meta.version)
+	err = rds.prefixFold(prefix, func(subKey, value []byte) bool {
+		//末尾的4个字节是 member 的长度
+		return fn(subKey[len(prefix) : len(subKey)-4])
+	})
+	return meta, err
+}
+
+// 数据部分的 key 是否存在
+func (rds *RedisDataStructure) subKeyExists(subKey []byte) (bool, error) {
+	_, err := rds.db.Get(subKey)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // ===================list数据结构======================
-func (rds *RedisDataStructure) LPush(key, element []byte) (uint32, error) {
-	return rds.pushInner(key, element, true)
+func (rds *RedisDataStructure) LPush(key []byte, elements ...[]byte) (uint32, error) {
+	return rds.pushInner(key, elements, true)
 }
-func (rds *RedisDataStructure) RPush(key, element []byte) (uint32, error) {
-	return rds.pushInner(key, element, false)
+func (rds *RedisDataStructure) RPush(key []byte, elements ...[]byte) (uint32, error) {
+	return rds.pushInner(key, elements, false)
 }
 
 func (rds *RedisDataStructure) LPop(key []byte) ([]byte, error) {
@@ -311,7 +1412,9 @@ func (rds *RedisDataStructure) RPop(key []byte) ([]byte, error) {
 
 }
 
-func (rds *RedisDataStructure) pushInner(key, element []byte, isLeft bool) (uint32, error) {
+func (rds *RedisDataStructure) pushInner(key []byte, elements [][]byte, isLeft bool) (uint32, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 
 	//查找元数据
 	meta, err := rds.findMetadata(key, List)
@@ -319,35 +1422,35 @@ func (rds *RedisDataStructure) pushInner(key, element []byte, isLeft bool) (uint
 		return 0, err
 	}
 
-	//构造数据部分的key
-	lk := &listInternalKey{
-		key:     key,
-		version: meta.version,
-	}
-	if isLeft {
-
-		lk.index = meta.head - 1
-	} else {
-		lk.index = meta.tail
-	}
 	//更新元数据和数据部分
-	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
-	meta.size++
-	if isLeft {
-		meta.head--
-
-	} else {
-		meta.tail++
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(elements) + 1))
+	for _, element := range elements {
+		//构造数据部分的key
+		lk := &listInternalKey{
+			key:     key,
+			version: meta.version,
+		}
+		if isLeft {
+			meta.head--
+			lk.index = meta.head
+		} else {
+			lk.index = meta.tail
+			meta.tail++
+		}
+		meta.size++
+		_ = wb.Put(lk.encode(), element)
 	}
-	_ = wb.Put(key, meta.encode())
-	_ = wb.Put(lk.encode(), element)
+	_ = wb.Put(encodeMetaKey(key), meta.encode())
 	if err = wb.Commit(); err != nil {
 		return 0, err
 	}
+	rds.notifyListPush(key)
 	//key下面有多少数据
 	return meta.size, nil
 }
 func (rds *RedisDataStructure) popInner(key []byte, isLeft bool) ([]byte, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
 
 	meta, err := rds.findMetadata(key, List)
 	if err != nil {
@@ -375,7 +1478,7 @@ func (rds *RedisDataStructure) popInner(key []byte, isLeft bool) ([]byte, error)
 		return nil, err
 	}
 
-	//更新元数据
+	//更新元数据,同时删除弹出的元素
 	meta.size--
 
 	if isLeft {
@@ -384,15 +1487,421 @@ func (rds *RedisDataStructure) popInner(key []byte, isLeft bool) ([]byte, error)
 	} else {
 		meta.tail--
 	}
-	if err = rds.db.Put(key, meta.encode()); err != nil {
+	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+	_ = wb.Delete(lk.encode())
+	rds.putListMeta(wb, key, meta)
+	if err = wb.Commit(); err != nil {
+		return nil, err
+	}
+	return element, nil
+}
+
+// LLen 列表的长度
+func (rds *RedisDataStructure) LLen(key []byte) (uint32, error) {
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// LIndex 返回下标为 index 的元素,负数表示从末尾开始计算,超出范围时返回 nil
+func (rds *RedisDataStructure) LIndex(key []byte, index int64) ([]byte, error) {
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 {
+		index += int64(meta.size)
+	}
+	if index < 0 || index >= int64(meta.size) {
+		return nil, nil
+	}
+	return rds.listElement(key, meta, uint64(index))
+}
+
+// LRange 返回下标在 [start, stop] 之间的元素
+func (rds *RedisDataStructure) LRange(key []byte, start, stop int64) ([][]byte, error) {
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, ok := normalizeRange(start, stop, int64(meta.size))
+	if !ok {
+		return [][]byte{}, nil
+	}
+	elements := make([][]byte, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		element, err := rds.listElement(key, meta, uint64(i))
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+	}
+	return elements, nil
+}
+
+// LSet 设置下标为 index 的元素
+func (rds *RedisDataStructure) LSet(key []byte, index int64, element []byte) error {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return ErrNoSuchKey
+	}
+	if index < 0 {
+		index += int64(meta.size)
+	}
+	if index < 0 || index >= int64(meta.size) {
+		return ErrIndexOutOfRange
+	}
+	lk := &listInternalKey{
+		key:     key,
+		version: meta.version,
+		index:   meta.head + uint64(index),
+	}
+	return rds.db.Put(lk.encode(), element)
+}
+
+// LTrim 只保留下标在 [start, stop] 之间的元素
+func (rds *RedisDataStructure) LTrim(key []byte, start, stop int64) error {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return err
+	}
+	if meta.size == 0 {
+		return nil
+	}
+	start, stop, ok := normalizeRange(start, stop, int64(meta.size))
+	if !ok {
+		//全部删除
+		start, stop = int64(meta.size), int64(meta.size)-1
+	}
+	wb := rds.db.NewWriteBatch(writeBatchOptions(int(meta.size) + 1))
+	for i := int64(0); i < int64(meta.size); i++ {
+		if i >= start && i <= stop {
+			continue
+		}
+		lk := &listInternalKey{
+			key:     key,
+			version: meta.version,
+			index:   meta.head + uint64(i),
+		}
+		_ = wb.Delete(lk.encode())
+	}
+	meta.tail = meta.head + uint64(stop) + 1
+	meta.head += uint64(start)
+	meta.size = uint32(meta.tail - meta.head)
+	rds.putListMeta(wb, key, meta)
+	return wb.Commit()
+}
+
+// LInsert 在 pivot 之前或者之后插入元素,返回插入之后列表的长度
+// 列表不存在时返回0,pivot 不存在时返回-1
+func (rds *RedisDataStructure) LInsert(key []byte, before bool, pivot, element []byte) (int64, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, nil
+	}
+	elements, err := rds.LRange(key, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	pos := -1
+	for i, e := range elements {
+		if bytes.Equal(e, pivot) {
+			pos = i
+			break
+		}
+	}
+	if pos < 0 {
+		return -1, nil
+	}
+	if !before {
+		pos++
+	}
+
+	//移动插入位置两侧中元素较少的一侧
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(elements) + 2))
+	put := func(index uint64, value []byte) {
+		lk := &listInternalKey{
+			key:     key,
+			version: meta.version,
+			index:   index,
+		}
+		_ = wb.Put(lk.encode(), value)
+	}
+	if pos < len(elements)/2 {
+		meta.head--
+		for i := 0; i < pos; i++ {
+			put(meta.head+uint64(i), elements[i])
+		}
+	} else {
+		for i := len(elements) - 1; i >= pos; i-- {
+			put(meta.head+uint64(i)+1, elements[i])
+		}
+		meta.tail++
+	}
+	put(meta.head+uint64(pos), element)
+	meta.size++
+	_ = wb.Put(encodeMetaKey(key), meta.encode())
+	if err = wb.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(meta.size), nil
+}
+
+// LRem 删除等于 element 的元素,count 大于0时从头部开始删除 count 个,
+// 小于0时从尾部开始删除 -count 个,等于0时删除全部,返回删除的数量
+func (rds *RedisDataStructure) LRem(key []byte, count int64, element []byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	meta, err := rds.findMetadata(key, List)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, nil
+	}
+	elements, err := rds.LRange(key, 0, -1)
+	if err != nil {
+		return 0, err
+	}
+	removed := make([]bool, len(elements))
+	var n int
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	for i := range elements {
+		idx := i
+		if count < 0 {
+			idx = len(elements) - 1 - i
+		}
+		if limit > 0 && int64(n) >= limit {
+			break
+		}
+		if bytes.Equal(elements[idx], element) {
+			removed[idx] = true
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	//剩余的元素从第一个被删除的位置开始依次向前移动
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(elements) + 1))
+	var kept uint64
+	var moving bool
+	for i, e := range elements {
+		if removed[i] {
+			moving = true
+			continue
+		}
+		if moving {
+			lk := &listInternalKey{
+				key:     key,
+				version: meta.version,
+				index:   meta.head + kept,
+			}
+			_ = wb.Put(lk.encode(), e)
+		}
+		kept++
+	}
+	for i := kept; i < uint64(len(elements)); i++ {
+		lk := &listInternalKey{
+			key:     key,
+			version: meta.version,
+			index:   meta.head + i,
+		}
+		_ = wb.Delete(lk.encode())
+	}
+	meta.tail = meta.head + kept
+	meta.size = uint32(kept)
+	rds.putListMeta(wb, key, meta)
+	if err = wb.Commit(); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// LMove 原子地从 source 的一端弹出元素并插入到 destination 的一端,source 为空时返回 nil
+func (rds *RedisDataStructure) LMove(source, destination []byte, srcLeft, dstLeft bool) ([]byte, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	srcMeta, err := rds.findMetadata(source, List)
+	if err != nil {
+		return nil, err
+	}
+	dstMeta := srcMeta
+	sameKey := bytes.Equal(source, destination)
+	if !sameKey {
+		if dstMeta, err = rds.findMetadata(destination, List); err != nil {
+			return nil, err
+		}
+	}
+	if srcMeta.size == 0 {
+		return nil, nil
+	}
+
+	srcKey := &listInternalKey{
+		key:     source,
+		version: srcMeta.version,
+	}
+	if srcLeft {
+		srcKey.index = srcMeta.head
+		srcMeta.head++
+	} else {
+		srcMeta.tail--
+		srcKey.index = srcMeta.tail
+	}
+	srcMeta.size--
+	element, err := rds.db.Get(srcKey.encode())
+	if err != nil {
+		return nil, err
+	}
+
+	dstKey := &listInternalKey{
+		key:     destination,
+		version: dstMeta.version,
+	}
+	if dstLeft {
+		dstMeta.head--
+		dstKey.index = dstMeta.head
+	} else {
+		dstKey.index = dstMeta.tail
+		dstMeta.tail++
+	}
+	dstMeta.size++
+
+	//同一个 key 先删除再写入,写入的结果会覆盖删除
+	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+	_ = wb.Delete(srcKey.encode())
+	_ = wb.Put(dstKey.encode(), element)
+	if !sameKey {
+		rds.putListMeta(wb, source, srcMeta)
+	}
+	_ = wb.Put(encodeMetaKey(destination), dstMeta.encode())
+	if err = wb.Commit(); err != nil {
 		return nil, err
 	}
+	rds.notifyListPush(destination)
 	return element, nil
 }
 
+// RPopLPush 等价于 LMove(source, destination, false, true)
+func (rds *RedisDataStructure) RPopLPush(source, destination []byte) ([]byte, error) {
+	return rds.LMove(source, destination, false, true)
+}
+
+// 读取列表中第 index 个元素
+func (rds *RedisDataStructure) listElement(key []byte, meta *Metadata, index uint64) ([]byte, error) {
+	lk := &listInternalKey{
+		key:     key,
+		version: meta.version,
+		index:   meta.head + index,
+	}
+	return rds.db.Get(lk.encode())
+}
+
+// 更新列表的元数据,列表为空时删除 key
+func (rds *RedisDataStructure) putListMeta(wb writeBatch, key []byte, meta *Metadata) {
+	if meta.size == 0 {
+		_ = wb.Delete(encodeMetaKey(key))
+		return
+	}
+	_ = wb.Put(encodeMetaKey(key), meta.encode())
+}
+
+// 将 [start, stop] 转换为有效的下标范围,负数表示从末尾开始计算,范围为空时返回 false
+func normalizeRange(start, stop, size int64) (int64, int64, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
 //========================ZSet======================
 
+// ZSetMember 有序集合中的一个元素
+type ZSetMember struct {
+	Member []byte
+	Score  float64
+}
+
+// ScoreRange 分数的范围,Exclusive 表示不包含边界,边界可以是正负无穷
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r *ScoreRange) aboveMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r *ScoreRange) belowMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+// LexRange member 的字典序范围,Unbounded 表示对应的一侧没有边界(即 - 和 +)
+type LexRange struct {
+	Min, Max                   []byte
+	MinExclusive, MaxExclusive bool
+	MinUnbounded, MaxUnbounded bool
+}
+
+func (r *LexRange) aboveMin(member []byte) bool {
+	if r.MinUnbounded {
+		return true
+	}
+	c := bytes.Compare(member, r.Min)
+	return c > 0 || (c == 0 && !r.MinExclusive)
+}
+
+func (r *LexRange) belowMax(member []byte) bool {
+	if r.MaxUnbounded {
+		return true
+	}
+	c := bytes.Compare(member, r.Max)
+	return c < 0 || (c == 0 && !r.MaxExclusive)
+}
+
 func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (bool, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	return rds.zadd(key, score, member)
+}
+
+func (rds *RedisDataStructure) zadd(key []byte, score float64, member []byte) (bool, error) {
 	meta, err := rds.findMetadata(key, ZSet)
 	if err != nil {
 		return false, err
@@ -425,7 +1934,7 @@ func (rds *RedisDataStructure) ZAdd(key []byte, score float64, member []byte) (b
 	wb := rds.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
 	if !exist {
 		meta.size++
-		_ = wb.Put(key, meta.encode())
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
 	}
 	if exist {
 		oldKey := &zsetInternalKey{
@@ -450,7 +1959,8 @@ func (rds *RedisDataStructure) ZScore(key []byte, member []byte) (float64, error
 		return -1, err
 	}
 	if meta.size == 0 {
-		return -1, nil
+		//与 member 不存在的情况保持一致,避免和分数-1混淆
+		return -1, bitcask.ErrKeyNotFound
 	}
 
 	// 构造数据部分的key
@@ -467,3 +1977,303 @@ func (rds *RedisDataStructure) ZScore(key []byte, member []byte) (float64, error
 
 	return utils.FloatFromBytes(value), nil
 }
+
+// ZCard 有序集合中元素的数量
+func (rds *RedisDataStructure) ZCard(key []byte) (uint32, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	return meta.size, nil
+}
+
+// ZIncrBy 将 member 的分数加上 incr,member 不存在时当作0处理,返回新的分数
+func (rds *RedisDataStructure) ZIncrBy(key []byte, incr float64, member []byte) (float64, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	score, err := rds.ZScore(key, member)
+	if errors.Is(err, bitcask.ErrKeyNotFound) {
+		score, err = 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	score += incr
+	if math.IsNaN(score) {
+		return 0, ErrScoreNaN
+	}
+	if _, err = rds.zadd(key, score, member); err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+// ZRem 删除元素,返回删除的数量
+func (rds *RedisDataStructure) ZRem(key []byte, members ...[]byte) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return 0, err
+	}
+	if meta.size == 0 {
+		return 0, nil
+	}
+	var removed []ZSetMember
+	for _, member := range members {
+		zk := &zsetInternalKey{
+			key:     key,
+			version: meta.version,
+			member:  member,
+		}
+		value, err := rds.db.Get(zk.encodeWithMember())
+		if errors.Is(err, bitcask.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		removed = append(removed, ZSetMember{Member: member, Score: utils.FloatFromBytes(value)})
+	}
+	if err = rds.zsetRemove(key, meta, removed); err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// ZRange 按分数从小到大(reverse 为 true 时从大到小)返回排名在 [start, stop] 之间的元素
+func (rds *RedisDataStructure) ZRange(key []byte, start, stop int64, reverse bool) ([]ZSetMember, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+	start, stop, ok := normalizeRange(start, stop, int64(meta.size))
+	if !ok {
+		return []ZSetMember{}, nil
+	}
+	res := make([]ZSetMember, 0, stop-start+1)
+	var rank int64
+	err = rds.zsetFold(key, meta, reverse, nil, func(member []byte, score float64) bool {
+		if rank >= start {
+			res = append(res, ZSetMember{Member: member, Score: score})
+		}
+		rank++
+		return rank <= stop
+	})
+	return res, err
+}
+
+// ZRangeByScore 返回分数在 r 范围内的元素,跳过前 offset 个之后最多返回 count 个,count 小于0表示不限制
+func (rds *RedisDataStructure) ZRangeByScore(key []byte, r ScoreRange, reverse bool, offset, count int64) ([]ZSetMember, error) {
+	res := []ZSetMember{}
+	_, err := rds.zsetScoreFold(key, r, reverse, func(member []byte, score float64) bool {
+		if offset > 0 {
+			offset--
+			return true
+		}
+		if count == 0 {
+			return false
+		}
+		res = append(res, ZSetMember{Member: member, Score: score})
+		count--
+		return true
+	})
+	return res, err
+}
+
+// ZRangeByLex 返回 member 在字典序范围 r 中的元素,要求所有元素的分数相同
+func (rds *RedisDataStructure) ZRangeByLex(key []byte, r LexRange, reverse bool, offset, count int64) ([]ZSetMember, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+	res := []ZSetMember{}
+	err = rds.zsetFold(key, meta, reverse, nil, func(member []byte, score float64) bool {
+		//分数相同时按 member 的字典序排列,超出范围之后不需要继续遍历
+		if reverse {
+			if !r.belowMax(member) {
+				return true
+			}
+			if !r.aboveMin(member) {
+				return false
+			}
+		} else {
+			if !r.aboveMin(member) {
+				return true
+			}
+			if !r.belowMax(member) {
+				return false
+			}
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		if count == 0 {
+			return false
+		}
+		res = append(res, ZSetMember{Member: member, Score: score})
+		count--
+		return true
+	})
+	return res, err
+}
+
+// ZRank member 按分数从小到大(reverse 为 true 时从大到小)的排名,从0开始,不存在时返回 false
+func (rds *RedisDataStructure) ZRank(key, member []byte, reverse bool) (int64, bool, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return 0, false, err
+	}
+	var rank int64
+	var found bool
+	err = rds.zsetFold(key, meta, reverse, nil, func(m []byte, score float64) bool {
+		if bytes.Equal(m, member) {
+			found = true
+			return false
+		}
+		rank++
+		return true
+	})
+	if err != nil || !found {
+		return 0, false, err
+	}
+	return rank, true, nil
+}
+
+// ZCount 分数在 r 范围内的元素数量
+func (rds *RedisDataStructure) ZCount(key []byte, r ScoreRange) (int, error) {
+	var count int
+	_, err := rds.zsetScoreFold(key, r, false, func(member []byte, score float64) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+// ZPopMin 删除并返回分数最小的 count 个元素
+func (rds *RedisDataStructure) ZPopMin(key []byte, count int) ([]ZSetMember, error) {
+	return rds.zpop(key, count, false)
+}
+
+// ZPopMax 删除并返回分数最大的 count 个元素
+func (rds *RedisDataStructure) ZPopMax(key []byte, count int) ([]ZSetMember, error) {
+	return rds.zpop(key, count, true)
+}
+
+// ZRemRangeByScore 删除分数在 r 范围内的元素,返回删除的数量
+func (rds *RedisDataStructure) ZRemRangeByScore(key []byte, r ScoreRange) (int, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	var removed []ZSetMember
+	meta, err := rds.zsetScoreFold(key, r, false, func(member []byte, score float64) bool {
+		removed = append(removed, ZSetMember{Member: member, Score: score})
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err = rds.zsetRemove(key, meta, removed); err != nil {
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+func (rds *RedisDataStructure) zpop(key []byte, count int, reverse bool) ([]ZSetMember, error) {
+	rds.mu.Lock()
+	defer rds.mu.Unlock()
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+	res := []ZSetMember{}
+	if count <= 0 || meta.size == 0 {
+		return res, nil
+	}
+	err = rds.zsetFold(key, meta, reverse, nil, func(member []byte, score float64) bool {
+		res = append(res, ZSetMember{Member: member, Score: score})
+		return len(res) < count
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = rds.zsetRemove(key, meta, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// 在一个批次中删除元素并更新元数据,集合为空时删除 key
+func (rds *RedisDataStructure) zsetRemove(key []byte, meta *Metadata, members []ZSetMember) error {
+	if len(members) == 0 {
+		return nil
+	}
+	//每个元素有 member 和 score 两个 key
+	wb := rds.db.NewWriteBatch(writeBatchOptions(len(members)*2 + 1))
+	for _, m := range members {
+		zk := &zsetInternalKey{
+			key:     key,
+			version: meta.version,
+			member:  m.Member,
+			score:   m.Score,
+		}
+		_ = wb.Delete(zk.encodeWithMember())
+		_ = wb.Delete(zk.encodeWithScore())
+	}
+	meta.size -= uint32(len(members))
+	if meta.size == 0 {
+		_ = wb.Delete(encodeMetaKey(key))
+	} else {
+		_ = wb.Put(encodeMetaKey(key), meta.encode())
+	}
+	return wb.Commit()
+}
+
+// 按分数的顺序遍历元素,from 不为空时从 from 对应的 score key 开始
+func (rds *RedisDataStructure) zsetFold(key []byte, meta *Metadata, reverse bool, from []byte,
+	fn func(member []byte, score float64) bool) error {
+	if meta.size == 0 {
+		return nil
+	}
+	prefix := zsetScorePrefix(key, meta.version)
+	return rds.prefixScan(prefix, from, reverse, func(subKey, value []byte) bool {
+		score, member := decodeZSetScoreKey(prefix, subKey)
+		return fn(member, score)
+	})
+}
+
+// 遍历分数在 r 范围内的元素,直接从边界对应的位置开始遍历
+func (rds *RedisDataStructure) zsetScoreFold(key []byte, r ScoreRange, reverse bool,
+	fn func(member []byte, score float64) bool) (*Metadata, error) {
+	meta, err := rds.findMetadata(key, ZSet)
+	if err != nil {
+		return nil, err
+	}
+	prefix := zsetScorePrefix(key, meta.version)
+	var from []byte
+	if reverse {
+		from = prefixUpperBound(append(bytes.Clone(prefix), utils.Float64ToSortableBytes(r.Max)...))
+	} else {
+		from = append(bytes.Clone(prefix), utils.Float64ToSortableBytes(r.Min)...)
+	}
+	err = rds.zsetFold(key, meta, reverse, from, func(member []byte, score float64) bool {
+		//边界不包含时需要跳过等于边界的元素
+		if reverse {
+			if !r.belowMax(score) {
+				return true
+			}
+			if !r.aboveMin(score) {
+				return false
+			}
+		} else {
+			if !r.aboveMin(score) {
+				return true
+			}
+			if !r.belowMax(score) {
+				return false
+			}
+		}
+		return fn(member, score)
+	})
+	return meta, err
+}
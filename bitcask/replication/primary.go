@@ -0,0 +1,236 @@
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"kv-go/bitcask"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// 没有新的变更时发送心跳的间隔
+const heartbeatInterval = time.Second
+
+// Primary 主节点,将数据文件中的变更推送给所有连接的从节点
+type Primary struct {
+	db       *bitcask.DB
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// NewPrimary 在 addr 上监听从节点的连接
+func NewPrimary(db *bitcask.DB, addr string) (*Primary, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &Primary{
+		db:       db,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	p.wg.Add(1)
+	go p.serve()
+	return p, nil
+}
+
+// Addr 实际监听的地址
+func (p *Primary) Addr() net.Addr {
+	return p.listener.Addr()
+}
+
+// Close 停止监听并断开所有的从节点,不会关闭 DB
+func (p *Primary) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+	p.mu.Unlock()
+	err := p.listener.Close()
+	p.wg.Wait()
+	return err
+}
+
+func (p *Primary) serve() {
+	defer p.wg.Done()
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		p.conns[conn] = struct{}{}
+		p.mu.Unlock()
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			if err := p.handleReplica(conn); err != nil && !errors.Is(err, net.ErrClosed) && err != io.EOF {
+				log.Printf("replication: replica %s disconnected: %v\n", conn.RemoteAddr(), err)
+			}
+			p.mu.Lock()
+			delete(p.conns, conn)
+			p.mu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+func (p *Primary) handleReplica(conn net.Conn) error {
+	reader := bufio.NewReader(conn)
+	typ, payload, err := readFrame(reader)
+	if err != nil {
+		return err
+	}
+	if typ != frameHandshake {
+		return ErrInvalidFrame
+	}
+	pos, err := decodePosition(payload)
+	if err != nil {
+		return err
+	}
+
+	//先订阅变更,用于在没有新数据时唤醒
+	watcher := p.db.Watch(nil)
+	defer func() {
+		watcher.Close()
+	}()
+
+	writer := bufio.NewWriter(conn)
+	cs, err := p.db.NewChangeStream(pos)
+	if errors.Is(err, bitcask.ErrCursorExpired) {
+		//从节点的位置已经被 merge 重写,需要全量同步
+		if pos, err = p.sendSnapshot(writer); err != nil {
+			return err
+		}
+		cs, err = p.db.NewChangeStream(pos)
+	}
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	var pending *bitcask.Event
+	for {
+		events, next, err := readEvents(cs, pending)
+		pending = next
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(events) > 0 {
+			if err := writeFrame(writer, frameEvents, encodeEvents(events)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writer.Flush(); err != nil {
+			return err
+		}
+
+		//已经读到了日志末尾,等待新的写入
+		select {
+		case _, ok := <-watcher.Events():
+			if !ok {
+				if errors.Is(watcher.Err(), bitcask.ErrDatabaseClosed) {
+					return nil
+				}
+				watcher = p.db.Watch(nil)
+				continue
+			}
+			//变更的内容从数据文件中读取,这里只需要清空通知
+			drainEvents(watcher)
+		case <-ticker.C:
+			if err := writeFrame(writer, frameHeartbeat, encodePosition(p.db.Position())); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func drainEvents(watcher *bitcask.Watcher) {
+	for {
+		select {
+		case _, ok := <-watcher.Events():
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// 读取下一组变更,同一个事务中的变更会一起返回
+// 返回的第二个值是多读出来的属于下一组的变更
+func readEvents(cs *bitcask.ChangeStream, pending *bitcask.Event) ([]*bitcask.Event, *bitcask.Event, error) {
+	first := pending
+	if first == nil {
+		ev, err := cs.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		first = ev
+	}
+	events := []*bitcask.Event{first}
+	if first.SeqNo == 0 {
+		return events, nil, nil
+	}
+	for {
+		ev, err := cs.Next()
+		if err != nil {
+			return events, nil, nil
+		}
+		if ev.SeqNo != first.SeqNo || ev.Cursor != first.Cursor {
+			return events, ev, nil
+		}
+		events = append(events, ev)
+	}
+}
+
+// 发送全量快照,返回快照对应的日志位置
+// 快照先导出到临时文件,发送的时候不持有数据库的锁,较慢的从节点不会阻塞主节点的写入
+func (p *Primary) sendSnapshot(w *bufio.Writer) (bitcask.Position, error) {
+	//先记录位置再导出,之后重放这个位置之后的变更是幂等的
+	pos := p.db.Position()
+	file, err := os.CreateTemp("", "bitcask-replication-snapshot")
+	if err != nil {
+		return pos, err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	exportOpts := bitcask.DefaultExportOptions
+	exportOpts.Compress = true
+	if err := p.db.Export(file, exportOpts); err != nil {
+		return pos, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return pos, err
+	}
+
+	if err := writeFrame(w, frameSnapshotBegin, nil); err != nil {
+		return pos, err
+	}
+	if _, err := io.Copy(&snapshotWriter{w: w}, file); err != nil {
+		return pos, err
+	}
+	if err := writeFrame(w, frameSnapshotEnd, encodePosition(pos)); err != nil {
+		return pos, err
+	}
+	return pos, w.Flush()
+}
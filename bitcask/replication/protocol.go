@@ -0,0 +1,159 @@
+package replication
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"kv-go/bitcask"
+)
+
+// 主从复制协议,所有的数据都以帧的形式发送
+// +------+----------------+---------+
+// | type | payload length | payload |
+// +------+----------------+---------+
+// | 1字节 | 4字节(小端)      |         |
+//
+// 1.从节点连接之后发送 frameHandshake,内容是已经同步到的日志位置
+// 2.如果这个位置已经失效(主节点 merge 之后重启),主节点发送全量快照: frameSnapshotBegin,
+// 若干 frameSnapshotData(bitcask.DB.Export 的数据流),frameSnapshotEnd(快照对应的日志位置)
+// 3.之后主节点持续发送 frameEvents,一个事务中的变更在同一帧中,从节点原子地应用
+// 4.没有新的变更时,主节点定期发送 frameHeartbeat,内容是主节点当前的日志位置
+const (
+	frameHandshake byte = iota + 1
+	frameSnapshotBegin
+	frameSnapshotData
+	frameSnapshotEnd
+	frameEvents
+	frameHeartbeat
+)
+
+const (
+	frameHeaderSize = 5
+	positionSize    = 4 + 4 + 8
+	maxFrameSize    = 64 * 1024 * 1024
+)
+
+var (
+	ErrInvalidFrame = errors.New("invalid replication frame")
+)
+
+func writeFrame(w io.Writer, typ byte, payload []byte) error {
+	header := make([]byte, frameHeaderSize)
+	header[0] = typ
+	binary.LittleEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+func readFrame(r *bufio.Reader) (byte, []byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.LittleEndian.Uint32(header[1:])
+	if size > maxFrameSize {
+		return 0, nil, ErrInvalidFrame
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[0], payload, nil
+}
+
+func encodePosition(pos bitcask.Position) []byte {
+	buf := make([]byte, positionSize)
+	binary.LittleEndian.PutUint32(buf[0:4], pos.Epoch)
+	binary.LittleEndian.PutUint32(buf[4:8], pos.Fid)
+	binary.LittleEndian.PutUint64(buf[8:16], uint64(pos.Offset))
+	return buf
+}
+
+func decodePosition(buf []byte) (bitcask.Position, error) {
+	if len(buf) < positionSize {
+		return bitcask.Position{}, ErrInvalidFrame
+	}
+	return bitcask.Position{
+		Epoch:  binary.LittleEndian.Uint32(buf[0:4]),
+		Fid:    binary.LittleEndian.Uint32(buf[4:8]),
+		Offset: int64(binary.LittleEndian.Uint64(buf[8:16])),
+	}, nil
+}
+
+// 对一组变更进行编码
+// +----------+-------+------------------------------------------------+
+// | position | count | type | key size | key | value size | value | ... |
+// +----------+-------+------------------------------------------------+
+func encodeEvents(events []*bitcask.Event) []byte {
+	var size = positionSize + binary.MaxVarintLen64
+	for _, ev := range events {
+		size += 1 + binary.MaxVarintLen64*2 + len(ev.Key) + len(ev.Value)
+	}
+	buf := make([]byte, size)
+	var index = copy(buf, encodePosition(events[len(events)-1].Cursor))
+	index += binary.PutUvarint(buf[index:], uint64(len(events)))
+	for _, ev := range events {
+		buf[index] = ev.Type
+		index++
+		index += binary.PutUvarint(buf[index:], uint64(len(ev.Key)))
+		index += copy(buf[index:], ev.Key)
+		index += binary.PutUvarint(buf[index:], uint64(len(ev.Value)))
+		index += copy(buf[index:], ev.Value)
+	}
+	return buf[:index]
+}
+
+func decodeEvents(buf []byte) ([]*bitcask.Event, error) {
+	pos, err := decodePosition(buf)
+	if err != nil {
+		return nil, err
+	}
+	var index = positionSize
+	count, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrInvalidFrame
+	}
+	index += n
+	readBytes := func() ([]byte, error) {
+		size, n := binary.Uvarint(buf[index:])
+		if n <= 0 || uint64(len(buf)-index-n) < size {
+			return nil, ErrInvalidFrame
+		}
+		index += n
+		b := buf[index : index+int(size)]
+		index += int(size)
+		return b, nil
+	}
+	events := make([]*bitcask.Event, 0, count)
+	for i := uint64(0); i < count; i++ {
+		if index >= len(buf) {
+			return nil, ErrInvalidFrame
+		}
+		ev := &bitcask.Event{Type: buf[index], Cursor: pos}
+		index++
+		if ev.Key, err = readBytes(); err != nil {
+			return nil, err
+		}
+		if ev.Value, err = readBytes(); err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// 将写入的数据切分成 frameSnapshotData 帧
+type snapshotWriter struct {
+	w io.Writer
+}
+
+func (sw *snapshotWriter) Write(p []byte) (int, error) {
+	if err := writeFrame(sw.w, frameSnapshotData, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
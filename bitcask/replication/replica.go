@@ -0,0 +1,307 @@
+package replication
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"kv-go/bitcask"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// 从节点保存同步位置的文件
+	positionFileName = "replica-position"
+
+	// 断开之后重新连接的间隔
+	reconnectInterval = time.Second
+)
+
+var (
+	ErrReplicaClosed = errors.New("replica is closed")
+)
+
+// Replica 从节点,从主节点同步数据并提供只读访问
+type Replica struct {
+	db          *bitcask.DB
+	primaryAddr string
+	mu          sync.RWMutex
+	pos         bitcask.Position //已经应用的日志位置
+	conn        net.Conn
+	closed      bool
+	closeCh     chan struct{}
+	wg          sync.WaitGroup
+}
+
+// OpenReplica 打开从节点的数据目录,并开始从 primaryAddr 同步数据
+func OpenReplica(options bitcask.Options, primaryAddr string) (*Replica, error) {
+	db, err := bitcask.Open(options)
+	if err != nil {
+		return nil, err
+	}
+	r := &Replica{
+		db:          db,
+		primaryAddr: primaryAddr,
+		closeCh:     make(chan struct{}),
+	}
+	if err := r.loadPosition(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.run()
+	return r, nil
+}
+
+// Close 停止同步并关闭从节点的 DB
+func (r *Replica) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.closeCh)
+	if r.conn != nil {
+		_ = r.conn.Close()
+	}
+	r.mu.Unlock()
+	r.wg.Wait()
+
+	if err := r.savePosition(); err != nil {
+		return err
+	}
+	return r.db.Close()
+}
+
+// Position 已经同步到的主节点日志位置
+func (r *Replica) Position() bitcask.Position {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pos
+}
+
+// Get 只读访问
+func (r *Replica) Get(key []byte) ([]byte, error) {
+	return r.db.Get(key)
+}
+
+func (r *Replica) ListKeys() [][]byte {
+	return r.db.ListKeys()
+}
+
+func (r *Replica) Fold(fn func(key []byte, value []byte) bool) error {
+	return r.db.Fold(fn)
+}
+
+func (r *Replica) NewIterator(opts bitcask.IteratorOptions) *bitcask.Iterator {
+	return r.db.NewIterator(opts)
+}
+
+func (r *Replica) Stat() *bitcask.Stat {
+	return r.db.Stat()
+}
+
+// 不断地连接主节点进行同步,断开之后重试
+func (r *Replica) run() {
+	defer r.wg.Done()
+	for {
+		err := r.sync()
+		if errors.Is(err, ErrReplicaClosed) {
+			return
+		}
+		if err != nil && err != io.EOF {
+			log.Printf("replication: sync from %s failed: %v\n", r.primaryAddr, err)
+		}
+		select {
+		case <-r.closeCh:
+			return
+		case <-time.After(reconnectInterval):
+		}
+	}
+}
+
+func (r *Replica) sync() error {
+	conn, err := net.Dial("tcp", r.primaryAddr)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		_ = conn.Close()
+		return ErrReplicaClosed
+	}
+	r.conn = conn
+	pos := r.pos
+	r.mu.Unlock()
+	defer func() {
+		_ = conn.Close()
+		//断开之前保存同步位置
+		_ = r.savePosition()
+	}()
+
+	if err := writeFrame(conn, frameHandshake, encodePosition(pos)); err != nil {
+		return r.wrapErr(err)
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		typ, payload, err := readFrame(reader)
+		if err != nil {
+			return r.wrapErr(err)
+		}
+		switch typ {
+		case frameSnapshotBegin:
+			if err := r.applySnapshot(reader); err != nil {
+				return r.wrapErr(err)
+			}
+		case frameEvents:
+			events, err := decodeEvents(payload)
+			if err != nil {
+				return err
+			}
+			if err := r.applyEvents(events); err != nil {
+				return err
+			}
+		case frameHeartbeat:
+			if err := r.savePosition(); err != nil {
+				return err
+			}
+		default:
+			return ErrInvalidFrame
+		}
+	}
+}
+
+// 应用全量快照,先清空本地的数据
+func (r *Replica) applySnapshot(reader *bufio.Reader) error {
+	for _, key := range r.db.ListKeys() {
+		if err := r.db.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	pr, pw := io.Pipe()
+	importErr := make(chan error, 1)
+	go func() {
+		err := r.db.Import(pr)
+		//Import 读到结束记录之后返回,剩余的数据直接丢弃
+		_, _ = io.Copy(io.Discard, pr)
+		importErr <- err
+	}()
+
+	for {
+		typ, payload, err := readFrame(reader)
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			<-importErr
+			return err
+		}
+		switch typ {
+		case frameSnapshotData:
+			if _, err := pw.Write(payload); err != nil {
+				_ = pw.CloseWithError(err)
+				<-importErr
+				return err
+			}
+		case frameSnapshotEnd:
+			_ = pw.Close()
+			if err := <-importErr; err != nil {
+				return err
+			}
+			pos, err := decodePosition(payload)
+			if err != nil {
+				return err
+			}
+			r.mu.Lock()
+			r.pos = pos
+			r.mu.Unlock()
+			return r.savePosition()
+		default:
+			_ = pw.CloseWithError(ErrInvalidFrame)
+			<-importErr
+			return ErrInvalidFrame
+		}
+	}
+}
+
+// 应用一组变更,事务中的多条变更通过 WriteBatch 原子地写入
+func (r *Replica) applyEvents(events []*bitcask.Event) error {
+	if len(events) == 1 {
+		ev := events[0]
+		var err error
+		if ev.Type == bitcask.EventDelete {
+			err = r.db.Delete(ev.Key)
+		} else {
+			err = r.db.Put(ev.Key, ev.Value)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		wb := r.db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+		for _, ev := range events {
+			var err error
+			if ev.Type == bitcask.EventDelete {
+				err = wb.Delete(ev.Key)
+			} else {
+				err = wb.Put(ev.Key, ev.Value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if err := wb.Commit(); err != nil {
+			return err
+		}
+	}
+	r.mu.Lock()
+	r.pos = events[len(events)-1].Cursor
+	r.mu.Unlock()
+	return nil
+}
+
+// 主动关闭导致的错误
+func (r *Replica) wrapErr(err error) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return ErrReplicaClosed
+	}
+	return err
+}
+
+func (r *Replica) loadPosition() error {
+	buf, err := os.ReadFile(filepath.Join(r.db.Options.DirPath, positionFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	pos, err := decodePosition(buf)
+	if err != nil {
+		return err
+	}
+	r.pos = pos
+	return nil
+}
+
+// 同步位置是至少一次的语义,重复应用主节点的变更是幂等的
+func (r *Replica) savePosition() error {
+	pos := r.Position()
+	//先保证位置之前的数据已经持久化
+	if err := r.db.Sync(); err != nil {
+		return err
+	}
+	fileName := filepath.Join(r.db.Options.DirPath, positionFileName)
+	tmpFileName := fileName + ".tmp"
+	if err := os.WriteFile(tmpFileName, encodePosition(pos), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFileName, fileName)
+}
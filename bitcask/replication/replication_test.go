@@ -0,0 +1,255 @@
+package replication
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask"
+	"kv-go/bitcask/utils"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func openPrimaryDB(t *testing.T, dir string) *bitcask.DB {
+	opts := bitcask.DefaultOptions
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	return db
+}
+
+func waitForValue(t *testing.T, r *Replica, key, value []byte) {
+	assert.Eventually(t, func() bool {
+		val, err := r.Get(key)
+		return err == nil && string(val) == string(value)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReplication(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-primary")
+	defer os.RemoveAll(dir)
+	db := openPrimaryDB(t, dir)
+	defer db.Close()
+
+	// 连接之前就已经存在的数据
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+
+	primary, err := NewPrimary(db, "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer primary.Close()
+
+	replicaDir, _ := os.MkdirTemp("", "bitcask-go-replica")
+	defer os.RemoveAll(replicaDir)
+	opts := bitcask.DefaultOptions
+	opts.DirPath = replicaDir
+	replica, err := OpenReplica(opts, primary.Addr().String())
+	assert.Nil(t, err)
+
+	last, _ := db.Get(utils.GetTestKey(99))
+	waitForValue(t, replica, utils.GetTestKey(99), last)
+
+	// 增量的写入、删除以及事务
+	err = db.Put([]byte("name"), []byte("bitcask"))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(0))
+	assert.Nil(t, err)
+	wb := db.NewWriteBatch(bitcask.DefaultWriteBatchOptions)
+	_ = wb.Put([]byte("txn-1"), []byte("a"))
+	_ = wb.Put([]byte("txn-2"), []byte("b"))
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	waitForValue(t, replica, []byte("txn-2"), []byte("b"))
+	val, err := replica.Get([]byte("name"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bitcask"), val)
+	_, err = replica.Get(utils.GetTestKey(0))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	assert.Equal(t, db.Position(), replica.Position())
+
+	// 从节点重启之后从保存的位置继续同步
+	err = replica.Close()
+	assert.Nil(t, err)
+	err = db.Put([]byte("after-restart"), []byte("ok"))
+	assert.Nil(t, err)
+	replica, err = OpenReplica(opts, primary.Addr().String())
+	assert.Nil(t, err)
+	defer replica.Close()
+	waitForValue(t, replica, []byte("after-restart"), []byte("ok"))
+	assert.Equal(t, db.Stat().KeyNum, replica.Stat().KeyNum)
+}
+
+func TestReplication_ResyncAfterMerge(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-primary-merge")
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir + "-merge")
+	db := openPrimaryDB(t, dir)
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	primary, err := NewPrimary(db, "127.0.0.1:0")
+	assert.Nil(t, err)
+	addr := primary.Addr().String()
+
+	replicaDir, _ := os.MkdirTemp("", "bitcask-go-replica-merge")
+	defer os.RemoveAll(replicaDir)
+	opts := bitcask.DefaultOptions
+	opts.DirPath = replicaDir
+	replica, err := OpenReplica(opts, addr)
+	assert.Nil(t, err)
+	defer replica.Close()
+	last, _ := db.Get(utils.GetTestKey(999))
+	waitForValue(t, replica, utils.GetTestKey(999), last)
+
+	// 主节点覆盖写入之后进行 merge 并重启,旧的数据文件被重写
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("merged"))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 500; i++ {
+		err := db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	err = primary.Close()
+	assert.Nil(t, err)
+	err = db.Merge()
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db = openPrimaryDB(t, dir)
+	defer db.Close()
+	assert.True(t, db.Position().Epoch > 0)
+	err = db.Put([]byte("after-merge"), []byte("ok"))
+	assert.Nil(t, err)
+
+	primary, err = NewPrimary(db, addr)
+	assert.Nil(t, err)
+	defer primary.Close()
+
+	// 快照导入的过程中数据是不完整的,等待同步到主节点的最新位置
+	assert.Eventually(t, func() bool {
+		return replica.Position() == db.Position()
+	}, 5*time.Second, 10*time.Millisecond)
+	val, err := replica.Get([]byte("after-merge"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ok"), val)
+	assert.Equal(t, db.Stat().KeyNum, replica.Stat().KeyNum)
+	_, err = replica.Get(utils.GetTestKey(0))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+	val, err = replica.Get(utils.GetTestKey(999))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("merged"), val)
+}
+
+func TestReplication_MergeWhileConnected(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-primary-merge-online")
+	defer os.RemoveAll(dir)
+	defer os.RemoveAll(dir + "-merge")
+	opts := bitcask.DefaultOptions
+	opts.DirPath = dir
+	opts.DataFileSize = 32 * 1024
+	opts.BytesPerSync = 0
+	db, err := bitcask.Open(opts)
+	assert.Nil(t, err)
+	defer db.Close()
+
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(64))
+		assert.Nil(t, err)
+	}
+	primary, err := NewPrimary(db, "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer primary.Close()
+	addr := primary.Addr().String()
+
+	openReplica := func(dir string) *Replica {
+		opts := bitcask.DefaultOptions
+		opts.DirPath = dir
+		opts.BytesPerSync = 0
+		replica, err := OpenReplica(opts, addr)
+		assert.Nil(t, err)
+		return replica
+	}
+	liveDir, _ := os.MkdirTemp("", "bitcask-go-replica-live")
+	defer os.RemoveAll(liveDir)
+	live := openReplica(liveDir)
+	defer live.Close()
+	staleDir, _ := os.MkdirTemp("", "bitcask-go-replica-stale")
+	defer os.RemoveAll(staleDir)
+	stale := openReplica(staleDir)
+	last, _ := db.Get(utils.GetTestKey(999))
+	waitForValue(t, live, utils.GetTestKey(999), last)
+	waitForValue(t, stale, utils.GetTestKey(999), last)
+	// 断开的从节点保存的位置在 merge 之前的数据文件中
+	assert.Nil(t, stale.Close())
+
+	// 从节点保持连接的时候进行 merge,同时还有写入
+	for i := 0; i < 1000; i++ {
+		err := db.Put(utils.GetTestKey(i), []byte("merged"))
+		assert.Nil(t, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			_ = db.Delete(utils.GetTestKey(i))
+		}
+	}()
+	err = db.Merge()
+	assert.Nil(t, err)
+	<-done
+	assert.True(t, db.Position().Epoch > 0)
+
+	for i := 0; i < 4000; i++ {
+		err := db.Put([]byte(fmt.Sprintf("large-%d", i)), utils.RandomValue(4096))
+		assert.Nil(t, err)
+	}
+	// 需要全量同步的从节点不读取快照,快照超过了 socket 的缓冲区,也不能阻塞主节点的写入
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, writeFrame(conn, frameHandshake, encodePosition(bitcask.Position{})))
+	typ, _, err := readFrame(bufio.NewReader(conn))
+	assert.Nil(t, err)
+	assert.Equal(t, frameSnapshotBegin, typ)
+	written := make(chan error, 1)
+	go func() {
+		written <- db.Put([]byte("after-merge"), []byte("ok"))
+	}()
+	select {
+	case err := <-written:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("write blocked by a stalled snapshot")
+	}
+
+	// 一直连接的从节点继续增量同步
+	assert.Eventually(t, func() bool {
+		return live.Position() == db.Position()
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, db.Stat().KeyNum, live.Stat().KeyNum)
+	_, err = live.Get(utils.GetTestKey(0))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+
+	// 重新连接的从节点的位置已经失效,通过快照同步
+	stale = openReplica(staleDir)
+	defer stale.Close()
+	assert.Eventually(t, func() bool {
+		return stale.Position() == db.Position()
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, db.Stat().KeyNum, stale.Stat().KeyNum)
+	val, err := stale.Get([]byte("after-merge"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("ok"), val)
+	_, err = stale.Get(utils.GetTestKey(0))
+	assert.Equal(t, bitcask.ErrKeyNotFound, err)
+}
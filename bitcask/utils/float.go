@@ -1,6 +1,10 @@
 package utils
 
-import "strconv"
+import (
+	"encoding/binary"
+	"math"
+	"strconv"
+)
 
 func FloatFromBytes(val []byte) float64 {
 	f, _ := strconv.ParseFloat(string(val), 64)
@@ -10,3 +14,33 @@ func FloatFromBytes(val []byte) float64 {
 func Float64ToBytes(val float64) []byte {
 	return []byte(strconv.FormatFloat(val, 'f', -1, 64))
 }
+
+// Float64ToSortableBytes 将浮点数编码为8个字节,编码之后的字节序与数值的大小顺序一致
+func Float64ToSortableBytes(val float64) []byte {
+	//-0 和 0 使用相同的编码
+	if val == 0 {
+		val = 0
+	}
+	bits := math.Float64bits(val)
+	if bits&(1<<63) == 0 {
+		//正数翻转符号位,排在所有负数之后
+		bits ^= 1 << 63
+	} else {
+		//负数翻转所有位,绝对值越大排在越前面
+		bits = ^bits
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, bits)
+	return buf
+}
+
+// SortableBytesToFloat64 解码 Float64ToSortableBytes 编码的浮点数
+func SortableBytesToFloat64(buf []byte) float64 {
+	bits := binary.BigEndian.Uint64(buf)
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
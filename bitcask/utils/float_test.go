@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+func TestFloat64ToSortableBytes(t *testing.T) {
+	values := []float64{math.Inf(-1), -1e100, -3.5, -1, -0.001, 0, 0.001, 1, 3.5, 1e100, math.Inf(1)}
+	for i, val := range values {
+		buf := Float64ToSortableBytes(val)
+		assert.Equal(t, val, SortableBytesToFloat64(buf))
+		if i > 0 {
+			assert.Equal(t, -1, bytes.Compare(Float64ToSortableBytes(values[i-1]), buf))
+		}
+	}
+	assert.Equal(t, Float64ToSortableBytes(0), Float64ToSortableBytes(math.Copysign(0, -1)))
+}
@@ -0,0 +1,96 @@
+package utils
+
+// GlobMatch 判断 str 是否匹配 redis 风格的通配符 pattern
+// 支持 * 匹配任意字符串, ? 匹配单个字符, [abc] [^a] [a-z] 匹配字符集合, \ 转义特殊字符
+func GlobMatch(pattern, str []byte) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			//连续的 * 等价于一个
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(str); i++ {
+				if GlobMatch(pattern[1:], str[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(str) == 0 {
+				return false
+			}
+			str = str[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(str) == 0 {
+				return false
+			}
+			var matched bool
+			var ok bool
+			matched, pattern, ok = matchCharClass(pattern[1:], str[0])
+			if !ok || !matched {
+				return false
+			}
+			str = str[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(str) == 0 || pattern[0] != str[0] {
+				return false
+			}
+			str = str[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(str) == 0
+}
+
+// 匹配 [] 中的字符集合,pattern 从 [ 之后开始,返回是否匹配以及 ] 之后剩余的 pattern
+func matchCharClass(pattern []byte, c byte) (bool, []byte, bool) {
+	var not bool
+	if len(pattern) > 0 && pattern[0] == '^' {
+		not = true
+		pattern = pattern[1:]
+	}
+	var matched bool
+	for {
+		if len(pattern) == 0 {
+			//没有闭合的 ]
+			return false, nil, false
+		}
+		if pattern[0] == ']' {
+			pattern = pattern[1:]
+			break
+		}
+		if pattern[0] == '\\' && len(pattern) >= 2 {
+			if pattern[1] == c {
+				matched = true
+			}
+			pattern = pattern[2:]
+			continue
+		}
+		if len(pattern) >= 3 && pattern[1] == '-' && pattern[2] != ']' {
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				matched = true
+			}
+			pattern = pattern[3:]
+			continue
+		}
+		if pattern[0] == c {
+			matched = true
+		}
+		pattern = pattern[1:]
+	}
+	return matched != not, pattern, true
+}
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		str     string
+		matched bool
+	}{
+		{"*", "", true},
+		{"*", "anything", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h*llo", "heeeello", true},
+		{"h*llo", "hello-world", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"user:*:name", "user:1001:name", true},
+		{"user:*:name", "user:1001:age", false},
+		{"a\\*b", "a*b", true},
+		{"a\\*b", "acb", false},
+		{"[abc", "a", false},
+		{"**a", "bba", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.matched, GlobMatch([]byte(c.pattern), []byte(c.str)), c.pattern+" "+c.str)
+	}
+}
@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"os"
+)
+
+var (
+	ErrTLSCertKeyPair = errors.New("tls cert file and key file must be set together")
+	ErrInvalidCACert  = errors.New("no valid certificate found in the CA file")
+)
+
+// 根据证书文件创建服务端的 TLS 配置,证书和私钥都为空时不启用 TLS 返回空,
+// 设置了 CA 文件时要求客户端提供由该 CA 签发的证书(双向 TLS)
+func NewServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			return nil, ErrTLSCertKeyPair
+		}
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, ErrTLSCertKeyPair
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if clientCAFile != "" {
+		pool, err := LoadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// 读取 PEM 格式的 CA 证书
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, ErrInvalidCACert
+	}
+	return pool, nil
+}
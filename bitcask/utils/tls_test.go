@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/tls"
+	"github.com/stretchr/testify/assert"
+	"kv-go/bitcask/utils/certtest"
+	"os"
+	"testing"
+)
+
+func TestNewServerTLSConfig(t *testing.T) {
+	dir, _ := os.MkdirTemp("", "bitcask-go-tls")
+	defer os.RemoveAll(dir)
+	certFile, keyFile, err := certtest.GenerateSelfSignedCert(dir, "server")
+	assert.Nil(t, err)
+
+	// 没有证书时不启用 TLS
+	config, err := NewServerTLSConfig("", "", "")
+	assert.Nil(t, err)
+	assert.Nil(t, config)
+
+	config, err = NewServerTLSConfig(certFile, keyFile, "")
+	assert.Nil(t, err)
+	assert.Len(t, config.Certificates, 1)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+
+	config, err = NewServerTLSConfig(certFile, keyFile, certFile)
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+
+	_, err = NewServerTLSConfig(certFile, "", "")
+	assert.Equal(t, ErrTLSCertKeyPair, err)
+	_, err = NewServerTLSConfig("", "", certFile)
+	assert.Equal(t, ErrTLSCertKeyPair, err)
+	_, err = NewServerTLSConfig(certFile, keyFile, keyFile)
+	assert.Equal(t, ErrInvalidCACert, err)
+	_, err = NewServerTLSConfig(keyFile, certFile, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,118 @@
+package bitcask
+
+import (
+	"bytes"
+)
+
+// 每个订阅者缓冲的事件数量,超过之后订阅者会被关闭
+const watchEventBufferSize = 1024
+
+type EventType = byte
+
+const (
+	EventPut EventType = iota
+	EventDelete
+)
+
+// Event 一次 key 的变更
+type Event struct {
+	Key   []byte
+	Value []byte //删除事件为空
+	Type  EventType
+	SeqNo uint64 //事务序列号,非事务写入为0
+
+	//这条变更之后的日志位置,从这个位置重新订阅不会再收到这条变更
+	Cursor Position
+}
+
+// Watcher 订阅指定前缀的 key 的变更
+type Watcher struct {
+	db     *DB
+	prefix []byte
+	events chan *Event
+	err    error
+	closed bool
+}
+
+// Watch 订阅前缀为 prefix 的 key 的变更,prefix 为空表示订阅所有的 key
+// 订阅者消费过慢导致缓冲区写满时会被关闭,Err 返回 ErrWatcherLagged,
+// 此时可以用最后一条事件的 Cursor 通过 NewChangeStream 从数据文件中补齐
+func (db *DB) Watch(prefix []byte) *Watcher {
+	w := &Watcher{
+		db:     db,
+		prefix: prefix,
+		events: make(chan *Event, watchEventBufferSize),
+	}
+	db.watchMu.Lock()
+	db.watchers[w] = struct{}{}
+	db.watchMu.Unlock()
+	return w
+}
+
+// Events 变更事件,订阅者关闭之后 channel 会被关闭
+func (w *Watcher) Events() <-chan *Event {
+	return w.events
+}
+
+// Err 订阅者被动关闭的原因
+func (w *Watcher) Err() error {
+	w.db.watchMu.Lock()
+	defer w.db.watchMu.Unlock()
+	return w.err
+}
+
+// Close 取消订阅
+func (w *Watcher) Close() {
+	w.db.watchMu.Lock()
+	defer w.db.watchMu.Unlock()
+	w.closeWithErr(nil)
+}
+
+// 调用前必须持有 watchMu
+func (w *Watcher) closeWithErr(err error) {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.err = err
+	delete(w.db.watchers, w)
+	close(w.events)
+}
+
+// 将变更分发给所有匹配的订阅者,不会阻塞写入,调用方需要持有 db.mu 保证事件的顺序
+func (db *DB) notifyWatchers(events ...*Event) {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	if len(db.watchers) == 0 {
+		return
+	}
+	//调用方之后可能复用 key 和 value 的内存
+	for _, event := range events {
+		event.Key = bytes.Clone(event.Key)
+		event.Value = bytes.Clone(event.Value)
+	}
+	for w := range db.watchers {
+		for _, event := range events {
+			if !bytes.HasPrefix(event.Key, w.prefix) {
+				continue
+			}
+			select {
+			case w.events <- event:
+			default:
+				w.closeWithErr(ErrWatcherLagged)
+			}
+			if w.closed {
+				break
+			}
+		}
+	}
+}
+
+// 关闭所有的订阅者
+func (db *DB) closeWatchers() {
+	db.watchMu.Lock()
+	defer db.watchMu.Unlock()
+	for w := range db.watchers {
+		w.closeWithErr(ErrDatabaseClosed)
+	}
+}
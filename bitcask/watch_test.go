@@ -0,0 +1,218 @@
+package bitcask
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"kv-go/bitcask/utils"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestDB_Watch(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w := db.Watch([]byte("user:"))
+	defer w.Close()
+
+	err = db.Put([]byte("user:1"), []byte("a"))
+	assert.Nil(t, err)
+	// 前缀不匹配的变更不会收到
+	err = db.Put([]byte("order:1"), []byte("b"))
+	assert.Nil(t, err)
+	err = db.Delete([]byte("user:1"))
+	assert.Nil(t, err)
+
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put([]byte("user:2"), []byte("c"))
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	ev1 := <-w.Events()
+	assert.Equal(t, []byte("user:1"), ev1.Key)
+	assert.Equal(t, []byte("a"), ev1.Value)
+	assert.Equal(t, EventPut, ev1.Type)
+
+	ev2 := <-w.Events()
+	assert.Equal(t, []byte("user:1"), ev2.Key)
+	assert.Equal(t, EventDelete, ev2.Type)
+
+	ev3 := <-w.Events()
+	assert.Equal(t, []byte("user:2"), ev3.Key)
+	assert.True(t, ev3.SeqNo > 0)
+	assert.Equal(t, db.Position(), ev3.Cursor)
+
+	// 取消订阅之后 channel 被关闭
+	w.Close()
+	_, ok := <-w.Events()
+	assert.False(t, ok)
+	assert.Nil(t, w.Err())
+}
+
+func TestDB_Watch_ReusedBuffer(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch-buffer")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w := db.Watch(nil)
+	defer w.Close()
+	// 写入之后调用方复用了 key 和 value 的内存,已经发布的事件不受影响
+	key, value := []byte("key-1"), []byte("value-1")
+	err = db.Put(key, value)
+	assert.Nil(t, err)
+	copy(key, "key-2")
+	copy(value, "value-2")
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(key, value)
+	assert.Nil(t, wb.Commit())
+	copy(key, "key-3")
+
+	ev := <-w.Events()
+	assert.Equal(t, []byte("key-1"), ev.Key)
+	assert.Equal(t, []byte("value-1"), ev.Value)
+	ev = <-w.Events()
+	assert.Equal(t, []byte("key-2"), ev.Key)
+	assert.Equal(t, []byte("value-2"), ev.Value)
+}
+
+func TestDB_Watch_Order(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch-order")
+	opts.DirPath = dir
+	opts.BytesPerSync = 0
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w := db.Watch(nil)
+	defer w.Close()
+	// 并发写入时事件的顺序和日志中的顺序一致
+	const writers, writes = 16, 40
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < writes; j++ {
+				key := utils.GetTestKey(i*writes + j)
+				_ = db.Put(key, []byte("value"))
+				if j%2 == 1 {
+					_ = db.Delete(key)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var last Position
+	for i := 0; i < writers*writes*3/2; i++ {
+		ev := <-w.Events()
+		assert.True(t, ev.Cursor.Fid > last.Fid || (ev.Cursor.Fid == last.Fid && ev.Cursor.Offset > last.Offset))
+		last = ev.Cursor
+	}
+	assert.Nil(t, w.Err())
+}
+
+func TestDB_Watch_Lagged(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-watch-lagged")
+	opts.DirPath = dir
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	w := db.Watch(nil)
+	for i := 0; i <= watchEventBufferSize; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(10))
+		assert.Nil(t, err)
+	}
+	var last *Event
+	for ev := range w.Events() {
+		last = ev
+	}
+	assert.Equal(t, ErrWatcherLagged, w.Err())
+
+	// 从最后一条事件的位置继续读取,可以补齐丢失的变更
+	cs, err := db.NewChangeStream(last.Cursor)
+	assert.Nil(t, err)
+	ev, err := cs.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.GetTestKey(watchEventBufferSize), ev.Key)
+	_, err = cs.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDB_ChangeStream(t *testing.T) {
+	opts := DefaultOptions
+	dir, _ := os.MkdirTemp("", "bitcask-go-change-stream")
+	opts.DirPath = dir
+	opts.DataFileSize = 4 * 1024
+	db, err := Open(opts)
+	defer destroyDB(db)
+	assert.Nil(t, err)
+
+	// 空的数据库
+	cs, err := db.NewChangeStream(Position{})
+	assert.Nil(t, err)
+	_, err = cs.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// 写入的数据跨越多个数据文件
+	for i := 0; i < 100; i++ {
+		err := db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	assert.True(t, len(db.olderFiles) > 0)
+	wb := db.NewWriteBatch(DefaultWriteBatchOptions)
+	_ = wb.Put(utils.GetTestKey(100), utils.RandomValue(10))
+	_ = wb.Delete(utils.GetTestKey(0))
+	err = wb.Commit()
+	assert.Nil(t, err)
+
+	var events []*Event
+	for {
+		ev, err := cs.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		events = append(events, ev)
+	}
+	assert.Equal(t, 102, len(events))
+	assert.Equal(t, utils.GetTestKey(0), events[0].Key)
+	assert.Equal(t, db.Position(), cs.Position())
+
+	// 模拟重启之后从保存的位置继续读取
+	pos := cs.Position()
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(opts)
+	defer destroyDB(db2)
+	assert.Nil(t, err)
+	err = db2.Put(utils.GetTestKey(200), []byte("new"))
+	assert.Nil(t, err)
+
+	cs2, err := db2.NewChangeStream(pos)
+	assert.Nil(t, err)
+	ev, err := cs2.Next()
+	assert.Nil(t, err)
+	assert.Equal(t, utils.GetTestKey(200), ev.Key)
+	assert.Equal(t, []byte("new"), ev.Value)
+	_, err = cs2.Next()
+	assert.Equal(t, io.EOF, err)
+
+	// merge 重写过的数据文件中的位置已经失效
+	db2.mergeEpoch = 2
+	_, err = db2.NewChangeStream(Position{Epoch: 0, Fid: 1})
+	assert.Equal(t, ErrCursorExpired, err)
+	_, err = db2.NewChangeStream(Position{Epoch: 0, Fid: 2})
+	assert.Nil(t, err)
+}